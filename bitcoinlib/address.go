@@ -0,0 +1,122 @@
+package bitcoinlib
+
+import (
+	"fmt"
+	"strings"
+)
+
+const MAINNET_P2PKH_PREFIX = 0x00
+const MAINNET_P2SH_PREFIX = 0x05
+const TESTNET_P2PKH_PREFIX = 0x6f
+const TESTNET_P2SH_PREFIX = 0xc4
+
+// Builds the scriptPubKey of a witness program of any version
+func WitnessPubKey(version byte, program []byte) *ScriptPubKey {
+	return &ScriptPubKey{
+		[]Operation{
+			witnessVersionOp(version),
+			&ScriptVal{program},
+		},
+		nil,
+	}
+}
+
+func witnessVersionOp(version byte) Operation {
+	if version == 0 {
+		return &OP_0{}
+	}
+	return OP_CODE_FUNCTIONS[0x50+int(version)]
+}
+
+// Returns the witness version and program if the script is a witness
+// output, OP_n followed by a single push of 2 to 40 bytes with the
+// opcode of its size
+func (s *ScriptPubKey) witnessProgram() (byte, []byte, bool) {
+	script := s.scriptBytes()
+	if len(script) < 4 || len(script) > 42 || int(script[1])+2 != len(script) {
+		return 0, nil, false
+	}
+	if script[0] == 0 {
+		return 0, script[2:], true
+	}
+	if script[0] >= 0x51 && script[0] <= 0x60 {
+		return script[0] - 0x50, script[2:], true
+	}
+	return 0, nil, false
+}
+
+func decodeBase58Address(address string) (*ScriptPubKey, *ChainParams, error) {
+	payload, err := DecodeBase58Check(address)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(payload) != 21 {
+		return nil, nil, fmt.Errorf("invalid base58 address length: %d", len(payload))
+	}
+	hash := payload[1:]
+	for _, params := range KNOWN_CHAINS {
+		switch payload[0] {
+		case params.P2PKHPrefix:
+			return P2PKHScript(hash), params, nil
+		case params.P2SHPrefix:
+			return P2SHPubKey(hash), params, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("unknown address version: %x", payload[0])
+}
+
+func decodeBech32Address(address string, params *ChainParams) (*ScriptPubKey, *ChainParams, error) {
+	version, program, err := DecodeSegwitAddress(params.Bech32Hrp, address)
+	if err != nil {
+		return nil, nil, err
+	}
+	return WitnessPubKey(version, program), params, nil
+}
+
+// Decodes any standard address (P2PKH, P2SH, P2WPKH, P2WSH, P2TR
+// and future witness versions) into the ScriptPubKey it pays to,
+// along with the first known network using its format
+func DecodeAddress(address string) (*ScriptPubKey, *ChainParams, error) {
+	separator := strings.LastIndexByte(address, '1')
+	if separator > 0 {
+		hrp := strings.ToLower(address[:separator])
+		for _, params := range KNOWN_CHAINS {
+			if params.Bech32Hrp == hrp {
+				return decodeBech32Address(address, params)
+			}
+		}
+	}
+	return decodeBase58Address(address)
+}
+
+// Same as DecodeAddress, but fails if the address does not
+// belong to the expected network
+func AddressToScriptPubKey(address string, params *ChainParams) (*ScriptPubKey, error) {
+	script, network, err := DecodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	matches := network.P2PKHPrefix == params.P2PKHPrefix && network.P2SHPrefix == params.P2SHPrefix
+	if _, _, ok := script.witnessProgram(); ok {
+		matches = network.Bech32Hrp == params.Bech32Hrp
+	}
+	if !matches {
+		return nil, fmt.Errorf("address %s does not belong to %s", address, params)
+	}
+	return script, nil
+}
+
+// Returns the address the script pays to. Fails for
+// scripts that have no address representation
+func (s *ScriptPubKey) Address(params *ChainParams) (string, error) {
+	class := s.Classify()
+	switch class.Type {
+	case SCRIPT_TYPE_P2PKH:
+		return H160P2PKHAddress(class.Hash, params), nil
+	case SCRIPT_TYPE_P2SH:
+		return H160P2SHAddress(class.Hash, params), nil
+	case SCRIPT_TYPE_P2WPKH, SCRIPT_TYPE_P2WSH, SCRIPT_TYPE_P2TR, SCRIPT_TYPE_WITNESS_UNKNOWN:
+		return EncodeSegwitAddress(params.Bech32Hrp, byte(class.Version), class.Program)
+	}
+	return "", fmt.Errorf("%s script has no address representation", class.Type)
+}
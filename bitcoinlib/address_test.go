@@ -0,0 +1,76 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDecodeAddress(t *testing.T) {
+	vectors := []struct {
+		address string
+		network *bitcoinlib.ChainParams
+		script  string
+	}{
+		{"1BenRpVUFK65JFWcQSuHnJKzc4M8ZP8Eqa", bitcoinlib.MAINNET_PARAMS, "1976a91474d691da1574e6b3c192ecfb52cc8984ee7b6c5688ac"},
+		{"mrAjisaT4LXL5MzE81sfcDYKU3wqWSvf9q", bitcoinlib.TESTNET3_PARAMS, "1976a91474d691da1574e6b3c192ecfb52cc8984ee7b6c5688ac"},
+		{"3CLoMMyuoDQTPRD3XYZtCvgvkadrAdvdXh", bitcoinlib.MAINNET_PARAMS, "17a91474d691da1574e6b3c192ecfb52cc8984ee7b6c5687"},
+		{"2N3u1R6uwQfuobCqbCgBkpsgBxvr1tZpe7B", bitcoinlib.TESTNET3_PARAMS, "17a91474d691da1574e6b3c192ecfb52cc8984ee7b6c5687"},
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", bitcoinlib.MAINNET_PARAMS, "160014751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", bitcoinlib.TESTNET3_PARAMS, "2200201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", bitcoinlib.MAINNET_PARAMS, "22512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+	}
+	for index, vector := range vectors {
+		script, network, err := bitcoinlib.DecodeAddress(vector.address)
+		if err != nil {
+			t.Fatalf("Failed at index %d with error: %s", index, err)
+		}
+		if network != vector.network {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s", index, vector.network, network)
+		}
+		serialized := hex.EncodeToString(script.Serialize())
+		if serialized != vector.script {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s", index, vector.script, serialized)
+		}
+		address, err := script.Address(network)
+		if err != nil || address != vector.address {
+			t.Fatalf("Failed reversing at index %d\nExpected => %s\nGot => %s", index, vector.address, address)
+		}
+	}
+}
+
+func TestAddressNetworkMismatch(t *testing.T) {
+	if _, err := bitcoinlib.AddressToScriptPubKey("mrAjisaT4LXL5MzE81sfcDYKU3wqWSvf9q", bitcoinlib.MAINNET_PARAMS); err == nil {
+		t.Fatal("Accepted testnet address for mainnet")
+	}
+	if _, err := bitcoinlib.AddressToScriptPubKey("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", bitcoinlib.TESTNET3_PARAMS); err == nil {
+		t.Fatal("Accepted mainnet address for testnet")
+	}
+	if _, err := bitcoinlib.AddressToScriptPubKey("1BenRpVUFK65JFWcQSuHnJKzc4M8ZP8Eqb", bitcoinlib.MAINNET_PARAMS); err == nil {
+		t.Fatal("Accepted address with invalid checksum")
+	}
+}
+
+func TestAddOutputScriptTypes(t *testing.T) {
+	tx := bitcoinlib.NewTransaction()
+	addresses := []string{
+		"3CLoMMyuoDQTPRD3XYZtCvgvkadrAdvdXh",
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+	}
+	for _, address := range addresses {
+		if err := tx.AddOutput(1000, address, bitcoinlib.MAINNET_PARAMS); err != nil {
+			t.Fatalf("Failed adding output for %s: %s", address, err)
+		}
+	}
+	if err := tx.AddOutput(1000, "not an address", bitcoinlib.MAINNET_PARAMS); err == nil {
+		t.Fatal("Added an output to an invalid address")
+	}
+	if err := tx.AddOutput(1000, "mwQkTVnb1hLa6qXyLT3i2cAFmi8p8Wn5wr", bitcoinlib.MAINNET_PARAMS); err == nil {
+		t.Fatal("Added an output to a testnet address on mainnet")
+	}
+	for index, address := range tx.GetOutputAddresses(bitcoinlib.MAINNET_PARAMS) {
+		if address != addresses[index] {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s", index, addresses[index], address)
+		}
+	}
+}
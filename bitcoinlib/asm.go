@@ -0,0 +1,100 @@
+package bitcoinlib
+
+import (
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Writes the operations in the ASM format of Bitcoin Core: opcodes by
+// name, pushes of up to 4 bytes as decimal numbers and longer pushes as
+// hex, like OP_DUP OP_HASH160 <hex> OP_EQUALVERIFY OP_CHECKSIG. Hex
+// made only of digits is prefixed with 0x
+func FormatAsm(cmds []Operation) string {
+	words := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		if val, ok := cmd.(*ScriptVal); ok {
+			data := hex.EncodeToString(val.Val)
+			switch {
+			case len(val.Val) <= 4:
+				words = append(words, decodeNum(val.Val).value.String())
+			case isAsmNumber(data):
+				// Hex made of digits would be read back as a number
+				words = append(words, "0x"+data)
+			default:
+				words = append(words, data)
+			}
+			continue
+		}
+		name, ok := OP_CODE_NAMES[cmd.Num()]
+		if !ok {
+			name = "OP_UNKNOWN"
+		}
+		words = append(words, name)
+	}
+	return strings.Join(words, " ")
+}
+
+// Decimal words of the ASM format, hex pushes are never written with a
+// sign or a leading zero
+func isAsmNumber(word string) bool {
+	digits := strings.TrimPrefix(word, "-")
+	if len(digits) > 1 && digits[0] == '0' {
+		return false
+	}
+	return isDecimal(word)
+}
+
+// Operation pushing the number with the shortest encoding
+func numberOperation(n int64) Operation {
+	script := pushNumber(n)
+	if len(script) == 1 {
+		return OP_CODE_FUNCTIONS[int(script[0])]
+	}
+	return &ScriptVal{script[1:]}
+}
+
+// Parses a script written in ASM, the inverse of FormatAsm. Opcodes can
+// be written with or without the OP_ prefix, decimal numbers are pushed
+// with the shortest encoding and any other word is hex data, which can be
+// prefixed with 0x
+func ParseAsm(asm string) ([]Operation, error) {
+	cmds := []Operation{}
+	for _, word := range strings.Fields(asm) {
+		if isAsmNumber(word) {
+			n, err := strconv.ParseInt(word, 10, 64)
+			if err != nil || n > 0xffffffff || n < -0xffffffff {
+				return nil, fmt.Errorf("invalid number %s", word)
+			}
+			cmds = append(cmds, numberOperation(n))
+			continue
+		}
+		if opcode, ok := opcodeByName(word); ok {
+			cmds = append(cmds, opcodeOperation(int(opcode), len(cmds)))
+			continue
+		}
+		data, err := hex.DecodeString(strings.TrimPrefix(word, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("unknown word %s", word)
+		}
+		cmds = append(cmds, &ScriptVal{data})
+	}
+	return cmds, nil
+}
+
+func (s *Script) String() string {
+	return FormatAsm(s.cmds)
+}
+
+func (s *ScriptPubKey) String() string {
+	return FormatAsm(s.cmds)
+}
+
+// The scriptSig followed by the scriptPubKey, in execution order
+func (t *CombinedScript) String() string {
+	cmds := slices.Clone(t.cmds)
+	slices.Reverse(cmds)
+	return FormatAsm(cmds)
+}
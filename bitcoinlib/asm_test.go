@@ -0,0 +1,105 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFormatAsm(t *testing.T) {
+	hash, _ := hex.DecodeString("751e76e8199196d454941c45d1b3a323f1433bd6")
+	sig := bytes.Repeat([]byte{0x30}, 71)
+	sec := bytes.Repeat([]byte{0x02}, 33)
+	vectors := []struct {
+		script   fmt.Stringer
+		expected string
+	}{
+		{bitcoinlib.P2PKHScript(hash), "OP_DUP OP_HASH160 751e76e8199196d454941c45d1b3a323f1433bd6 OP_EQUALVERIFY OP_CHECKSIG"},
+		{bitcoinlib.P2SHPubKey(hash), "OP_HASH160 751e76e8199196d454941c45d1b3a323f1433bd6 OP_EQUAL"},
+		{bitcoinlib.P2WPKHPubKey(hash), "0 751e76e8199196d454941c45d1b3a323f1433bd6"},
+		// The signature is made of digits, so it is marked as hex
+		{bitcoinlib.P2PKHSignature(sig, sec), "0x" + hex.EncodeToString(sig) + " " + hex.EncodeToString(sec)},
+		{bitcoinlib.P2PKHScript(hash).Combine(*bitcoinlib.P2PKHSignature(sig, sec)),
+			"0x" + hex.EncodeToString(sig) + " " + hex.EncodeToString(sec) + " OP_DUP OP_HASH160 751e76e8199196d454941c45d1b3a323f1433bd6 OP_EQUALVERIFY OP_CHECKSIG"},
+		{bitcoinlib.NewScript([]bitcoinlib.Operation{
+			bitcoinlib.NewScriptVal([]byte{}),
+			bitcoinlib.NewScriptVal([]byte{0xe8, 0x03}),
+			bitcoinlib.NewScriptVal([]byte{0x81}),
+			bitcoinlib.NewScriptVal([]byte{0xff, 0xff, 0xff, 0x7f}),
+			bitcoinlib.NewScriptVal([]byte{0xff, 0xff, 0xff, 0xff, 0x00}),
+		}), "0 1000 -1 2147483647 ffffffff00"},
+		{bitcoinlib.NewScript([]bitcoinlib.Operation{
+			bitcoinlib.NewScriptVal([]byte{0x11, 0x22, 0x33, 0x44, 0x55}),
+		}), "0x1122334455"},
+	}
+	for index, vector := range vectors {
+		if got := vector.script.String(); got != vector.expected {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s", index, vector.expected, got)
+		}
+	}
+}
+
+func TestParseAsm(t *testing.T) {
+	vectors := []struct {
+		asm      string
+		expected string
+	}{
+		{"OP_DUP OP_HASH160 751e76e8199196d454941c45d1b3a323f1433bd6 OP_EQUALVERIFY OP_CHECKSIG", "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac"},
+		{"DUP HASH160 751e76e8199196d454941c45d1b3a323f1433bd6 EQUALVERIFY CHECKSIG", "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac"},
+		{"2 02aa 03bb 2 OP_CHECKMULTISIG", "520202aa0203bb52ae"},
+		{"0 -1 16 17 -1000 4294967295", "004f600111 02e883 05ffffffff00"},
+		{"500000 OP_CHECKLOCKTIMEVERIFY OP_DROP", "0320a107b175"},
+		{"OP_NOP1 OP_NOP4 OP_NOP10 OP_CAT OP_RESERVED", "b0b3b97e50"},
+		{"  00  ", "0100"},
+		{"0x1122334455 0xab", "051122334455 01ab"},
+	}
+	for index, vector := range vectors {
+		cmds, err := bitcoinlib.ParseAsm(vector.asm)
+		expected := strings.ReplaceAll(vector.expected, " ", "")
+		if err != nil {
+			t.Fatalf("Failed at index %d: %s", index, err)
+		}
+		got := hex.EncodeToString(bitcoinlib.NewPubkey(cmds).Serialize()[1:])
+		if got != expected {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s", index, expected, got)
+		}
+	}
+	for _, asm := range []string{"OP_FOO", "abc", "OP_UNKNOWN", "99999999999"} {
+		if _, err := bitcoinlib.ParseAsm(asm); err == nil {
+			t.Fatalf("Parsed invalid ASM %s", asm)
+		}
+	}
+}
+
+func TestAsmRoundTrip(t *testing.T) {
+	for opcode := range 256 {
+		name, ok := bitcoinlib.OP_CODE_NAMES[opcode]
+		if !ok || strings.HasPrefix(name, "OP_PUSHDATA") {
+			continue
+		}
+		cmds, err := bitcoinlib.ParseAsm(name)
+		if err != nil || len(cmds) != 1 || cmds[0].Num() != opcode {
+			t.Fatalf("Failed at opcode %d\nExpected => %s\nGot => %v %v", opcode, name, cmds, err)
+		}
+		if got := bitcoinlib.FormatAsm(cmds); got != name {
+			t.Fatalf("Failed at opcode %d\nExpected => %s\nGot => %s", opcode, name, got)
+		}
+	}
+	// Pushes longer than 4 bytes stay hex even when made of digits
+	for _, push := range []string{"1122334455", "1234567890123456789012345678901234567890"} {
+		data, _ := hex.DecodeString(push)
+		asm := bitcoinlib.FormatAsm([]bitcoinlib.Operation{bitcoinlib.NewScriptVal(data)})
+		cmds, err := bitcoinlib.ParseAsm(asm)
+		if err != nil || len(cmds) != 1 || hex.EncodeToString(bitcoinlib.NewPubkey(cmds).Serialize()[2:]) != push {
+			t.Fatalf("Failed at push %s\nExpected => %s\nGot => %v %v", push, push, cmds, err)
+		}
+	}
+	for opcode := range bitcoinlib.OP_CODE_FUNCTIONS {
+		if _, ok := bitcoinlib.OP_CODE_NAMES[opcode]; !ok {
+			t.Fatalf("Opcode %d has no name", opcode)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package bitcoinlib
 
 import (
+	"bytes"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"math/big"
 	"strings"
 )
@@ -40,4 +43,49 @@ func FromBase58(s string) string {
   }
   combined := num.IntoBytes()
   return hex.EncodeToString(combined[:])
-}
\ No newline at end of file
+}
+// Decodes a Base58 string into its raw bytes, keeping
+// the leading zeroes encoded as '1'
+func DecodeBase58(s string) ([]byte, error) {
+	num := big.NewInt(0)
+	base := big.NewInt(58)
+	for index, r := range s {
+		value := strings.IndexRune(ALPHABET, r)
+		if value < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q at position %d", r, index)
+		}
+		num.Mul(num, base)
+		num.Add(num, big.NewInt(int64(value)))
+	}
+	leading := 0
+	for leading < len(s) && s[leading] == ALPHABET[0] {
+		leading++
+	}
+	return append(make([]byte, leading), num.Bytes()...), nil
+}
+
+// Encodes the payload with the first four bytes of its
+// Hash256 appended as checksum
+func EncodeBase58Check(payload []byte) string {
+	total := append([]byte{}, payload...)
+	total = append(total, Hash256(payload)[:4]...)
+	return IntoBase58(hex.EncodeToString(total))
+}
+
+// Decodes a Base58Check string returning the payload
+// without the checksum
+func DecodeBase58Check(s string) ([]byte, error) {
+	decoded, err := DecodeBase58(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) < 4 {
+		return nil, errors.New("base58check string too short")
+	}
+	payload := decoded[:len(decoded)-4]
+	checksum := decoded[len(decoded)-4:]
+	if !bytes.Equal(Hash256(payload)[:4], checksum) {
+		return nil, errors.New("invalid base58check checksum")
+	}
+	return payload, nil
+}
@@ -0,0 +1,272 @@
+package bitcoinlib
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const BECH32_CHARSET = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+const BECH32_CONST = 1
+const BECH32M_CONST = 0x2bc830a3
+const BECH32_MAX_LENGTH = 90
+const BECH32_CHECKSUM_LENGTH = 6
+
+const MAINNET_HRP = "bc"
+const TESTNET_HRP = "tb"
+const REGTEST_HRP = "bcrt"
+
+type Bech32Encoding uint8
+
+const (
+	BECH32 Bech32Encoding = 1 + iota
+	BECH32M
+)
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+// Error raised while decoding a bech32 string. Position is the
+// index of the offending character, or -1 when it can't be located
+type Bech32Error struct {
+	Position int
+	Reason   string
+}
+
+func (e *Bech32Error) Error() string {
+	if e.Position < 0 {
+		return "bech32: " + e.Reason
+	}
+	return fmt.Sprintf("bech32: %s at position %d", e.Reason, e.Position)
+}
+
+func bech32Error(position int, reason string) error {
+	return &Bech32Error{position, reason}
+}
+
+func (e Bech32Encoding) constant() uint32 {
+	if e == BECH32M {
+		return BECH32M_CONST
+	}
+	return BECH32_CONST
+}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, value := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(value)
+		for i := range 5 {
+			if (top>>i)&1 == 1 {
+				chk ^= bech32Generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HrpExpand(hrp string) []byte {
+	result := make([]byte, 0, len(hrp)*2+1)
+	for i := range len(hrp) {
+		result = append(result, hrp[i]>>5)
+	}
+	result = append(result, 0)
+	for i := range len(hrp) {
+		result = append(result, hrp[i]&31)
+	}
+	return result
+}
+
+func bech32Checksum(hrp string, data []byte, encoding Bech32Encoding) []byte {
+	values := append(bech32HrpExpand(hrp), data...)
+	values = append(values, make([]byte, BECH32_CHECKSUM_LENGTH)...)
+	polymod := bech32Polymod(values) ^ encoding.constant()
+	checksum := make([]byte, BECH32_CHECKSUM_LENGTH)
+	for i := range checksum {
+		checksum[i] = byte(polymod>>(5*(5-i))) & 31
+	}
+	return checksum
+}
+
+// Encodes the 5 bit values of data with the given hrp
+func Bech32Encode(hrp string, data []byte, encoding Bech32Encoding) (string, error) {
+	if len(hrp) == 0 {
+		return "", errors.New("bech32: empty human readable part")
+	}
+	if len(hrp)+len(data)+1+BECH32_CHECKSUM_LENGTH > BECH32_MAX_LENGTH {
+		return "", errors.New("bech32: encoded string too long")
+	}
+	for i := range len(hrp) {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", bech32Error(i, "invalid human readable part character")
+		}
+	}
+	hrp = strings.ToLower(hrp)
+	var result strings.Builder
+	result.WriteString(hrp)
+	result.WriteByte('1')
+	values := append([]byte{}, data...)
+	for _, value := range append(values, bech32Checksum(hrp, data, encoding)...) {
+		if value > 31 {
+			return "", errors.New("bech32: data value out of range")
+		}
+		result.WriteByte(BECH32_CHARSET[value])
+	}
+	return result.String(), nil
+}
+
+// Decodes a bech32 or bech32m string returning the hrp, the 5 bit
+// values without checksum and the encoding that matched the checksum
+func Bech32Decode(encoded string) (string, []byte, Bech32Encoding, error) {
+	if len(encoded) > BECH32_MAX_LENGTH {
+		return "", nil, 0, bech32Error(BECH32_MAX_LENGTH, "string too long")
+	}
+	lower, upper := false, false
+	for i := range len(encoded) {
+		c := encoded[i]
+		if c < 33 || c > 126 {
+			return "", nil, 0, bech32Error(i, "invalid character")
+		}
+		lower = lower || (c >= 'a' && c <= 'z')
+		upper = upper || (c >= 'A' && c <= 'Z')
+		if lower && upper {
+			return "", nil, 0, bech32Error(i, "mixed case")
+		}
+	}
+	encoded = strings.ToLower(encoded)
+	separator := strings.LastIndexByte(encoded, '1')
+	if separator < 1 {
+		return "", nil, 0, bech32Error(separator, "missing or misplaced separator")
+	}
+	if separator+BECH32_CHECKSUM_LENGTH+1 > len(encoded) {
+		return "", nil, 0, bech32Error(separator, "checksum too short")
+	}
+	hrp := encoded[:separator]
+	data := make([]byte, 0, len(encoded)-separator-1)
+	for i := separator + 1; i < len(encoded); i++ {
+		value := strings.IndexByte(BECH32_CHARSET, encoded[i])
+		if value < 0 {
+			return "", nil, 0, bech32Error(i, "invalid data character")
+		}
+		data = append(data, byte(value))
+	}
+	var encoding Bech32Encoding
+	switch bech32Polymod(append(bech32HrpExpand(hrp), data...)) {
+	case BECH32_CONST:
+		encoding = BECH32
+	case BECH32M_CONST:
+		encoding = BECH32M
+	default:
+		return "", nil, 0, bech32Error(-1, "invalid checksum")
+	}
+	return hrp, data[:len(data)-BECH32_CHECKSUM_LENGTH], encoding, nil
+}
+
+// Regroups the bits of data from groups of fromBits into groups of toBits
+func ConvertBits(data []byte, fromBits uint, toBits uint, pad bool) ([]byte, error) {
+	acc := uint32(0)
+	bits := uint(0)
+	maxv := uint32(1)<<toBits - 1
+	result := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+	for _, value := range data {
+		if uint32(value)>>fromBits != 0 {
+			return nil, errors.New("bech32: invalid data range")
+		}
+		acc = acc<<fromBits | uint32(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			result = append(result, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || (acc<<(toBits-bits))&maxv != 0 {
+		return nil, errors.New("bech32: invalid padding")
+	}
+	return result, nil
+}
+
+func validWitnessProgram(version byte, program []byte) error {
+	if version > 16 {
+		return fmt.Errorf("invalid witness version: %d", version)
+	}
+	if len(program) < 2 || len(program) > 40 {
+		return fmt.Errorf("invalid witness program length: %d", len(program))
+	}
+	if version == 0 && len(program) != 20 && len(program) != 32 {
+		return fmt.Errorf("invalid witness v0 program length: %d", len(program))
+	}
+	return nil
+}
+
+// Encodes a witness program as a segwit address. Version 0 uses
+// bech32 and later versions bech32m (BIP350)
+func EncodeSegwitAddress(hrp string, version byte, program []byte) (string, error) {
+	if err := validWitnessProgram(version, program); err != nil {
+		return "", err
+	}
+	encoding := BECH32M
+	if version == 0 {
+		encoding = BECH32
+	}
+	converted, _ := ConvertBits(program, 8, 5, true)
+	return Bech32Encode(hrp, append([]byte{version}, converted...), encoding)
+}
+
+// Decodes a segwit address validating its hrp, witness version
+// and program, returning both of them
+func DecodeSegwitAddress(hrp string, address string) (byte, []byte, error) {
+	decodedHrp, data, encoding, err := Bech32Decode(address)
+	if err != nil {
+		return 0, nil, err
+	}
+	if decodedHrp != hrp {
+		return 0, nil, fmt.Errorf("invalid human readable part: %s != %s", decodedHrp, hrp)
+	}
+	if len(data) < 1 {
+		return 0, nil, errors.New("empty witness data")
+	}
+	version := data[0]
+	program, err := ConvertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := validWitnessProgram(version, program); err != nil {
+		return 0, nil, err
+	}
+	if (version == 0 && encoding != BECH32) || (version != 0 && encoding != BECH32M) {
+		return 0, nil, fmt.Errorf("invalid checksum encoding for witness version %d", version)
+	}
+	return version, program, nil
+}
+
+func H160P2WPKHAddress(hash []byte, params *ChainParams) string {
+	address, _ := EncodeSegwitAddress(params.Bech32Hrp, 0, hash)
+	return address
+}
+
+func SHA256P2WSHAddress(hash []byte, params *ChainParams) string {
+	address, _ := EncodeSegwitAddress(params.Bech32Hrp, 0, hash)
+	return address
+}
+
+// Returns the P2WSH address paying to the given witness script
+func P2WSHAddress(witnessScript []byte, params *ChainParams) string {
+	hashed := sha256.Sum256(witnessScript)
+	return SHA256P2WSHAddress(hashed[:], params)
+}
+
+// Native segwit (P2WPKH) address of the compressed public key
+func (p *PrivateKey) P2WPKHAddress(params *ChainParams) string {
+	return H160P2WPKHAddress(Hash160(p.Sec(COMPRESSED)), params)
+}
+
+// P2WPKH nested inside P2SH, for wallets that can't pay to bech32
+func (p *PrivateKey) P2SHP2WPKHAddress(params *ChainParams) string {
+	redeem := P2WPKHPubKey(Hash160(p.Sec(COMPRESSED)))
+	return H160P2SHAddress(Hash160(serializeScriptToBytes(redeem.cmds)), params)
+}
@@ -0,0 +1,128 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBech32ValidChecksums(t *testing.T) {
+	valid := map[bitcoinlib.Bech32Encoding][]string{
+		bitcoinlib.BECH32: {
+			"A12UEL5L",
+			"a12uel5l",
+			"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+			"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+			"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+		},
+		bitcoinlib.BECH32M: {
+			"A1LQFN3A",
+			"a1lqfn3a",
+			"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx",
+			"split1checkupstagehandshakeupstreamerranterredcaperredlc445v",
+			"?1v759aa",
+		},
+	}
+	for encoding, values := range valid {
+		for index, value := range values {
+			hrp, data, decodedEncoding, err := bitcoinlib.Bech32Decode(value)
+			if err != nil {
+				t.Fatalf("Failed at index %d (%s): %s", index, value, err)
+			}
+			if decodedEncoding != encoding {
+				t.Fatalf("Failed at index %d: wrong encoding detected", index)
+			}
+			encoded, err := bitcoinlib.Bech32Encode(hrp, data, encoding)
+			if err != nil || encoded != strings.ToLower(value) {
+				t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s", index, value, encoded)
+			}
+		}
+	}
+}
+
+func TestBech32ErrorPositions(t *testing.T) {
+	invalid := map[string]int{
+		"a12UEL5L":      3,
+		"pzry9x0s0muk":  -1,
+		"1pzry9x0s0muk": 0,
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxy": -1,
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxb": 44,
+		"li1dgmt3": 2,
+		"A1G7SGD8": -1,
+	}
+	for value, position := range invalid {
+		_, _, _, err := bitcoinlib.Bech32Decode(value)
+		var bechErr *bitcoinlib.Bech32Error
+		if !errors.As(err, &bechErr) {
+			t.Fatalf("Decoded invalid string %s", value)
+		}
+		if bechErr.Position != position {
+			t.Fatalf("Failed at %s\nExpected => %d\nGot => %d", value, position, bechErr.Position)
+		}
+	}
+}
+
+func TestSegwitAddresses(t *testing.T) {
+	valid := []struct {
+		address string
+		hrp     string
+		script  string
+	}{
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", "bc", "0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", "tb", "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", "bc", "5128751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"BC1SW50QGDZ25J", "bc", "6002751e"},
+		{"bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs", "bc", "5210751e76e8199196d454941c45d1b3a323"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", "bc", "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+	}
+	for index, vector := range valid {
+		version, program, err := bitcoinlib.DecodeSegwitAddress(vector.hrp, vector.address)
+		if err != nil {
+			t.Fatalf("Failed at index %d with error: %s", index, err)
+		}
+		opcode := version
+		if version > 0 {
+			opcode += 0x50
+		}
+		script := hex.EncodeToString(append([]byte{opcode, byte(len(program))}, program...))
+		if script != vector.script {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s", index, vector.script, script)
+		}
+		encoded, err := bitcoinlib.EncodeSegwitAddress(vector.hrp, version, program)
+		if err != nil || encoded != strings.ToLower(vector.address) {
+			t.Fatalf("Failed encoding at index %d: %s", index, encoded)
+		}
+	}
+}
+
+func TestInvalidSegwitAddresses(t *testing.T) {
+	invalid := []string{
+		"tc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq5zuyut",
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd",
+		"BC1S0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ54WELL",
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh",
+		"bc1rw5uspcuh",
+		"BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P",
+		"bc1gmk9yu",
+	}
+	for index, address := range invalid {
+		if _, _, err := bitcoinlib.DecodeSegwitAddress("bc", address); err == nil {
+			t.Fatalf("Decoded invalid address at index %d: %s", index, address)
+		}
+	}
+}
+
+func TestPrivateKeySegwitAddresses(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(1))
+	if key.P2WPKHAddress(bitcoinlib.MAINNET_PARAMS) != "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4" {
+		t.Fatalf("Failed p2wpkh address: %s", key.P2WPKHAddress(bitcoinlib.MAINNET_PARAMS))
+	}
+	if key.P2SHP2WPKHAddress(bitcoinlib.MAINNET_PARAMS) != "3JvL6Ymt8MVWiCNHC7oWU6nLeHNJKLZGLN" {
+		t.Fatalf("Failed p2sh-p2wpkh address: %s", key.P2SHP2WPKHAddress(bitcoinlib.MAINNET_PARAMS))
+	}
+	if !strings.HasPrefix(key.P2WPKHAddress(bitcoinlib.TESTNET3_PARAMS), "tb1q") {
+		t.Fatalf("Failed testnet p2wpkh address: %s", key.P2WPKHAddress(bitcoinlib.TESTNET3_PARAMS))
+	}
+}
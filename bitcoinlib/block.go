@@ -31,6 +31,26 @@ func BitsToTarget(bits uint32) Int {
 	return coefficient.Mul(base.Exp(exponent, MAX))
 }
 
+// Encodes a target in its compact bits representation
+func TargetToBits(target Int) uint32 {
+	asBytes := target.value.Bytes()
+	exponent := len(asBytes)
+	var coefficient []byte
+	if exponent == 0 {
+		return 0
+	}
+	if asBytes[0] > 0x7f {
+		exponent++
+		coefficient = append([]byte{0}, asBytes...)
+	} else {
+		coefficient = append([]byte{}, asBytes...)
+	}
+	coefficient = append(coefficient, 0, 0)[:3]
+	slices.Reverse(coefficient)
+	bits := append(coefficient, byte(exponent))
+	return binary.LittleEndian.Uint32(bits)
+}
+
 func TwoWeeks() uint32 {
 	return 14 * 24 * 60 * 60
 }
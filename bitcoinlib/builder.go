@@ -0,0 +1,265 @@
+package bitcoinlib
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+)
+
+// Fee rate in sat/vB used to compute dust thresholds, like Bitcoin Core
+const DUST_RELAY_FEE_RATE = 3
+
+// Weight of version, locktime and the input and output counts
+const TX_OVERHEAD_WEIGHT = 4 * (4 + 4 + 1 + 1)
+
+// Output that can be spent by the builder. Estimate describes the
+// signed input spending it, inferred from the script when nil
+type Utxo struct {
+	TxId     string
+	Index    uint32
+	Output   *Output
+	Estimate *InputEstimate
+}
+
+func NewUtxo(txId string, index uint32, output *Output) *Utxo {
+	return &Utxo{
+		TxId:   txId,
+		Index:  index,
+		Output: output,
+	}
+}
+
+func (u *Utxo) estimate() (*InputEstimate, error) {
+	if u.Estimate != nil {
+		return u.Estimate, nil
+	}
+	estimate, err := EstimateFromScript(u.Output.scriptPubKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w, set the estimate of the utxo", err)
+	}
+	return estimate, nil
+}
+
+func outputWeight(script *ScriptPubKey) int {
+	size := len(serializeScriptToBytes(script.cmds))
+	return WITNESS_SCALE_FACTOR * (8 + varIntSize(size) + size)
+}
+
+// Smallest amount worth creating an output for the script: the cost of
+// the output and of spending it later at the dust relay fee rate
+func DustThreshold(script *ScriptPubKey) uint64 {
+	spendSize := 36 + 4 + 1 + 107
+	if _, _, ok := script.witnessProgram(); ok {
+		spendSize = 36 + 4 + 1 + 107/4
+	}
+	return uint64((outputWeight(script)/4 + spendSize) * DUST_RELAY_FEE_RATE)
+}
+
+// Summary of the transaction built by the TxBuilder
+type FeeReport struct {
+	Algorithm    CoinSelection
+	Selected     []*Utxo
+	InputAmount  uint64
+	OutputAmount uint64
+	Fee          uint64
+	ChangeIndex  int // -1 when there is no change output
+	Weight       int // estimated once signed
+	VSize        int
+	FeeRate      float64 // in sat/vB
+}
+
+// Builds transactions paying a set of outputs from a set of UTXOs,
+// choosing the inputs with a coin selection algorithm and sending
+// the remainder to a change output when it is above dust
+type TxBuilder struct {
+	utxos     []*Utxo
+	payments  []*Output
+	feeRate   float64
+	change    *ScriptPubKey
+	algorithm CoinSelection
+	rng       *rand.Rand
+}
+
+// Creates a builder paying feeRate sat/vB and sending change to the script
+func NewTxBuilder(feeRate float64, change *ScriptPubKey) *TxBuilder {
+	return &TxBuilder{
+		feeRate:   feeRate,
+		change:    change,
+		algorithm: BRANCH_AND_BOUND,
+		rng:       rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+	}
+}
+
+func (b *TxBuilder) AddUtxo(utxo *Utxo) {
+	b.utxos = append(b.utxos, utxo)
+}
+
+func (b *TxBuilder) AddPayment(amount uint64, address string) error {
+	script, _, err := DecodeAddress(address)
+	if err != nil {
+		return err
+	}
+	b.AddPaymentScript(amount, script)
+	return nil
+}
+
+func (b *TxBuilder) AddPaymentScript(amount uint64, script *ScriptPubKey) {
+	b.payments = append(b.payments, NewOutput(amount, script))
+}
+
+// Branch and Bound, the default, falls back to knapsack when there
+// is no selection avoiding the change output
+func (b *TxBuilder) SetCoinSelection(algorithm CoinSelection) {
+	b.algorithm = algorithm
+}
+
+// Sets the source of randomness of knapsack and single random draw
+func (b *TxBuilder) SetRandomSource(source rand.Source) {
+	b.rng = rand.New(source)
+}
+
+// Returns a provider with the UTXOs of the builder, to sign and
+// verify the built transaction
+func (b *TxBuilder) Provider() *MemoryProvider {
+	provider := NewMemoryProvider()
+	for _, utxo := range b.utxos {
+		provider.Add(utxo.TxId, utxo.Index, utxo.Output)
+	}
+	return provider
+}
+
+func (b *TxBuilder) fee(weight int) int64 {
+	return int64(FeeForWeight(weight, b.feeRate))
+}
+
+func (b *TxBuilder) selectCoins(candidates []*coinCandidate, target int64, changeFee int64, costOfChange int64, dust int64) ([]*coinCandidate, CoinSelection) {
+	algorithm := b.algorithm
+	if algorithm == BRANCH_AND_BOUND {
+		if selected := selectBranchAndBound(candidates, target, costOfChange); selected != nil {
+			return selected, algorithm
+		}
+		algorithm = KNAPSACK
+	}
+	// The other algorithms pay for a change output above dust when they can
+	switch algorithm {
+	case KNAPSACK:
+		selected := selectKnapsack(candidates, target+changeFee, dust, b.rng)
+		if selected == nil {
+			selected = selectKnapsack(candidates, target, 0, b.rng)
+		}
+		return selected, algorithm
+	case LARGEST_FIRST:
+		return selectLargestFirst(candidates, target, target+changeFee+dust), algorithm
+	case SINGLE_RANDOM_DRAW:
+		return selectSingleRandomDraw(candidates, target, target+changeFee+dust, b.rng), algorithm
+	}
+	return nil, algorithm
+}
+
+// Selects the inputs and returns the unsigned transaction
+func (b *TxBuilder) Build() (*Transaction, *FeeReport, error) {
+	if len(b.payments) == 0 {
+		return nil, nil, errors.New("transaction without payments")
+	}
+	if b.change == nil {
+		return nil, nil, errors.New("missing change script")
+	}
+	if b.feeRate < 0 {
+		return nil, nil, fmt.Errorf("invalid fee rate: %f", b.feeRate)
+	}
+	var paid uint64
+	fixedWeight := TX_OVERHEAD_WEIGHT
+	for index, payment := range b.payments {
+		if payment.amount < DustThreshold(payment.scriptPubKey) {
+			return nil, nil, fmt.Errorf("payment %d of %d is dust", index, payment.amount)
+		}
+		paid += payment.amount
+		fixedWeight += outputWeight(payment.scriptPubKey)
+	}
+	estimates := map[*Utxo]*InputEstimate{}
+	segwit := false
+	for _, utxo := range b.utxos {
+		estimate, err := utxo.estimate()
+		if err != nil {
+			return nil, nil, fmt.Errorf("utxo %s:%d: %w", utxo.TxId, utxo.Index, err)
+		}
+		estimates[utxo] = estimate
+		segwit = segwit || estimate.IsSegwit()
+	}
+	// Selection assumes the marker and flag are needed if any input can be
+	// segwit, in which case legacy inputs have an empty witness
+	if segwit {
+		fixedWeight += SEGWIT_MARKER_WEIGHT
+	}
+	candidates := []*coinCandidate{}
+	for _, utxo := range b.utxos {
+		estimate := estimates[utxo]
+		weight, err := estimate.Weight()
+		if err != nil {
+			return nil, nil, fmt.Errorf("utxo %s:%d: %w", utxo.TxId, utxo.Index, err)
+		}
+		if segwit && !estimate.IsSegwit() {
+			weight++
+		}
+		// UTXOs costing more than they are worth are left out
+		effective := int64(utxo.Output.amount) - b.fee(weight)
+		if effective > 0 {
+			candidates = append(candidates, &coinCandidate{utxo, estimate, effective})
+		}
+	}
+	target := int64(paid) + b.fee(fixedWeight)
+	changeFee := b.fee(outputWeight(b.change))
+	changeSpend := NewInputEstimate(P2PKH_INPUT)
+	if estimate, err := EstimateFromScript(b.change); err == nil {
+		changeSpend = estimate
+	}
+	changeSpendWeight, err := changeSpend.Weight()
+	if err != nil {
+		return nil, nil, err
+	}
+	costOfChange := changeFee + b.fee(changeSpendWeight)
+	dust := int64(DustThreshold(b.change))
+
+	selected, algorithm := b.selectCoins(candidates, target, changeFee, costOfChange, dust)
+	if selected == nil {
+		return nil, nil, errors.New("insufficient funds")
+	}
+
+	tx := NewTransaction()
+	report := &FeeReport{Algorithm: algorithm, ChangeIndex: -1, OutputAmount: paid}
+	inputs := []*InputEstimate{}
+	for _, candidate := range selected {
+		tx.AddInput(candidate.utxo.TxId, candidate.utxo.Index)
+		inputs = append(inputs, candidate.estimate)
+		report.Selected = append(report.Selected, candidate.utxo)
+		report.InputAmount += candidate.utxo.Output.amount
+	}
+	for _, payment := range b.payments {
+		tx.AddOutputScript(payment.amount, payment.scriptPubKey)
+	}
+	// The change output is kept when it is above dust after paying for itself
+	tx.AddOutputScript(0, b.change)
+	weight, err := tx.EstimateWeight(inputs)
+	if err != nil {
+		return nil, nil, err
+	}
+	change := int64(report.InputAmount) - int64(paid) - b.fee(weight)
+	if change >= dust {
+		tx.outputs[len(tx.outputs)-1].amount = uint64(change)
+		report.ChangeIndex = len(tx.outputs) - 1
+		report.OutputAmount += uint64(change)
+	} else {
+		tx.outputs = tx.outputs[:len(tx.outputs)-1]
+		if weight, err = tx.EstimateWeight(inputs); err != nil {
+			return nil, nil, err
+		}
+		if int64(report.InputAmount)-int64(paid) < b.fee(weight) {
+			return nil, nil, errors.New("insufficient funds")
+		}
+	}
+	report.Weight = weight
+	report.Fee = report.InputAmount - report.OutputAmount
+	report.VSize = weightToVSize(weight)
+	report.FeeRate = float64(report.Fee) / float64(report.VSize)
+	return tx, report, nil
+}
@@ -0,0 +1,142 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+func builderScript(t *testing.T, address string) *bitcoinlib.ScriptPubKey {
+	script, _, err := bitcoinlib.DecodeAddress(address)
+	if err != nil {
+		t.Fatalf("Failed decoding %s: %s", address, err)
+	}
+	return script
+}
+
+// Builder paying 1 sat/vB with UTXOs of the given amounts to the key,
+// alternating between P2WPKH and P2PKH outputs
+func newBuilderFixture(t *testing.T, key *bitcoinlib.PrivateKey, amounts ...uint64) *bitcoinlib.TxBuilder {
+	scripts := []*bitcoinlib.ScriptPubKey{
+		builderScript(t, key.P2WPKHAddress(bitcoinlib.MAINNET_PARAMS)),
+		builderScript(t, key.Address(bitcoinlib.COMPRESSED, bitcoinlib.MAINNET_PARAMS)),
+	}
+	builder := bitcoinlib.NewTxBuilder(1, scripts[0])
+	builder.SetRandomSource(rand.NewPCG(1, 2))
+	for index, amount := range amounts {
+		txId := strings.Repeat(fmt.Sprintf("%02x", index+1), 32)
+		output := bitcoinlib.NewOutput(amount, scripts[index%2])
+		builder.AddUtxo(bitcoinlib.NewUtxo(txId, uint32(index), output))
+	}
+	return builder
+}
+
+func TestTxBuilderAlgorithms(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(5005))
+	payee := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(6006)).P2WPKHAddress(bitcoinlib.MAINNET_PARAMS)
+	algorithms := []bitcoinlib.CoinSelection{
+		bitcoinlib.BRANCH_AND_BOUND,
+		bitcoinlib.KNAPSACK,
+		bitcoinlib.LARGEST_FIRST,
+		bitcoinlib.SINGLE_RANDOM_DRAW,
+	}
+	for index, algorithm := range algorithms {
+		builder := newBuilderFixture(t, key, 20000, 35000, 50000, 80000, 120000)
+		builder.SetCoinSelection(algorithm)
+		if err := builder.AddPayment(100000, payee); err != nil {
+			t.Fatalf("Failed adding payment: %s", err)
+		}
+		tx, report, err := builder.Build()
+		if err != nil {
+			t.Fatalf("Failed at index %d: %s", index, err)
+		}
+		if report.InputAmount != report.OutputAmount+report.Fee || report.FeeRate < 1 {
+			t.Fatalf("Failed at index %d\nExpected => fee rate of at least 1\nGot => %f", index, report.FeeRate)
+		}
+		provider := builder.Provider()
+		if err := tx.Sign(provider, key); err != nil {
+			t.Fatalf("Failed signing at index %d: %s", index, err)
+		}
+		if !tx.Verify(provider) {
+			t.Fatalf("Failed verifying at index %d", index)
+		}
+		// The estimate assumes the largest signatures
+		if weight := tx.Weight(); weight > report.Weight || report.Weight-weight > 8*len(report.Selected) {
+			t.Fatalf("Failed at index %d\nExpected => weight %d\nGot => %d", index, weight, report.Weight)
+		}
+	}
+}
+
+func TestTxBuilderChange(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(5005))
+	payee := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(6006)).P2WPKHAddress(bitcoinlib.MAINNET_PARAMS)
+
+	// The 40000 UTXO pays 39800 plus fees with an excess below the cost of change
+	builder := newBuilderFixture(t, key, 40000, 100000)
+	builder.AddPayment(39800, payee)
+	_, report, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Failed building exact match: %s", err)
+	}
+	if report.Algorithm != bitcoinlib.BRANCH_AND_BOUND || report.ChangeIndex != -1 || len(report.Selected) != 1 {
+		t.Fatalf("Failed finding exact match\nExpected => no change\nGot => %s with change %d", report.Algorithm, report.ChangeIndex)
+	}
+
+	// No exact match falls back to knapsack with change
+	builder = newBuilderFixture(t, key, 40000, 100000)
+	builder.AddPayment(50000, payee)
+	tx, report, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Failed building with change: %s", err)
+	}
+	if report.Algorithm != bitcoinlib.KNAPSACK || report.ChangeIndex != 1 {
+		t.Fatalf("Failed adding change\nExpected => knapsack with change 1\nGot => %s with change %d", report.Algorithm, report.ChangeIndex)
+	}
+	if err := tx.Sign(builder.Provider(), key); err != nil || !tx.Verify(builder.Provider()) {
+		t.Fatalf("Failed signing transaction with change: %v", err)
+	}
+
+	// Change below dust goes to the fee
+	builder = newBuilderFixture(t, key, 40000)
+	builder.SetCoinSelection(bitcoinlib.LARGEST_FIRST)
+	builder.AddPayment(39700, payee)
+	_, report, err = builder.Build()
+	if err != nil {
+		t.Fatalf("Failed building with dust change: %s", err)
+	}
+	if report.ChangeIndex != -1 || report.Fee != 300 {
+		t.Fatalf("Failed dropping dust change\nExpected => fee 300\nGot => %d", report.Fee)
+	}
+}
+
+func TestTxBuilderErrors(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(5005))
+	payee := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(6006)).P2WPKHAddress(bitcoinlib.MAINNET_PARAMS)
+
+	builder := newBuilderFixture(t, key, 20000, 30000)
+	builder.AddPayment(50000, payee)
+	if _, _, err := builder.Build(); err == nil {
+		t.Fatal("Built transaction without enough funds for the fee")
+	}
+	builder = newBuilderFixture(t, key, 20000)
+	builder.AddPayment(293, payee)
+	if _, _, err := builder.Build(); err == nil {
+		t.Fatal("Built transaction with a dust payment")
+	}
+	builder = newBuilderFixture(t, key, 20000)
+	if _, _, err := builder.Build(); err == nil {
+		t.Fatal("Built transaction without payments")
+	}
+	if err := builder.AddPayment(1000, "not an address"); err == nil {
+		t.Fatal("Added payment to an invalid address")
+	}
+	// UTXOs worth less than the fee to spend them are ignored
+	builder = newBuilderFixture(t, key, 60, 20000)
+	builder.AddPayment(10000, payee)
+	_, report, err := builder.Build()
+	if err != nil || len(report.Selected) != 1 || report.Selected[0].Output.Amount() != 20000 {
+		t.Fatalf("Failed skipping uneconomical UTXO: %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+package bitcoinlib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"net"
+)
+
+const REGTEST_MAGIC = 0xfabfb5da
+const SIGNET_MAGIC = 0x0a03cf40
+const TESTNET4_MAGIC = 0x1c163f28
+
+const REGTEST_GENESIS_BLOCK = "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4adae5494dffff7f2002000000"
+const SIGNET_GENESIS_BLOCK = "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a008f4d5fae77031e8ad22203"
+const TESTNET4_GENESIS_BLOCK = "0100000000000000000000000000000000000000000000000000000000000000000000004e7b2b9128fe0291db0693af2ae418b767e657cd407e80cb1434221eaea7a07a046f3566ffff001dbb0c7817"
+
+const WIF_MAINNET_PREFIX = 0x80
+const WIF_TESTNET_PREFIX = 0xef
+
+// Everything that changes from one bitcoin network to another
+type ChainParams struct {
+	Name        string
+	Magic       uint32
+	DefaultPort uint16
+	// Serialized 80 bytes header of the genesis block
+	GenesisHeader string
+	// Resolved by LookupSeeds to find nodes
+	DNSSeeds []string
+	// Public Esplora REST API used by DefaultProvider
+	EsploraUrl string
+
+	P2PKHPrefix byte
+	P2SHPrefix  byte
+	WIFPrefix   byte
+	Bech32Hrp   string
+
+	// BIP32 extended key versions
+	PrivateKeyVersion [4]byte
+	PublicKeyVersion  [4]byte
+
+	// Retarget rules
+	PowLimitBits   uint32
+	TargetTimespan uint32
+	TargetSpacing  uint32
+	// Blocks coming twice the target spacing after the previous one can
+	// be mined at the minimum difficulty
+	AllowMinDifficulty bool
+	NoRetargeting      bool
+	// BIP94: retarget from the first block of the period
+	EnforceBIP94 bool
+}
+
+var MAINNET_PARAMS = &ChainParams{
+	Name:          "mainnet",
+	Magic:         MAINNET_MAGIC,
+	DefaultPort:   8333,
+	GenesisHeader: GENESIS_BLOCK,
+	DNSSeeds: []string{
+		"seed.bitcoin.sipa.be",
+		"dnsseed.bluematt.me",
+		"seed.bitcoinstats.com",
+		"seed.bitcoin.jonasschnelli.ch",
+	},
+	EsploraUrl:        "https://mempool.space/api",
+	P2PKHPrefix:       MAINNET_P2PKH_PREFIX,
+	P2SHPrefix:        MAINNET_P2SH_PREFIX,
+	WIFPrefix:         WIF_MAINNET_PREFIX,
+	Bech32Hrp:         MAINNET_HRP,
+	PrivateKeyVersion: MAINNET_PRIVATE_VERSION,
+	PublicKeyVersion:  MAINNET_PUBLIC_VERSION,
+	PowLimitBits:      0x1d00ffff,
+	TargetTimespan:    TwoWeeks(),
+	TargetSpacing:     10 * 60,
+}
+
+var TESTNET3_PARAMS = &ChainParams{
+	Name:          "testnet3",
+	Magic:         TESTNET_MAGIC,
+	DefaultPort:   18333,
+	GenesisHeader: TESTNET_GENESIS_BLOCK,
+	DNSSeeds: []string{
+		"testnet-seed.bitcoin.jonasschnelli.ch",
+		"seed.tbtc.petertodd.net",
+		"testnet-seed.bluematt.me",
+	},
+	EsploraUrl:         "https://mempool.space/testnet/api",
+	P2PKHPrefix:        TESTNET_P2PKH_PREFIX,
+	P2SHPrefix:         TESTNET_P2SH_PREFIX,
+	WIFPrefix:          WIF_TESTNET_PREFIX,
+	Bech32Hrp:          TESTNET_HRP,
+	PrivateKeyVersion:  TESTNET_PRIVATE_VERSION,
+	PublicKeyVersion:   TESTNET_PUBLIC_VERSION,
+	PowLimitBits:       0x1d00ffff,
+	TargetTimespan:     TwoWeeks(),
+	TargetSpacing:      10 * 60,
+	AllowMinDifficulty: true,
+}
+
+var TESTNET4_PARAMS = &ChainParams{
+	Name:          "testnet4",
+	Magic:         TESTNET4_MAGIC,
+	DefaultPort:   48333,
+	GenesisHeader: TESTNET4_GENESIS_BLOCK,
+	DNSSeeds: []string{
+		"seed.testnet4.bitcoin.sprovoost.nl",
+		"seed.testnet4.wiz.biz",
+	},
+	EsploraUrl:         "https://mempool.space/testnet4/api",
+	P2PKHPrefix:        TESTNET_P2PKH_PREFIX,
+	P2SHPrefix:         TESTNET_P2SH_PREFIX,
+	WIFPrefix:          WIF_TESTNET_PREFIX,
+	Bech32Hrp:          TESTNET_HRP,
+	PrivateKeyVersion:  TESTNET_PRIVATE_VERSION,
+	PublicKeyVersion:   TESTNET_PUBLIC_VERSION,
+	PowLimitBits:       0x1d00ffff,
+	TargetTimespan:     TwoWeeks(),
+	TargetSpacing:      10 * 60,
+	AllowMinDifficulty: true,
+	EnforceBIP94:       true,
+}
+
+var SIGNET_PARAMS = &ChainParams{
+	Name:              "signet",
+	Magic:             SIGNET_MAGIC,
+	DefaultPort:       38333,
+	GenesisHeader:     SIGNET_GENESIS_BLOCK,
+	DNSSeeds:          []string{"seed.signet.bitcoin.sprovoost.nl"},
+	EsploraUrl:        "https://mempool.space/signet/api",
+	P2PKHPrefix:       TESTNET_P2PKH_PREFIX,
+	P2SHPrefix:        TESTNET_P2SH_PREFIX,
+	WIFPrefix:         WIF_TESTNET_PREFIX,
+	Bech32Hrp:         TESTNET_HRP,
+	PrivateKeyVersion: TESTNET_PRIVATE_VERSION,
+	PublicKeyVersion:  TESTNET_PUBLIC_VERSION,
+	PowLimitBits:      0x1e0377ae,
+	TargetTimespan:    TwoWeeks(),
+	TargetSpacing:     10 * 60,
+}
+
+var REGTEST_PARAMS = &ChainParams{
+	Name:               "regtest",
+	Magic:              REGTEST_MAGIC,
+	DefaultPort:        18444,
+	GenesisHeader:      REGTEST_GENESIS_BLOCK,
+	P2PKHPrefix:        TESTNET_P2PKH_PREFIX,
+	P2SHPrefix:         TESTNET_P2SH_PREFIX,
+	WIFPrefix:          WIF_TESTNET_PREFIX,
+	Bech32Hrp:          REGTEST_HRP,
+	PrivateKeyVersion:  TESTNET_PRIVATE_VERSION,
+	PublicKeyVersion:   TESTNET_PUBLIC_VERSION,
+	PowLimitBits:       0x207fffff,
+	TargetTimespan:     TwoWeeks(),
+	TargetSpacing:      10 * 60,
+	AllowMinDifficulty: true,
+	NoRetargeting:      true,
+}
+
+// Every network known by the library, in the
+// order used when guessing the network of an address
+var KNOWN_CHAINS = []*ChainParams{
+	MAINNET_PARAMS,
+	TESTNET3_PARAMS,
+	TESTNET4_PARAMS,
+	SIGNET_PARAMS,
+	REGTEST_PARAMS,
+}
+
+// Returns the parameters of the network with the given name
+func ChainParamsByName(name string) *ChainParams {
+	for _, params := range KNOWN_CHAINS {
+		if params.Name == name {
+			return params
+		}
+	}
+	return nil
+}
+
+// Returns the parameters of the network using magic
+func ChainParamsByMagic(magic uint32) *ChainParams {
+	for _, params := range KNOWN_CHAINS {
+		if params.Magic == magic {
+			return params
+		}
+	}
+	return nil
+}
+
+func (p *ChainParams) String() string {
+	return p.Name
+}
+
+func (p *ChainParams) IsMainnet() bool {
+	return p.Magic == MAINNET_MAGIC
+}
+
+// Returns true if both networks share the same address formats
+func (p *ChainParams) SameAddressFormat(other *ChainParams) bool {
+	return p.P2PKHPrefix == other.P2PKHPrefix &&
+		p.P2SHPrefix == other.P2SHPrefix &&
+		p.Bech32Hrp == other.Bech32Hrp
+}
+
+func (p *ChainParams) GenesisBlock() *Block {
+	header, _ := hex.DecodeString(p.GenesisHeader)
+	block := NewBlock()
+	block.Parse(bytes.NewReader(header))
+	return block
+}
+
+func (p *ChainParams) GenesisHash() string {
+	return p.GenesisBlock().Hash()
+}
+
+func (p *ChainParams) PowLimit() Int {
+	return BitsToTarget(p.PowLimitBits)
+}
+
+// Resolves the DNS seeds of the network into addresses of nodes,
+// skipping the seeds that can't be resolved
+func (p *ChainParams) LookupSeeds() []string {
+	addrs := []string{}
+	for _, seed := range p.DNSSeeds {
+		found, err := net.LookupHost(seed)
+		if err != nil {
+			continue
+		}
+		addrs = append(addrs, found...)
+	}
+	return addrs
+}
+
+// Number of blocks between difficulty adjustments
+func (p *ChainParams) RetargetInterval() uint32 {
+	return p.TargetTimespan / p.TargetSpacing
+}
+
+// Returns the bits of the block following last, where first is the
+// first block of the retarget period ending at last
+func (p *ChainParams) NextWorkRequired(first *Block, last *Block) uint32 {
+	if p.NoRetargeting {
+		return last.blockBits
+	}
+	timespan := int64(last.timestamp) - int64(first.timestamp)
+	minimum := int64(p.TargetTimespan / 4)
+	maximum := int64(p.TargetTimespan * 4)
+	if timespan < minimum {
+		timespan = minimum
+	} else if timespan > maximum {
+		timespan = maximum
+	}
+	target := last.BitsToTarget().value
+	if p.EnforceBIP94 {
+		target = first.BitsToTarget().value
+	}
+	next := new(big.Int).Mul(target, big.NewInt(timespan))
+	next.Div(next, big.NewInt(int64(p.TargetTimespan)))
+	limit := p.PowLimit()
+	if next.Cmp(limit.value) > 0 {
+		next = limit.value
+	}
+	return TargetToBits(Int{next})
+}
+
+// Returns the bits of the block at height mined at timestamp, where
+// headers are the blocks from the first one of the retarget period of
+// the previous block up to it
+func (p *ChainParams) WorkRequired(height uint32, timestamp uint32, headers []*Block) uint32 {
+	last := headers[len(headers)-1]
+	if height%p.RetargetInterval() == 0 {
+		return p.NextWorkRequired(headers[0], last)
+	}
+	if !p.AllowMinDifficulty {
+		return last.blockBits
+	}
+	if int64(timestamp) > int64(last.timestamp)+int64(p.TargetSpacing*2) {
+		return p.PowLimitBits
+	}
+	// Otherwise the bits of the last block not mined at the minimum
+	// difficulty, or of the first block of the period
+	index := len(headers) - 1
+	for index > 0 && headers[index].blockBits == p.PowLimitBits {
+		index--
+	}
+	return headers[index].blockBits
+}
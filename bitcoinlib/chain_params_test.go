@@ -0,0 +1,145 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestGenesisHashes(t *testing.T) {
+	expected := map[*bitcoinlib.ChainParams]string{
+		bitcoinlib.MAINNET_PARAMS:  "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+		bitcoinlib.TESTNET3_PARAMS: "000000000933ea01ad0ee984209779baaec3ced90fa3f408719526f8d77f4943",
+		bitcoinlib.TESTNET4_PARAMS: "00000000da84f2bafbbc53dee25a72ae507ff4914b867c565be350b0da8bf043",
+		bitcoinlib.SIGNET_PARAMS:   "00000008819873e925422c1ff0f99f7cc9bbb232af63a077a480a3633bee1ef6",
+		bitcoinlib.REGTEST_PARAMS:  "0f9188f13cb7b2c71f2a335e3a4fc328bf5beb436012afca590b1a11466e2206",
+	}
+	for params, hash := range expected {
+		if params.GenesisHash() != hash {
+			t.Fatalf("Failed at %s\nExpected => %s\nGot => %s", params, hash, params.GenesisHash())
+		}
+	}
+}
+
+func TestChainParamsLookup(t *testing.T) {
+	for _, params := range bitcoinlib.KNOWN_CHAINS {
+		if bitcoinlib.ChainParamsByName(params.Name) != params {
+			t.Fatalf("Failed looking up %s by name", params)
+		}
+		if bitcoinlib.ChainParamsByMagic(params.Magic) != params {
+			t.Fatalf("Failed looking up %s by magic", params)
+		}
+	}
+	if bitcoinlib.ChainParamsByName("unknown") != nil {
+		t.Fatal("Found an unknown network")
+	}
+}
+
+func TestNextWorkRequired(t *testing.T) {
+	first, _ := hex.DecodeString("000000203471101bbda3fe307664b3283a9ef0e97d9a38a7eacd8800000000000000000010c8aba8479bbaa5e0848152fd3c2289ca50e1c3e58c9a4faaafbdf5803c5448ddb845597e8b0118e43a81d3")
+	last, _ := hex.DecodeString("02000020f1472d9db4b563c35f97c428ac903f23b7fc055d1cfc26000000000000000000b3f449fcbe1bc4cfbcb8283a0d2c037f961a3fdf2b8bedc144973735eea707e1264258597e8b0118e5f00474")
+	firstBlock := bitcoinlib.NewBlock()
+	lastBlock := bitcoinlib.NewBlock()
+	firstBlock.Parse(bytes.NewReader(first))
+	lastBlock.Parse(bytes.NewReader(last))
+
+	expected := binary.LittleEndian.Uint32([]byte{0x30, 0x8d, 0x01, 0x18})
+	actual := bitcoinlib.MAINNET_PARAMS.NextWorkRequired(firstBlock, lastBlock)
+	if actual != expected {
+		t.Fatalf("Expected new bits %x but got %x", expected, actual)
+	}
+	unchanged := binary.LittleEndian.Uint32([]byte{0x7e, 0x8b, 0x01, 0x18})
+	if bitcoinlib.REGTEST_PARAMS.NextWorkRequired(firstBlock, lastBlock) != unchanged {
+		t.Fatal("Regtest retargeted the difficulty")
+	}
+}
+
+// Header of a block mined at timestamp with bits
+func workHeader(timestamp uint32, bits uint32) *bitcoinlib.Block {
+	header := make([]byte, 68)
+	header = binary.LittleEndian.AppendUint32(header, timestamp)
+	header = binary.LittleEndian.AppendUint32(header, bits)
+	header = binary.LittleEndian.AppendUint32(header, 0)
+	block := bitcoinlib.NewBlock()
+	block.Parse(bytes.NewReader(header))
+	return block
+}
+
+func TestWorkRequired(t *testing.T) {
+	limit := uint32(0x1d00ffff)
+	bits := uint32(0x1c00ffff)
+	// Blocks of the period from height 4032, the last mined at the minimum difficulty
+	headers := []*bitcoinlib.Block{
+		workHeader(1000, bits),
+		workHeader(1600, bits),
+		workHeader(3000, limit),
+	}
+	vectors := []struct {
+		params    *bitcoinlib.ChainParams
+		timestamp uint32
+		expected  uint32
+	}{
+		{bitcoinlib.MAINNET_PARAMS, 5000, limit},
+		{bitcoinlib.TESTNET3_PARAMS, 3000 + 1201, limit},
+		{bitcoinlib.TESTNET3_PARAMS, 3000 + 1200, bits},
+		{bitcoinlib.TESTNET4_PARAMS, 3000 + 600, bits},
+	}
+	for index, vector := range vectors {
+		actual := vector.params.WorkRequired(4035, vector.timestamp, headers)
+		if actual != vector.expected {
+			t.Fatalf("Failed at index %d\nExpected => %x\nGot => %x", index, vector.expected, actual)
+		}
+	}
+	// Only min difficulty blocks since the start of the period
+	minimum := []*bitcoinlib.Block{workHeader(1000, limit), workHeader(1600, limit)}
+	if actual := bitcoinlib.TESTNET3_PARAMS.WorkRequired(4034, 1700, minimum); actual != limit {
+		t.Fatalf("Expected => %x\nGot => %x", limit, actual)
+	}
+	// Retargets ignore the min difficulty rule
+	period := []*bitcoinlib.Block{workHeader(0, bits)}
+	for range bitcoinlib.TESTNET3_PARAMS.RetargetInterval() - 1 {
+		period = append(period, workHeader(bitcoinlib.TwoWeeks(), bits))
+	}
+	if actual := bitcoinlib.TESTNET3_PARAMS.WorkRequired(4032, bitcoinlib.TwoWeeks()+5000, period); actual != bits {
+		t.Fatalf("Expected => %x\nGot => %x", bits, actual)
+	}
+}
+
+func TestLookupSeeds(t *testing.T) {
+	if addrs := bitcoinlib.REGTEST_PARAMS.LookupSeeds(); len(addrs) != 0 {
+		t.Fatalf("Found regtest seeds %v", addrs)
+	}
+}
+
+func TestTargetToBits(t *testing.T) {
+	for _, bits := range []uint32{0x1d00ffff, 0x18018d30, 0x207fffff, 0x1e0377ae} {
+		if result := bitcoinlib.TargetToBits(bitcoinlib.BitsToTarget(bits)); result != bits {
+			t.Fatalf("Expected => %x\nGot => %x", bits, result)
+		}
+	}
+}
+
+func TestRegtestAddresses(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(1))
+	address := key.P2WPKHAddress(bitcoinlib.REGTEST_PARAMS)
+	if !strings.HasPrefix(address, "bcrt1q") {
+		t.Fatalf("Failed regtest p2wpkh address: %s", address)
+	}
+	if _, err := bitcoinlib.AddressToScriptPubKey(address, bitcoinlib.REGTEST_PARAMS); err != nil {
+		t.Fatalf("Failed decoding regtest address: %s", err)
+	}
+	if _, err := bitcoinlib.AddressToScriptPubKey(address, bitcoinlib.TESTNET3_PARAMS); err == nil {
+		t.Fatal("Accepted regtest address for testnet")
+	}
+	legacy := key.Address(bitcoinlib.COMPRESSED, bitcoinlib.REGTEST_PARAMS)
+	if _, err := bitcoinlib.AddressToScriptPubKey(legacy, bitcoinlib.REGTEST_PARAMS); err != nil {
+		t.Fatalf("Failed decoding regtest legacy address: %s", err)
+	}
+	wif := key.WIF(bitcoinlib.COMPRESSED, bitcoinlib.REGTEST_PARAMS)
+	if wif != key.WIF(bitcoinlib.COMPRESSED, bitcoinlib.TESTNET3_PARAMS) {
+		t.Fatalf("Regtest WIF differs from testnet: %s", wif)
+	}
+}
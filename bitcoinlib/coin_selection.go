@@ -0,0 +1,225 @@
+package bitcoinlib
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+)
+
+// Algorithm choosing the UTXOs funding a transaction
+type CoinSelection int
+
+const (
+	BRANCH_AND_BOUND CoinSelection = iota
+	KNAPSACK
+	LARGEST_FIRST
+	SINGLE_RANDOM_DRAW
+)
+
+const BNB_MAX_TRIES = 100000
+const KNAPSACK_ITERATIONS = 1000
+
+func (c CoinSelection) String() string {
+	switch c {
+	case BRANCH_AND_BOUND:
+		return "branch and bound"
+	case KNAPSACK:
+		return "knapsack"
+	case LARGEST_FIRST:
+		return "largest first"
+	case SINGLE_RANDOM_DRAW:
+		return "single random draw"
+	}
+	return "unknown"
+}
+
+// UTXO considered by coin selection. Its effective value is the
+// amount minus the fee paid by the input spending it
+type coinCandidate struct {
+	utxo      *Utxo
+	estimate  *InputEstimate
+	effective int64
+}
+
+func sumEffective(candidates []*coinCandidate) int64 {
+	var total int64
+	for _, candidate := range candidates {
+		total += candidate.effective
+	}
+	return total
+}
+
+func sortByEffective(candidates []*coinCandidate) []*coinCandidate {
+	sorted := slices.Clone(candidates)
+	slices.SortStableFunc(sorted, func(a, b *coinCandidate) int {
+		return cmp.Compare(b.effective, a.effective)
+	})
+	return sorted
+}
+
+// Depth first search, as in Bitcoin Core, for the subset whose effective
+// value is between target and target + costOfChange, so the transaction
+// needs no change output. The solution with the lowest excess is kept
+func selectBranchAndBound(candidates []*coinCandidate, target int64, costOfChange int64) []*coinCandidate {
+	sorted := sortByEffective(candidates)
+	selected := make([]bool, len(sorted))
+	var best []bool
+	bestExcess := costOfChange + 1
+	tries := 0
+	var search func(index int, value int64, available int64)
+	search = func(index int, value int64, available int64) {
+		if tries >= BNB_MAX_TRIES || bestExcess == 0 {
+			return
+		}
+		tries++
+		if value > target+costOfChange {
+			return
+		}
+		if value >= target {
+			if value-target < bestExcess {
+				bestExcess = value - target
+				best = slices.Clone(selected)
+			}
+			return
+		}
+		if index == len(sorted) || value+available < target {
+			return
+		}
+		selected[index] = true
+		search(index+1, value+sorted[index].effective, available-sorted[index].effective)
+		selected[index] = false
+		// Excluding a candidate then including an equal one explores the
+		// same sums, so candidates with the same value are skipped together
+		next := index
+		for next < len(sorted) && sorted[next].effective == sorted[index].effective {
+			available -= sorted[next].effective
+			next++
+		}
+		search(next, value, available)
+	}
+	search(0, 0, sumEffective(sorted))
+	if best == nil {
+		return nil
+	}
+	result := []*coinCandidate{}
+	for index, included := range best {
+		if included {
+			result = append(result, sorted[index])
+		}
+	}
+	return result
+}
+
+// Randomly includes candidates looking for the subset closest to target
+// from above. Returns the subset and its value
+func approximateBestSubset(candidates []*coinCandidate, total int64, target int64, rng *rand.Rand) ([]bool, int64) {
+	best := make([]bool, len(candidates))
+	for index := range best {
+		best[index] = true
+	}
+	bestValue := total
+	for range KNAPSACK_ITERATIONS {
+		if bestValue == target {
+			break
+		}
+		included := make([]bool, len(candidates))
+		var value int64
+		reached := false
+		for pass := 0; pass < 2 && !reached; pass++ {
+			for index, candidate := range candidates {
+				// The first pass picks at random, the second one fills the gaps
+				if (pass == 0 && rng.IntN(2) == 1) || (pass == 1 && !included[index]) {
+					value += candidate.effective
+					included[index] = true
+					if value >= target {
+						reached = true
+						if value < bestValue {
+							bestValue = value
+							best = slices.Clone(included)
+						}
+						value -= candidate.effective
+						included[index] = false
+					}
+				}
+			}
+		}
+	}
+	return best, bestValue
+}
+
+// Bitcoin Core's knapsack solver: an exact match, every smaller candidate,
+// the smallest larger candidate or the best random subset leaving at
+// least minChange
+func selectKnapsack(candidates []*coinCandidate, target int64, minChange int64, rng *rand.Rand) []*coinCandidate {
+	shuffled := slices.Clone(candidates)
+	rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	var lowestLarger *coinCandidate
+	applicable := []*coinCandidate{}
+	var total int64
+	for _, candidate := range shuffled {
+		if candidate.effective == target {
+			return []*coinCandidate{candidate}
+		}
+		if candidate.effective < target+minChange {
+			applicable = append(applicable, candidate)
+			total += candidate.effective
+		} else if lowestLarger == nil || candidate.effective < lowestLarger.effective {
+			lowestLarger = candidate
+		}
+	}
+	if total == target {
+		return applicable
+	}
+	if total < target {
+		if lowestLarger == nil {
+			return nil
+		}
+		return []*coinCandidate{lowestLarger}
+	}
+	applicable = sortByEffective(applicable)
+	best, bestValue := approximateBestSubset(applicable, total, target, rng)
+	if bestValue != target && total >= target+minChange {
+		best, bestValue = approximateBestSubset(applicable, total, target+minChange, rng)
+	}
+	if lowestLarger != nil &&
+		((bestValue != target && bestValue < target+minChange) || lowestLarger.effective <= bestValue) {
+		return []*coinCandidate{lowestLarger}
+	}
+	result := []*coinCandidate{}
+	for index, included := range best {
+		if included {
+			result = append(result, applicable[index])
+		}
+	}
+	return result
+}
+
+// Adds candidates in order until goal is reached, settling for
+// target when the candidates run out
+func selectInOrder(candidates []*coinCandidate, target int64, goal int64) []*coinCandidate {
+	var value int64
+	for index, candidate := range candidates {
+		value += candidate.effective
+		if value >= goal {
+			return candidates[:index+1]
+		}
+	}
+	if value >= target {
+		return candidates
+	}
+	return nil
+}
+
+func selectLargestFirst(candidates []*coinCandidate, target int64, goal int64) []*coinCandidate {
+	return selectInOrder(sortByEffective(candidates), target, goal)
+}
+
+func selectSingleRandomDraw(candidates []*coinCandidate, target int64, goal int64, rng *rand.Rand) []*coinCandidate {
+	shuffled := slices.Clone(candidates)
+	rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return selectInOrder(shuffled, target, goal)
+}
@@ -0,0 +1,622 @@
+package bitcoinlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Opcodes that can be written by name in the Bitcoin Core test notation,
+// with and without the OP_ prefix
+func opcodeByName(name string) (byte, bool) {
+	for opcode, opName := range OP_CODE_NAMES {
+		if opcode < 97 && opcode != 80 {
+			// Numbers and pushes are written as such
+			continue
+		}
+		if name == opName || "OP_"+name == opName {
+			return byte(opcode), true
+		}
+	}
+	return 0, false
+}
+
+func isDecimal(word string) bool {
+	digits := strings.TrimPrefix(word, "-")
+	if digits == "" {
+		return false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Shortest script pushing the number
+func pushNumber(n int64) []byte {
+	switch {
+	case n == 0:
+		return []byte{0}
+	case n == -1:
+		return []byte{79}
+	case n >= 1 && n <= 16:
+		return []byte{byte(80 + n)}
+	}
+	return serializeScriptToBytes([]Operation{&ScriptVal{encodeNum(FromInt(int(n)))}})
+}
+
+// Parses the script notation of the Bitcoin Core test vectors: decimal
+// numbers, 0x prefixed raw bytes inserted as they are, 'quoted' strings
+// and opcode names with or without the OP_ prefix
+func ParseCoreScript(notation string) ([]byte, error) {
+	script := []byte{}
+	for _, word := range strings.Fields(notation) {
+		switch {
+		case isDecimal(word):
+			n, err := strconv.ParseInt(word, 10, 64)
+			if err != nil || n > 0xffffffff || n < -0xffffffff {
+				return nil, fmt.Errorf("invalid number %s", word)
+			}
+			script = append(script, pushNumber(n)...)
+		case strings.HasPrefix(word, "0x") && len(word) > 2:
+			raw, err := hex.DecodeString(word[2:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid hex %s", word)
+			}
+			script = append(script, raw...)
+		case len(word) >= 2 && word[0] == '\'' && word[len(word)-1] == '\'':
+			data := []byte(word[1 : len(word)-1])
+			script = append(script, serializeScriptToBytes([]Operation{&ScriptVal{data}})...)
+		default:
+			opcode, ok := opcodeByName(word)
+			if !ok {
+				return nil, fmt.Errorf("unknown opcode %s", word)
+			}
+			script = append(script, opcode)
+		}
+	}
+	return script, nil
+}
+
+// Builds the transactions of the Bitcoin Core script tests: the
+// scriptPubKey is the only output of a crediting transaction, spent by the
+// only input of a transaction with the scriptSig and witness. Returns the
+// spending transaction and a provider with the credited output
+func scriptTestTransaction(scriptSig []byte, scriptPubKey []byte, witness [][]byte, amount uint64) (*Transaction, *MemoryProvider, error) {
+	// The crediting transaction has a null prevout and OP_0 OP_0 as scriptSig
+	credit := binary.LittleEndian.AppendUint32(nil, 1)
+	credit = append(credit, 1)
+	credit = append(credit, make([]byte, 32)...)
+	credit = binary.LittleEndian.AppendUint32(credit, 0xffffffff)
+	credit = append(credit, 2, 0, 0)
+	credit = binary.LittleEndian.AppendUint32(credit, SEQUENCE_FINAL)
+	credit = append(credit, 1)
+	credit = binary.LittleEndian.AppendUint64(credit, amount)
+	credit = append(credit, EncodeVarInt(uint64(len(scriptPubKey)))...)
+	credit = append(credit, scriptPubKey...)
+	credit = binary.LittleEndian.AppendUint32(credit, 0)
+	creditTx, err := ParseTransaction(bytes.NewReader(credit))
+	if err != nil {
+		return nil, nil, err
+	}
+	// The id comes from the raw bytes, as parsing doesn't keep how the
+	// scripts were pushed
+	creditHash := Hash256(credit)
+
+	spend := binary.LittleEndian.AppendUint32(nil, 1)
+	if len(witness) > 0 {
+		spend = append(spend, 0, 1)
+	}
+	spend = append(spend, 1)
+	spend = append(spend, creditHash...)
+	spend = binary.LittleEndian.AppendUint32(spend, 0)
+	spend = append(spend, EncodeVarInt(uint64(len(scriptSig)))...)
+	spend = append(spend, scriptSig...)
+	spend = binary.LittleEndian.AppendUint32(spend, SEQUENCE_FINAL)
+	spend = append(spend, 1)
+	spend = binary.LittleEndian.AppendUint64(spend, amount)
+	spend = append(spend, 0)
+	if len(witness) > 0 {
+		spend = append(spend, EncodeVarInt(uint64(len(witness)))...)
+		for _, item := range witness {
+			spend = append(spend, EncodeVarInt(uint64(len(item)))...)
+			spend = append(spend, item...)
+		}
+	}
+	spend = binary.LittleEndian.AppendUint32(spend, 0)
+	spendTx, err := ParseTransaction(bytes.NewReader(spend))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	slices.Reverse(creditHash)
+	provider := NewMemoryProvider()
+	provider.Add(hex.EncodeToString(creditHash), 0, creditTx.outputs[0])
+	return spendTx, provider, nil
+}
+
+// Verifies the scripts the way the Bitcoin Core script tests do. Scripts
+// that can't be parsed are invalid
+func VerifyScripts(scriptSig []byte, scriptPubKey []byte, witness [][]byte, amount uint64, flags ScriptFlags) bool {
+	return ValidateScripts(scriptSig, scriptPubKey, witness, amount, flags) == nil
+}
+
+// Verifies the scripts like VerifyScripts, returning the error they fail
+// with. Scripts that can't be parsed fail with SCRIPT_ERR_BAD_OPCODE
+func ValidateScripts(scriptSig []byte, scriptPubKey []byte, witness [][]byte, amount uint64, flags ScriptFlags) error {
+	tx, provider, err := scriptTestTransaction(scriptSig, scriptPubKey, witness, amount)
+	if err != nil {
+		return SCRIPT_ERR_BAD_OPCODE
+	}
+	return tx.ValidateInput(0, provider, flags)
+}
+
+// A vector of Bitcoin Core's script_tests.json
+type ScriptTest struct {
+	Witness      [][]byte
+	Amount       uint64
+	ScriptSig    string
+	ScriptPubKey string
+	Flags        string
+	Expected     string // OK or the expected script error
+	Comment      string
+}
+
+// Parses the vectors of a script_tests.json file, skipping comments
+func ParseScriptTests(from io.Reader) ([]*ScriptTest, error) {
+	var entries [][]json.RawMessage
+	if err := json.NewDecoder(from).Decode(&entries); err != nil {
+		return nil, err
+	}
+	tests := []*ScriptTest{}
+	for index, entry := range entries {
+		if len(entry) == 1 {
+			continue
+		}
+		test := &ScriptTest{}
+		if len(entry) > 0 && bytes.HasPrefix(bytes.TrimSpace(entry[0]), []byte("[")) {
+			if err := test.parseWitness(entry[0]); err != nil {
+				return nil, fmt.Errorf("entry %d: %w", index, err)
+			}
+			entry = entry[1:]
+		}
+		if len(entry) < 4 || len(entry) > 5 {
+			return nil, fmt.Errorf("entry %d: invalid number of fields", index)
+		}
+		fields := []*string{&test.ScriptSig, &test.ScriptPubKey, &test.Flags, &test.Expected, &test.Comment}
+		for i, raw := range entry {
+			if err := json.Unmarshal(raw, fields[i]); err != nil {
+				return nil, fmt.Errorf("entry %d: %w", index, err)
+			}
+		}
+		tests = append(tests, test)
+	}
+	return tests, nil
+}
+
+// The witness is a list of hex items followed by the amount in BTC
+func (t *ScriptTest) parseWitness(raw json.RawMessage) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return errors.New("witness without amount")
+	}
+	var amount float64
+	if err := json.Unmarshal(items[len(items)-1], &amount); err != nil {
+		return err
+	}
+	t.Amount = uint64(math.Round(amount * 1e8))
+	for _, item := range items[:len(items)-1] {
+		var encoded string
+		if err := json.Unmarshal(item, &encoded); err != nil {
+			return err
+		}
+		decoded, err := hex.DecodeString(encoded)
+		if err != nil {
+			return err
+		}
+		t.Witness = append(t.Witness, decoded)
+	}
+	return nil
+}
+
+// Whether the interpreter implements every flag of the vector
+func (t *ScriptTest) Supported() bool {
+	_, err := ParseScriptFlags(t.Flags)
+	return err == nil
+}
+
+// Runs the vector, returning an error when the scripts don't fail with
+// the expected script error
+func (t *ScriptTest) Run() error {
+	flags, err := ParseScriptFlags(t.Flags)
+	if err != nil {
+		return err
+	}
+	scriptSig, err := ParseCoreScript(t.ScriptSig)
+	if err != nil {
+		return fmt.Errorf("scriptSig: %w", err)
+	}
+	scriptPubKey, err := ParseCoreScript(t.ScriptPubKey)
+	if err != nil {
+		return fmt.Errorf("scriptPubKey: %w", err)
+	}
+	err = ValidateScripts(scriptSig, scriptPubKey, t.Witness, t.Amount, flags)
+	if got := ScriptErrorCodeOf(err).String(); got != t.Expected {
+		return fmt.Errorf("expected %s, got %s: %v", t.Expected, got, err)
+	}
+	return nil
+}
+
+// Output spent by a vector of tx_valid.json or tx_invalid.json
+type TxTestPrevout struct {
+	TxId         string
+	Index        uint32
+	ScriptPubKey string
+	Amount       uint64
+}
+
+// Flags of the tx_invalid.json vectors failing Bitcoin Core's
+// CheckTransaction instead of the script verification
+const BAD_TX_FLAGS = "BADTX"
+
+// A vector of Bitcoin Core's tx_valid.json or tx_invalid.json. Flags are
+// the ones the verification uses, or the ones it excludes when Excluded.
+// Files since Bitcoin Core 0.21 exclude the flags of valid transactions
+type TxTest struct {
+	Prevouts []*TxTestPrevout
+	Tx       string
+	Flags    string
+	Excluded bool
+	Valid    bool
+	Comment  string
+}
+
+// Parses the vectors of a tx_valid.json or tx_invalid.json file. The
+// comments preceding a vector become its comment, the ones describing
+// the format tell whether the flags are excluded
+func ParseTxTests(from io.Reader, valid bool) ([]*TxTest, error) {
+	var entries [][]json.RawMessage
+	if err := json.NewDecoder(from).Decode(&entries); err != nil {
+		return nil, err
+	}
+	tests := []*TxTest{}
+	comments := []string{}
+	excluded := false
+	for index, entry := range entries {
+		if len(entry) == 1 {
+			var comment string
+			if err := json.Unmarshal(entry[0], &comment); err == nil {
+				comments = append(comments, comment)
+				excluded = excluded || (valid && strings.Contains(comment, "excluded verifyFlags"))
+			}
+			continue
+		}
+		if len(entry) != 3 {
+			return nil, fmt.Errorf("entry %d: invalid number of fields", index)
+		}
+		test := &TxTest{Excluded: excluded, Valid: valid, Comment: strings.Join(comments, " ")}
+		comments = []string{}
+		var prevouts [][]json.RawMessage
+		if err := json.Unmarshal(entry[0], &prevouts); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", index, err)
+		}
+		for _, fields := range prevouts {
+			prevout, err := parseTxTestPrevout(fields)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: %w", index, err)
+			}
+			test.Prevouts = append(test.Prevouts, prevout)
+		}
+		if err := json.Unmarshal(entry[1], &test.Tx); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", index, err)
+		}
+		if err := json.Unmarshal(entry[2], &test.Flags); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", index, err)
+		}
+		tests = append(tests, test)
+	}
+	return tests, nil
+}
+
+// Prevouts are [txid, index, scriptPubKey] with an optional amount, and
+// an index of -1 for null prevouts
+func parseTxTestPrevout(fields []json.RawMessage) (*TxTestPrevout, error) {
+	if len(fields) < 3 || len(fields) > 4 {
+		return nil, errors.New("invalid prevout")
+	}
+	prevout := &TxTestPrevout{}
+	var index int64
+	if err := json.Unmarshal(fields[0], &prevout.TxId); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(fields[1], &index); err != nil {
+		return nil, err
+	}
+	prevout.Index = uint32(index)
+	if err := json.Unmarshal(fields[2], &prevout.ScriptPubKey); err != nil {
+		return nil, err
+	}
+	if len(fields) == 4 {
+		if err := json.Unmarshal(fields[3], &prevout.Amount); err != nil {
+			return nil, err
+		}
+	}
+	return prevout, nil
+}
+
+// Union of every supported flag
+func allScriptFlags() ScriptFlags {
+	flags := SCRIPT_VERIFY_NONE
+	for _, flag := range SCRIPT_FLAG_NAMES {
+		flags |= flag
+	}
+	return flags
+}
+
+// Whether the interpreter implements every flag of the vector
+func (t *TxTest) Supported() bool {
+	_, err := ParseScriptFlags(t.Flags)
+	return err == nil || (!t.Valid && t.Flags == BAD_TX_FLAGS)
+}
+
+// Runs the vector, returning an error when a valid transaction fails to
+// verify or an invalid one verifies
+func (t *TxTest) Run() error {
+	raw, err := hex.DecodeString(t.Tx)
+	if err != nil {
+		return err
+	}
+	tx, err := ParseTransaction(bytes.NewReader(raw))
+	if err != nil {
+		if t.Valid {
+			return fmt.Errorf("parsing transaction: %w", err)
+		}
+		return nil
+	}
+	if err := tx.Check(); err != nil {
+		if t.Valid {
+			return err
+		}
+		return nil
+	}
+	if !t.Valid && t.Flags == BAD_TX_FLAGS {
+		return errors.New("transaction passed CheckTransaction")
+	}
+	flags, err := ParseScriptFlags(t.Flags)
+	if err != nil {
+		return err
+	}
+	if t.Excluded {
+		flags = allScriptFlags() &^ flags
+	}
+	provider := NewMemoryProvider()
+	for _, prevout := range t.Prevouts {
+		script, err := ParseCoreScript(prevout.ScriptPubKey)
+		if err != nil {
+			return fmt.Errorf("prevout %s:%d: %w", prevout.TxId, prevout.Index, err)
+		}
+		scriptPubKey, err := ParsePubKey(bytes.NewReader(append(EncodeVarInt(uint64(len(script))), script...)))
+		if err != nil {
+			// The input spending it can't be valid
+			continue
+		}
+		provider.Add(prevout.TxId, prevout.Index, NewOutput(prevout.Amount, scriptPubKey))
+	}
+	for input := range tx.inputs {
+		if !tx.VerifyInputWithFlags(input, provider, flags) {
+			if t.Valid {
+				return fmt.Errorf("input %d failed to verify", input)
+			}
+			return nil
+		}
+	}
+	if !t.Valid {
+		return errors.New("invalid transaction verified")
+	}
+	return nil
+}
+
+// A vector of Bitcoin Core's sighash.json, the legacy signature hash
+// of an input committing to Script
+type SigHashTest struct {
+	Tx       string
+	Script   string
+	Input    int
+	HashType SigHashType
+	Expected string // as printed by Bitcoin Core, byte reversed
+}
+
+// Parses the vectors of a sighash.json file, skipping the comments
+func ParseSigHashTests(from io.Reader) ([]*SigHashTest, error) {
+	var entries [][]json.RawMessage
+	if err := json.NewDecoder(from).Decode(&entries); err != nil {
+		return nil, err
+	}
+	tests := []*SigHashTest{}
+	for index, entry := range entries {
+		if len(entry) == 1 {
+			continue
+		}
+		if len(entry) != 5 {
+			return nil, fmt.Errorf("entry %d: invalid number of fields", index)
+		}
+		test := &SigHashTest{}
+		// The hash type is signed in Bitcoin Core
+		var hashType int32
+		for field, value := range []any{&test.Tx, &test.Script, &test.Input, &hashType, &test.Expected} {
+			if err := json.Unmarshal(entry[field], value); err != nil {
+				return nil, fmt.Errorf("entry %d: %w", index, err)
+			}
+		}
+		test.HashType = SigHashType(hashType)
+		tests = append(tests, test)
+	}
+	return tests, nil
+}
+
+// Runs the vector, returning an error when the hash differs
+func (t *SigHashTest) Run() error {
+	raw, err := hex.DecodeString(t.Tx)
+	if err != nil {
+		return err
+	}
+	tx, err := ParseTransaction(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	script, err := hex.DecodeString(t.Script)
+	if err != nil {
+		return err
+	}
+	hash, err := tx.legacySigHash(t.Input, script, t.HashType)
+	if err != nil {
+		return err
+	}
+	slices.Reverse(hash)
+	if hex.EncodeToString(hash) != t.Expected {
+		return fmt.Errorf("expected %s, got %x", t.Expected, hash)
+	}
+	return nil
+}
+
+// A key path spend of the keyPathSpending vectors of BIP341's
+// wallet-test-vectors.json, with the outputs spent by every input of
+// the transaction
+type TaprootKeyPathTest struct {
+	Tx              string
+	Prevouts        []*Output
+	Input           int
+	InternalPrivkey string
+	MerkleRoot      string // empty without script path
+	HashType        SigHashType
+	TweakedPrivkey  string
+	SigHash         string
+	Witness         []string
+}
+
+// Parses the keyPathSpending vectors of a BIP341 wallet-test-vectors.json
+// file, one for each input spent
+func ParseTaprootKeyPathTests(from io.Reader) ([]*TaprootKeyPathTest, error) {
+	var file struct {
+		KeyPathSpending []struct {
+			Given struct {
+				RawUnsignedTx string
+				UtxosSpent    []struct {
+					ScriptPubKey string
+					AmountSats   uint64
+				}
+			}
+			InputSpending []struct {
+				Given struct {
+					TxinIndex       int
+					InternalPrivkey string
+					MerkleRoot      string
+					HashType        SigHashType
+				}
+				Intermediary struct {
+					TweakedPrivkey string
+					SigHash        string
+				}
+				Expected struct {
+					Witness []string
+				}
+			}
+		}
+	}
+	if err := json.NewDecoder(from).Decode(&file); err != nil {
+		return nil, err
+	}
+	tests := []*TaprootKeyPathTest{}
+	for index, spending := range file.KeyPathSpending {
+		prevouts := []*Output{}
+		for _, utxo := range spending.Given.UtxosSpent {
+			script, err := hex.DecodeString(utxo.ScriptPubKey)
+			if err != nil {
+				return nil, fmt.Errorf("vector %d: %w", index, err)
+			}
+			scriptPubKey, err := ParsePubKey(bytes.NewReader(append(EncodeVarInt(uint64(len(script))), script...)))
+			if err != nil {
+				return nil, fmt.Errorf("vector %d: %w", index, err)
+			}
+			prevouts = append(prevouts, NewOutput(utxo.AmountSats, scriptPubKey))
+		}
+		for _, input := range spending.InputSpending {
+			tests = append(tests, &TaprootKeyPathTest{
+				Tx:              spending.Given.RawUnsignedTx,
+				Prevouts:        prevouts,
+				Input:           input.Given.TxinIndex,
+				InternalPrivkey: input.Given.InternalPrivkey,
+				MerkleRoot:      input.Given.MerkleRoot,
+				HashType:        input.Given.HashType,
+				TweakedPrivkey:  input.Intermediary.TweakedPrivkey,
+				SigHash:         input.Intermediary.SigHash,
+				Witness:         input.Expected.Witness,
+			})
+		}
+	}
+	return tests, nil
+}
+
+// Runs the vector, returning an error when the tweaked key or the
+// signature hash differ, or the expected witness doesn't verify
+func (t *TaprootKeyPathTest) Run() error {
+	raw, err := hex.DecodeString(t.Tx)
+	if err != nil {
+		return err
+	}
+	tx, err := ParseTransaction(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	if len(t.Prevouts) != len(tx.inputs) || t.Input >= len(tx.inputs) {
+		return errors.New("the outputs spent don't match the inputs")
+	}
+	provider := NewMemoryProvider()
+	for index, in := range tx.inputs {
+		provider.Add(in.previousID, in.previousIndex, t.Prevouts[index])
+	}
+	merkleRoot, err := hex.DecodeString(t.MerkleRoot)
+	if err != nil {
+		return err
+	}
+	if len(merkleRoot) == 0 {
+		merkleRoot = nil
+	}
+	tweaked, err := NewPrivateKey(FromHexString("0x" + t.InternalPrivkey)).TaprootTweak(merkleRoot)
+	if err != nil {
+		return err
+	}
+	if key := tweaked.e.IntoBytes(); hex.EncodeToString(key[:]) != t.TweakedPrivkey {
+		return fmt.Errorf("expected tweaked key %s, got %x", t.TweakedPrivkey, key)
+	}
+	hash, err := tx.SigHashTaproot(t.Input, provider, t.HashType, nil)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash) != t.SigHash {
+		return fmt.Errorf("expected sighash %s, got %x", t.SigHash, hash)
+	}
+	tx.inputs[t.Input].items = nil
+	for _, encoded := range t.Witness {
+		item, err := hex.DecodeString(encoded)
+		if err != nil {
+			return err
+		}
+		tx.inputs[t.Input].items = append(tx.inputs[t.Input].items, item)
+	}
+	tx.segwit = true
+	return tx.ValidateInput(t.Input, provider, SCRIPT_VERIFY_CONSENSUS)
+}
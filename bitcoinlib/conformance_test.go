@@ -0,0 +1,215 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Categories of the known failures, skipped with it as the reason
+const (
+	FAILURE_LARGE_DECIMAL      = "Decimal numbers outside the range Bitcoin Core's ParseScript accepts since 0.21"
+	FAILURE_MULTIPLE_ELSE      = "Multiple ELSE in a conditional"
+	FAILURE_SPANNING_SCRIPTS   = "Conditionals and the altstack spanning scriptSig and scriptPubKey"
+	FAILURE_UNEXECUTED_OPCODES = "VERIF, VERNOTIF and the disabled opcodes fail even in unexecuted branches"
+	FAILURE_EMPTY_SIZE         = "SIZE of an empty element pushed by OP_0"
+	FAILURE_ARITHMETIC         = "ABS doesn't push its result, and BOOLAND, BOOLOR and ABS of -1"
+	FAILURE_RIPEMD160          = "RIPEMD160 computes HASH160"
+	FAILURE_LIMITS             = "Limits on pushes, stack size, script size and opcode count"
+	FAILURE_EMPTY_WITNESS      = "P2WPKH spent with an empty witness"
+	FAILURE_WITNESS_PUSH_SIZE  = "Pushes of 520 bytes in a witness"
+)
+
+// The vectors in testdata are Bitcoin Core's script_tests.json,
+// tx_valid.json and tx_invalid.json as vendored by btcd v0.22.1 (MIT),
+// where the flags of valid transactions are the ones to verify with.
+// Vectors the interpreter doesn't pass yet are listed by the start of
+// the SHA-256 of their content with their category, and skipped. Vectors
+// with flags the interpreter doesn't implement are skipped too
+var knownConformanceFailures = map[string]string{
+	"81ed7fa17bed8566": FAILURE_LARGE_DECIMAL,      // ["549755813887", "SIZE 5 EQUAL", "P2SH,STRICTENC", "OK"]
+	"2d5cb20389d03018": FAILURE_LARGE_DECIMAL,      // ["549755813888", "SIZE 6 EQUAL", "P2SH,STRICTENC", "OK"]
+	"6e834d596b0d3b9a": FAILURE_LARGE_DECIMAL,      // ["9223372036854775807", "SIZE 8 EQUAL", "P2SH,STRICTENC", "OK"]
+	"86aa4a87b37f4d59": FAILURE_LARGE_DECIMAL,      // ["-549755813887", "SIZE 5 EQUAL", "P2SH,STRICTENC", "OK"]
+	"bed7b9a4ccf05b38": FAILURE_LARGE_DECIMAL,      // ["-549755813888", "SIZE 6 EQUAL", "P2SH,STRICTENC", "OK"]
+	"edf2bb1b0e334ed9": FAILURE_LARGE_DECIMAL,      // ["-9223372036854775807", "SIZE 8 EQUAL", "P2SH,STRICTENC", "OK"]
+	"81d51cc2e3f24c20": FAILURE_LARGE_DECIMAL,      // ["549755813887", "0x05 0xFFFFFFFF7F EQUAL", "P2SH,STRICTENC", "OK"]
+	"84c662d27a5db980": FAILURE_LARGE_DECIMAL,      // ["549755813888", "0x06 0xFFFFFFFF7F EQUAL", "P2SH,STRICTENC", "OK"]
+	"56761f409ffa8a03": FAILURE_LARGE_DECIMAL,      // ["9223372036854775807", "0x08 0xFFFFFFFFFFFFFF7F EQUAL", "P2SH,STRICT...
+	"945ba7263c8da3bb": FAILURE_LARGE_DECIMAL,      // ["-549755813887", "0x05 0xFFFFFFFFFF EQUAL", "P2SH,STRICTENC", "OK"]
+	"0290dec8b68c3308": FAILURE_LARGE_DECIMAL,      // ["-549755813888", "0x06 0x000000008080 EQUAL", "P2SH,STRICTENC", "OK"]
+	"67c961159b56a5bd": FAILURE_LARGE_DECIMAL,      // ["-9223372036854775807", "0x08 0xFFFFFFFFFFFFFFFF EQUAL", "P2SH,STRIC...
+	"e5268a310bc4beca": FAILURE_LARGE_DECIMAL,      // ["4294967296", "CHECKSEQUENCEVERIFY", "CHECKSEQUENCEVERIFY", "UNSATIS...
+	"98e4007f6778e8b8": FAILURE_LARGE_DECIMAL,      // tx_valid.json d1edbcde44691e98a7b7f556bd04966091302e29ad9af3c2baac382...
+	"856aa0d9d90535ea": FAILURE_LARGE_DECIMAL,      // tx_valid.json 01a86c65460325dc6699714d26df512a62a854a669f6ed2e6f369a2...
+	"f2eaf49c85de1fd4": FAILURE_LARGE_DECIMAL,      // tx_valid.json c9dda3a24cc8a5acb153d1085ecd2fecf6f87083122f8cdecc515b1...
+	"2abf7cfe096aebd3": FAILURE_LARGE_DECIMAL,      // tx_invalid.json 5f99c0abf511294d76cbe144d86b77238a03e086974bc7a8ea0bd...
+	"64edc01b9501e0c2": FAILURE_MULTIPLE_ELSE,      // ["0", "IF 0 ELSE 1 ELSE 0 ENDIF", "P2SH,STRICTENC", "OK"]
+	"7c9e6ae6d1528ab3": FAILURE_MULTIPLE_ELSE,      // ["1", "IF ELSE 0 ELSE 1 ENDIF", "P2SH,STRICTENC", "OK"]
+	"8f8c3e0c5cb2a92a": FAILURE_MULTIPLE_ELSE,      // ["1", "IF 1 ELSE 0 ELSE 1 ENDIF ADD 2 EQUAL", "P2SH,STRICTENC", "OK"]
+	"f103ee088266c346": FAILURE_MULTIPLE_ELSE,      // ["'' 1", "IF SHA1 ELSE ELSE SHA1 ELSE ELSE SHA1 ELSE ELSE SHA1 ELSE E...
+	"40a797c591bb5767": FAILURE_MULTIPLE_ELSE,      // ["1", "NOTIF 0 ELSE 1 ELSE 0 ENDIF", "P2SH,STRICTENC", "OK"]
+	"7ca91af57131b9f2": FAILURE_MULTIPLE_ELSE,      // ["0", "NOTIF ELSE 0 ELSE 1 ENDIF", "P2SH,STRICTENC", "OK"]
+	"e693691d85018987": FAILURE_MULTIPLE_ELSE,      // ["0", "NOTIF 1 ELSE 0 ELSE 1 ENDIF ADD 2 EQUAL", "P2SH,STRICTENC", "OK"]
+	"f7fd082e4ed5a569": FAILURE_MULTIPLE_ELSE,      // ["'' 0", "NOTIF SHA1 ELSE ELSE SHA1 ELSE ELSE SHA1 ELSE ELSE SHA1 ELS...
+	"bb67e0b40b0a7387": FAILURE_MULTIPLE_ELSE,      // ["0", "IF 1 IF RETURN ELSE RETURN ELSE RETURN ENDIF ELSE 1 IF 1 ELSE ...
+	"150eccd7192c0369": FAILURE_MULTIPLE_ELSE,      // ["1", "NOTIF 0 NOTIF RETURN ELSE RETURN ELSE RETURN ENDIF ELSE 0 NOTI...
+	"1229647364383f43": FAILURE_MULTIPLE_ELSE,      // ["1", "IF 1 ELSE ELSE RETURN ENDIF", "P2SH,STRICTENC", "OP_RETURN"]
+	"a5ef4076b9a2dd43": FAILURE_SPANNING_SCRIPTS,   // ["1 IF", "1 ENDIF", "P2SH,STRICTENC", "UNBALANCED_CONDITIONAL"]
+	"8b1fae37b28ac600": FAILURE_SPANNING_SCRIPTS,   // ["0 IF", "RETURN ENDIF 1", "P2SH,STRICTENC", "UNBALANCED_CONDITIONAL"]
+	"26c2bb75b09001ae": FAILURE_SPANNING_SCRIPTS,   // ["1 TOALTSTACK", "FROMALTSTACK 1", "P2SH,STRICTENC", "INVALID_ALTSTAC...
+	"f846a040bd50eb7f": FAILURE_SPANNING_SCRIPTS,   // ["1 IF 1 ELSE", "0xff ENDIF", "P2SH,STRICTENC", "UNBALANCED_CONDITION...
+	"2d0d878cedf46b08": FAILURE_SPANNING_SCRIPTS,   // ["1 2 3 4 5 0x6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6...
+	"57f8bad12bc71c56": FAILURE_SPANNING_SCRIPTS,   // ["1 IF 1", "ENDIF", "P2SH,STRICTENC", "UNBALANCED_CONDITIONAL"]
+	"2ad7964602a73d97": FAILURE_UNEXECUTED_OPCODES, // ["0", "IF VERIF ELSE 1 ENDIF", "P2SH,STRICTENC", "BAD_OPCODE"]
+	"6ee5e215287e460a": FAILURE_UNEXECUTED_OPCODES, // ["0", "IF VERNOTIF ELSE 1 ENDIF", "P2SH,STRICTENC", "BAD_OPCODE"]
+	"068b569a3da45d38": FAILURE_UNEXECUTED_OPCODES, // ["'a' 'b' 0", "IF CAT ELSE 1 ENDIF", "P2SH,STRICTENC", "DISABLED_OPCO...
+	"a72a1fd047fb3889": FAILURE_UNEXECUTED_OPCODES, // ["'abc' 1 1 0", "IF SUBSTR ELSE 1 ENDIF", "P2SH,STRICTENC", "DISABLED...
+	"32940caa1a1f9c02": FAILURE_UNEXECUTED_OPCODES, // ["'abc' 2 0", "IF LEFT ELSE 1 ENDIF", "P2SH,STRICTENC", "DISABLED_OPC...
+	"4903545b28189210": FAILURE_UNEXECUTED_OPCODES, // ["'abc' 2 0", "IF RIGHT ELSE 1 ENDIF", "P2SH,STRICTENC", "DISABLED_OP...
+	"41464931b17d2a0a": FAILURE_UNEXECUTED_OPCODES, // ["1 2 0 IF AND ELSE 1 ENDIF", "NOP", "P2SH,STRICTENC", "DISABLED_OPCO...
+	"7e9763ac31ae5bf8": FAILURE_UNEXECUTED_OPCODES, // ["1 2 0 IF OR ELSE 1 ENDIF", "NOP", "P2SH,STRICTENC", "DISABLED_OPCODE"]
+	"adb4af280c8de065": FAILURE_UNEXECUTED_OPCODES, // ["1 2 0 IF XOR ELSE 1 ENDIF", "NOP", "P2SH,STRICTENC", "DISABLED_OPCO...
+	"04a5c70ac3d1af48": FAILURE_UNEXECUTED_OPCODES, // ["2 0 IF 2MUL ELSE 1 ENDIF", "NOP", "P2SH,STRICTENC", "DISABLED_OPCODE"]
+	"2cde04d1a5f17779": FAILURE_UNEXECUTED_OPCODES, // ["2 0 IF 2DIV ELSE 1 ENDIF", "NOP", "P2SH,STRICTENC", "DISABLED_OPCODE"]
+	"92737e366a54292a": FAILURE_UNEXECUTED_OPCODES, // ["2 2 0 IF MUL ELSE 1 ENDIF", "NOP", "P2SH,STRICTENC", "DISABLED_OPCO...
+	"9ee15df1e4f2e4da": FAILURE_UNEXECUTED_OPCODES, // ["2 2 0 IF DIV ELSE 1 ENDIF", "NOP", "P2SH,STRICTENC", "DISABLED_OPCO...
+	"c0f45960dbdf8085": FAILURE_UNEXECUTED_OPCODES, // ["2 2 0 IF MOD ELSE 1 ENDIF", "NOP", "P2SH,STRICTENC", "DISABLED_OPCO...
+	"aed9161df3cb92a5": FAILURE_UNEXECUTED_OPCODES, // ["2 2 0 IF LSHIFT ELSE 1 ENDIF", "NOP", "P2SH,STRICTENC", "DISABLED_O...
+	"86301d4c1cd935fd": FAILURE_UNEXECUTED_OPCODES, // ["2 2 0 IF RSHIFT ELSE 1 ENDIF", "NOP", "P2SH,STRICTENC", "DISABLED_O...
+	"5acf9145f4f2bace": FAILURE_UNEXECUTED_OPCODES, // ["2 DUP MUL", "4 EQUAL", "P2SH,STRICTENC", "DISABLED_OPCODE"]
+	"9b1c95793dc729d5": FAILURE_UNEXECUTED_OPCODES, // ["1", "NOP NOP NOP NOP NOP NOP NOP NOP NOP NOP NOP NOP NOP 0 0 'a' 'b...
+	"af7b8faeac1c1d43": FAILURE_EMPTY_SIZE,         // ["0", "SIZE 0 EQUAL", "P2SH,STRICTENC", "OK"]
+	"8fb8fd7a8b8a6bd7": FAILURE_EMPTY_SIZE,         // ["0x00", "SIZE 0 EQUAL", "P2SH,STRICTENC", "OK"]
+	"e5b055dc6373375a": FAILURE_ARITHMETIC,         // ["0x02 0x0000", "ABS DROP 1", "", "OK"]
+	"30e09ddde0126afd": FAILURE_ARITHMETIC,         // ["0 ABS", "0 EQUAL", "P2SH,STRICTENC", "OK"]
+	"0e4204aad7778cde": FAILURE_ARITHMETIC,         // ["16 ABS", "16 EQUAL", "P2SH,STRICTENC", "OK"]
+	"762f520e89ba4a9e": FAILURE_ARITHMETIC,         // ["-16 ABS", "-16 NEGATE EQUAL", "P2SH,STRICTENC", "OK"]
+	"0f901188d0c3153b": FAILURE_ARITHMETIC,         // ["-1", "ABS", "P2SH,STRICTENC", "OK"]
+	"7e5487b88aa352dc": FAILURE_ARITHMETIC,         // ["-1 -1", "BOOLAND", "P2SH,STRICTENC", "OK"]
+	"f94b6c176039a891": FAILURE_ARITHMETIC,         // ["-1 0", "BOOLOR", "P2SH,STRICTENC", "OK"]
+	"b41c269864e61607": FAILURE_RIPEMD160,          // ["''", "RIPEMD160 0x14 0x9c1185a5c5e9fc54612808977ee8f548b2258d31 EQU...
+	"e18a275077f34a5c": FAILURE_RIPEMD160,          // ["'a'", "RIPEMD160 0x14 0x0bdc9d2d256b3ee9daae347be6f4dc835a467ffe EQ...
+	"99bd57690b06717b": FAILURE_RIPEMD160,          // ["'abcdefghijklmnopqrstuvwxyz'", "RIPEMD160 0x14 0xf71c27109c692c1b56...
+	"65b885f0f65e7e11": FAILURE_RIPEMD160,          // ["''", "DUP HASH160 SWAP SHA256 RIPEMD160 EQUAL", "P2SH,STRICTENC", "...
+	"e8d5169f80a0a2b2": FAILURE_LIMITS,             // ["NOP", "'bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb...
+	"2b4a4dcc5aae15d8": FAILURE_LIMITS,             // ["0", "IF 'bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb...
+	"bb2862960b01e9c6": FAILURE_LIMITS,             // ["1", "0x616161616161616161616161616161616161616161616161616161616161...
+	"b83c3903f487acbc": FAILURE_LIMITS,             // ["0", "IF 0x616161616161616161616161616161616161616161616161616161616...
+	"764930d49f3513c1": FAILURE_LIMITS,             // ["1 2 3 4 5 0x6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6f6...
+	"0dd681144a1be07e": FAILURE_LIMITS,             // ["NOP", "0 'aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa...
+	"f1a6be1f6d0d4715": FAILURE_LIMITS,             // ["", "0 0 0 CHECKMULTISIG 0 0 CHECKMULTISIG 0 0 CHECKMULTISIG 0 0 CHE...
+	"02f78a0bc22c1f9d": FAILURE_LIMITS,             // ["", "NOP NOP NOP NOP NOP NOP NOP NOP NOP NOP NOP NOP NOP 0 0 'a' 'b'...
+	"6bdd7c1a6d18e0e4": FAILURE_EMPTY_WITNESS,      // ["", "0 0x14 0x91b24bf9f5288532960ac687abb035127b1d28a5", "P2SH,WITNE...
+	"59e415e341afc347": FAILURE_WITNESS_PUSH_SIZE,  // tx_valid.json d93ab9e12d7c29d2adc13d5cdf619d53eec1f36eb6612f55af52be7...
+}
+
+func conformanceKey(vector string) string {
+	hash := sha256.Sum256([]byte(vector))
+	return hex.EncodeToString(hash[:8])
+}
+
+func TestScriptConformance(t *testing.T) {
+	file, err := os.Open("testdata/script_tests.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	tests, err := bitcoinlib.ParseScriptTests(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for index, test := range tests {
+		t.Run(fmt.Sprintf("script_tests.json:%d", index), func(t *testing.T) {
+			if !test.Supported() {
+				t.Skipf("Unsupported flags %s", test.Flags)
+			}
+			checkConformance(t, fmt.Sprintf("[%q, %q, %q, %q]", test.ScriptSig, test.ScriptPubKey, test.Flags, test.Expected), test.Run())
+		})
+	}
+}
+
+func TestTxConformance(t *testing.T) {
+	for _, vector := range []struct {
+		name  string
+		valid bool
+	}{
+		{"tx_valid.json", true},
+		{"tx_invalid.json", false},
+	} {
+		file, err := os.Open("testdata/" + vector.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests, err := bitcoinlib.ParseTxTests(file, vector.valid)
+		file.Close()
+		if err != nil {
+			t.Fatalf("Failed parsing %s: %s", vector.name, err)
+		}
+		for index, test := range tests {
+			t.Run(fmt.Sprintf("%s:%d", vector.name, index), func(t *testing.T) {
+				if !test.Supported() {
+					t.Skipf("Unsupported flags %s", test.Flags)
+				}
+				checkConformance(t, txConformanceVector(vector.name, test), test.Run())
+			})
+		}
+	}
+}
+
+// Vectors share transactions, they are told apart by the id of their
+// transaction, which is the raw hex when it can't be parsed, their flags
+// and the scripts they spend
+func txConformanceVector(name string, test *bitcoinlib.TxTest) string {
+	id := test.Tx
+	raw, _ := hex.DecodeString(test.Tx)
+	if tx, err := bitcoinlib.ParseTransaction(bytes.NewReader(raw)); err == nil {
+		id = tx.Id()
+	}
+	scripts := []string{}
+	for _, prevout := range test.Prevouts {
+		scripts = append(scripts, prevout.ScriptPubKey)
+	}
+	return fmt.Sprintf("%s %s %s [%s]", name, id, test.Flags, strings.Join(scripts, ", "))
+}
+
+func checkConformance(t *testing.T, vector string, err error) {
+	if category, ok := knownConformanceFailures[conformanceKey(vector)]; ok {
+		if err == nil {
+			t.Fatalf("%s passes and has to be removed from the known failures", conformanceKey(vector))
+		}
+		t.Skipf("%s: %s", category, err)
+	}
+	if err != nil {
+		t.Fatalf("%s: %s\n%s", conformanceKey(vector), err, vector)
+	}
+}
+
+func TestParseCoreScript(t *testing.T) {
+	vectors := []struct {
+		notation string
+		expected string
+	}{
+		{"0 1 16 -1 17", "005160 4f0111"},
+		{"DUP HASH160 0x14 0x0102030405060708090a0b0c0d0e0f1011121314 EQUALVERIFY OP_CHECKSIG", "76a9140102030405060708090a0b0c0d0e0f1011121314 88ac"},
+		{"'Az' NOP10 0x4c 0x00", "02417a b9 4c00"},
+		{"1000 -1000", "02e803 02e883"},
+	}
+	for index, vector := range vectors {
+		script, err := bitcoinlib.ParseCoreScript(vector.notation)
+		expected := strings.ReplaceAll(vector.expected, " ", "")
+		if err != nil || hex.EncodeToString(script) != expected {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %x %v", index, expected, script, err)
+		}
+	}
+	for _, notation := range []string{"FOO", "0xzz", "4294967296"} {
+		if _, err := bitcoinlib.ParseCoreScript(notation); err == nil {
+			t.Fatalf("Parsed invalid notation %s", notation)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package bitcoinlib
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+// Rules signatures are checked with, depending on how the output is spent
+type SigVersion int
+
+const (
+	SIGVERSION_BASE SigVersion = iota
+	SIGVERSION_WITNESS_V0
+	SIGVERSION_TAPROOT
+	SIGVERSION_TAPSCRIPT
+)
+
+// Bitmask of the rules enforced when verifying scripts
+type ScriptFlags uint32
+
+// Everything the opcodes can see besides the stacks: the spending
+// transaction and input, the output it spends and the flags. The digest
+// of each sighash type is computed the first time a signature uses it
+type ExecutionContext struct {
+	tx           *Transaction
+	input        int
+	provider     PrevoutProvider
+	amount       uint64
+	scriptPubKey *ScriptPubKey
+	scriptCode   []byte
+	sigVersion   SigVersion
+	flags        ScriptFlags
+	leafHash     []byte // tapscript only
+	budget       int    // tapscript only
+	z            string // digest of every signature when there is no transaction
+	sighashes    map[SigHashType][]byte
+	trace        *Trace
+	branches     []branchFrame      // traced only
+	steps        int                // operations executed
+	nonMinimal   map[Operation]bool // scriptSig pushes failing MINIMALDATA
+	// OP_CODESEPARATORs of the script signatures commit to, and the
+	// number of its operations up to the last one executed
+	codeSeparators map[Operation]bool
+	separator      int
+}
+
+// Creates the context to verify the input of the transaction, fetching
+// the output it spends from the provider
+func NewExecutionContext(tx *Transaction, input int, provider PrevoutProvider, flags ScriptFlags) (*ExecutionContext, error) {
+	if input < 0 || input >= len(tx.inputs) {
+		return nil, errors.New("input index out of range")
+	}
+	prevout, err := tx.inputs[input].Prevout(provider)
+	if err != nil {
+		return nil, err
+	}
+	ctx := &ExecutionContext{
+		tx:           tx,
+		input:        input,
+		provider:     provider,
+		amount:       prevout.amount,
+		scriptPubKey: prevout.scriptPubKey,
+		flags:        flags,
+		sighashes:    map[SigHashType][]byte{},
+	}
+	pubKey := prevout.scriptPubKey
+	version, program, p2sh, isWitness := ctx.witnessProgram()
+	// Only inputs spending a witness program use BIP143, legacy inputs
+	// of a segwit transaction keep the old digest. Without the flags,
+	// witness programs are evaluated as legacy scripts
+	switch {
+	case pubKey.isP2TR() && flags.has(SCRIPT_VERIFY_TAPROOT):
+		ctx.sigVersion = SIGVERSION_TAPROOT
+	case flags.has(SCRIPT_VERIFY_WITNESS) && isWitness && version == 0:
+		ctx.sigVersion = SIGVERSION_WITNESS_V0
+		if len(program) != 20 && len(program) != 32 {
+			return nil, ctx.fail(SCRIPT_ERR_WITNESS_PROGRAM_WRONG_LENGTH)
+		}
+		// P2WSH needs the witness script
+		if len(program) == 32 && len(tx.inputs[input].items) == 0 {
+			return nil, ctx.fail(SCRIPT_ERR_WITNESS_PROGRAM_WITNESS_EMPTY)
+		}
+		ctx.scriptCode, _, err = tx.segwitScriptCode(input, provider, p2sh)
+	default:
+		ctx.scriptCode, err = tx.legacyScriptCode(input, provider, pubKey.isP2SH() && flags.has(SCRIPT_VERIFY_P2SH))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// Witness program spent by the input: the scriptPubKey, or the redeem
+// script pushed by the scriptSig of a P2SH output
+func (ctx *ExecutionContext) witnessProgram() (version byte, program []byte, p2sh bool, ok bool) {
+	script := ctx.scriptPubKey
+	if script.isP2SH() && ctx.flags.has(SCRIPT_VERIFY_P2SH) {
+		redeem, err := ctx.tx.inputs[ctx.input].redeemScript()
+		if err != nil {
+			return 0, nil, false, false
+		}
+		script, p2sh = redeem, true
+	}
+	version, program, ok = script.witnessProgram()
+	return version, program, p2sh, ok
+}
+
+// Creates a context without transaction, where every signature is
+// checked against the digest z whatever its sighash type, and lock
+// times are not checked
+func NewDigestContext(z string, flags ScriptFlags) *ExecutionContext {
+	return &ExecutionContext{
+		z:         z,
+		flags:     flags,
+		sighashes: map[SigHashType][]byte{},
+	}
+}
+
+// Context of a tapscript leaf, whose signatures commit to the leaf and
+// consume the validation weight budget
+func (ctx *ExecutionContext) tapscript(script []byte, budget int) *ExecutionContext {
+	return &ExecutionContext{
+		tx:           ctx.tx,
+		input:        ctx.input,
+		provider:     ctx.provider,
+		amount:       ctx.amount,
+		scriptPubKey: ctx.scriptPubKey,
+		sigVersion:   SIGVERSION_TAPSCRIPT,
+		flags:        ctx.flags,
+		leafHash:     TapLeafHash(TAPROOT_LEAF_TAPSCRIPT, script),
+		budget:       budget,
+		sighashes:    map[SigHashType][]byte{},
+		trace:        ctx.trace,
+	}
+}
+
+// The spending transaction, nil in a digest context
+func (ctx *ExecutionContext) Transaction() *Transaction {
+	return ctx.tx
+}
+
+func (ctx *ExecutionContext) InputIndex() int {
+	return ctx.input
+}
+
+// Amount of the output spent by the input
+func (ctx *ExecutionContext) Amount() uint64 {
+	return ctx.amount
+}
+
+func (ctx *ExecutionContext) SigVersion() SigVersion {
+	return ctx.sigVersion
+}
+
+func (ctx *ExecutionContext) Flags() ScriptFlags {
+	return ctx.flags
+}
+
+// Returns the digest signed by signatures of the sighash type
+func (ctx *ExecutionContext) SigHash(hashType SigHashType) ([]byte, error) {
+	if ctx.tx == nil {
+		return hex.DecodeString(ctx.z)
+	}
+	if hash, ok := ctx.sighashes[hashType]; ok {
+		return hash, nil
+	}
+	var hash []byte
+	var err error
+	switch ctx.sigVersion {
+	case SIGVERSION_BASE:
+		hash, err = ctx.tx.legacySigHash(ctx.input, ctx.code(), hashType)
+	case SIGVERSION_WITNESS_V0:
+		hash, err = ctx.tx.segwitSigHash(ctx.input, ctx.code(), ctx.amount, hashType)
+	default:
+		codeSeparator := uint32(TAPSCRIPT_NO_CODESEPARATOR)
+		if ctx.separator > 0 {
+			codeSeparator = uint32(ctx.separator - 1)
+		}
+		hash, err = ctx.tx.SigHashTapscript(ctx.input, ctx.provider, hashType, ctx.leafHash, codeSeparator)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ctx.sighashes[hashType] = hash
+	return hash, nil
+}
+
+// The scriptCode signatures commit to, from the operation following
+// the last OP_CODESEPARATOR executed
+func (ctx *ExecutionContext) code() []byte {
+	code := ctx.scriptCode
+	for range ctx.separator {
+		if len(code) == 0 {
+			break
+		}
+		code = code[operationSize(code):]
+	}
+	return code
+}
+
+// Marks the OP_CODESEPARATORs of the script signatures commit to, the
+// ones of other scripts don't change the scriptCode when executed
+func (ctx *ExecutionContext) markCodeSeparators(cmds []Operation) {
+	if ctx.codeSeparators == nil {
+		ctx.codeSeparators = map[Operation]bool{}
+	}
+	for _, cmd := range cmds {
+		if _, ok := cmd.(*OP_CODESEPARATOR); ok {
+			ctx.codeSeparators[cmd] = true
+		}
+	}
+}
+
+// Legacy signatures don't commit to themselves: the signatures checked
+// by the operation are removed from the scriptCode before hashing it
+func (ctx *ExecutionContext) legacySigHash(hashType SigHashType, signatures [][]byte) ([]byte, error) {
+	code := ctx.code()
+	for _, signature := range signatures {
+		code = findAndDelete(code, signature)
+	}
+	return ctx.tx.legacySigHash(ctx.input, code, hashType)
+}
+
+// Verifies a DER signature followed by its sighash type byte against
+// the SEC public key. Returns an error when the encoding of the signature
+// or the public key breaks the flags, which makes the script fail
+func (ctx *ExecutionContext) checkSig(sig []byte, sec []byte) (bool, error) {
+	return ctx.checkSigOf(sig, sec, [][]byte{sig})
+}
+
+// Verifies the signature like checkSig, where signatures are all the
+// signatures of the operation
+func (ctx *ExecutionContext) checkSigOf(sig []byte, sec []byte, signatures [][]byte) (bool, error) {
+	// An empty signature is a failed check, not an invalid script
+	if len(sig) == 0 {
+		return false, nil
+	}
+	if ctx.flags.has(SCRIPT_VERIFY_DERSIG|SCRIPT_VERIFY_LOW_S|SCRIPT_VERIFY_STRICTENC) && !isStrictDer(sig) {
+		return false, SCRIPT_ERR_SIG_DER
+	}
+	if ctx.flags.has(SCRIPT_VERIFY_LOW_S) && !isLowS(sig) {
+		return false, SCRIPT_ERR_SIG_HIGH_S
+	}
+	if ctx.flags.has(SCRIPT_VERIFY_STRICTENC) {
+		if !validSigHashType(SigHashType(sig[len(sig)-1])) {
+			return false, SCRIPT_ERR_SIG_HASHTYPE
+		}
+		if !isValidPubKeyEncoding(sec) {
+			return false, SCRIPT_ERR_PUBKEYTYPE
+		}
+	}
+	if ctx.flags.has(SCRIPT_VERIFY_WITNESS_PUBKEYTYPE) && ctx.sigVersion == SIGVERSION_WITNESS_V0 && len(sec) != 33 {
+		return false, SCRIPT_ERR_WITNESS_PUBKEYTYPE
+	}
+	pubkey, err := parseLaxSec(sec)
+	if err != nil {
+		return false, nil
+	}
+	copied := make([]byte, len(sig)-1)
+	copy(copied, sig)
+	der, err := parseLaxDer(pubkey, copied)
+	if err != nil {
+		return false, nil
+	}
+	z := ctx.z
+	if ctx.tx != nil {
+		hashType := SigHashType(sig[len(sig)-1])
+		var hash []byte
+		if ctx.sigVersion == SIGVERSION_BASE {
+			hash, err = ctx.legacySigHash(hashType, signatures)
+		} else {
+			hash, err = ctx.SigHash(hashType)
+		}
+		if err != nil {
+			return false, SCRIPT_ERR_UNKNOWN_ERROR
+		}
+		z = hex.EncodeToString(hash)
+	}
+	return der.Verify(FromHexString("0x" + z)), nil
+}
+
+// Checks a tapscript signature following BIP342. Returns whether the
+// signature is valid, and the error when the whole script must fail
+func (ctx *ExecutionContext) checkSchnorrSig(sig []byte, pubkey []byte) (bool, error) {
+	if len(pubkey) == 0 {
+		return false, SCRIPT_ERR_TAPSCRIPT_EMPTY_PUBKEY
+	}
+	if len(sig) == 0 {
+		return false, nil
+	}
+	ctx.budget -= TAPSCRIPT_SIGOP_WEIGHT
+	if ctx.budget < 0 {
+		return false, SCRIPT_ERR_TAPSCRIPT_VALIDATION_WEIGHT
+	}
+	if len(pubkey) != XONLY_PUBKEY_SIZE {
+		// Unknown public key types are reserved for soft forks
+		return true, nil
+	}
+	schnorr, hashType, err := parseTaprootSignature(sig)
+	if err != nil {
+		return false, taprootSignatureError(sig)
+	}
+	hash, err := ctx.SigHash(hashType)
+	if err != nil {
+		return false, SCRIPT_ERR_SCHNORR_SIG_HASHTYPE
+	}
+	// A non empty signature that fails makes the script fail
+	if !schnorr.Verify(pubkey, hash) {
+		return false, SCRIPT_ERR_SCHNORR_SIG
+	}
+	return true, nil
+}
+
+// BIP65: the transaction locktime must be of the same kind, height or
+// time, and at least the locktime of the script. A final input would
+// disable the transaction locktime, so it fails the check
+func (ctx *ExecutionContext) checkLockTime(locktime int64) bool {
+	txLocktime := int64(ctx.tx.locktime)
+	if (locktime < LOCKTIME_THRESHOLD) != (txLocktime < LOCKTIME_THRESHOLD) {
+		return false
+	}
+	if locktime > txLocktime {
+		return false
+	}
+	return ctx.tx.inputs[ctx.input].sequence != SEQUENCE_FINAL
+}
+
+// BIP112: the input sequence must enforce a relative lock time of the
+// same kind and at least the one of the script
+func (ctx *ExecutionContext) checkSequence(sequence int64) bool {
+	if ctx.tx.version.number < 2 {
+		return false
+	}
+	txSequence := int64(ctx.tx.inputs[ctx.input].sequence)
+	if txSequence&SEQUENCE_LOCKTIME_DISABLE_FLAG != 0 {
+		return false
+	}
+	mask := int64(SEQUENCE_LOCKTIME_TYPE_FLAG | SEQUENCE_LOCKTIME_MASK)
+	txSequence &= mask
+	sequence &= mask
+	if (sequence < SEQUENCE_LOCKTIME_TYPE_FLAG) != (txSequence < SEQUENCE_LOCKTIME_TYPE_FLAG) {
+		return false
+	}
+	return sequence <= txSequence
+}
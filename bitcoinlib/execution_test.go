@@ -0,0 +1,77 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestExecutionContext(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(5005))
+	scripts := []*bitcoinlib.ScriptPubKey{
+		builderScript(t, key.P2WPKHAddress(bitcoinlib.MAINNET_PARAMS)),
+		builderScript(t, key.Address(bitcoinlib.COMPRESSED, bitcoinlib.MAINNET_PARAMS)),
+	}
+	provider := bitcoinlib.NewMemoryProvider()
+	tx := bitcoinlib.NewTransaction()
+	for index, script := range scripts {
+		txId := strings.Repeat("88", 32)
+		provider.Add(txId, uint32(index), bitcoinlib.NewOutput(uint64(10000*(index+1)), script))
+		tx.AddInput(txId, uint32(index))
+	}
+	tx.AddOutputScript(25000, scripts[0])
+
+	vectors := []struct {
+		sigVersion bitcoinlib.SigVersion
+		amount     uint64
+		sighash    func(int, bitcoinlib.SigHashType) ([]byte, error)
+	}{
+		{bitcoinlib.SIGVERSION_WITNESS_V0, 10000, func(input int, hashType bitcoinlib.SigHashType) ([]byte, error) {
+			return tx.SigHashBIP143WithType(input, provider, false, hashType)
+		}},
+		{bitcoinlib.SIGVERSION_BASE, 20000, func(input int, hashType bitcoinlib.SigHashType) ([]byte, error) {
+			return tx.SigHashWithType(input, provider, false, hashType)
+		}},
+	}
+	for index, vector := range vectors {
+		ctx, err := bitcoinlib.NewExecutionContext(tx, index, provider, bitcoinlib.SCRIPT_VERIFY_CONSENSUS)
+		if err != nil {
+			t.Fatalf("Failed at index %d: %s", index, err)
+		}
+		if ctx.SigVersion() != vector.sigVersion || ctx.Amount() != vector.amount || ctx.InputIndex() != index {
+			t.Fatalf("Failed at index %d\nExpected => %d %d\nGot => %d %d", index, vector.sigVersion, vector.amount, ctx.SigVersion(), ctx.Amount())
+		}
+		for _, hashType := range []bitcoinlib.SigHashType{bitcoinlib.SIGHASH_ALL, bitcoinlib.SIGHASH_NONE | bitcoinlib.SIGHASH_ANYONECANPAY} {
+			expected, _ := vector.sighash(index, hashType)
+			for range 2 {
+				got, err := ctx.SigHash(hashType)
+				if err != nil || !bytes.Equal(got, expected) {
+					t.Fatalf("Failed at index %d\nExpected => %x\nGot => %x", index, expected, got)
+				}
+			}
+		}
+	}
+
+	if _, err := bitcoinlib.NewExecutionContext(tx, 2, provider, bitcoinlib.SCRIPT_VERIFY_CONSENSUS); err == nil {
+		t.Fatal("Created context for a missing input")
+	}
+	if _, err := bitcoinlib.NewExecutionContext(tx, 0, bitcoinlib.NewMemoryProvider(), bitcoinlib.SCRIPT_VERIFY_CONSENSUS); err == nil {
+		t.Fatal("Created context without the prevout")
+	}
+}
+
+func TestDigestContext(t *testing.T) {
+	z := strings.Repeat("ab", 32)
+	ctx := bitcoinlib.NewDigestContext(z, bitcoinlib.SCRIPT_VERIFY_NONE)
+	if ctx.Transaction() != nil {
+		t.Fatal("Digest context has a transaction")
+	}
+	for _, hashType := range []bitcoinlib.SigHashType{bitcoinlib.SIGHASH_ALL, bitcoinlib.SIGHASH_SINGLE} {
+		hash, err := ctx.SigHash(hashType)
+		if err != nil || hex.EncodeToString(hash) != z {
+			t.Fatalf("Failed at sighash type %d\nExpected => %s\nGot => %x", hashType, z, hash)
+		}
+	}
+}
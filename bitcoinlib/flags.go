@@ -0,0 +1,224 @@
+package bitcoinlib
+
+import (
+	"fmt"
+	"maps"
+	"math/big"
+	"strings"
+)
+
+// Script verification flags, using the same bits as Bitcoin Core
+const (
+	SCRIPT_VERIFY_NONE ScriptFlags = 0
+	// Evaluates the redeem script of P2SH outputs (BIP16)
+	SCRIPT_VERIFY_P2SH ScriptFlags = 1 << 0
+	// Public keys and sighash types must have a defined encoding
+	SCRIPT_VERIFY_STRICTENC ScriptFlags = 1 << 1
+	// Signatures must be strict DER (BIP66)
+	SCRIPT_VERIFY_DERSIG ScriptFlags = 1 << 2
+	// The S value of signatures must be in the lower half of the order
+	SCRIPT_VERIFY_LOW_S ScriptFlags = 1 << 3
+	// The dummy element of OP_CHECKMULTISIG must be empty (BIP147)
+	SCRIPT_VERIFY_NULLDUMMY ScriptFlags = 1 << 4
+	// scriptSigs can only push data
+	SCRIPT_VERIFY_SIGPUSHONLY ScriptFlags = 1 << 5
+	// Data must be pushed with the shortest possible opcode
+	SCRIPT_VERIFY_MINIMALDATA ScriptFlags = 1 << 6
+	// OP_NOP1 and OP_NOP4 to OP_NOP10 fail, they are kept for soft forks
+	SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_NOPS ScriptFlags = 1 << 7
+	// Scripts must leave nothing on the stack but their result
+	SCRIPT_VERIFY_CLEANSTACK          ScriptFlags = 1 << 8
+	SCRIPT_VERIFY_CHECKLOCKTIMEVERIFY ScriptFlags = 1 << 9
+	SCRIPT_VERIFY_CHECKSEQUENCEVERIFY ScriptFlags = 1 << 10
+	// Evaluates segwit v0 witness programs (BIP141)
+	SCRIPT_VERIFY_WITNESS ScriptFlags = 1 << 11
+	// Witness programs of unknown versions fail instead of succeeding
+	SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM ScriptFlags = 1 << 12
+	// OP_IF and OP_NOTIF of witness scripts take an empty or 0x01 argument
+	SCRIPT_VERIFY_MINIMALIF ScriptFlags = 1 << 13
+	// Signature checks can only fail with empty signatures
+	SCRIPT_VERIFY_NULLFAIL ScriptFlags = 1 << 14
+	// Witness scripts only accept compressed public keys
+	SCRIPT_VERIFY_WITNESS_PUBKEYTYPE ScriptFlags = 1 << 15
+	// Evaluates taproot outputs (BIP341 and BIP342)
+	SCRIPT_VERIFY_TAPROOT ScriptFlags = 1 << 17
+)
+
+// Rules enforced by consensus after the taproot activation
+const SCRIPT_VERIFY_CONSENSUS = SCRIPT_VERIFY_P2SH | SCRIPT_VERIFY_DERSIG |
+	SCRIPT_VERIFY_NULLDUMMY | SCRIPT_VERIFY_CHECKLOCKTIMEVERIFY |
+	SCRIPT_VERIFY_CHECKSEQUENCEVERIFY | SCRIPT_VERIFY_WITNESS | SCRIPT_VERIFY_TAPROOT
+
+// Rules of the default relay policy of Bitcoin Core
+const SCRIPT_VERIFY_STANDARD = SCRIPT_VERIFY_CONSENSUS | SCRIPT_VERIFY_STRICTENC |
+	SCRIPT_VERIFY_LOW_S | SCRIPT_VERIFY_MINIMALDATA | SCRIPT_VERIFY_CLEANSTACK |
+	SCRIPT_VERIFY_MINIMALIF | SCRIPT_VERIFY_NULLFAIL | SCRIPT_VERIFY_WITNESS_PUBKEYTYPE
+
+// Names of the flags in the Bitcoin Core test vectors
+var SCRIPT_FLAG_NAMES map[string]ScriptFlags = map[string]ScriptFlags{
+	"NONE":                                  SCRIPT_VERIFY_NONE,
+	"P2SH":                                  SCRIPT_VERIFY_P2SH,
+	"STRICTENC":                             SCRIPT_VERIFY_STRICTENC,
+	"DERSIG":                                SCRIPT_VERIFY_DERSIG,
+	"LOW_S":                                 SCRIPT_VERIFY_LOW_S,
+	"NULLDUMMY":                             SCRIPT_VERIFY_NULLDUMMY,
+	"SIGPUSHONLY":                           SCRIPT_VERIFY_SIGPUSHONLY,
+	"MINIMALDATA":                           SCRIPT_VERIFY_MINIMALDATA,
+	"DISCOURAGE_UPGRADABLE_NOPS":            SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_NOPS,
+	"CLEANSTACK":                            SCRIPT_VERIFY_CLEANSTACK,
+	"CHECKLOCKTIMEVERIFY":                   SCRIPT_VERIFY_CHECKLOCKTIMEVERIFY,
+	"CHECKSEQUENCEVERIFY":                   SCRIPT_VERIFY_CHECKSEQUENCEVERIFY,
+	"WITNESS":                               SCRIPT_VERIFY_WITNESS,
+	"DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM": SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM,
+	"MINIMALIF":                             SCRIPT_VERIFY_MINIMALIF,
+	"NULLFAIL":                              SCRIPT_VERIFY_NULLFAIL,
+	"WITNESS_PUBKEYTYPE":                    SCRIPT_VERIFY_WITNESS_PUBKEYTYPE,
+	"TAPROOT":                               SCRIPT_VERIFY_TAPROOT,
+}
+
+// Parses a comma separated list of flag names, like "P2SH,STRICTENC"
+func ParseScriptFlags(names string) (ScriptFlags, error) {
+	flags := SCRIPT_VERIFY_NONE
+	if names == "" {
+		return flags, nil
+	}
+	for _, name := range strings.Split(names, ",") {
+		flag, ok := SCRIPT_FLAG_NAMES[name]
+		if !ok {
+			return flags, fmt.Errorf("unsupported script flag %s", name)
+		}
+		flags |= flag
+	}
+	return flags, nil
+}
+
+func (f ScriptFlags) has(flag ScriptFlags) bool {
+	return f&flag != 0
+}
+
+// BIP66 check of a DER signature followed by its sighash type byte
+func isStrictDer(sig []byte) bool {
+	if len(sig) < 9 || len(sig) > 73 {
+		return false
+	}
+	if sig[0] != 0x30 || int(sig[1]) != len(sig)-3 {
+		return false
+	}
+	rLength := int(sig[3])
+	if 5+rLength >= len(sig) {
+		return false
+	}
+	sLength := int(sig[5+rLength])
+	if rLength+sLength+7 != len(sig) {
+		return false
+	}
+	if sig[2] != 0x02 || rLength == 0 || sig[4]&0x80 != 0 {
+		return false
+	}
+	// Only a negative value can start with a zero byte
+	if rLength > 1 && sig[4] == 0 && sig[5]&0x80 == 0 {
+		return false
+	}
+	if sig[rLength+4] != 0x02 || sLength == 0 || sig[rLength+6]&0x80 != 0 {
+		return false
+	}
+	if sLength > 1 && sig[rLength+6] == 0 && sig[rLength+7]&0x80 == 0 {
+		return false
+	}
+	return true
+}
+
+// True if the S value of the strict DER signature is at most half the
+// order, so its negation can't be used to malleate the transaction
+func isLowS(sig []byte) bool {
+	rLength := int(sig[3])
+	sLength := int(sig[5+rLength])
+	s := new(big.Int).SetBytes(sig[6+rLength : 6+rLength+sLength])
+	half := new(big.Int).Rsh(ORDER.value, 1)
+	return s.Cmp(half) <= 0
+}
+
+// Compressed or uncompressed SEC public key
+func isValidPubKeyEncoding(sec []byte) bool {
+	if len(sec) == 33 {
+		return sec[0] == 0x02 || sec[0] == 0x03
+	}
+	return len(sec) == 65 && sec[0] == 0x04
+}
+
+// True if no shorter opcode pushes the data
+func checkMinimalPush(data []byte, opcode byte) bool {
+	switch {
+	case len(data) == 0:
+		return opcode == 0
+	case len(data) == 1 && data[0] >= 1 && data[0] <= 16:
+		// OP_1 to OP_16
+		return false
+	case len(data) == 1 && data[0] == 0x81:
+		// OP_1NEGATE
+		return false
+	case len(data) <= 75:
+		return int(opcode) == len(data)
+	case len(data) <= 255:
+		return opcode == 76
+	case len(data) <= 65535:
+		return opcode == 77
+	}
+	return true
+}
+
+// Pushes of the serialized script not using the shortest encoding,
+// among the operations parsed from it
+func nonMinimalPushes(buf []byte, cmds []Operation) map[Operation]bool {
+	pushes := map[Operation]bool{}
+	index := 0
+	for _, cmd := range cmds {
+		if index >= len(buf) {
+			break
+		}
+		opcode := buf[index]
+		index++
+		val, ok := cmd.(*ScriptVal)
+		if !ok {
+			continue
+		}
+		switch opcode {
+		case 76:
+			index++
+		case 77:
+			index += 2
+		case 78:
+			index += 4
+		}
+		if !checkMinimalPush(val.Val, opcode) {
+			pushes[cmd] = true
+		}
+		index += len(val.Val)
+	}
+	return pushes
+}
+
+// Marks the pushes of the script parsed from buf failing MINIMALDATA,
+// for them to fail when executed
+func (ctx *ExecutionContext) markNonMinimal(buf []byte, cmds []Operation) {
+	if ctx.nonMinimal == nil {
+		ctx.nonMinimal = map[Operation]bool{}
+	}
+	maps.Copy(ctx.nonMinimal, nonMinimalPushes(buf, cmds))
+}
+
+// True if the script only pushes data, including the small numbers
+func isPushOnly(cmds []Operation) bool {
+	for _, cmd := range cmds {
+		if cmd.Num() > 96 {
+			return false
+		}
+	}
+	return true
+}
+
+// Under MINIMALIF the argument of OP_IF is either empty or 0x01
+func isMinimalIf(element Operation) bool {
+	value := stackBytes(element)
+	return len(value) == 0 || (len(value) == 1 && value[0] == 1)
+}
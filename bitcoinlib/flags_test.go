@@ -0,0 +1,209 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+const witnessFlags = bitcoinlib.SCRIPT_VERIFY_P2SH | bitcoinlib.SCRIPT_VERIFY_WITNESS
+
+func p2shSpend(t *testing.T, script []byte, pushes ...[]byte) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+	scriptSig := []byte{}
+	for _, push := range pushes {
+		scriptSig = append(scriptSig, push...)
+	}
+	scriptSig = append(scriptSig, pushData(script)...)
+	tx, provider := spendOutput(bitcoinlib.P2SHPubKey(bitcoinlib.Hash160(script)), 1, 0, bitcoinlib.SEQUENCE_FINAL)
+	return finalizeSpend(t, tx, scriptSig, nil), provider
+}
+
+func p2wshSpend(t *testing.T, script []byte, items ...[]byte) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+	hash := sha256.Sum256(script)
+	tx, provider := spendOutput(bitcoinlib.P2WSHPubKey(hash[:]), 1, 0, bitcoinlib.SEQUENCE_FINAL)
+	return finalizeSpend(t, tx, nil, append(items, script)), provider
+}
+
+func TestScriptFlags(t *testing.T) {
+	type spend func(t *testing.T) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider)
+	vectors := []struct {
+		name  string
+		spend spend
+		valid []bitcoinlib.ScriptFlags
+		fail  []bitcoinlib.ScriptFlags
+	}{
+		{"NULLDUMMY", func(t *testing.T) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+			// OP_0 OP_0 OP_CHECKMULTISIG with a non empty dummy
+			return p2wshSpend(t, []byte{0x00, 0x00, 0xae}, []byte{0x01})
+		}, []bitcoinlib.ScriptFlags{witnessFlags}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_CONSENSUS}},
+		{"MINIMALIF", func(t *testing.T) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+			// OP_IF OP_1 OP_ELSE OP_0 OP_ENDIF taking 0x02
+			return p2wshSpend(t, []byte{0x63, 0x51, 0x67, 0x00, 0x68}, []byte{0x02})
+		}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_CONSENSUS}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_STANDARD}},
+		{"CLEANSTACK", func(t *testing.T) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+			return p2shSpend(t, []byte{0x51, 0x51})
+		}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_CONSENSUS}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_STANDARD}},
+		{"witness CLEANSTACK", func(t *testing.T) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+			return p2wshSpend(t, []byte{0x51, 0x51})
+		}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_NONE}, []bitcoinlib.ScriptFlags{witnessFlags}},
+		{"MINIMALDATA", func(t *testing.T) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+			// Pushes 5 instead of using OP_5, then OP_DROP OP_1
+			return p2shSpend(t, []byte{0x01, 0x05, 0x75, 0x51})
+		}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_CONSENSUS}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_STANDARD}},
+		{"MINIMALDATA scriptSig", func(t *testing.T) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+			// OP_DROP OP_1 with 0x81 pushed instead of OP_1NEGATE
+			return p2shSpend(t, []byte{0x75, 0x51}, []byte{0x01, 0x81})
+		}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_CONSENSUS}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_STANDARD}},
+		{"MINIMALDATA PUSHDATA1", func(t *testing.T) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+			// <0102> OP_EQUAL with 0102 pushed through OP_PUSHDATA1
+			return p2shSpend(t, []byte{0x02, 0x01, 0x02, 0x87}, []byte{0x4c, 0x02, 0x01, 0x02})
+		}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_CONSENSUS}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_STANDARD}},
+		{"MINIMALDATA unexecuted", func(t *testing.T) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+			// OP_0 OP_IF <05> OP_ENDIF OP_1, the push never runs
+			return p2shSpend(t, []byte{0x00, 0x63, 0x01, 0x05, 0x68, 0x51})
+		}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_STANDARD}, nil},
+		{"witness MINIMALDATA unexecuted", func(t *testing.T) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+			return p2wshSpend(t, []byte{0x00, 0x63, 0x01, 0x05, 0x68, 0x51})
+		}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_STANDARD}, nil},
+		{"P2SH push only", func(t *testing.T) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+			// OP_1 OP_DROP before the redeem script
+			return p2shSpend(t, []byte{0x51}, []byte{0x51, 0x75})
+		}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_NONE}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_P2SH, bitcoinlib.SCRIPT_VERIFY_SIGPUSHONLY}},
+		{"P2SH", func(t *testing.T) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+			// The redeem script OP_0 only runs with the P2SH flag
+			return p2shSpend(t, []byte{0x00})
+		}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_NONE}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_P2SH}},
+		{"WITNESS", func(t *testing.T) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+			return p2wshSpend(t, []byte{0x00})
+		}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_P2SH}, []bitcoinlib.ScriptFlags{witnessFlags}},
+		{"CHECKLOCKTIMEVERIFY", func(t *testing.T) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+			return p2wshSpend(t, timelockScript(100, 0xb1))
+		}, []bitcoinlib.ScriptFlags{witnessFlags}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_CONSENSUS}},
+	}
+	for _, vector := range vectors {
+		tx, provider := vector.spend(t)
+		for _, flags := range vector.valid {
+			if !tx.VerifyInputWithFlags(0, provider, flags) {
+				t.Fatalf("Failed at %s\nExpected => valid with flags %x\nGot => invalid", vector.name, flags)
+			}
+		}
+		for _, flags := range vector.fail {
+			if tx.VerifyInputWithFlags(0, provider, flags) {
+				t.Fatalf("Failed at %s\nExpected => invalid with flags %x\nGot => valid", vector.name, flags)
+			}
+		}
+	}
+}
+
+// DER encoding of r and s, with an extra zero byte before r when padded
+func encodeDer(r *big.Int, s *big.Int, padded bool) []byte {
+	encode := func(value *big.Int, pad bool) []byte {
+		bytes := value.Bytes()
+		if bytes[0]&0x80 != 0 {
+			bytes = append([]byte{0}, bytes...)
+		}
+		if pad {
+			bytes = append([]byte{0}, bytes...)
+		}
+		return append([]byte{0x02, byte(len(bytes))}, bytes...)
+	}
+	der := append(encode(r, padded), encode(s, false)...)
+	return append([]byte{0x30, byte(len(der))}, der...)
+}
+
+func TestSignatureFlags(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(7007))
+	sec := key.Sec(bitcoinlib.COMPRESSED)
+	scriptPubKey := builderScript(t, key.P2WPKHAddress(bitcoinlib.MAINNET_PARAMS))
+	txId := strings.Repeat("99", 32)
+	provider := bitcoinlib.NewMemoryProvider()
+	provider.Add(txId, 0, bitcoinlib.NewOutput(10000, scriptPubKey))
+	tx := bitcoinlib.NewTransaction()
+	tx.AddInput(txId, 0)
+	tx.AddOutputScript(9000, scriptPubKey)
+	psbt, _ := bitcoinlib.NewPsbt(tx)
+	psbt.AddWitnessUtxo(0, bitcoinlib.NewOutput(10000, scriptPubKey))
+	if err := psbt.SignInput(0, key); err != nil {
+		t.Fatalf("Failed signing: %s", err)
+	}
+	sig := psbt.Inputs[0].PartialSigs[hex.EncodeToString(sec)]
+	rLength := int(sig[3])
+	r := new(big.Int).SetBytes(sig[4 : 4+rLength])
+	s := new(big.Int).SetBytes(sig[6+rLength : len(sig)-1])
+	order, _ := new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+	highS := new(big.Int).Sub(order, s)
+
+	vectors := []struct {
+		name  string
+		sig   []byte
+		valid []bitcoinlib.ScriptFlags
+		fail  []bitcoinlib.ScriptFlags
+	}{
+		{"low s", sig, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_STANDARD}, nil},
+		{"high s", append(encodeDer(r, highS, false), sig[len(sig)-1]),
+			[]bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_CONSENSUS}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_LOW_S | witnessFlags}},
+		{"padded r", append(encodeDer(r, s, true), sig[len(sig)-1]),
+			[]bitcoinlib.ScriptFlags{witnessFlags}, []bitcoinlib.ScriptFlags{bitcoinlib.SCRIPT_VERIFY_CONSENSUS}},
+	}
+	for _, vector := range vectors {
+		psbt.Inputs[0].FinalScriptWitness = [][]byte{vector.sig, sec}
+		spend, err := psbt.Extract()
+		if err != nil {
+			t.Fatalf("Failed extracting at %s: %s", vector.name, err)
+		}
+		for _, flags := range vector.valid {
+			if !spend.VerifyInputWithFlags(0, provider, flags) {
+				t.Fatalf("Failed at %s\nExpected => valid with flags %x\nGot => invalid", vector.name, flags)
+			}
+		}
+		for _, flags := range vector.fail {
+			if spend.VerifyInputWithFlags(0, provider, flags) {
+				t.Fatalf("Failed at %s\nExpected => invalid with flags %x\nGot => valid", vector.name, flags)
+			}
+		}
+	}
+}
+
+func TestNullFail(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(7007))
+	sec := key.Sec(bitcoinlib.COMPRESSED)
+	// <sec> OP_CHECKSIG OP_NOT succeeds when the signature check fails
+	script := append(pushData(sec), 0xac, 0x91)
+	vectors := []struct {
+		sig   []byte
+		valid bool
+	}{
+		{[]byte{}, true},
+		{append(encodeDer(big.NewInt(1), big.NewInt(1), false), 0x01), false},
+	}
+	for index, vector := range vectors {
+		tx, provider := p2wshSpend(t, script, vector.sig)
+		if !tx.VerifyInputWithFlags(0, provider, bitcoinlib.SCRIPT_VERIFY_CONSENSUS) {
+			t.Fatalf("Failed at index %d: failed signature check is invalid by consensus", index)
+		}
+		if tx.VerifyInputWithFlags(0, provider, bitcoinlib.SCRIPT_VERIFY_STANDARD) != vector.valid {
+			t.Fatalf("Failed at index %d\nExpected => %t\nGot => %t", index, vector.valid, !vector.valid)
+		}
+	}
+}
+
+func TestMinimalDataParsedScriptSig(t *testing.T) {
+	// Parsed transactions keep how their scriptSig pushed the data
+	scriptSig := []byte{0x4c, 0x02, 0x01, 0x02}
+	scriptPubKey := []byte{0x02, 0x01, 0x02, 0x87}
+	if err := bitcoinlib.ValidateScripts(scriptSig, scriptPubKey, nil, 0, bitcoinlib.SCRIPT_VERIFY_P2SH); err != nil {
+		t.Fatalf("Expected => valid without MINIMALDATA\nGot => %s", err)
+	}
+	err := bitcoinlib.ValidateScripts(scriptSig, scriptPubKey, nil, 0, bitcoinlib.SCRIPT_VERIFY_MINIMALDATA)
+	if code := bitcoinlib.ScriptErrorCodeOf(err); code != bitcoinlib.SCRIPT_ERR_MINIMALDATA {
+		t.Fatalf("Expected => %s\nGot => %s", bitcoinlib.SCRIPT_ERR_MINIMALDATA, code)
+	}
+	// Only the pushes executed have to be minimal: 0 IF <> ENDIF 1
+	unexecuted := []byte{0x00, 0x63, 0x4c, 0x00, 0x68, 0x51}
+	if err := bitcoinlib.ValidateScripts(unexecuted, nil, nil, 0, bitcoinlib.SCRIPT_VERIFY_MINIMALDATA); err != nil {
+		t.Fatalf("Expected => valid with MINIMALDATA\nGot => %s", err)
+	}
+}
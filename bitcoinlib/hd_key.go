@@ -0,0 +1,429 @@
+package bitcoinlib
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Children with an index equal or above this value
+// are derived using the hardened formula
+const HARDENED_OFFSET uint32 = 0x80000000
+
+const EXTENDED_KEY_SIZE = 78
+
+var MAINNET_PRIVATE_VERSION = [4]byte{0x04, 0x88, 0xad, 0xe4}
+var MAINNET_PUBLIC_VERSION = [4]byte{0x04, 0x88, 0xb2, 0x1e}
+var TESTNET_PRIVATE_VERSION = [4]byte{0x04, 0x35, 0x83, 0x94}
+var TESTNET_PUBLIC_VERSION = [4]byte{0x04, 0x35, 0x87, 0xcf}
+
+var MASTER_KEY_SEED = []byte("Bitcoin seed")
+
+// Common fields shared between private and public extended keys
+type extendedKeyData struct {
+	version           [4]byte
+	depth             uint8
+	parentFingerprint [4]byte
+	childNumber       uint32
+	chainCode         []byte
+}
+
+type ExtendedPrivateKey struct {
+	extendedKeyData
+	key *PrivateKey
+}
+
+type ExtendedPublicKey struct {
+	extendedKeyData
+	point Point
+}
+
+func hmacSHA512(key []byte, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func intFromBytes(value []byte) Int {
+	return FromHexString("0x" + hex.EncodeToString(value))
+}
+
+// Checks that a derived scalar can be used as a private key
+func validScalar(value Int) bool {
+	return value.Ge(ZERO) && value.Le(ORDER)
+}
+
+func publicVersionFor(private [4]byte) [4]byte {
+	for _, params := range KNOWN_CHAINS {
+		if params.PrivateKeyVersion == private {
+			return params.PublicKeyVersion
+		}
+	}
+	return MAINNET_PUBLIC_VERSION
+}
+
+func knownVersion(version [4]byte, private bool) bool {
+	for _, params := range KNOWN_CHAINS {
+		if (private && params.PrivateKeyVersion == version) ||
+			(!private && params.PublicKeyVersion == version) {
+			return true
+		}
+	}
+	return false
+}
+
+// Generates the master extended key from a seed of
+// between 16 and 64 bytes
+func NewMasterKey(seed []byte, params *ChainParams) (*ExtendedPrivateKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("invalid seed length: %d", len(seed))
+	}
+	hashed := hmacSHA512(MASTER_KEY_SEED, seed)
+	secret := intFromBytes(hashed[:32])
+	if !validScalar(secret) {
+		return nil, errors.New("invalid master key generated from seed")
+	}
+	return &ExtendedPrivateKey{
+		extendedKeyData{
+			version:   params.PrivateKeyVersion,
+			chainCode: hashed[32:],
+		},
+		NewPrivateKey(secret),
+	}, nil
+}
+
+// Returns true if the index corresponds to a hardened child
+func IsHardened(index uint32) bool {
+	return index >= HARDENED_OFFSET
+}
+
+// Parses a derivation path of the form m/84'/1'/0'/0/5.
+// Hardened indexes can be marked with ', h or H
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if len(parts) == 0 || (parts[0] != "m" && parts[0] != "M") {
+		return nil, fmt.Errorf("derivation path must start with m: %s", path)
+	}
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := false
+		if strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h") || strings.HasSuffix(part, "H") {
+			hardened = true
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(index) >= HARDENED_OFFSET {
+			return nil, fmt.Errorf("invalid derivation index %q in path %s", part, path)
+		}
+		if hardened {
+			index += uint64(HARDENED_OFFSET)
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
+
+// Formats a list of indexes as a derivation path
+func FormatPath(indexes []uint32) string {
+	result := "m"
+	for _, index := range indexes {
+		if IsHardened(index) {
+			result += fmt.Sprintf("/%d'", index-HARDENED_OFFSET)
+		} else {
+			result += fmt.Sprintf("/%d", index)
+		}
+	}
+	return result
+}
+
+func fingerprint(p Point) [4]byte {
+	return [4]byte(Hash160(sec(p, COMPRESSED))[:4])
+}
+
+// Returns the private key wrapped by the extended key
+func (k *ExtendedPrivateKey) PrivateKey() *PrivateKey {
+	return k.key
+}
+
+func (k *ExtendedPrivateKey) ChainCode() []byte {
+	return k.chainCode
+}
+
+func (k *ExtendedPrivateKey) Depth() uint8 {
+	return k.depth
+}
+
+func (k *ExtendedPrivateKey) ChildNumber() uint32 {
+	return k.childNumber
+}
+
+func (k *ExtendedPrivateKey) ParentFingerprint() [4]byte {
+	return k.parentFingerprint
+}
+
+// First four bytes of the Hash160 of the compressed public key
+func (k *ExtendedPrivateKey) Fingerprint() [4]byte {
+	return fingerprint(k.key.p)
+}
+
+// CKDpriv: derives the child private key at the given index
+func (k *ExtendedPrivateKey) Child(index uint32) (*ExtendedPrivateKey, error) {
+	var data []byte
+	if IsHardened(index) {
+		secret := k.key.e.IntoBytes()
+		data = append([]byte{0x00}, secret[:]...)
+	} else {
+		data = k.key.Sec(COMPRESSED)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+	hashed := hmacSHA512(k.chainCode, data)
+	tweak := intFromBytes(hashed[:32])
+	if !tweak.Le(ORDER) {
+		return nil, fmt.Errorf("invalid child at index %d", index)
+	}
+	secret := tweak.Add(k.key.e).Mod(ORDER)
+	if !validScalar(secret) {
+		return nil, fmt.Errorf("invalid child at index %d", index)
+	}
+	return &ExtendedPrivateKey{
+		extendedKeyData{
+			version:           k.version,
+			depth:             k.depth + 1,
+			parentFingerprint: k.Fingerprint(),
+			childNumber:       index,
+			chainCode:         hashed[32:],
+		},
+		NewPrivateKey(secret),
+	}, nil
+}
+
+// Derives every index of the path starting from this key
+func (k *ExtendedPrivateKey) Derive(path string) (*ExtendedPrivateKey, error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	current := k
+	for _, index := range indexes {
+		current, err = current.Child(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+// Returns the extended public key matching this private key
+func (k *ExtendedPrivateKey) PublicKey() *ExtendedPublicKey {
+	data := k.extendedKeyData
+	data.version = publicVersionFor(k.version)
+	return &ExtendedPublicKey{
+		data,
+		k.key.p,
+	}
+}
+
+func (k *extendedKeyData) serialize(key []byte) []byte {
+	buf := append([]byte{}, k.version[:]...)
+	buf = append(buf, k.depth)
+	buf = append(buf, k.parentFingerprint[:]...)
+	buf = binary.BigEndian.AppendUint32(buf, k.childNumber)
+	buf = append(buf, k.chainCode...)
+	return append(buf, key...)
+}
+
+func (k *ExtendedPrivateKey) Serialize() []byte {
+	secret := k.key.e.IntoBytes()
+	return k.serialize(append([]byte{0x00}, secret[:]...))
+}
+
+// Returns the xprv/tprv representation of the key
+func (k *ExtendedPrivateKey) String() string {
+	return EncodeBase58Check(k.Serialize())
+}
+
+func (k *ExtendedPublicKey) Point() Point {
+	return k.point
+}
+
+func (k *ExtendedPublicKey) ChainCode() []byte {
+	return k.chainCode
+}
+
+func (k *ExtendedPublicKey) Depth() uint8 {
+	return k.depth
+}
+
+func (k *ExtendedPublicKey) ChildNumber() uint32 {
+	return k.childNumber
+}
+
+func (k *ExtendedPublicKey) ParentFingerprint() [4]byte {
+	return k.parentFingerprint
+}
+
+func (k *ExtendedPublicKey) Fingerprint() [4]byte {
+	return fingerprint(k.point)
+}
+
+func (k *ExtendedPublicKey) Sec(secType SecStart) []byte {
+	return sec(k.point, secType)
+}
+
+func (k *ExtendedPublicKey) Address(secType SecStart, params *ChainParams) string {
+	return Address(k.point, secType, params)
+}
+
+// CKDpub: derives the child public key at the given index.
+// Hardened children cannot be derived from a public key
+func (k *ExtendedPublicKey) Child(index uint32) (*ExtendedPublicKey, error) {
+	if IsHardened(index) {
+		return nil, fmt.Errorf("cannot derive hardened child %d from a public key", index)
+	}
+	data := binary.BigEndian.AppendUint32(k.Sec(COMPRESSED), index)
+	hashed := hmacSHA512(k.chainCode, data)
+	tweak := intFromBytes(hashed[:32])
+	if !tweak.Le(ORDER) {
+		return nil, fmt.Errorf("invalid child at index %d", index)
+	}
+	point, err := G().ScaleInt(tweak).Add(k.point)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := point.(*FinitePoint); !ok {
+		return nil, fmt.Errorf("invalid child at index %d", index)
+	}
+	return &ExtendedPublicKey{
+		extendedKeyData{
+			version:           k.version,
+			depth:             k.depth + 1,
+			parentFingerprint: k.Fingerprint(),
+			childNumber:       index,
+			chainCode:         hashed[32:],
+		},
+		point,
+	}, nil
+}
+
+func (k *ExtendedPublicKey) Derive(path string) (*ExtendedPublicKey, error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	current := k
+	for _, index := range indexes {
+		current, err = current.Child(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+func (k *ExtendedPublicKey) Serialize() []byte {
+	return k.serialize(k.Sec(COMPRESSED))
+}
+
+// Returns the xpub/tpub representation of the key
+func (k *ExtendedPublicKey) String() string {
+	return EncodeBase58Check(k.Serialize())
+}
+
+func parseExtendedKeyData(payload []byte) (extendedKeyData, error) {
+	data := extendedKeyData{}
+	if len(payload) != EXTENDED_KEY_SIZE {
+		return data, fmt.Errorf("invalid extended key length: %d", len(payload))
+	}
+	data.version = [4]byte(payload[:4])
+	data.depth = payload[4]
+	data.parentFingerprint = [4]byte(payload[5:9])
+	data.childNumber = binary.BigEndian.Uint32(payload[9:13])
+	data.chainCode = payload[13:45]
+	if data.depth == 0 && (data.parentFingerprint != [4]byte{} || data.childNumber != 0) {
+		return data, errors.New("master key with non zero parent fingerprint or index")
+	}
+	return data, nil
+}
+
+// A private or public extended key
+type ExtendedKey interface {
+	Serialize() []byte
+	String() string
+}
+
+// Parses a Base58Check encoded extended key, private or public
+// depending on its version
+func ParseExtendedKey(encoded string) (ExtendedKey, error) {
+	payload, err := DecodeBase58Check(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) >= 4 && knownVersion([4]byte(payload[:4]), true) {
+		key, err := ParseExtendedPrivateKey(encoded)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	key, err := ParseExtendedPublicKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Parses a Base58Check encoded xprv/tprv
+func ParseExtendedPrivateKey(encoded string) (*ExtendedPrivateKey, error) {
+	payload, err := DecodeBase58Check(encoded)
+	if err != nil {
+		return nil, err
+	}
+	data, err := parseExtendedKeyData(payload)
+	if err != nil {
+		return nil, err
+	}
+	if !knownVersion(data.version, true) {
+		return nil, fmt.Errorf("unknown private key version: %x", data.version)
+	}
+	if payload[45] != 0x00 {
+		return nil, errors.New("invalid private key prefix")
+	}
+	secret := intFromBytes(payload[46:])
+	if !validScalar(secret) {
+		return nil, errors.New("private key out of range")
+	}
+	return &ExtendedPrivateKey{data, NewPrivateKey(secret)}, nil
+}
+
+// Parses a Base58Check encoded xpub/tpub
+func ParseExtendedPublicKey(encoded string) (*ExtendedPublicKey, error) {
+	payload, err := DecodeBase58Check(encoded)
+	if err != nil {
+		return nil, err
+	}
+	data, err := parseExtendedKeyData(payload)
+	if err != nil {
+		return nil, err
+	}
+	if !knownVersion(data.version, false) {
+		return nil, fmt.Errorf("unknown public key version: %x", data.version)
+	}
+	key := payload[45:]
+	if key[0] != byte(EVEN_Y) && key[0] != byte(ODD_Y) {
+		return nil, errors.New("invalid public key prefix")
+	}
+	point, err := ParseFromSec(key)
+	if err != nil || point == nil {
+		return nil, errors.New("public key is not on the curve")
+	}
+	if !bytes.Equal(sec(point, COMPRESSED), key) {
+		return nil, errors.New("public key is not on the curve")
+	}
+	return &ExtendedPublicKey{data, point}, nil
+}
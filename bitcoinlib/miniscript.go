@@ -0,0 +1,1105 @@
+package bitcoinlib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Largest witness script relayed by Bitcoin Core
+const MAX_STANDARD_P2WSH_SCRIPT_SIZE = 3600
+
+// Keys of multi are limited by OP_CHECKMULTISIG
+const MINISCRIPT_MAX_MULTI_KEYS = 20
+
+// Fragments of Miniscript (BIP379), the same as Bitcoin Core's
+// miniscript::Fragment. Wrappers apply to the single expression
+// under them
+type MiniscriptFragment int
+
+const (
+	MINISCRIPT_JUST_0 MiniscriptFragment = iota
+	MINISCRIPT_JUST_1
+	MINISCRIPT_PK_K
+	MINISCRIPT_PK_H
+	MINISCRIPT_OLDER
+	MINISCRIPT_AFTER
+	MINISCRIPT_SHA256
+	MINISCRIPT_HASH256
+	MINISCRIPT_RIPEMD160
+	MINISCRIPT_HASH160
+	MINISCRIPT_WRAP_A
+	MINISCRIPT_WRAP_S
+	MINISCRIPT_WRAP_C
+	MINISCRIPT_WRAP_D
+	MINISCRIPT_WRAP_V
+	MINISCRIPT_WRAP_J
+	MINISCRIPT_WRAP_N
+	MINISCRIPT_AND_V
+	MINISCRIPT_AND_B
+	MINISCRIPT_OR_B
+	MINISCRIPT_OR_C
+	MINISCRIPT_OR_D
+	MINISCRIPT_OR_I
+	MINISCRIPT_ANDOR
+	MINISCRIPT_THRESH
+	MINISCRIPT_MULTI
+)
+
+// Names of the fragments in expressions, the wrappers by their letter
+var MINISCRIPT_FRAGMENT_NAMES = map[MiniscriptFragment]string{
+	MINISCRIPT_JUST_0:    "0",
+	MINISCRIPT_JUST_1:    "1",
+	MINISCRIPT_PK_K:      "pk_k",
+	MINISCRIPT_PK_H:      "pk_h",
+	MINISCRIPT_OLDER:     "older",
+	MINISCRIPT_AFTER:     "after",
+	MINISCRIPT_SHA256:    "sha256",
+	MINISCRIPT_HASH256:   "hash256",
+	MINISCRIPT_RIPEMD160: "ripemd160",
+	MINISCRIPT_HASH160:   "hash160",
+	MINISCRIPT_WRAP_A:    "a",
+	MINISCRIPT_WRAP_S:    "s",
+	MINISCRIPT_WRAP_C:    "c",
+	MINISCRIPT_WRAP_D:    "d",
+	MINISCRIPT_WRAP_V:    "v",
+	MINISCRIPT_WRAP_J:    "j",
+	MINISCRIPT_WRAP_N:    "n",
+	MINISCRIPT_AND_V:     "and_v",
+	MINISCRIPT_AND_B:     "and_b",
+	MINISCRIPT_OR_B:      "or_b",
+	MINISCRIPT_OR_C:      "or_c",
+	MINISCRIPT_OR_D:      "or_d",
+	MINISCRIPT_OR_I:      "or_i",
+	MINISCRIPT_ANDOR:     "andor",
+	MINISCRIPT_THRESH:    "thresh",
+	MINISCRIPT_MULTI:     "multi",
+}
+
+func (f MiniscriptFragment) String() string {
+	return MINISCRIPT_FRAGMENT_NAMES[f]
+}
+
+func (f MiniscriptFragment) isWrapper() bool {
+	return f >= MINISCRIPT_WRAP_A && f <= MINISCRIPT_WRAP_N
+}
+
+// Opcode and hash function of the hash fragments
+var miniscriptHashes = map[MiniscriptFragment]struct {
+	op   Operation
+	hash func([]byte) []byte
+	size int
+}{
+	MINISCRIPT_SHA256:    {&OP_SHA256{}, Sha256, 32},
+	MINISCRIPT_HASH256:   {&OP_HASH256{}, Hash256, 32},
+	MINISCRIPT_RIPEMD160: {&OP_RIPEMD160{}, Ripemd160, 20},
+	MINISCRIPT_HASH160:   {&OP_HASH160{}, Hash160, 20},
+}
+
+// Properties of the Miniscript type system, one bit per letter:
+// the basic types B, V, K and W, the properties z, o, n, d, u, e, f,
+// s and m, and the timelock properties g, h, i, j and k
+type MiniscriptType uint32
+
+const MINISCRIPT_TYPE_LETTERS = "BVKWzondufesmghijk"
+
+// Type with the properties of the letters, like Bitcoin Core's "..."_mst
+func miniscriptType(letters string) MiniscriptType {
+	var t MiniscriptType
+	for _, letter := range letters {
+		t |= 1 << strings.IndexRune(MINISCRIPT_TYPE_LETTERS, letter)
+	}
+	return t
+}
+
+// Whether the type has every property of the letters
+func (t MiniscriptType) Has(letters string) bool {
+	properties := miniscriptType(letters)
+	return t&properties == properties
+}
+
+func (t MiniscriptType) when(condition bool) MiniscriptType {
+	if condition {
+		return t
+	}
+	return 0
+}
+
+// A valid type has exactly one basic type
+func (t MiniscriptType) valid() bool {
+	basic := 0
+	for _, letter := range "BVKW" {
+		if t.Has(string(letter)) {
+			basic++
+		}
+	}
+	return basic == 1
+}
+
+func (t MiniscriptType) String() string {
+	letters := []byte{}
+	for index := range MINISCRIPT_TYPE_LETTERS {
+		if t&(1<<index) != 0 {
+			letters = append(letters, MINISCRIPT_TYPE_LETTERS[index])
+		}
+	}
+	return string(letters)
+}
+
+// Expression of Miniscript in the P2WSH context. Keys are compressed
+// SEC public keys and K holds the threshold of thresh and multi or the
+// lock time of older and after
+type Miniscript struct {
+	Fragment MiniscriptFragment
+	K        int64
+	Keys     [][]byte
+	Hash     []byte
+	Subs     []*Miniscript
+	typ      MiniscriptType
+}
+
+func newMiniscript(fragment MiniscriptFragment, subs ...*Miniscript) *Miniscript {
+	return (&Miniscript{Fragment: fragment, Subs: subs}).typed()
+}
+
+// Computes the type of the expression, zero when it is invalid
+func (m *Miniscript) typed() *Miniscript {
+	m.typ = m.computeType()
+	if !m.typ.valid() {
+		m.typ = 0
+	}
+	return m
+}
+
+func (m *Miniscript) Type() MiniscriptType {
+	return m.typ
+}
+
+// Whether combining the two mixes heights and times in lock times
+// of the same kind, which no transaction can satisfy together
+func timelocksMix(x MiniscriptType, y MiniscriptType) bool {
+	return x.Has("g") && y.Has("h") || x.Has("h") && y.Has("g") || x.Has("i") && y.Has("j") || x.Has("j") && y.Has("i")
+}
+
+// The typing rules of Bitcoin Core's ComputeType for P2WSH
+func (m *Miniscript) computeType() MiniscriptType {
+	t := miniscriptType
+	var x, y, z MiniscriptType
+	for index, sub := range m.Subs {
+		if sub.typ == 0 {
+			return 0
+		}
+		switch index {
+		case 0:
+			x = sub.typ
+		case 1:
+			y = sub.typ
+		case 2:
+			z = sub.typ
+		}
+	}
+	noMix := func(x MiniscriptType, y MiniscriptType) MiniscriptType {
+		return t("k").when((x & y).Has("k") && !timelocksMix(x, y))
+	}
+	switch m.Fragment {
+	case MINISCRIPT_JUST_0:
+		return t("Bzudemsk")
+	case MINISCRIPT_JUST_1:
+		return t("Bzufmk")
+	case MINISCRIPT_PK_K:
+		return t("Konudemsk")
+	case MINISCRIPT_PK_H:
+		return t("Knudemsk")
+	case MINISCRIPT_OLDER:
+		return t("g").when(m.K&SEQUENCE_LOCKTIME_TYPE_FLAG != 0) | t("h").when(m.K&SEQUENCE_LOCKTIME_TYPE_FLAG == 0) | t("Bzfmk")
+	case MINISCRIPT_AFTER:
+		return t("i").when(m.K >= LOCKTIME_THRESHOLD) | t("j").when(m.K < LOCKTIME_THRESHOLD) | t("Bzfmk")
+	case MINISCRIPT_SHA256, MINISCRIPT_HASH256, MINISCRIPT_RIPEMD160, MINISCRIPT_HASH160:
+		return t("Bonudmk")
+	case MINISCRIPT_WRAP_A:
+		return t("W").when(x.Has("B")) | x&t("ghijk") | x&t("udfems")
+	case MINISCRIPT_WRAP_S:
+		return t("W").when(x.Has("Bo")) | x&t("ghijk") | x&t("udfems")
+	case MINISCRIPT_WRAP_C:
+		return t("B").when(x.Has("K")) | x&t("ghijk") | x&t("ondfem") | t("us")
+	case MINISCRIPT_WRAP_D:
+		// OP_IF doesn't need a minimal argument in P2WSH, so d: isn't u
+		return t("B").when(x.Has("Vz")) | t("o").when(x.Has("z")) | t("e").when(x.Has("f")) | x&t("ghijk") | x&t("ms") | t("nd")
+	case MINISCRIPT_WRAP_V:
+		return t("V").when(x.Has("B")) | x&t("ghijk") | x&t("zonms") | t("f")
+	case MINISCRIPT_WRAP_J:
+		return t("B").when(x.Has("Bn")) | t("e").when(x.Has("f")) | x&t("ghijk") | x&t("oums") | t("nd")
+	case MINISCRIPT_WRAP_N:
+		return x&t("ghijk") | x&t("Bzondfems") | t("u")
+	case MINISCRIPT_AND_V:
+		return (y & t("KVB")).when(x.Has("V")) | x&t("n") | (y & t("n")).when(x.Has("z")) |
+			((x | y) & t("o")).when((x | y).Has("z")) | x&y&t("dmz") | (x|y)&t("s") |
+			t("f").when(y.Has("f") || x.Has("s")) | y&t("u") | (x|y)&t("ghij") | noMix(x, y)
+	case MINISCRIPT_AND_B:
+		return (x & t("B")).when(y.Has("W")) | ((x | y) & t("o")).when((x | y).Has("z")) | x&t("n") |
+			(y & t("n")).when(x.Has("z")) | (x & y & t("e")).when((x & y).Has("s")) | x&y&t("dzm") |
+			t("f").when((x&y).Has("f") || x.Has("sf") || y.Has("sf")) | (x|y)&t("s") | t("u") |
+			(x|y)&t("ghij") | noMix(x, y)
+	case MINISCRIPT_OR_B:
+		return t("B").when(x.Has("Bd") && y.Has("Wd")) | ((x | y) & t("o")).when((x | y).Has("z")) |
+			(x & y & t("m")).when((x|y).Has("s") && (x&y).Has("e")) | x&y&t("zse") | t("du") |
+			(x|y)&t("ghij") | x&y&t("k")
+	case MINISCRIPT_OR_C:
+		return (y & t("V")).when(x.Has("Bdu")) | (x & t("o")).when(y.Has("z")) |
+			(x & y & t("m")).when(x.Has("e") && (x|y).Has("s")) | x&y&t("zs") | t("f") |
+			(x|y)&t("ghij") | x&y&t("k")
+	case MINISCRIPT_OR_D:
+		return (y & t("B")).when(x.Has("Bdu")) | (x & t("o")).when(y.Has("z")) |
+			(x & y & t("m")).when(x.Has("e") && (x|y).Has("s")) | x&y&t("zs") | y&t("ufde") |
+			(x|y)&t("ghij") | x&y&t("k")
+	case MINISCRIPT_OR_I:
+		return x&y&t("VBKufs") | t("o").when((x & y).Has("z")) | ((x | y) & t("e")).when((x | y).Has("f")) |
+			(x & y & t("m")).when((x | y).Has("s")) | (x|y)&t("d") | (x|y)&t("ghij") | x&y&t("k")
+	case MINISCRIPT_ANDOR:
+		return (y & z & t("BKV")).when(x.Has("Bdu")) | x&y&z&t("z") |
+			((x | (y & z)) & t("o")).when((x | (y & z)).Has("z")) | y&z&t("u") |
+			(z & t("f")).when(x.Has("s") || y.Has("f")) | z&t("d") |
+			(z & t("e")).when(x.Has("s") || y.Has("f")) |
+			(x & y & z & t("m")).when(x.Has("e") && (x|y|z).Has("s")) | z&(x|y)&t("s") |
+			(x|y|z)&t("ghij") | noMix(x, y)&z
+	case MINISCRIPT_MULTI:
+		return t("Bnudemsk")
+	case MINISCRIPT_THRESH:
+		allE, allM := true, true
+		args, safe := 0, 0
+		timelocks := t("k")
+		for index, sub := range m.Subs {
+			required := "Wdu"
+			if index == 0 {
+				required = "Bdu"
+			}
+			if !sub.typ.Has(required) {
+				return 0
+			}
+			allE = allE && sub.typ.Has("e")
+			allM = allM && sub.typ.Has("m")
+			if sub.typ.Has("s") {
+				safe++
+			}
+			if !sub.typ.Has("z") {
+				args++
+				if !sub.typ.Has("o") {
+					args++
+				}
+			}
+			mix := m.K > 1 && timelocksMix(timelocks, sub.typ)
+			timelocks = (timelocks|sub.typ)&t("ghij") | t("k").when((timelocks&sub.typ).Has("k") && !mix)
+		}
+		n := len(m.Subs)
+		return t("Bdu") | t("z").when(args == 0) | t("o").when(args == 1) |
+			t("e").when(allE && safe == n) | t("m").when(allE && allM && safe >= n-int(m.K)) |
+			t("s").when(safe >= n-int(m.K)+1) | timelocks
+	}
+	return 0
+}
+
+// Parses a Miniscript expression, failing unless it is valid at the top
+// level. Besides the fragments it accepts the pk, pkh and and_n aliases
+// and the t:, l: and u: wrappers
+func ParseMiniscript(expr string) (*Miniscript, error) {
+	parser := &miniscriptParser{expr, 0}
+	m, err := parser.expression()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos != len(expr) {
+		return nil, fmt.Errorf("unexpected %q at position %d of miniscript", expr[parser.pos:], parser.pos)
+	}
+	if m.typ == 0 {
+		return nil, errors.New("miniscript doesn't type check")
+	}
+	if !m.typ.Has("B") {
+		return nil, fmt.Errorf("miniscript of type %q is not B", m.typ)
+	}
+	return m, nil
+}
+
+type miniscriptParser struct {
+	expr string
+	pos  int
+}
+
+// Reads a name or an argument, up to the next parenthesis or comma
+func (p *miniscriptParser) word() string {
+	start := p.pos
+	for p.pos < len(p.expr) && !strings.ContainsRune("(),", rune(p.expr[p.pos])) {
+		p.pos++
+	}
+	return p.expr[start:p.pos]
+}
+
+func (p *miniscriptParser) consume(c byte) bool {
+	if p.pos < len(p.expr) && p.expr[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *miniscriptParser) expect(c byte) error {
+	if !p.consume(c) {
+		return fmt.Errorf("expected '%c' at position %d of miniscript", c, p.pos)
+	}
+	return nil
+}
+
+// Reads the arguments between parentheses that aren't expressions
+func (p *miniscriptParser) words() ([]string, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	words := []string{p.word()}
+	for p.consume(',') {
+		words = append(words, p.word())
+	}
+	return words, p.expect(')')
+}
+
+// Reads count expressions between parentheses
+func (p *miniscriptParser) expressions(count int) ([]*Miniscript, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	subs := []*Miniscript{}
+	for index := 0; index < count; index++ {
+		if index > 0 {
+			if err := p.expect(','); err != nil {
+				return nil, err
+			}
+		}
+		sub, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, p.expect(')')
+}
+
+var miniscriptWrappers = map[byte]MiniscriptFragment{
+	'a': MINISCRIPT_WRAP_A,
+	's': MINISCRIPT_WRAP_S,
+	'c': MINISCRIPT_WRAP_C,
+	'd': MINISCRIPT_WRAP_D,
+	'v': MINISCRIPT_WRAP_V,
+	'j': MINISCRIPT_WRAP_J,
+	'n': MINISCRIPT_WRAP_N,
+}
+
+// Parses an expression with its wrappers, which apply from right to left
+func (p *miniscriptParser) expression() (*Miniscript, error) {
+	name := p.word()
+	wrappers := ""
+	if index := strings.IndexByte(name, ':'); index >= 0 {
+		wrappers, name = name[:index], name[index+1:]
+		if wrappers == "" {
+			return nil, errors.New("empty miniscript wrappers")
+		}
+	}
+	m, err := p.fragment(name)
+	if err != nil {
+		return nil, err
+	}
+	for index := len(wrappers) - 1; index >= 0; index-- {
+		switch wrapper := wrappers[index]; wrapper {
+		case 't':
+			m = newMiniscript(MINISCRIPT_AND_V, m, newMiniscript(MINISCRIPT_JUST_1))
+		case 'l':
+			m = newMiniscript(MINISCRIPT_OR_I, newMiniscript(MINISCRIPT_JUST_0), m)
+		case 'u':
+			m = newMiniscript(MINISCRIPT_OR_I, m, newMiniscript(MINISCRIPT_JUST_0))
+		default:
+			fragment, ok := miniscriptWrappers[wrapper]
+			if !ok {
+				return nil, fmt.Errorf("unknown miniscript wrapper %c", wrapper)
+			}
+			m = newMiniscript(fragment, m)
+		}
+	}
+	return m, nil
+}
+
+// Compressed public key argument of pk_k, pk_h and multi
+func parseMiniscriptKey(word string) ([]byte, error) {
+	sec, err := hex.DecodeString(word)
+	if err != nil || len(sec) != 33 {
+		return nil, fmt.Errorf("invalid miniscript key %s", word)
+	}
+	if _, err := ParseFromSec(sec); err != nil {
+		return nil, fmt.Errorf("invalid miniscript key %s: %w", word, err)
+	}
+	return sec, nil
+}
+
+// Decimal argument of older, after, thresh and multi, between min and max
+func parseMiniscriptNumber(word string, min int64, max int64) (int64, error) {
+	n, err := strconv.ParseInt(word, 10, 64)
+	if err != nil || !isDecimal(word) || n < min || n > max {
+		return 0, fmt.Errorf("invalid miniscript number %s", word)
+	}
+	return n, nil
+}
+
+func (p *miniscriptParser) fragment(name string) (*Miniscript, error) {
+	switch name {
+	case "pk", "pkh":
+		m, err := p.fragment(map[string]string{"pk": "pk_k", "pkh": "pk_h"}[name])
+		if err != nil {
+			return nil, err
+		}
+		return newMiniscript(MINISCRIPT_WRAP_C, m), nil
+	case "and_n":
+		subs, err := p.expressions(2)
+		if err != nil {
+			return nil, err
+		}
+		return newMiniscript(MINISCRIPT_ANDOR, subs[0], subs[1], newMiniscript(MINISCRIPT_JUST_0)), nil
+	}
+	fragment := MiniscriptFragment(-1)
+	for candidate, candidateName := range MINISCRIPT_FRAGMENT_NAMES {
+		if candidateName == name && !candidate.isWrapper() {
+			fragment = candidate
+		}
+	}
+	m := &Miniscript{Fragment: fragment}
+	switch fragment {
+	case MINISCRIPT_JUST_0, MINISCRIPT_JUST_1:
+	case MINISCRIPT_PK_K, MINISCRIPT_PK_H:
+		words, err := p.words()
+		if err != nil {
+			return nil, err
+		}
+		if len(words) != 1 {
+			return nil, fmt.Errorf("%s takes a single key", name)
+		}
+		sec, err := parseMiniscriptKey(words[0])
+		if err != nil {
+			return nil, err
+		}
+		m.Keys = [][]byte{sec}
+	case MINISCRIPT_OLDER, MINISCRIPT_AFTER:
+		words, err := p.words()
+		if err != nil {
+			return nil, err
+		}
+		if len(words) != 1 {
+			return nil, fmt.Errorf("%s takes a single lock time", name)
+		}
+		// Lock times have to fit in a positive 4 byte number
+		if m.K, err = parseMiniscriptNumber(words[0], 1, 0x7fffffff); err != nil {
+			return nil, err
+		}
+	case MINISCRIPT_SHA256, MINISCRIPT_HASH256, MINISCRIPT_RIPEMD160, MINISCRIPT_HASH160:
+		words, err := p.words()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := hex.DecodeString(words[0])
+		if err != nil || len(words) != 1 || len(hash) != miniscriptHashes[fragment].size {
+			return nil, fmt.Errorf("%s takes a %d byte hash", name, miniscriptHashes[fragment].size)
+		}
+		m.Hash = hash
+	case MINISCRIPT_MULTI:
+		words, err := p.words()
+		if err != nil {
+			return nil, err
+		}
+		for _, word := range words[1:] {
+			sec, err := parseMiniscriptKey(word)
+			if err != nil {
+				return nil, err
+			}
+			m.Keys = append(m.Keys, sec)
+		}
+		if len(m.Keys) > MINISCRIPT_MAX_MULTI_KEYS {
+			return nil, fmt.Errorf("multi takes at most %d keys", MINISCRIPT_MAX_MULTI_KEYS)
+		}
+		if m.K, err = parseMiniscriptNumber(words[0], 1, int64(len(m.Keys))); err != nil {
+			return nil, err
+		}
+	case MINISCRIPT_THRESH:
+		if err := p.expect('('); err != nil {
+			return nil, err
+		}
+		k := p.word()
+		for p.consume(',') {
+			sub, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			m.Subs = append(m.Subs, sub)
+		}
+		if err := p.expect(')'); err != nil {
+			return nil, err
+		}
+		var err error
+		if m.K, err = parseMiniscriptNumber(k, 1, int64(len(m.Subs))); err != nil {
+			return nil, err
+		}
+	case MINISCRIPT_ANDOR:
+		var err error
+		if m.Subs, err = p.expressions(3); err != nil {
+			return nil, err
+		}
+	case MINISCRIPT_AND_V, MINISCRIPT_AND_B, MINISCRIPT_OR_B, MINISCRIPT_OR_C, MINISCRIPT_OR_D, MINISCRIPT_OR_I:
+		var err error
+		if m.Subs, err = p.expressions(2); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown miniscript fragment %q", name)
+	}
+	return m.typed(), nil
+}
+
+// Prints the expression the way it is parsed back, using the aliases
+// and wrapper letters where they apply
+func (m *Miniscript) String() string {
+	wrappers := ""
+	node := m
+	for {
+		if node.Fragment == MINISCRIPT_WRAP_C && (node.Subs[0].Fragment == MINISCRIPT_PK_K || node.Subs[0].Fragment == MINISCRIPT_PK_H) {
+			break
+		}
+		if node.Fragment.isWrapper() {
+			wrappers += node.Fragment.String()
+			node = node.Subs[0]
+		} else if node.Fragment == MINISCRIPT_AND_V && node.Subs[1].Fragment == MINISCRIPT_JUST_1 {
+			wrappers += "t"
+			node = node.Subs[0]
+		} else if node.Fragment == MINISCRIPT_OR_I && node.Subs[0].Fragment == MINISCRIPT_JUST_0 {
+			wrappers += "l"
+			node = node.Subs[1]
+		} else if node.Fragment == MINISCRIPT_OR_I && node.Subs[1].Fragment == MINISCRIPT_JUST_0 {
+			wrappers += "u"
+			node = node.Subs[0]
+		} else {
+			break
+		}
+	}
+	if wrappers != "" {
+		wrappers += ":"
+	}
+
+	name := node.Fragment.String()
+	args := []string{}
+	subs := node.Subs
+	switch node.Fragment {
+	case MINISCRIPT_JUST_0, MINISCRIPT_JUST_1:
+		return wrappers + name
+	case MINISCRIPT_WRAP_C:
+		name = map[MiniscriptFragment]string{MINISCRIPT_PK_K: "pk", MINISCRIPT_PK_H: "pkh"}[subs[0].Fragment]
+		args = append(args, hex.EncodeToString(subs[0].Keys[0]))
+		subs = nil
+	case MINISCRIPT_OLDER, MINISCRIPT_AFTER:
+		args = append(args, strconv.FormatInt(node.K, 10))
+	case MINISCRIPT_SHA256, MINISCRIPT_HASH256, MINISCRIPT_RIPEMD160, MINISCRIPT_HASH160:
+		args = append(args, hex.EncodeToString(node.Hash))
+	case MINISCRIPT_THRESH, MINISCRIPT_MULTI:
+		args = append(args, strconv.FormatInt(node.K, 10))
+	case MINISCRIPT_ANDOR:
+		if subs[2].Fragment == MINISCRIPT_JUST_0 {
+			name = "and_n"
+			subs = subs[:2]
+		}
+	}
+	if node.Fragment != MINISCRIPT_WRAP_C {
+		for _, key := range node.Keys {
+			args = append(args, hex.EncodeToString(key))
+		}
+	}
+	for _, sub := range subs {
+		args = append(args, sub.String())
+	}
+	return wrappers + name + "(" + strings.Join(args, ",") + ")"
+}
+
+// Public keys of the expression, in the order they appear
+func (m *Miniscript) PubKeys() [][]byte {
+	keys := slices.Clone(m.Keys)
+	for _, sub := range m.Subs {
+		keys = append(keys, sub.PubKeys()...)
+	}
+	return keys
+}
+
+// Whether the expression is safe to use: every satisfaction needs a
+// signature, a non-malleable one always exists, lock times don't mix
+// heights and times, keys aren't repeated and the script is standard
+func (m *Miniscript) IsSane() bool {
+	if !m.typ.Has("Bmsk") {
+		return false
+	}
+	keys := map[string]bool{}
+	for _, key := range m.PubKeys() {
+		if keys[string(key)] {
+			return false
+		}
+		keys[string(key)] = true
+	}
+	return len(m.Serialize()) <= MAX_STANDARD_P2WSH_SCRIPT_SIZE
+}
+
+// Turns the last operation into its VERIFY version, or appends OP_VERIFY
+func verifyOperations(cmds []Operation) []Operation {
+	verify := map[int]Operation{
+		135: &OP_EQUALVERIFY{},
+		156: &OP_NUMEQUALVERIFY{},
+		172: &OP_CHECKSIGVERIFY{},
+		174: &OP_CHECKMULTISIGVERIFY{},
+	}
+	if op, ok := verify[cmds[len(cmds)-1].Num()]; ok {
+		return append(slices.Clone(cmds[:len(cmds)-1]), op)
+	}
+	return append(slices.Clone(cmds), &OP_VERIFY{})
+}
+
+func (m *Miniscript) operations() []Operation {
+	subs := make([][]Operation, len(m.Subs))
+	for index, sub := range m.Subs {
+		subs[index] = sub.operations()
+	}
+	switch m.Fragment {
+	case MINISCRIPT_JUST_0:
+		return []Operation{&OP_0{}}
+	case MINISCRIPT_JUST_1:
+		return []Operation{&OP_1{}}
+	case MINISCRIPT_PK_K:
+		return []Operation{&ScriptVal{m.Keys[0]}}
+	case MINISCRIPT_PK_H:
+		return []Operation{&OP_DUP{}, &OP_HASH160{}, &ScriptVal{Hash160(m.Keys[0])}, &OP_EQUALVERIFY{}}
+	case MINISCRIPT_OLDER:
+		return []Operation{numberOperation(m.K), &OP_CHECKSEQUENCEVERIFY{}}
+	case MINISCRIPT_AFTER:
+		return []Operation{numberOperation(m.K), &OP_CHECKLOCKTIMEVERIFY{}}
+	case MINISCRIPT_SHA256, MINISCRIPT_HASH256, MINISCRIPT_RIPEMD160, MINISCRIPT_HASH160:
+		return []Operation{&OP_SIZE{}, numberOperation(32), &OP_EQUALVERIFY{}, miniscriptHashes[m.Fragment].op, &ScriptVal{m.Hash}, &OP_EQUAL{}}
+	case MINISCRIPT_WRAP_A:
+		return slices.Concat([]Operation{&OP_TOALTSTACK{}}, subs[0], []Operation{&OP_FROMALTSTACK{}})
+	case MINISCRIPT_WRAP_S:
+		return slices.Concat([]Operation{&OP_SWAP{}}, subs[0])
+	case MINISCRIPT_WRAP_C:
+		return slices.Concat(subs[0], []Operation{&OP_CHECKSIG{}})
+	case MINISCRIPT_WRAP_D:
+		return slices.Concat([]Operation{&OP_DUP{}, &OP_IF{}}, subs[0], []Operation{&OP_ENDIF{}})
+	case MINISCRIPT_WRAP_V:
+		return verifyOperations(subs[0])
+	case MINISCRIPT_WRAP_J:
+		return slices.Concat([]Operation{&OP_SIZE{}, &OP_0NOTEQUAL{}, &OP_IF{}}, subs[0], []Operation{&OP_ENDIF{}})
+	case MINISCRIPT_WRAP_N:
+		return slices.Concat(subs[0], []Operation{&OP_0NOTEQUAL{}})
+	case MINISCRIPT_AND_V:
+		return slices.Concat(subs[0], subs[1])
+	case MINISCRIPT_AND_B:
+		return slices.Concat(subs[0], subs[1], []Operation{&OP_BOOLAND{}})
+	case MINISCRIPT_OR_B:
+		return slices.Concat(subs[0], subs[1], []Operation{&OP_BOOLOR{}})
+	case MINISCRIPT_OR_C:
+		return slices.Concat(subs[0], []Operation{&OP_NOTIF{}}, subs[1], []Operation{&OP_ENDIF{}})
+	case MINISCRIPT_OR_D:
+		return slices.Concat(subs[0], []Operation{&OP_IFDUP{}, &OP_NOTIF{}}, subs[1], []Operation{&OP_ENDIF{}})
+	case MINISCRIPT_OR_I:
+		return slices.Concat([]Operation{&OP_IF{}}, subs[0], []Operation{&OP_ELSE{}}, subs[1], []Operation{&OP_ENDIF{}})
+	case MINISCRIPT_ANDOR:
+		return slices.Concat(subs[0], []Operation{&OP_NOTIF{}}, subs[2], []Operation{&OP_ELSE{}}, subs[1], []Operation{&OP_ENDIF{}})
+	case MINISCRIPT_THRESH:
+		cmds := slices.Clone(subs[0])
+		for _, sub := range subs[1:] {
+			cmds = append(append(cmds, sub...), &OP_ADD{})
+		}
+		return append(cmds, numberOperation(m.K), &OP_EQUAL{})
+	case MINISCRIPT_MULTI:
+		cmds := []Operation{numberOperation(m.K)}
+		for _, key := range m.Keys {
+			cmds = append(cmds, &ScriptVal{key})
+		}
+		return append(cmds, numberOperation(int64(len(m.Keys))), &OP_CHECKMULTISIG{})
+	}
+	return nil
+}
+
+// The witness script the expression compiles to
+func (m *Miniscript) Script() *Script {
+	return NewScript(m.operations())
+}
+
+func (m *Miniscript) Serialize() []byte {
+	return serializeScriptToBytes(m.operations())
+}
+
+// The P2WSH output paying to the witness script
+func (m *Miniscript) ScriptPubKey() *ScriptPubKey {
+	return P2WSHPubKey(Sha256(m.Serialize()))
+}
+
+func (m *Miniscript) Address(params *ChainParams) string {
+	return P2WSHAddress(m.Serialize(), params)
+}
+
+// Largest satisfaction or dissatisfaction of an expression, in bytes
+// of its witness elements with their lengths and in elements
+type satisfactionSize struct {
+	ok       bool
+	size     int
+	elements int
+}
+
+// Elements of the given lengths, all shorter than 253 bytes
+func satisfactionElements(lengths ...int) satisfactionSize {
+	size := satisfactionSize{true, 0, len(lengths)}
+	for _, length := range lengths {
+		size.size += 1 + length
+	}
+	return size
+}
+
+func (a satisfactionSize) plus(b satisfactionSize) satisfactionSize {
+	if !a.ok || !b.ok {
+		return satisfactionSize{}
+	}
+	return satisfactionSize{true, a.size + b.size, a.elements + b.elements}
+}
+
+func (a satisfactionSize) max(b satisfactionSize) satisfactionSize {
+	if !b.ok || a.ok && (a.size > b.size || a.size == b.size && a.elements >= b.elements) {
+		return a
+	}
+	return b
+}
+
+// Size of signatures in witnesses, with low S and the sighash type
+const MINISCRIPT_SIGNATURE_SIZE = ESTIMATED_SIGNATURE_SIZE
+
+// Largest non-malleable satisfaction and dissatisfaction of the expression
+func (m *Miniscript) maxSizes() (satisfactionSize, satisfactionSize) {
+	sats := make([]satisfactionSize, len(m.Subs))
+	dsats := make([]satisfactionSize, len(m.Subs))
+	for index, sub := range m.Subs {
+		sats[index], dsats[index] = sub.maxSizes()
+	}
+	none := satisfactionSize{}
+	switch m.Fragment {
+	case MINISCRIPT_JUST_0:
+		return none, satisfactionElements()
+	case MINISCRIPT_JUST_1, MINISCRIPT_OLDER, MINISCRIPT_AFTER:
+		return satisfactionElements(), none
+	case MINISCRIPT_PK_K:
+		return satisfactionElements(MINISCRIPT_SIGNATURE_SIZE), satisfactionElements(0)
+	case MINISCRIPT_PK_H:
+		return satisfactionElements(MINISCRIPT_SIGNATURE_SIZE, 33), satisfactionElements(0, 33)
+	case MINISCRIPT_SHA256, MINISCRIPT_HASH256, MINISCRIPT_RIPEMD160, MINISCRIPT_HASH160:
+		return satisfactionElements(32), satisfactionElements(32)
+	case MINISCRIPT_WRAP_A, MINISCRIPT_WRAP_S, MINISCRIPT_WRAP_C, MINISCRIPT_WRAP_N:
+		return sats[0], dsats[0]
+	case MINISCRIPT_WRAP_D:
+		return sats[0].plus(satisfactionElements(1)), satisfactionElements(0)
+	case MINISCRIPT_WRAP_V:
+		return sats[0], none
+	case MINISCRIPT_WRAP_J:
+		return sats[0], satisfactionElements(0)
+	case MINISCRIPT_AND_V:
+		return sats[0].plus(sats[1]), none
+	case MINISCRIPT_AND_B:
+		return sats[0].plus(sats[1]), dsats[0].plus(dsats[1])
+	case MINISCRIPT_OR_B:
+		return sats[0].plus(dsats[1]).max(dsats[0].plus(sats[1])), dsats[0].plus(dsats[1])
+	case MINISCRIPT_OR_C:
+		return sats[0].max(dsats[0].plus(sats[1])), none
+	case MINISCRIPT_OR_D:
+		return sats[0].max(dsats[0].plus(sats[1])), dsats[0].plus(dsats[1])
+	case MINISCRIPT_OR_I:
+		return sats[0].plus(satisfactionElements(1)).max(sats[1].plus(satisfactionElements(0))),
+			dsats[0].plus(satisfactionElements(1)).max(dsats[1].plus(satisfactionElements(0)))
+	case MINISCRIPT_ANDOR:
+		return sats[0].plus(sats[1]).max(dsats[0].plus(sats[2])), dsats[0].plus(dsats[2])
+	case MINISCRIPT_MULTI:
+		lengths := []int{0}
+		for range m.K {
+			lengths = append(lengths, MINISCRIPT_SIGNATURE_SIZE)
+		}
+		dsat := satisfactionElements(make([]int, m.K+1)...)
+		return satisfactionElements(lengths...), dsat
+	case MINISCRIPT_THRESH:
+		// satisfied[i] is the largest with i of the subexpressions satisfied
+		satisfied := []satisfactionSize{satisfactionElements()}
+		for index := range m.Subs {
+			next := []satisfactionSize{satisfied[0].plus(dsats[index])}
+			for i := 1; i < len(satisfied); i++ {
+				next = append(next, satisfied[i].plus(dsats[index]).max(satisfied[i-1].plus(sats[index])))
+			}
+			next = append(next, satisfied[len(satisfied)-1].plus(sats[index]))
+			satisfied = next
+		}
+		return satisfied[m.K], satisfied[0]
+	}
+	return none, none
+}
+
+// Largest witness spending the P2WSH output of the expression: its
+// element count, the elements of the largest satisfaction and the
+// witness script. False when it can't be satisfied
+func (m *Miniscript) MaxWitnessSize() (int, bool) {
+	sat, _ := m.maxSizes()
+	if !sat.ok {
+		return 0, false
+	}
+	script := len(m.Serialize())
+	return len(EncodeVarInt(uint64(sat.elements+1))) + sat.size + len(EncodeVarInt(uint64(script))) + script, true
+}
+
+// Source of what satisfies an expression. Signature and Preimage return
+// nil when they aren't available, the preimage is checked against the
+// hash function of the fragment
+type Satisfier interface {
+	Signature(pubkey []byte) []byte
+	Preimage(hash []byte) []byte
+	CheckOlder(sequence uint32) bool
+	CheckAfter(locktime uint32) bool
+}
+
+// Satisfaction or dissatisfaction of an expression, like Bitcoin Core's
+// InputStack. The elements are in witness order, the top of the stack last
+type miniscriptStack struct {
+	available bool
+	hasSig    bool
+	malleable bool
+	elements  [][]byte
+}
+
+func stackOf(elements ...[]byte) miniscriptStack {
+	return miniscriptStack{available: true, elements: elements}
+}
+
+func (s miniscriptStack) size() int {
+	size := 0
+	for _, element := range s.elements {
+		size += len(EncodeVarInt(uint64(len(element)))) + len(element)
+	}
+	return size
+}
+
+// The elements of s under the ones of other
+func (s miniscriptStack) concat(other miniscriptStack) miniscriptStack {
+	if !s.available || !other.available {
+		return miniscriptStack{}
+	}
+	return miniscriptStack{true, s.hasSig || other.hasSig, s.malleable || other.malleable, slices.Concat(s.elements, other.elements)}
+}
+
+// Picks between two alternatives the way Bitcoin Core does: a third
+// party can't forge an alternative needing a signature, so when only
+// one of them doesn't need one it is the only non-malleable choice
+func (s miniscriptStack) choose(other miniscriptStack) miniscriptStack {
+	if !s.available {
+		return other
+	}
+	if !other.available {
+		return s
+	}
+	if !s.hasSig && other.hasSig {
+		return s
+	}
+	if s.hasSig && !other.hasSig {
+		return other
+	}
+	if !s.hasSig && !other.hasSig {
+		s.malleable, other.malleable = true, true
+	} else if s.malleable != other.malleable {
+		if s.malleable {
+			return other
+		}
+		return s
+	}
+	if other.size() < s.size() {
+		return other
+	}
+	return s
+}
+
+// Non-malleable satisfaction and dissatisfaction of the expression
+func (m *Miniscript) satisfactions(satisfier Satisfier) (miniscriptStack, miniscriptStack) {
+	sats := make([]miniscriptStack, len(m.Subs))
+	dsats := make([]miniscriptStack, len(m.Subs))
+	for index, sub := range m.Subs {
+		sats[index], dsats[index] = sub.satisfactions(satisfier)
+	}
+	none := miniscriptStack{}
+	zero, one := stackOf([]byte{}), stackOf([]byte{1})
+	signature := func(key []byte) miniscriptStack {
+		if sig := satisfier.Signature(key); sig != nil {
+			return miniscriptStack{available: true, hasSig: true, elements: [][]byte{sig}}
+		}
+		return none
+	}
+	switch m.Fragment {
+	case MINISCRIPT_JUST_0:
+		return none, stackOf()
+	case MINISCRIPT_JUST_1:
+		return stackOf(), none
+	case MINISCRIPT_PK_K:
+		return signature(m.Keys[0]), zero
+	case MINISCRIPT_PK_H:
+		return signature(m.Keys[0]).concat(stackOf(m.Keys[0])), stackOf([]byte{}, m.Keys[0])
+	case MINISCRIPT_OLDER:
+		if satisfier.CheckOlder(uint32(m.K)) {
+			return stackOf(), none
+		}
+		return none, none
+	case MINISCRIPT_AFTER:
+		if satisfier.CheckAfter(uint32(m.K)) {
+			return stackOf(), none
+		}
+		return none, none
+	case MINISCRIPT_SHA256, MINISCRIPT_HASH256, MINISCRIPT_RIPEMD160, MINISCRIPT_HASH160:
+		// Anyone can replace a dissatisfying preimage with another one
+		dsat := stackOf(make([]byte, 32))
+		dsat.malleable = true
+		preimage := satisfier.Preimage(m.Hash)
+		if len(preimage) != 32 || !bytes.Equal(miniscriptHashes[m.Fragment].hash(preimage), m.Hash) {
+			return none, dsat
+		}
+		return stackOf(preimage), dsat
+	case MINISCRIPT_WRAP_A, MINISCRIPT_WRAP_S, MINISCRIPT_WRAP_C, MINISCRIPT_WRAP_N:
+		return sats[0], dsats[0]
+	case MINISCRIPT_WRAP_D:
+		return sats[0].concat(one), zero
+	case MINISCRIPT_WRAP_V:
+		return sats[0], none
+	case MINISCRIPT_WRAP_J:
+		// When the subexpression can be dissatisfied without a signature,
+		// a non-zero top element would dissatisfy it as well
+		dsat := zero
+		dsat.malleable = dsats[0].available && !dsats[0].hasSig
+		return sats[0], dsat
+	case MINISCRIPT_AND_V:
+		// Never needed, but it can make other alternatives malleable
+		return sats[1].concat(sats[0]), dsats[1].concat(sats[0])
+	case MINISCRIPT_AND_B:
+		dsat := dsats[1].concat(dsats[0])
+		for _, other := range []miniscriptStack{sats[1].concat(dsats[0]), dsats[1].concat(sats[0])} {
+			other.malleable = true
+			dsat = dsat.choose(other)
+		}
+		return sats[1].concat(sats[0]), dsat
+	case MINISCRIPT_OR_B:
+		// Satisfying both is overcomplete, either one can be dissatisfied
+		both := sats[1].concat(sats[0])
+		both.malleable = true
+		return dsats[1].concat(sats[0]).choose(sats[1].concat(dsats[0])).choose(both), dsats[1].concat(dsats[0])
+	case MINISCRIPT_OR_C:
+		return sats[0].choose(sats[1].concat(dsats[0])), none
+	case MINISCRIPT_OR_D:
+		return sats[0].choose(sats[1].concat(dsats[0])), dsats[1].concat(dsats[0])
+	case MINISCRIPT_OR_I:
+		return sats[0].concat(one).choose(sats[1].concat(zero)), dsats[0].concat(one).choose(dsats[1].concat(zero))
+	case MINISCRIPT_ANDOR:
+		return sats[1].concat(sats[0]).choose(sats[2].concat(dsats[0])), dsats[1].concat(sats[0]).choose(dsats[2].concat(dsats[0]))
+	case MINISCRIPT_MULTI:
+		// Signatures follow the order of the keys, after the dummy element
+		sat := zero
+		for _, key := range m.Keys {
+			if sig := signature(key); sig.available && len(sat.elements) <= int(m.K) {
+				sat = sat.concat(sig)
+			}
+		}
+		if len(sat.elements) <= int(m.K) {
+			sat = none
+		}
+		return sat, stackOf(make([][]byte, m.K+1)...)
+	case MINISCRIPT_THRESH:
+		// satisfied[i] satisfies i of the subexpressions. The first one
+		// runs first, so its elements go on top
+		satisfied := []miniscriptStack{stackOf()}
+		for index := len(m.Subs) - 1; index >= 0; index-- {
+			next := []miniscriptStack{satisfied[0].concat(dsats[index])}
+			for i := 1; i < len(satisfied); i++ {
+				next = append(next, satisfied[i].concat(dsats[index]).choose(satisfied[i-1].concat(sats[index])))
+			}
+			next = append(next, satisfied[len(satisfied)-1].concat(sats[index]))
+			satisfied = next
+		}
+		// Satisfying some but not k of them dissatisfies as well, but
+		// anyone can turn such a satisfaction into a dissatisfaction
+		dsat := none
+		for count, stack := range satisfied {
+			if count != 0 && count != int(m.K) {
+				stack.malleable = true
+			}
+			if count != int(m.K) {
+				dsat = dsat.choose(stack)
+			}
+		}
+		return satisfied[m.K], dsat
+	}
+	return none, none
+}
+
+// Builds the witness stack satisfying the expression, without the
+// witness script. Fails when what the satisfier provides isn't enough
+// or when the satisfaction it allows could be malleated
+func (m *Miniscript) Satisfy(satisfier Satisfier) ([][]byte, error) {
+	if !m.Type().Has("m") {
+		return nil, errors.New("the miniscript only has malleable satisfactions")
+	}
+	sat, _ := m.satisfactions(satisfier)
+	if !sat.available {
+		return nil, errors.New("missing signatures, preimages or lock times to satisfy the miniscript")
+	}
+	if sat.malleable || !sat.hasSig {
+		return nil, errors.New("the miniscript only has malleable satisfactions")
+	}
+	for index, element := range sat.elements {
+		if element == nil {
+			sat.elements[index] = []byte{}
+		}
+	}
+	return sat.elements, nil
+}
+
+// Satisfies a miniscript with the partial signatures and preimages of
+// a PSBT input, spent by the input of the transaction
+type psbtSatisfier struct {
+	in  *PsbtInput
+	ctx *ExecutionContext
+}
+
+func (s *psbtSatisfier) Signature(pubkey []byte) []byte {
+	return s.in.PartialSigs[hex.EncodeToString(pubkey)]
+}
+
+func (s *psbtSatisfier) Preimage(hash []byte) []byte {
+	for keyType := range PSBT_PREIMAGE_HASHES {
+		if preimage, ok := s.in.preimages(keyType)[hex.EncodeToString(hash)]; ok {
+			return preimage
+		}
+	}
+	return nil
+}
+
+func (s *psbtSatisfier) CheckOlder(sequence uint32) bool {
+	return s.ctx.checkSequence(int64(sequence))
+}
+
+func (s *psbtSatisfier) CheckAfter(locktime uint32) bool {
+	return s.ctx.checkLockTime(int64(locktime))
+}
+
+// Returns the function satisfying the script of the input with the
+// miniscript it was compiled from
+func (in *PsbtInput) satisfyMiniscript(ms *Miniscript, tx *Transaction, input int) func(*ScriptPubKey) ([][]byte, error) {
+	return func(script *ScriptPubKey) ([][]byte, error) {
+		if !bytes.Equal(serializeScriptToBytes(script.cmds), ms.Serialize()) {
+			return nil, errors.New("script doesn't match the miniscript")
+		}
+		return ms.Satisfy(&psbtSatisfier{in, &ExecutionContext{tx: tx, input: input}})
+	}
+}
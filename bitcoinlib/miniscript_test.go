@@ -0,0 +1,309 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"bytes"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type miniscriptKeys struct {
+	keys []*bitcoinlib.PrivateKey
+	hex  map[string]string
+}
+
+// Keys named A, B and C, replaced by their hex in expressions
+func newMiniscriptKeys() *miniscriptKeys {
+	k := &miniscriptKeys{hex: map[string]string{}}
+	for index, name := range []string{"A", "B", "C"} {
+		key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(7001 + index))
+		k.keys = append(k.keys, key)
+		sec := key.Sec(bitcoinlib.COMPRESSED)
+		k.hex[name] = hex.EncodeToString(sec)
+		k.hex["h"+name] = hex.EncodeToString(bitcoinlib.Hash160(sec))
+	}
+	k.hex["H"] = hex.EncodeToString(bitcoinlib.Sha256(miniscriptPreimage))
+	return k
+}
+
+var miniscriptNames = regexp.MustCompile(`\b(h?[ABC]|H)\b`)
+
+func (k *miniscriptKeys) expand(expr string) string {
+	return miniscriptNames.ReplaceAllStringFunc(expr, func(name string) string {
+		return k.hex[name]
+	})
+}
+
+var miniscriptPreimage = bytes.Repeat([]byte{0x77}, 32)
+
+func TestMiniscriptParse(t *testing.T) {
+	k := newMiniscriptKeys()
+	vectors := []struct {
+		expr    string
+		printed string
+		typ     string
+		asm     string
+		sane    bool
+	}{
+		{"pk(A)", "pk(A)", "Bonduesmk", "A OP_CHECKSIG", true},
+		{"c:pk_k(A)", "pk(A)", "Bonduesmk", "A OP_CHECKSIG", true},
+		{"pkh(A)", "pkh(A)", "Bnduesmk", "OP_DUP OP_HASH160 hA OP_EQUALVERIFY OP_CHECKSIG", true},
+		{"or_d(pk(A),and_v(v:pkh(B),older(144)))", "or_d(pk(A),and_v(v:pkh(B),older(144)))", "Bfsmhk",
+			"A OP_CHECKSIG OP_IFDUP OP_NOTIF OP_DUP OP_HASH160 hB OP_EQUALVERIFY OP_CHECKSIGVERIFY 144 OP_CHECKSEQUENCEVERIFY OP_ENDIF", true},
+		{"and_v(v:pk(A),sha256(H))", "and_v(v:pk(A),sha256(H))", "Bnufsmk",
+			"A OP_CHECKSIGVERIFY OP_SIZE 32 OP_EQUALVERIFY OP_SHA256 H OP_EQUAL", true},
+		{"multi(2,A,B,C)", "multi(2,A,B,C)", "Bnduesmk", "2 A B C 3 OP_CHECKMULTISIG", true},
+		{"thresh(2,pk(A),s:pk(B),a:pkh(C))", "thresh(2,pk(A),s:pk(B),a:pkh(C))", "Bduesmk",
+			"A OP_CHECKSIG OP_SWAP B OP_CHECKSIG OP_ADD OP_TOALTSTACK OP_DUP OP_HASH160 hC OP_EQUALVERIFY OP_CHECKSIG OP_FROMALTSTACK OP_ADD 2 OP_EQUAL", true},
+		{"and_v(v:pk(A),1)", "tv:pk(A)", "Bonufsmk", "A OP_CHECKSIGVERIFY 1", true},
+		{"or_i(0,pk(A))", "l:pk(A)", "Bdusmk", "OP_IF 0 OP_ELSE A OP_CHECKSIG OP_ENDIF", true},
+		{"andor(pk(A),pk(B),0)", "and_n(pk(A),pk(B))", "Bduesmk", "A OP_CHECKSIG OP_NOTIF 0 OP_ELSE B OP_CHECKSIG OP_ENDIF", true},
+		{"or_b(pk(A),a:pk(B))", "or_b(pk(A),a:pk(B))", "Bduesmk",
+			"A OP_CHECKSIG OP_TOALTSTACK B OP_CHECKSIG OP_FROMALTSTACK OP_BOOLOR", true},
+		{"andor(pk(A),after(500000001),n:pk(B))", "andor(pk(A),after(500000001),n:pk(B))", "Bdesmik",
+			"A OP_CHECKSIG OP_NOTIF B OP_CHECKSIG OP_0NOTEQUAL OP_ELSE 500000001 OP_CHECKLOCKTIMEVERIFY OP_ENDIF", true},
+		{"t:or_c(pk(A),v:ripemd160(hA))", "t:or_c(pk(A),v:ripemd160(hA))", "Bufmk",
+			"A OP_CHECKSIG OP_NOTIF OP_SIZE 32 OP_EQUALVERIFY OP_RIPEMD160 hA OP_EQUALVERIFY OP_ENDIF 1", false},
+		// Valid but not sane: no signature needed, a repeated key, mixed lock times
+		{"or_i(older(1),pk(A))", "or_i(older(1),pk(A))", "Bdemhk", "OP_IF 1 OP_CHECKSEQUENCEVERIFY OP_ELSE A OP_CHECKSIG OP_ENDIF", false},
+		{"or_d(j:pkh(A),pk(B))", "or_d(j:pkh(A),pk(B))", "Bduesk",
+			"OP_SIZE OP_0NOTEQUAL OP_IF OP_DUP OP_HASH160 hA OP_EQUALVERIFY OP_CHECKSIG OP_ENDIF OP_IFDUP OP_NOTIF B OP_CHECKSIG OP_ENDIF", false},
+		{"and_v(v:pk(A),pk(A))", "and_v(v:pk(A),pk(A))", "Bnufsmk", "A OP_CHECKSIGVERIFY A OP_CHECKSIG", false},
+		{"and_v(v:pk(A),and_b(after(500000001),a:after(10)))", "and_v(v:pk(A),and_b(after(500000001),a:after(10)))", "Bnufsmij",
+			"A OP_CHECKSIGVERIFY 500000001 OP_CHECKLOCKTIMEVERIFY OP_TOALTSTACK 10 OP_CHECKLOCKTIMEVERIFY OP_FROMALTSTACK OP_BOOLAND", false},
+	}
+	for index, vector := range vectors {
+		ms, err := bitcoinlib.ParseMiniscript(k.expand(vector.expr))
+		if err != nil {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s", index, vector.expr, err)
+		}
+		if ms.String() != k.expand(vector.printed) || ms.Type().String() != vector.typ || ms.IsSane() != vector.sane {
+			t.Fatalf("Failed at index %d\nExpected => %s %s %t\nGot => %s %s %t", index, k.expand(vector.printed), vector.typ, vector.sane, ms, ms.Type(), ms.IsSane())
+		}
+		if asm := ms.Script().String(); asm != k.expand(vector.asm) {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s", index, k.expand(vector.asm), asm)
+		}
+	}
+}
+
+func TestMiniscriptParseErrors(t *testing.T) {
+	k := newMiniscriptKeys()
+	vectors := []string{
+		"and_v(pk(A),pk(B))",    // the first of and_v has to be V
+		"or_b(pk(A),pk(B))",     // the second of or_b has to be W
+		"v:pk(A)",               // not B at the top
+		"thresh(1,pk(A),pk(B))", // subexpressions after the first have to be W
+		"older(0)",
+		"after(2147483648)",
+		"thresh(0,pk(A))",
+		"multi(3,A,B)",
+		"pk(02ff)",
+		"sha256(hA)",
+		"hash160(H)",
+		"foo(A)",
+		"x:pk(A)",
+		":pk(A)",
+		"pk(A)x",
+		"and_v(v:pk(A)",
+		"a(pk(A))",
+	}
+	for index, vector := range vectors {
+		if ms, err := bitcoinlib.ParseMiniscript(k.expand(vector)); err == nil {
+			t.Fatalf("Failed at index %d\nExpected => error for %s\nGot => %s", index, vector, ms)
+		}
+	}
+}
+
+func TestMiniscriptMaxWitnessSize(t *testing.T) {
+	k := newMiniscriptKeys()
+	vectors := []struct {
+		expr     string
+		expected int
+	}{
+		// Count, the signature with its length, a dissatisfied pk(A) and
+		// the key of pkh(B), then the script
+		{"or_d(pk(A),and_v(v:pkh(B),older(144)))", 1 + 108 + 1 + 67},
+		{"multi(2,A,B,C)", 1 + 1 + 2*73 + 1 + 105},
+		{"and_v(v:pk(A),sha256(H))", 1 + 73 + 33 + 1 + 74},
+		{"or_i(pk(A),pkh(B))", 1 + 108 + 1 + 63},
+	}
+	for index, vector := range vectors {
+		ms, err := bitcoinlib.ParseMiniscript(k.expand(vector.expr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size, ok := ms.MaxWitnessSize(); !ok || size != vector.expected {
+			t.Fatalf("Failed at index %d\nExpected => %d\nGot => %d %t", index, vector.expected, size, ok)
+		}
+	}
+}
+
+// Signatures and preimages by name, and the lock times reached
+type testSatisfier struct {
+	k        *miniscriptKeys
+	sigs     []string
+	preimage bool
+	sequence uint32
+	locktime uint32
+}
+
+func (s *testSatisfier) Signature(pubkey []byte) []byte {
+	for _, name := range s.sigs {
+		if s.k.hex[name] == hex.EncodeToString(pubkey) {
+			return []byte("sig" + name)
+		}
+	}
+	return nil
+}
+
+func (s *testSatisfier) Preimage(hash []byte) []byte {
+	if s.preimage {
+		return miniscriptPreimage
+	}
+	return nil
+}
+
+func (s *testSatisfier) CheckOlder(sequence uint32) bool {
+	return sequence <= s.sequence
+}
+
+func (s *testSatisfier) CheckAfter(locktime uint32) bool {
+	return locktime <= s.locktime
+}
+
+func TestMiniscriptSatisfy(t *testing.T) {
+	k := newMiniscriptKeys()
+	preimage := hex.EncodeToString(miniscriptPreimage)
+	vectors := []struct {
+		expr     string
+		sigs     []string
+		preimage bool
+		sequence uint32
+		expected string // stack in hex, bottom first, empty on error
+	}{
+		{"or_d(pk(A),and_v(v:pkh(B),older(144)))", []string{"A"}, false, 0, "73696741"},
+		{"or_d(pk(A),and_v(v:pkh(B),older(144)))", []string{"B"}, false, 144, "73696742 B "},
+		{"or_d(pk(A),and_v(v:pkh(B),older(144)))", []string{"A", "B"}, false, 144, "73696741"},
+		{"or_d(pk(A),and_v(v:pkh(B),older(144)))", []string{"B"}, false, 143, ""},
+		{"or_d(pk(A),and_v(v:pkh(B),older(144)))", nil, false, 144, ""},
+		{"and_v(v:pk(A),sha256(H))", []string{"A"}, true, 0, preimage + " 73696741"},
+		{"and_v(v:pk(A),sha256(H))", []string{"A"}, false, 0, ""},
+		{"multi(2,A,B,C)", []string{"A", "C"}, false, 0, " 73696741 73696743"},
+		{"multi(2,A,B,C)", []string{"A", "B", "C"}, false, 0, " 73696741 73696742"},
+		{"multi(2,A,B,C)", []string{"B"}, false, 0, ""},
+		{"thresh(2,pk(A),s:pk(B),a:pkh(C))", []string{"A", "C"}, false, 0, "73696743 C  73696741"},
+		{"or_i(pk(A),pkh(B))", []string{"B"}, false, 0, "73696742 B "},
+		// Without a signature anyone could replace the preimage, and
+		// any other 32 bytes dissatisfy the hash as well
+		{"or_d(sha256(H),pk(A))", nil, true, 0, ""},
+		{"or_d(sha256(H),pk(A))", []string{"A"}, false, 0, ""},
+		// A non-zero top element also dissatisfies j:pkh(A)
+		{"or_d(j:pkh(A),pk(B))", []string{"B"}, false, 0, ""},
+		{"or_b(pk(A),s:pk(B))", []string{"A", "B"}, false, 0, " 73696741"},
+	}
+	for index, vector := range vectors {
+		ms, err := bitcoinlib.ParseMiniscript(k.expand(vector.expr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stack, err := ms.Satisfy(&testSatisfier{k, vector.sigs, vector.preimage, vector.sequence, 0})
+		items := []string{}
+		for _, item := range stack {
+			items = append(items, hex.EncodeToString(item))
+		}
+		got := strings.Join(items, " ")
+		expected := k.expand(vector.expected)
+		if (err != nil) != (expected == "") || got != expected {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s %v", index, expected, got, err)
+		}
+	}
+}
+
+func TestSignMiniscript(t *testing.T) {
+	k := newMiniscriptKeys()
+	recovery, err := bitcoinlib.ParseMiniscript(k.expand("or_d(pk(A),and_v(v:pkh(B),older(144)))"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors := []struct {
+		keys     []*bitcoinlib.PrivateKey
+		sequence uint32
+		valid    bool
+	}{
+		{k.keys[:1], bitcoinlib.SEQUENCE_FINAL, true},
+		{k.keys[1:2], 144, true},
+		{k.keys[1:2], 143, false},
+		{k.keys[1:2], bitcoinlib.SEQUENCE_FINAL, false},
+		{k.keys[2:], 144, false},
+	}
+	for index, vector := range vectors {
+		tx, provider := spendOutput(recovery.ScriptPubKey(), 2, 0, vector.sequence)
+		err := tx.SignMiniscript(0, provider, recovery, vector.keys, nil, bitcoinlib.SIGHASH_ALL)
+		if (err == nil) != vector.valid {
+			t.Fatalf("Failed at index %d\nExpected => %t\nGot => %v", index, vector.valid, err)
+		}
+		if err == nil {
+			if err := tx.ValidateInput(0, provider, bitcoinlib.SCRIPT_VERIFY_STANDARD); err != nil {
+				t.Fatalf("Failed at index %d\nExpected => valid input\nGot => %s", index, err)
+			}
+		}
+	}
+
+	hashLock, _ := bitcoinlib.ParseMiniscript(k.expand("and_v(v:pk(A),sha256(H))"))
+	tx, provider := spendOutput(hashLock.ScriptPubKey(), 2, 0, bitcoinlib.SEQUENCE_FINAL)
+	if err := tx.SignMiniscript(0, provider, hashLock, k.keys[:1], [][]byte{bytes.Repeat([]byte{0x66}, 32)}, bitcoinlib.SIGHASH_ALL); err == nil {
+		t.Fatal("Signed with the preimage of another hash")
+	}
+	if err := tx.SignMiniscript(0, provider, hashLock, k.keys[:1], [][]byte{miniscriptPreimage}, bitcoinlib.SIGHASH_ALL); err != nil {
+		t.Fatalf("Failed signing hash lock: %s", err)
+	}
+	if err := tx.ValidateInput(0, provider, bitcoinlib.SCRIPT_VERIFY_STANDARD); err != nil {
+		t.Fatalf("Failed validating hash lock: %s", err)
+	}
+
+	malleable, _ := bitcoinlib.ParseMiniscript(k.expand("or_d(j:pkh(A),pk(B))"))
+	tx, provider = spendOutput(malleable.ScriptPubKey(), 2, 0, bitcoinlib.SEQUENCE_FINAL)
+	if err := tx.SignMiniscript(0, provider, malleable, k.keys, nil, bitcoinlib.SIGHASH_ALL); err == nil {
+		t.Fatal("Signed a miniscript without non-malleable satisfactions")
+	}
+}
+
+func TestPsbtFinalizeMiniscript(t *testing.T) {
+	k := newMiniscriptKeys()
+	ms, _ := bitcoinlib.ParseMiniscript(k.expand("and_v(v:pk(A),sha256(H))"))
+	tx, _ := spendOutput(ms.ScriptPubKey(), 2, 0, bitcoinlib.SEQUENCE_FINAL)
+	psbt, err := bitcoinlib.NewPsbt(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	psbt.AddWitnessUtxo(0, bitcoinlib.NewOutput(10000, ms.ScriptPubKey()))
+	psbt.Inputs[0].WitnessScript = ms.Serialize()
+	if err := psbt.AddPreimage(0, bytes.Repeat([]byte{0x66}, 32)); err == nil {
+		t.Fatal("Added the preimage of another hash")
+	}
+	if err := psbt.AddPreimage(0, miniscriptPreimage); err != nil {
+		t.Fatalf("Failed adding preimage: %s", err)
+	}
+	if err := psbt.SignInput(0, k.keys[0]); err != nil {
+		t.Fatalf("Failed signing: %s", err)
+	}
+	psbt = roundTrip(t, psbt)
+	if preimage := psbt.Inputs[0].Sha256Preimages[k.hex["H"]]; !bytes.Equal(preimage, miniscriptPreimage) {
+		t.Fatalf("Expected => %x\nGot => %x", miniscriptPreimage, preimage)
+	}
+	if err := psbt.FinalizeInput(0); err == nil {
+		t.Fatal("Finalized a miniscript as a standard script")
+	}
+	if err := psbt.FinalizeMiniscript(0, ms); err != nil {
+		t.Fatalf("Failed finalizing: %s", err)
+	}
+	if len(psbt.Inputs[0].Sha256Preimages) != 0 {
+		t.Fatal("Finalizing kept the preimages")
+	}
+	signed, _ := psbt.Extract()
+	if !signed.Verify(psbt) {
+		t.Fatal("Failed verifying transaction finalized from a miniscript")
+	}
+}
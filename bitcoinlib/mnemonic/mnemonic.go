@@ -0,0 +1,137 @@
+// Implementation of BIP39 mnemonic phrases: entropy to words
+// conversion with checksum and seed derivation
+package mnemonic
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const SEED_ITERATIONS = 2048
+const SEED_SIZE = 64
+const BITS_PER_WORD = 11
+
+var wordIndex map[string]int = indexWords(ENGLISH_WORDLIST)
+
+func indexWords(words []string) map[string]int {
+	index := make(map[string]int, len(words))
+	for position, word := range words {
+		index[word] = position
+	}
+	return index
+}
+
+func validEntropyBits(bits int) bool {
+	return bits >= 128 && bits <= 256 && bits%32 == 0
+}
+
+// Returns random entropy of the given size in bits.
+// Valid sizes are 128, 160, 192, 224 and 256
+func NewEntropy(bits int) ([]byte, error) {
+	if !validEntropyBits(bits) {
+		return nil, fmt.Errorf("invalid entropy size: %d bits", bits)
+	}
+	entropy := make([]byte, bits/8)
+	_, err := rand.Read(entropy)
+	return entropy, err
+}
+
+// Converts the entropy into its mnemonic phrase, appending
+// the first ENT/32 bits of its sha256 as checksum
+func NewMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if !validEntropyBits(bits) {
+		return "", fmt.Errorf("invalid entropy size: %d bits", bits)
+	}
+	checksumBits := bits / 32
+	hashed := sha256.Sum256(entropy)
+	value := new(big.Int).SetBytes(entropy)
+	value.Lsh(value, uint(checksumBits))
+	value.Or(value, big.NewInt(int64(hashed[0]>>(8-checksumBits))))
+
+	total := (bits + checksumBits) / BITS_PER_WORD
+	words := make([]string, total)
+	mask := big.NewInt(1<<BITS_PER_WORD - 1)
+	index := new(big.Int)
+	for i := total - 1; i >= 0; i-- {
+		index.And(value, mask)
+		words[i] = ENGLISH_WORDLIST[index.Int64()]
+		value.Rsh(value, BITS_PER_WORD)
+	}
+	return strings.Join(words, " "), nil
+}
+
+// Generates a new random mnemonic with the given entropy size
+func GenerateMnemonic(bits int) (string, error) {
+	entropy, err := NewEntropy(bits)
+	if err != nil {
+		return "", err
+	}
+	return NewMnemonic(entropy)
+}
+
+// Recovers the entropy from a mnemonic, validating
+// its words and checksum
+func EntropyFromMnemonic(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words)%3 != 0 || len(words) < 12 || len(words) > 24 {
+		return nil, fmt.Errorf("invalid number of words: %d", len(words))
+	}
+	value := new(big.Int)
+	for position, word := range words {
+		index, ok := wordIndex[strings.ToLower(word)]
+		if !ok {
+			return nil, fmt.Errorf("word %q at position %d is not in the wordlist", word, position)
+		}
+		value.Lsh(value, BITS_PER_WORD)
+		value.Or(value, big.NewInt(int64(index)))
+	}
+	totalBits := len(words) * BITS_PER_WORD
+	checksumBits := totalBits / 33
+	checksum := new(big.Int).And(value, big.NewInt(int64(1<<checksumBits-1)))
+	value.Rsh(value, uint(checksumBits))
+
+	entropy := make([]byte, (totalBits-checksumBits)/8)
+	value.FillBytes(entropy)
+	hashed := sha256.Sum256(entropy)
+	if checksum.Int64() != int64(hashed[0]>>(8-checksumBits)) {
+		return nil, errors.New("invalid mnemonic checksum")
+	}
+	return entropy, nil
+}
+
+// Returns nil if the mnemonic is made of known words
+// with a valid checksum
+func ValidateMnemonic(mnemonic string) error {
+	_, err := EntropyFromMnemonic(mnemonic)
+	return err
+}
+
+func IsValid(mnemonic string) bool {
+	return ValidateMnemonic(mnemonic) == nil
+}
+
+// Derives the 64 byte seed using PBKDF2-HMAC-SHA512 with
+// "mnemonic" + passphrase as salt. The phrase is not validated,
+// as stated by the BIP, and the passphrase is expected to be
+// already NFKD normalized.
+func NewSeed(mnemonic string, passphrase string) []byte {
+	normalized := strings.Join(strings.Fields(mnemonic), " ")
+	salt := "mnemonic" + passphrase
+	return pbkdf2.Key([]byte(normalized), []byte(salt), SEED_ITERATIONS, SEED_SIZE, sha512.New)
+}
+
+// Same as NewSeed, but fails if the mnemonic is not valid
+func NewSeedWithChecks(mnemonic string, passphrase string) ([]byte, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+	return NewSeed(mnemonic, passphrase), nil
+}
@@ -0,0 +1,120 @@
+package mnemonic_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"bitcoinlib/bitcoinlib/mnemonic"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Vectors from https://github.com/trezor/python-mnemonic/blob/master/vectors.json
+var vectors = [][3]string{
+	{
+		"00000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+	},
+	{
+		"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		"legal winner thank year wave sausage worth useful legal winner thank yellow",
+		"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+	},
+	{
+		"80808080808080808080808080808080",
+		"letter advice cage absurd amount doctor acoustic avoid letter advice cage above",
+		"d71de856f81a8acc65e6fc851a38d4d7ec216fd0796d0a6827a3ad6ed5511a30fa280f12eb2e47ed2ac03b5c462a0358d18d69fe4f985ec81778c1b370b652a8",
+	},
+	{
+		"ffffffffffffffffffffffffffffffff",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+		"ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069",
+	},
+	{
+		"9e885d952ad362caeb4efe34a8e91bd2",
+		"ozone drill grab fiber curtain grace pudding thank cruise elder eight picnic",
+		"274ddc525802f7c828d8ef7ddbcdc5304e87ac3535913611fbbfa986d0c9e5476c91689f9c8a54fd55bd38606aa6a8595ad213d4c9c9f9aca3fb217069a41028",
+	},
+	{
+		"c0ba5a8e914111210f2bd131f3d5e08d",
+		"scheme spot photo card baby mountain device kick cradle pact join borrow",
+		"ea725895aaae8d4c1cf682c1bfd2d358d52ed9f0f0591131b559e2724bb234fca05aa9c02c57407e04ee9dc3b454aa63fbff483a8b11de949624b9f1831a9612",
+	},
+	{
+		"f585c11aec520db57dd353c69554b21a89b20fb0650966fa0a9d6f74fd989d8f",
+		"void come effort suffer camp survey warrior heavy shoot primary clutch crush open amazing screen patrol group space point ten exist slush involve unfold",
+		"01f5bced59dec48e362f2c45b5de68b9fd6c92c6634f44d6d40aab69056506f0e35524a518034ddc1192e1dacd32c1ed3eaa3c3b131c88ed8e7e54c49a5d0998",
+	},
+}
+
+func TestMnemonicVectors(t *testing.T) {
+	for index, vector := range vectors {
+		entropy, _ := hex.DecodeString(vector[0])
+		phrase, err := mnemonic.NewMnemonic(entropy)
+		if err != nil {
+			t.Fatalf("Failed at index %d with error: %s", index, err)
+		}
+		if phrase != vector[1] {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s", index, vector[1], phrase)
+		}
+		recovered, err := mnemonic.EntropyFromMnemonic(phrase)
+		if err != nil || hex.EncodeToString(recovered) != vector[0] {
+			t.Fatalf("Failed recovering entropy at index %d: %x (%v)", index, recovered, err)
+		}
+		seed := hex.EncodeToString(mnemonic.NewSeed(phrase, "TREZOR"))
+		if seed != vector[2] {
+			t.Fatalf("Failed seed at index %d\nExpected => %s\nGot => %s", index, vector[2], seed)
+		}
+	}
+}
+
+func TestInvalidMnemonics(t *testing.T) {
+	invalid := []string{
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon bitcoin",
+	}
+	for index, phrase := range invalid {
+		if mnemonic.IsValid(phrase) {
+			t.Fatalf("Considered valid invalid mnemonic at index %d", index)
+		}
+	}
+	if _, err := mnemonic.NewMnemonic(make([]byte, 15)); err == nil {
+		t.Fatal("Accepted entropy of invalid size")
+	}
+}
+
+func TestGeneratedMnemonicIsValid(t *testing.T) {
+	for _, bits := range []int{128, 160, 192, 224, 256} {
+		phrase, err := mnemonic.GenerateMnemonic(bits)
+		if err != nil {
+			t.Fatalf("Failed generating mnemonic of %d bits: %s", bits, err)
+		}
+		if len(strings.Fields(phrase)) != (bits+bits/32)/11 {
+			t.Fatalf("Invalid number of words for %d bits: %s", bits, phrase)
+		}
+		if err := mnemonic.ValidateMnemonic(phrase); err != nil {
+			t.Fatalf("Generated invalid mnemonic: %s", err)
+		}
+	}
+}
+
+func TestSeedIntoMasterKey(t *testing.T) {
+	phrase := vectors[0][1]
+	seed, err := mnemonic.NewSeedWithChecks(phrase, "TREZOR")
+	if err != nil {
+		t.Fatalf("Failed generating seed: %s", err)
+	}
+	master, err := bitcoinlib.NewMasterKey(seed, bitcoinlib.MAINNET_PARAMS)
+	if err != nil {
+		t.Fatalf("Failed generating master key: %s", err)
+	}
+	expected := "xprv9s21ZrQH143K3h3fDYiay8mocZ3afhfULfb5GX8kCBdno77K4HiA15Tg23wpbeF1pLfs1c5SPmYHrEpTuuRhxMwvKDwqdKiGJS9XFKzUsAF"
+	if master.String() != expected {
+		t.Fatalf("Failed master key\nExpected => %s\nGot => %s", expected, master.String())
+	}
+	key := master.PrivateKey()
+	if !key.Sign(bitcoinlib.FromInt(1)).Verify(bitcoinlib.FromInt(1)) {
+		t.Fatal("Failed to verify signature made with master key")
+	}
+}
@@ -182,15 +182,9 @@ func NewVersionMessage() *VersionMessage {
 	}
 }
 
-func NewNetworkMessage(testnet bool) *NetworkMessage {
-	var magic uint32
-	if testnet {
-		magic = TESTNET_MAGIC
-	} else {
-		magic = MAINNET_MAGIC
-	}
+func NewNetworkMessage(params *ChainParams) *NetworkMessage {
 	return &NetworkMessage{
-		magic,
+		params.Magic,
 		[12]byte{},
 		nil,
 	}
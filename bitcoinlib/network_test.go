@@ -9,7 +9,7 @@ import (
 
 func TestParseExcercise1(t *testing.T) {
 	message, _ := hex.DecodeString("f9beb4d976657261636b000000000000000000005df6e0e2")
-	blockMessage := bitcoinlib.NewNetworkMessage(false)
+	blockMessage := bitcoinlib.NewNetworkMessage(bitcoinlib.MAINNET_PARAMS)
 	err := blockMessage.Parse(bytes.NewReader(message))
 	if err != nil {
 		t.Fatalf("Error parsing messag: %s", err)
@@ -28,7 +28,7 @@ func TestParseExcercise1(t *testing.T) {
 
 func TestSerializing(t *testing.T) {
 	msg, _ := hex.DecodeString("f9beb4d976657261636b000000000000000000005df6e0e2")
-	nmsg := bitcoinlib.NewNetworkMessage(false)
+	nmsg := bitcoinlib.NewNetworkMessage(bitcoinlib.MAINNET_PARAMS)
 	if nmsg.Parse(bytes.NewReader(msg)) != nil {
 		t.Fatal("Failed parsing first message")
 	}
@@ -4,30 +4,46 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net"
+	"strconv"
 )
 
 type SimpleNode struct {
 	host       [16]byte
 	port       uint16
 	connection net.Conn
-	testnet    bool
+	chain      *ChainParams
 	logging    bool
 }
 
 type NodeParams struct {
+	// Found through the DNS seeds of the network if empty
 	Addr    string
 	Port    uint16
-	Testnet bool
+	// Network to connect to, mainnet if nil
+	Chain   *ChainParams
 	Logging bool
 }
 
 func NewSimpleNode(params NodeParams) *SimpleNode {
-	if params.Port == 0 && params.Testnet {
-		params.Port = 18333
-	} else if params.Port == 0 {
-		params.Port = 8333
+	if params.Chain == nil {
+		params.Chain = MAINNET_PARAMS
+	}
+	if params.Port == 0 {
+		params.Port = params.Chain.DefaultPort
+	}
+	hosts := []string{params.Addr}
+	if params.Addr == "" {
+		// Any node found through the DNS seeds of the network
+		hosts = params.Chain.LookupSeeds()
+	}
+	var conn net.Conn
+	err := fmt.Errorf("no node found for %s", params.Chain)
+	for _, host := range hosts {
+		conn, err = net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(params.Port))))
+		if err == nil {
+			break
+		}
 	}
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", params.Addr, params.Port))
 	if err != nil {
 		panic(fmt.Sprintf("Could not connect to host %s because of %s", params.Addr, err))
 	}
@@ -35,13 +51,13 @@ func NewSimpleNode(params NodeParams) *SimpleNode {
 		IPAddressFromString(conn.RemoteAddr().String()),
 		params.Port,
 		conn,
-		params.Testnet,
+		params.Chain,
 		params.Logging,
 	}
 }
 
 func (sn *SimpleNode) Send(message Message) error {
-	envelope := NewNetworkMessage(sn.testnet)
+	envelope := NewNetworkMessage(sn.chain)
 	envelope.command = message.Command()
 	envelope.payload = message.Serialize()
 	serialized := envelope.Serialize()
@@ -53,7 +69,7 @@ func (sn *SimpleNode) Send(message Message) error {
 }
 
 func (sn *SimpleNode) Read() (*NetworkMessage, error) {
-	message := NewNetworkMessage(sn.testnet)
+	message := NewNetworkMessage(sn.chain)
 	err := message.Parse(sn.connection)
 	if sn.logging {
 		fmt.Printf("Recieved: %o\nWith Error: %s\n", message, err)
@@ -0,0 +1,196 @@
+package bitcoinlib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Gives access to the outputs spent by the inputs of a transaction,
+// which are needed to compute fees, sighashes and to verify scripts
+type PrevoutProvider interface {
+	Prevout(txId string, index uint32) (*Output, error)
+}
+
+func prevoutNotFound(txId string, index uint32) error {
+	return fmt.Errorf("prevout %s:%d not found", txId, index)
+}
+
+// Returns the output of tx being spent by outpoint index
+func outputAt(tx *Transaction, txId string, index uint32) (*Output, error) {
+	if int(index) >= len(tx.outputs) {
+		return nil, prevoutNotFound(txId, index)
+	}
+	return tx.outputs[index], nil
+}
+
+// Provider holding the prevouts in memory, safe for concurrent use
+type MemoryProvider struct {
+	lock    sync.RWMutex
+	outputs map[string]*Output
+}
+
+func NewMemoryProvider() *MemoryProvider {
+	return &MemoryProvider{
+		outputs: make(map[string]*Output),
+	}
+}
+
+func outpointKey(txId string, index uint32) string {
+	return fmt.Sprintf("%s:%d", txId, index)
+}
+
+func (m *MemoryProvider) Add(txId string, index uint32, output *Output) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.outputs[outpointKey(txId, index)] = output
+}
+
+// Adds every output of tx as a spendable prevout
+func (m *MemoryProvider) AddTransaction(tx *Transaction) {
+	id := tx.Id()
+	for index, output := range tx.outputs {
+		m.Add(id, uint32(index), output)
+	}
+}
+
+func (m *MemoryProvider) Prevout(txId string, index uint32) (*Output, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	output, ok := m.outputs[outpointKey(txId, index)]
+	if !ok {
+		return nil, prevoutNotFound(txId, index)
+	}
+	return output, nil
+}
+
+// Provider storing each prevout in its own file inside dir.
+// Misses are looked up in fallback, if any, and saved to disk
+type FileProvider struct {
+	lock     sync.Mutex
+	dir      string
+	fallback PrevoutProvider
+}
+
+func NewFileProvider(dir string, fallback PrevoutProvider) (*FileProvider, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileProvider{
+		dir:      dir,
+		fallback: fallback,
+	}, nil
+}
+
+func (f *FileProvider) path(txId string, index uint32) string {
+	return filepath.Join(f.dir, fmt.Sprintf("%s_%d.hex", txId, index))
+}
+
+func (f *FileProvider) Add(txId string, index uint32, output *Output) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	serialized := []byte(hex.EncodeToString(output.Serialize()))
+	return os.WriteFile(f.path(txId, index), serialized, 0o644)
+}
+
+func (f *FileProvider) Prevout(txId string, index uint32) (*Output, error) {
+	f.lock.Lock()
+	stored, err := os.ReadFile(f.path(txId, index))
+	f.lock.Unlock()
+	if err == nil {
+		decoded, err := hex.DecodeString(strings.TrimSpace(string(stored)))
+		if err != nil {
+			return nil, err
+		}
+		return NewOutputFrom(bytes.NewReader(decoded))
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if f.fallback == nil {
+		return nil, prevoutNotFound(txId, index)
+	}
+	output, err := f.fallback.Prevout(txId, index)
+	if err != nil {
+		return nil, err
+	}
+	return output, f.Add(txId, index, output)
+}
+
+// Provider fetching transactions from an Esplora compatible
+// REST API (https://github.com/Blockstream/esplora/blob/master/API.md)
+type EsploraProvider struct {
+	Url    string
+	Client *http.Client
+	lock   sync.Mutex
+	cache  map[string]*Transaction
+}
+
+func NewEsploraProvider(url string) *EsploraProvider {
+	return &EsploraProvider{
+		Url:    strings.TrimSuffix(url, "/"),
+		Client: http.DefaultClient,
+		cache:  make(map[string]*Transaction),
+	}
+}
+
+// Returns the Esplora provider of the public instance for the network
+func DefaultProvider(params *ChainParams) (*EsploraProvider, error) {
+	if params.EsploraUrl == "" {
+		return nil, fmt.Errorf("no esplora server for %s", params)
+	}
+	return NewEsploraProvider(params.EsploraUrl), nil
+}
+
+// Fetches the transaction with the given id, checking that its
+// id matches the one requested
+func (e *EsploraProvider) Transaction(txId string) (*Transaction, error) {
+	e.lock.Lock()
+	tx, ok := e.cache[txId]
+	e.lock.Unlock()
+	if ok {
+		return tx, nil
+	}
+	response, err := e.Client.Get(fmt.Sprintf("%s/tx/%s/hex", e.Url, txId))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	buf, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", txId, response.Status)
+	}
+	buf, err = hex.DecodeString(string(bytes.TrimSpace(buf)))
+	if err != nil {
+		return nil, err
+	}
+	tx, err = ParseTransaction(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	if tx.Id() != txId {
+		return nil, fmt.Errorf("server returned %s instead of %s", tx.Id(), txId)
+	}
+	e.lock.Lock()
+	e.cache[txId] = tx
+	e.lock.Unlock()
+	return tx, nil
+}
+
+func (e *EsploraProvider) Prevout(txId string, index uint32) (*Output, error) {
+	tx, err := e.Transaction(txId)
+	if err != nil {
+		return nil, err
+	}
+	return outputAt(tx, txId, index)
+}
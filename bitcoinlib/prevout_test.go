@@ -0,0 +1,130 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func fundingTransaction(key *bitcoinlib.PrivateKey) *bitcoinlib.Transaction {
+	funding := bitcoinlib.NewTransaction()
+	funding.AddInput(strings.Repeat("11", 32), 0)
+	funding.AddOutputScript(50000, bitcoinlib.P2PKHScript(bitcoinlib.Hash160(key.Sec(bitcoinlib.COMPRESSED))))
+	return funding
+}
+
+func spendingTransaction(t *testing.T, funding *bitcoinlib.Transaction) *bitcoinlib.Transaction {
+	tx := bitcoinlib.NewTransaction()
+	tx.AddInput(funding.Id(), 0)
+	if err := tx.AddOutput(40000, "1BenRpVUFK65JFWcQSuHnJKzc4M8ZP8Eqa", bitcoinlib.MAINNET_PARAMS); err != nil {
+		t.Fatalf("Failed adding output: %s", err)
+	}
+	return tx
+}
+
+func TestMemoryProviderSignAndVerify(t *testing.T) {
+	t.Parallel()
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(8675309))
+	funding := fundingTransaction(key)
+	provider := bitcoinlib.NewMemoryProvider()
+	provider.AddTransaction(funding)
+
+	tx := spendingTransaction(t, funding)
+	if err := tx.Sign(provider, key); err != nil {
+		t.Fatalf("Failed signing: %s", err)
+	}
+	if tx.Fee(provider) != 10000 {
+		t.Fatalf("Expected => 10000\nGot => %d", tx.Fee(provider))
+	}
+	if !tx.Verify(provider) {
+		t.Fatal("Failed to verify transaction signed offline")
+	}
+	if tx.Verify(bitcoinlib.NewMemoryProvider()) {
+		t.Fatal("Verified transaction without its prevouts")
+	}
+}
+
+func TestMemoryProviderMissingPrevout(t *testing.T) {
+	t.Parallel()
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(8675309))
+	tx := spendingTransaction(t, fundingTransaction(key))
+	provider := bitcoinlib.NewMemoryProvider()
+	if err := tx.Sign(provider, key); err == nil {
+		t.Fatal("Signed transaction without its prevouts")
+	}
+	if tx.Fee(provider) >= 0 {
+		t.Fatal("Computed fee without prevouts")
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	t.Parallel()
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(8675309))
+	funding := fundingTransaction(key)
+	memory := bitcoinlib.NewMemoryProvider()
+	memory.AddTransaction(funding)
+	dir := t.TempDir()
+
+	cached, err := bitcoinlib.NewFileProvider(dir, memory)
+	if err != nil {
+		t.Fatalf("Failed creating provider: %s", err)
+	}
+	if _, err := cached.Prevout(funding.Id(), 0); err != nil {
+		t.Fatalf("Failed fetching through fallback: %s", err)
+	}
+
+	offline, _ := bitcoinlib.NewFileProvider(dir, nil)
+	output, err := offline.Prevout(funding.Id(), 0)
+	if err != nil {
+		t.Fatalf("Failed reading cached prevout: %s", err)
+	}
+	if output.Amount() != 50000 {
+		t.Fatalf("Expected => 50000\nGot => %d", output.Amount())
+	}
+	tx := spendingTransaction(t, funding)
+	if err := tx.Sign(offline, key); err != nil || !tx.Verify(offline) {
+		t.Fatal("Failed signing and verifying from file cache")
+	}
+	if _, err := offline.Prevout(funding.Id(), 1); err == nil {
+		t.Fatal("Found prevout that was never stored")
+	}
+}
+
+func TestEsploraProvider(t *testing.T) {
+	t.Parallel()
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(8675309))
+	funding := fundingTransaction(key)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != fmt.Sprintf("/tx/%s/hex", funding.Id()) {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, hex.EncodeToString(funding.Serialize()))
+	}))
+	defer server.Close()
+
+	provider := bitcoinlib.NewEsploraProvider(server.URL + "/")
+	provider.Client = server.Client()
+	tx := spendingTransaction(t, funding)
+	if err := tx.Sign(provider, key); err != nil {
+		t.Fatalf("Failed signing: %s", err)
+	}
+	if !tx.Verify(provider) {
+		t.Fatal("Failed to verify transaction")
+	}
+	if requests != 1 {
+		t.Fatalf("Expected a single request, got %d", requests)
+	}
+	if _, err := provider.Prevout(strings.Repeat("22", 32), 0); err == nil {
+		t.Fatal("Found unknown transaction")
+	}
+	if _, err := bitcoinlib.DefaultProvider(bitcoinlib.REGTEST_PARAMS); err == nil {
+		t.Fatal("Found default esplora server for regtest")
+	}
+}
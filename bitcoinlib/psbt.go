@@ -0,0 +1,1326 @@
+package bitcoinlib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+const PSBT_MAGIC = "psbt\xff"
+
+// Key types of the global map
+const (
+	PSBT_GLOBAL_UNSIGNED_TX       = 0x00
+	PSBT_GLOBAL_XPUB              = 0x01
+	PSBT_GLOBAL_TX_VERSION        = 0x02
+	PSBT_GLOBAL_FALLBACK_LOCKTIME = 0x03
+	PSBT_GLOBAL_INPUT_COUNT       = 0x04
+	PSBT_GLOBAL_OUTPUT_COUNT      = 0x05
+	PSBT_GLOBAL_TX_MODIFIABLE     = 0x06
+	PSBT_GLOBAL_VERSION           = 0xfb
+)
+
+// Key types of the per input maps
+const (
+	PSBT_IN_NON_WITNESS_UTXO     = 0x00
+	PSBT_IN_WITNESS_UTXO         = 0x01
+	PSBT_IN_PARTIAL_SIG          = 0x02
+	PSBT_IN_SIGHASH_TYPE         = 0x03
+	PSBT_IN_REDEEM_SCRIPT        = 0x04
+	PSBT_IN_WITNESS_SCRIPT       = 0x05
+	PSBT_IN_BIP32_DERIVATION     = 0x06
+	PSBT_IN_FINAL_SCRIPTSIG      = 0x07
+	PSBT_IN_FINAL_SCRIPTWITNESS  = 0x08
+	PSBT_IN_RIPEMD160            = 0x0a
+	PSBT_IN_SHA256               = 0x0b
+	PSBT_IN_HASH160              = 0x0c
+	PSBT_IN_HASH256              = 0x0d
+	PSBT_IN_PREVIOUS_TXID        = 0x0e
+	PSBT_IN_OUTPUT_INDEX         = 0x0f
+	PSBT_IN_SEQUENCE             = 0x10
+	PSBT_IN_REQUIRED_TIME_LOCK   = 0x11
+	PSBT_IN_REQUIRED_HEIGHT_LOCK = 0x12
+)
+
+// Hash functions of the preimage key types, keyed by the hash
+var PSBT_PREIMAGE_HASHES = map[byte]func([]byte) []byte{
+	PSBT_IN_RIPEMD160: Ripemd160,
+	PSBT_IN_SHA256:    Sha256,
+	PSBT_IN_HASH160:   Hash160,
+	PSBT_IN_HASH256:   Hash256,
+}
+
+// Key types of the per output maps
+const (
+	PSBT_OUT_REDEEM_SCRIPT    = 0x00
+	PSBT_OUT_WITNESS_SCRIPT   = 0x01
+	PSBT_OUT_BIP32_DERIVATION = 0x02
+	PSBT_OUT_AMOUNT           = 0x03
+	PSBT_OUT_SCRIPT           = 0x04
+)
+
+// Fingerprint of the master key and derivation path of a key
+type KeyOrigin struct {
+	Fingerprint [4]byte
+	Path        []uint32
+}
+
+func NewKeyOrigin(fingerprint [4]byte, path string) (*KeyOrigin, error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyOrigin{fingerprint, indexes}, nil
+}
+
+func parseKeyOrigin(value []byte) (*KeyOrigin, error) {
+	if len(value) < 4 || len(value)%4 != 0 {
+		return nil, fmt.Errorf("invalid key origin length: %d", len(value))
+	}
+	origin := &KeyOrigin{[4]byte(value[:4]), []uint32{}}
+	for index := 4; index < len(value); index += 4 {
+		origin.Path = append(origin.Path, binary.LittleEndian.Uint32(value[index:index+4]))
+	}
+	return origin, nil
+}
+
+func (o *KeyOrigin) Serialize() []byte {
+	buf := append([]byte{}, o.Fingerprint[:]...)
+	for _, index := range o.Path {
+		buf = binary.LittleEndian.AppendUint32(buf, index)
+	}
+	return buf
+}
+
+func (o *KeyOrigin) String() string {
+	return fmt.Sprintf("[%x%s]", o.Fingerprint, FormatPath(o.Path)[1:])
+}
+
+// Per input data of a PSBT. Maps are keyed by the hex encoded
+// public key, or by the hex encoded full key for unknown fields.
+// The outpoint and sequence are part of the global transaction in
+// version 0, the required locktimes only exist in version 2
+type PsbtInput struct {
+	PreviousTxid           string
+	OutputIndex            uint32
+	Sequence               uint32
+	RequiredTimeLocktime   uint32 // zero when not set
+	RequiredHeightLocktime uint32 // zero when not set
+
+	NonWitnessUtxo     *Transaction
+	WitnessUtxo        *Output
+	PartialSigs        map[string][]byte
+	SigHashType        SigHashType // zero when not set
+	RedeemScript       []byte
+	WitnessScript      []byte
+	Bip32Derivation    map[string]*KeyOrigin
+	FinalScriptSig     []byte
+	FinalScriptWitness [][]byte
+	Ripemd160Preimages map[string][]byte // keyed by the hex encoded hash
+	Sha256Preimages    map[string][]byte
+	Hash160Preimages   map[string][]byte
+	Hash256Preimages   map[string][]byte
+	Unknown            map[string][]byte
+}
+
+// Per output data of a PSBT. Amount and Script are part of the
+// global transaction in version 0
+type PsbtOutput struct {
+	Amount uint64
+	Script *ScriptPubKey
+
+	RedeemScript    []byte
+	WitnessScript   []byte
+	Bip32Derivation map[string]*KeyOrigin
+	Unknown         map[string][]byte
+}
+
+// Partially Signed Bitcoin Transaction, version 0 (BIP174) or 2
+// (BIP370). Xpubs is keyed by the Base58Check encoded extended key.
+// The unsigned transaction is built from the inputs and outputs
+type Psbt struct {
+	Version          uint32
+	TxVersion        uint32
+	FallbackLocktime uint32
+	TxModifiable     uint8
+	Xpubs            map[string]*KeyOrigin
+	Inputs           []*PsbtInput
+	Outputs          []*PsbtOutput
+	Unknown          map[string][]byte
+}
+
+func newPsbtInput() *PsbtInput {
+	return &PsbtInput{
+		Sequence:           0xffffffff,
+		PartialSigs:        make(map[string][]byte),
+		Bip32Derivation:    make(map[string]*KeyOrigin),
+		Ripemd160Preimages: make(map[string][]byte),
+		Sha256Preimages:    make(map[string][]byte),
+		Hash160Preimages:   make(map[string][]byte),
+		Hash256Preimages:   make(map[string][]byte),
+		Unknown:            make(map[string][]byte),
+	}
+}
+
+// Preimages of the key type
+func (in *PsbtInput) preimages(keyType byte) map[string][]byte {
+	switch keyType {
+	case PSBT_IN_RIPEMD160:
+		return in.Ripemd160Preimages
+	case PSBT_IN_SHA256:
+		return in.Sha256Preimages
+	case PSBT_IN_HASH160:
+		return in.Hash160Preimages
+	}
+	return in.Hash256Preimages
+}
+
+func newPsbtOutput() *PsbtOutput {
+	return &PsbtOutput{
+		Bip32Derivation: make(map[string]*KeyOrigin),
+		Unknown:         make(map[string][]byte),
+	}
+}
+
+// Creator role: wraps an unsigned transaction into an empty version 0 PSBT
+func NewPsbt(tx *Transaction) (*Psbt, error) {
+	for index, in := range tx.inputs {
+		if len(in.scriptSig.cmds) > 0 || len(in.items) > 0 {
+			return nil, fmt.Errorf("input %d of the transaction is signed", index)
+		}
+	}
+	psbt := &Psbt{
+		TxVersion:        tx.version.number,
+		FallbackLocktime: tx.locktime,
+		Xpubs:            make(map[string]*KeyOrigin),
+		Unknown:          make(map[string][]byte),
+	}
+	psbt.setTransaction(tx)
+	return psbt, nil
+}
+
+// Creates the inputs and outputs of the PSBT from the transaction
+func (p *Psbt) setTransaction(tx *Transaction) {
+	for _, txIn := range tx.inputs {
+		in := newPsbtInput()
+		in.PreviousTxid = txIn.previousID
+		in.OutputIndex = txIn.previousIndex
+		in.Sequence = txIn.sequence
+		p.Inputs = append(p.Inputs, in)
+	}
+	for _, txOut := range tx.outputs {
+		out := newPsbtOutput()
+		out.Amount = txOut.amount
+		out.Script = txOut.scriptPubKey
+		p.Outputs = append(p.Outputs, out)
+	}
+}
+
+// Returns the unsigned transaction described by the PSBT
+func (p *Psbt) UnsignedTx() (*Transaction, error) {
+	locktime, err := p.ComputeLocktime()
+	if err != nil {
+		return nil, err
+	}
+	tx := NewTransaction()
+	tx.version = *NewVersion(p.TxVersion)
+	tx.locktime = locktime
+	for _, in := range p.Inputs {
+		tx.AddInput(in.PreviousTxid, in.OutputIndex)
+		tx.inputs[len(tx.inputs)-1].sequence = in.Sequence
+	}
+	for _, out := range p.Outputs {
+		tx.AddOutputScript(out.Amount, out.Script)
+	}
+	return tx, nil
+}
+
+func readPsbtBytes(from *bytes.Reader, length uint64) ([]byte, error) {
+	if uint64(from.Len()) < length {
+		return nil, errors.New("unexpected end of psbt")
+	}
+	buf := make([]byte, length)
+	_, err := io.ReadFull(from, buf)
+	return buf, err
+}
+
+// Reads a key-value pair, returning a nil key at the map separator
+func readPsbtPair(from *bytes.Reader) ([]byte, []byte, error) {
+	if from.Len() == 0 {
+		return nil, nil, errors.New("unexpected end of psbt")
+	}
+	keyLength := ReadVarInt(from)
+	if keyLength == 0 {
+		return nil, nil, nil
+	}
+	key, err := readPsbtBytes(from, keyLength)
+	if err != nil {
+		return nil, nil, err
+	}
+	if from.Len() == 0 {
+		return nil, nil, errors.New("unexpected end of psbt")
+	}
+	value, err := readPsbtBytes(from, ReadVarInt(from))
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, value, nil
+}
+
+// Reads a whole map calling parse for every pair, rejecting duplicated
+// keys. Returns the key types found in the map
+func readPsbtMap(from *bytes.Reader, parse func(key []byte, value []byte) error) (map[byte]bool, error) {
+	seen := map[string]bool{}
+	types := map[byte]bool{}
+	for {
+		key, value, err := readPsbtPair(from)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return types, nil
+		}
+		if seen[string(key)] {
+			return nil, fmt.Errorf("duplicated psbt key: %x", key)
+		}
+		seen[string(key)] = true
+		types[key[0]] = true
+		if err := parse(key, value); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Fields of a map that are required in each version, and the
+// fields that only exist in version 2
+type psbtFields struct {
+	v0Required []byte
+	v2Required []byte
+	v2Only     []byte
+}
+
+var psbtGlobalFields = psbtFields{
+	[]byte{PSBT_GLOBAL_UNSIGNED_TX},
+	[]byte{PSBT_GLOBAL_TX_VERSION, PSBT_GLOBAL_INPUT_COUNT, PSBT_GLOBAL_OUTPUT_COUNT},
+	[]byte{PSBT_GLOBAL_TX_VERSION, PSBT_GLOBAL_FALLBACK_LOCKTIME, PSBT_GLOBAL_INPUT_COUNT,
+		PSBT_GLOBAL_OUTPUT_COUNT, PSBT_GLOBAL_TX_MODIFIABLE},
+}
+
+var psbtInputFields = psbtFields{
+	nil,
+	[]byte{PSBT_IN_PREVIOUS_TXID, PSBT_IN_OUTPUT_INDEX},
+	[]byte{PSBT_IN_PREVIOUS_TXID, PSBT_IN_OUTPUT_INDEX, PSBT_IN_SEQUENCE,
+		PSBT_IN_REQUIRED_TIME_LOCK, PSBT_IN_REQUIRED_HEIGHT_LOCK},
+}
+
+var psbtOutputFields = psbtFields{
+	nil,
+	[]byte{PSBT_OUT_AMOUNT, PSBT_OUT_SCRIPT},
+	[]byte{PSBT_OUT_AMOUNT, PSBT_OUT_SCRIPT},
+}
+
+// Checks that the fields required by the PSBT version are present in
+// the map and that the fields of the other version are not
+func (f *psbtFields) check(types map[byte]bool, version uint32) error {
+	required, forbidden := f.v0Required, f.v2Only
+	if version == 2 {
+		required, forbidden = f.v2Required, f.v0Required
+	}
+	for _, keyType := range required {
+		if !types[keyType] {
+			return fmt.Errorf("missing psbt field %x for version %d", keyType, version)
+		}
+	}
+	for _, keyType := range forbidden {
+		if types[keyType] {
+			return fmt.Errorf("psbt field %x is not allowed in version %d", keyType, version)
+		}
+	}
+	return nil
+}
+
+func parseUint32Value(value []byte) (uint32, error) {
+	if len(value) != 4 {
+		return 0, fmt.Errorf("invalid psbt uint32 value length: %d", len(value))
+	}
+	return binary.LittleEndian.Uint32(value), nil
+}
+
+func parseCountValue(value []byte) (uint64, error) {
+	from := bytes.NewReader(value)
+	if from.Len() == 0 {
+		return 0, errors.New("empty psbt count")
+	}
+	count := ReadVarInt(from)
+	if from.Len() != 0 || !bytes.Equal(EncodeVarInt(count), value) {
+		return 0, errors.New("invalid psbt count")
+	}
+	return count, nil
+}
+
+func expectKeyLength(key []byte, length int) error {
+	if len(key) != length {
+		return fmt.Errorf("invalid key length for psbt type %x: %d", key[0], len(key))
+	}
+	return nil
+}
+
+// Checks the key data of a key indexed by a public key
+func pubkeyKey(key []byte) (string, error) {
+	if len(key) != 34 && len(key) != 66 {
+		return "", fmt.Errorf("invalid public key in psbt key: %x", key)
+	}
+	if _, err := ParseFromSec(key[1:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key[1:]), nil
+}
+
+func parseWitnessStack(value []byte) ([][]byte, error) {
+	from := bytes.NewReader(value)
+	count := ReadVarInt(from)
+	// Every item takes at least its length byte
+	if count > uint64(from.Len()) {
+		return nil, errors.New("unexpected end of witness")
+	}
+	var items [][]byte
+	for range count {
+		if from.Len() == 0 {
+			return nil, errors.New("unexpected end of witness")
+		}
+		item, err := readPsbtBytes(from, ReadVarInt(from))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if from.Len() != 0 {
+		return nil, errors.New("trailing data after witness")
+	}
+	return items, nil
+}
+
+func serializeWitnessStack(items [][]byte) []byte {
+	buf := EncodeVarInt(uint64(len(items)))
+	for _, item := range items {
+		buf = append(buf, EncodeVarInt(uint64(len(item)))...)
+		buf = append(buf, item...)
+	}
+	return buf
+}
+
+func (in *PsbtInput) parse(key []byte, value []byte) error {
+	var err error
+	switch key[0] {
+	case PSBT_IN_NON_WITNESS_UTXO:
+		if err = expectKeyLength(key, 1); err == nil {
+			in.NonWitnessUtxo, err = ParseTransaction(bytes.NewReader(value))
+		}
+	case PSBT_IN_WITNESS_UTXO:
+		if err = expectKeyLength(key, 1); err == nil {
+			in.WitnessUtxo, err = NewOutputFrom(bytes.NewReader(value))
+		}
+	case PSBT_IN_PARTIAL_SIG:
+		var pubkey string
+		if pubkey, err = pubkeyKey(key); err == nil {
+			in.PartialSigs[pubkey] = value
+		}
+	case PSBT_IN_SIGHASH_TYPE:
+		if err = expectKeyLength(key, 1); err == nil {
+			if len(value) != 4 {
+				return errors.New("invalid psbt sighash type")
+			}
+			in.SigHashType = SigHashType(binary.LittleEndian.Uint32(value))
+		}
+	case PSBT_IN_REDEEM_SCRIPT:
+		if err = expectKeyLength(key, 1); err == nil {
+			in.RedeemScript = value
+		}
+	case PSBT_IN_WITNESS_SCRIPT:
+		if err = expectKeyLength(key, 1); err == nil {
+			in.WitnessScript = value
+		}
+	case PSBT_IN_BIP32_DERIVATION:
+		var pubkey string
+		if pubkey, err = pubkeyKey(key); err == nil {
+			in.Bip32Derivation[pubkey], err = parseKeyOrigin(value)
+		}
+	case PSBT_IN_FINAL_SCRIPTSIG:
+		if err = expectKeyLength(key, 1); err == nil {
+			in.FinalScriptSig = value
+		}
+	case PSBT_IN_FINAL_SCRIPTWITNESS:
+		if err = expectKeyLength(key, 1); err == nil {
+			in.FinalScriptWitness, err = parseWitnessStack(value)
+		}
+	case PSBT_IN_RIPEMD160, PSBT_IN_SHA256, PSBT_IN_HASH160, PSBT_IN_HASH256:
+		// The key holds the hash of the preimage
+		if !bytes.Equal(key[1:], PSBT_PREIMAGE_HASHES[key[0]](value)) {
+			return fmt.Errorf("invalid preimage for psbt type %x", key[0])
+		}
+		in.preimages(key[0])[hex.EncodeToString(key[1:])] = value
+	case PSBT_IN_PREVIOUS_TXID:
+		if err = expectKeyLength(key, 1); err == nil {
+			if len(value) != 32 {
+				return errors.New("invalid psbt previous txid")
+			}
+			in.PreviousTxid, _ = parseHash(bytes.NewReader(value))
+		}
+	case PSBT_IN_OUTPUT_INDEX:
+		if err = expectKeyLength(key, 1); err == nil {
+			in.OutputIndex, err = parseUint32Value(value)
+		}
+	case PSBT_IN_SEQUENCE:
+		if err = expectKeyLength(key, 1); err == nil {
+			in.Sequence, err = parseUint32Value(value)
+		}
+	case PSBT_IN_REQUIRED_TIME_LOCK:
+		if err = expectKeyLength(key, 1); err == nil {
+			if in.RequiredTimeLocktime, err = parseUint32Value(value); err == nil && in.RequiredTimeLocktime < LOCKTIME_THRESHOLD {
+				return errors.New("required time locktime below the threshold")
+			}
+		}
+	case PSBT_IN_REQUIRED_HEIGHT_LOCK:
+		if err = expectKeyLength(key, 1); err == nil {
+			in.RequiredHeightLocktime, err = parseUint32Value(value)
+			if err == nil && (in.RequiredHeightLocktime == 0 || in.RequiredHeightLocktime >= LOCKTIME_THRESHOLD) {
+				return errors.New("invalid required height locktime")
+			}
+		}
+	default:
+		in.Unknown[hex.EncodeToString(key)] = value
+	}
+	return err
+}
+
+func (out *PsbtOutput) parse(key []byte, value []byte) error {
+	var err error
+	switch key[0] {
+	case PSBT_OUT_REDEEM_SCRIPT:
+		if err = expectKeyLength(key, 1); err == nil {
+			out.RedeemScript = value
+		}
+	case PSBT_OUT_WITNESS_SCRIPT:
+		if err = expectKeyLength(key, 1); err == nil {
+			out.WitnessScript = value
+		}
+	case PSBT_OUT_BIP32_DERIVATION:
+		var pubkey string
+		if pubkey, err = pubkeyKey(key); err == nil {
+			out.Bip32Derivation[pubkey], err = parseKeyOrigin(value)
+		}
+	case PSBT_OUT_AMOUNT:
+		if err = expectKeyLength(key, 1); err == nil {
+			if len(value) != 8 {
+				return errors.New("invalid psbt output amount")
+			}
+			out.Amount = binary.LittleEndian.Uint64(value)
+		}
+	case PSBT_OUT_SCRIPT:
+		if err = expectKeyLength(key, 1); err == nil {
+			out.Script, err = parsedScript(value)
+		}
+	default:
+		out.Unknown[hex.EncodeToString(key)] = value
+	}
+	return err
+}
+
+func (p *Psbt) parseGlobal(key []byte, value []byte) error {
+	var err error
+	switch key[0] {
+	case PSBT_GLOBAL_UNSIGNED_TX:
+		if err = expectKeyLength(key, 1); err != nil {
+			return err
+		}
+		tx, err := ParseTransaction(bytes.NewReader(value))
+		if err != nil {
+			return err
+		}
+		if tx.segwit || !bytes.Equal(tx.serializeLegacy(), value) {
+			return errors.New("psbt unsigned transaction must use the legacy serialization")
+		}
+		for index, in := range tx.inputs {
+			if len(in.scriptSig.cmds) > 0 {
+				return fmt.Errorf("input %d of the unsigned transaction has a scriptSig", index)
+			}
+		}
+		p.TxVersion = tx.version.number
+		p.FallbackLocktime = tx.locktime
+		p.setTransaction(tx)
+	case PSBT_GLOBAL_XPUB:
+		if err = expectKeyLength(key, EXTENDED_KEY_SIZE+1); err == nil {
+			p.Xpubs[EncodeBase58Check(key[1:])], err = parseKeyOrigin(value)
+		}
+	case PSBT_GLOBAL_TX_VERSION:
+		if err = expectKeyLength(key, 1); err == nil {
+			p.TxVersion, err = parseUint32Value(value)
+		}
+	case PSBT_GLOBAL_FALLBACK_LOCKTIME:
+		if err = expectKeyLength(key, 1); err == nil {
+			p.FallbackLocktime, err = parseUint32Value(value)
+		}
+	case PSBT_GLOBAL_TX_MODIFIABLE:
+		if err = expectKeyLength(key, 1); err == nil {
+			if len(value) != 1 {
+				return errors.New("invalid psbt modifiable flags")
+			}
+			p.TxModifiable = value[0]
+		}
+	case PSBT_GLOBAL_VERSION:
+		if err = expectKeyLength(key, 1); err == nil {
+			p.Version, err = parseUint32Value(value)
+		}
+	default:
+		p.Unknown[hex.EncodeToString(key)] = value
+	}
+	return err
+}
+
+func ParsePsbt(from io.Reader) (*Psbt, error) {
+	raw, err := io.ReadAll(from)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(raw, []byte(PSBT_MAGIC)) {
+		return nil, errors.New("invalid psbt magic bytes")
+	}
+	reader := bytes.NewReader(raw[len(PSBT_MAGIC):])
+	psbt := &Psbt{
+		Xpubs:   make(map[string]*KeyOrigin),
+		Unknown: make(map[string][]byte),
+	}
+	// The counts only exist in version 2, the maps are created once
+	// the version is known
+	var inputCount, outputCount uint64
+	types, err := readPsbtMap(reader, func(key []byte, value []byte) error {
+		switch key[0] {
+		case PSBT_GLOBAL_INPUT_COUNT, PSBT_GLOBAL_OUTPUT_COUNT:
+			if err := expectKeyLength(key, 1); err != nil {
+				return err
+			}
+			count, err := parseCountValue(value)
+			if key[0] == PSBT_GLOBAL_INPUT_COUNT {
+				inputCount = count
+			} else {
+				outputCount = count
+			}
+			return err
+		}
+		return psbt.parseGlobal(key, value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if psbt.Version != 0 && psbt.Version != 2 {
+		return nil, fmt.Errorf("unsupported psbt version: %d", psbt.Version)
+	}
+	if err := psbtGlobalFields.check(types, psbt.Version); err != nil {
+		return nil, err
+	}
+	if psbt.Version == 2 {
+		// Every map takes at least its separator byte
+		remaining := uint64(reader.Len())
+		if inputCount > remaining || outputCount > remaining-inputCount {
+			return nil, errors.New("unexpected end of psbt")
+		}
+		for range inputCount {
+			psbt.Inputs = append(psbt.Inputs, newPsbtInput())
+		}
+		for range outputCount {
+			psbt.Outputs = append(psbt.Outputs, newPsbtOutput())
+		}
+	}
+	for _, in := range psbt.Inputs {
+		types, err := readPsbtMap(reader, in.parse)
+		if err != nil {
+			return nil, err
+		}
+		if err := psbtInputFields.check(types, psbt.Version); err != nil {
+			return nil, err
+		}
+	}
+	for _, out := range psbt.Outputs {
+		types, err := readPsbtMap(reader, out.parse)
+		if err != nil {
+			return nil, err
+		}
+		if err := psbtOutputFields.check(types, psbt.Version); err != nil {
+			return nil, err
+		}
+	}
+	if reader.Len() != 0 {
+		return nil, errors.New("trailing data after psbt")
+	}
+	for index, in := range psbt.Inputs {
+		if in.NonWitnessUtxo != nil && in.NonWitnessUtxo.Id() != in.PreviousTxid {
+			return nil, fmt.Errorf("non witness utxo of input %d does not match its outpoint", index)
+		}
+	}
+	if _, err := psbt.ComputeLocktime(); err != nil {
+		return nil, err
+	}
+	return psbt, nil
+}
+
+func ParsePsbtBase64(encoded string) (*Psbt, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePsbt(bytes.NewReader(raw))
+}
+
+func appendPsbtPair(buf []byte, key []byte, value []byte) []byte {
+	buf = append(buf, EncodeVarInt(uint64(len(key)))...)
+	buf = append(buf, key...)
+	buf = append(buf, EncodeVarInt(uint64(len(value)))...)
+	return append(buf, value...)
+}
+
+// Appends the pairs of a map keyed by hex encoded key data, sorted by key
+func appendPsbtMap[T any](buf []byte, keyType byte, values map[string]T, serialize func(T) []byte) []byte {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		data, _ := hex.DecodeString(key)
+		if keyType != 0xff {
+			data = append([]byte{keyType}, data...)
+		}
+		buf = appendPsbtPair(buf, data, serialize(values[key]))
+	}
+	return buf
+}
+
+func rawValue(value []byte) []byte {
+	return value
+}
+
+func (in *PsbtInput) serialize(version uint32) []byte {
+	buf := []byte{}
+	if in.NonWitnessUtxo != nil {
+		buf = appendPsbtPair(buf, []byte{PSBT_IN_NON_WITNESS_UTXO}, in.NonWitnessUtxo.Serialize())
+	}
+	if in.WitnessUtxo != nil {
+		buf = appendPsbtPair(buf, []byte{PSBT_IN_WITNESS_UTXO}, in.WitnessUtxo.Serialize())
+	}
+	buf = appendPsbtMap(buf, PSBT_IN_PARTIAL_SIG, in.PartialSigs, rawValue)
+	if in.SigHashType != 0 {
+		buf = appendPsbtPair(buf, []byte{PSBT_IN_SIGHASH_TYPE}, binary.LittleEndian.AppendUint32(nil, uint32(in.SigHashType)))
+	}
+	if in.RedeemScript != nil {
+		buf = appendPsbtPair(buf, []byte{PSBT_IN_REDEEM_SCRIPT}, in.RedeemScript)
+	}
+	if in.WitnessScript != nil {
+		buf = appendPsbtPair(buf, []byte{PSBT_IN_WITNESS_SCRIPT}, in.WitnessScript)
+	}
+	buf = appendPsbtMap(buf, PSBT_IN_BIP32_DERIVATION, in.Bip32Derivation, (*KeyOrigin).Serialize)
+	if in.FinalScriptSig != nil {
+		buf = appendPsbtPair(buf, []byte{PSBT_IN_FINAL_SCRIPTSIG}, in.FinalScriptSig)
+	}
+	if in.FinalScriptWitness != nil {
+		buf = appendPsbtPair(buf, []byte{PSBT_IN_FINAL_SCRIPTWITNESS}, serializeWitnessStack(in.FinalScriptWitness))
+	}
+	for _, keyType := range []byte{PSBT_IN_RIPEMD160, PSBT_IN_SHA256, PSBT_IN_HASH160, PSBT_IN_HASH256} {
+		buf = appendPsbtMap(buf, keyType, in.preimages(keyType), rawValue)
+	}
+	if version == 2 {
+		txid, _ := hex.DecodeString(in.PreviousTxid)
+		slices.Reverse(txid)
+		buf = appendPsbtPair(buf, []byte{PSBT_IN_PREVIOUS_TXID}, txid)
+		buf = appendPsbtPair(buf, []byte{PSBT_IN_OUTPUT_INDEX}, binary.LittleEndian.AppendUint32(nil, in.OutputIndex))
+		if in.Sequence != 0xffffffff {
+			buf = appendPsbtPair(buf, []byte{PSBT_IN_SEQUENCE}, binary.LittleEndian.AppendUint32(nil, in.Sequence))
+		}
+		if in.RequiredTimeLocktime != 0 {
+			buf = appendPsbtPair(buf, []byte{PSBT_IN_REQUIRED_TIME_LOCK}, binary.LittleEndian.AppendUint32(nil, in.RequiredTimeLocktime))
+		}
+		if in.RequiredHeightLocktime != 0 {
+			buf = appendPsbtPair(buf, []byte{PSBT_IN_REQUIRED_HEIGHT_LOCK}, binary.LittleEndian.AppendUint32(nil, in.RequiredHeightLocktime))
+		}
+	}
+	buf = appendPsbtMap(buf, 0xff, in.Unknown, rawValue)
+	return append(buf, 0x00)
+}
+
+func (out *PsbtOutput) serialize(version uint32) []byte {
+	buf := []byte{}
+	if out.RedeemScript != nil {
+		buf = appendPsbtPair(buf, []byte{PSBT_OUT_REDEEM_SCRIPT}, out.RedeemScript)
+	}
+	if out.WitnessScript != nil {
+		buf = appendPsbtPair(buf, []byte{PSBT_OUT_WITNESS_SCRIPT}, out.WitnessScript)
+	}
+	buf = appendPsbtMap(buf, PSBT_OUT_BIP32_DERIVATION, out.Bip32Derivation, (*KeyOrigin).Serialize)
+	if version == 2 {
+		buf = appendPsbtPair(buf, []byte{PSBT_OUT_AMOUNT}, binary.LittleEndian.AppendUint64(nil, out.Amount))
+		buf = appendPsbtPair(buf, []byte{PSBT_OUT_SCRIPT}, serializeScriptToBytes(out.Script.cmds))
+	}
+	buf = appendPsbtMap(buf, 0xff, out.Unknown, rawValue)
+	return append(buf, 0x00)
+}
+
+func (p *Psbt) Serialize() []byte {
+	buf := []byte(PSBT_MAGIC)
+	if p.Version == 0 {
+		tx, _ := p.UnsignedTx()
+		buf = appendPsbtPair(buf, []byte{PSBT_GLOBAL_UNSIGNED_TX}, tx.serializeLegacy())
+	}
+	xpubs := make(map[string]*KeyOrigin, len(p.Xpubs))
+	for encoded, origin := range p.Xpubs {
+		raw, _ := DecodeBase58Check(encoded)
+		xpubs[hex.EncodeToString(raw)] = origin
+	}
+	buf = appendPsbtMap(buf, PSBT_GLOBAL_XPUB, xpubs, (*KeyOrigin).Serialize)
+	if p.Version == 2 {
+		buf = appendPsbtPair(buf, []byte{PSBT_GLOBAL_TX_VERSION}, binary.LittleEndian.AppendUint32(nil, p.TxVersion))
+		if p.FallbackLocktime != 0 {
+			buf = appendPsbtPair(buf, []byte{PSBT_GLOBAL_FALLBACK_LOCKTIME}, binary.LittleEndian.AppendUint32(nil, p.FallbackLocktime))
+		}
+		buf = appendPsbtPair(buf, []byte{PSBT_GLOBAL_INPUT_COUNT}, EncodeVarInt(uint64(len(p.Inputs))))
+		buf = appendPsbtPair(buf, []byte{PSBT_GLOBAL_OUTPUT_COUNT}, EncodeVarInt(uint64(len(p.Outputs))))
+		if p.TxModifiable != 0 {
+			buf = appendPsbtPair(buf, []byte{PSBT_GLOBAL_TX_MODIFIABLE}, []byte{p.TxModifiable})
+		}
+	}
+	if p.Version != 0 {
+		buf = appendPsbtPair(buf, []byte{PSBT_GLOBAL_VERSION}, binary.LittleEndian.AppendUint32(nil, p.Version))
+	}
+	buf = appendPsbtMap(buf, 0xff, p.Unknown, rawValue)
+	buf = append(buf, 0x00)
+	for _, in := range p.Inputs {
+		buf = append(buf, in.serialize(p.Version)...)
+	}
+	for _, out := range p.Outputs {
+		buf = append(buf, out.serialize(p.Version)...)
+	}
+	return buf
+}
+
+func (p *Psbt) Base64() string {
+	return base64.StdEncoding.EncodeToString(p.Serialize())
+}
+
+// Returns the input at index, failing when out of range
+func (p *Psbt) input(index int) (*PsbtInput, error) {
+	if index < 0 || index >= len(p.Inputs) {
+		return nil, fmt.Errorf("psbt has no input %d", index)
+	}
+	return p.Inputs[index], nil
+}
+
+// Updater role: attaches the full previous transaction of the input
+func (p *Psbt) AddNonWitnessUtxo(input int, prev *Transaction) error {
+	in, err := p.input(input)
+	if err != nil {
+		return err
+	}
+	if prev.Id() != in.PreviousTxid {
+		return fmt.Errorf("transaction %s is not spent by input %d", prev.Id(), input)
+	}
+	if int(in.OutputIndex) >= len(prev.outputs) {
+		return fmt.Errorf("transaction %s has no output %d", prev.Id(), in.OutputIndex)
+	}
+	in.NonWitnessUtxo = prev
+	return nil
+}
+
+// Updater role: attaches the output spent by a segwit input
+func (p *Psbt) AddWitnessUtxo(input int, output *Output) error {
+	in, err := p.input(input)
+	if err != nil {
+		return err
+	}
+	in.WitnessUtxo = output
+	return nil
+}
+
+// Psbt is a PrevoutProvider for the UTXOs attached to its inputs
+func (p *Psbt) Prevout(txId string, index uint32) (*Output, error) {
+	for input, in := range p.Inputs {
+		if in.PreviousTxid == txId && in.OutputIndex == index {
+			return p.utxo(input)
+		}
+	}
+	return nil, prevoutNotFound(txId, index)
+}
+
+func (p *Psbt) utxo(input int) (*Output, error) {
+	in, err := p.input(input)
+	if err != nil {
+		return nil, err
+	}
+	if in.WitnessUtxo != nil {
+		return in.WitnessUtxo, nil
+	}
+	if in.NonWitnessUtxo != nil {
+		return outputAt(in.NonWitnessUtxo, in.PreviousTxid, in.OutputIndex)
+	}
+	return nil, fmt.Errorf("missing utxo for input %d", input)
+}
+
+func (in *PsbtInput) isFinal() bool {
+	return in.FinalScriptSig != nil || in.FinalScriptWitness != nil
+}
+
+func (in *PsbtInput) sigHashType() SigHashType {
+	if in.SigHashType == 0 {
+		return SIGHASH_ALL
+	}
+	return in.SigHashType
+}
+
+func parsedScript(script []byte) (*ScriptPubKey, error) {
+	cmds, err := parseScriptFromBytes(script)
+	if err != nil {
+		return nil, err
+	}
+	return &ScriptPubKey{cmds, script}, nil
+}
+
+// Returns the script the signatures of the input commit to, resolving the
+// redeem and witness scripts, and whether it uses the BIP143 digest
+func (in *PsbtInput) scriptCode(prevout *Output) ([]byte, bool, error) {
+	script := prevout.scriptPubKey
+	if script.isP2SH() {
+		if in.RedeemScript == nil {
+			return nil, false, errors.New("missing redeem script")
+		}
+		if !bytes.Equal(Hash160(in.RedeemScript), script.cmds[1].(*ScriptVal).Val) {
+			return nil, false, errors.New("redeem script does not match the output")
+		}
+		redeem, err := parsedScript(in.RedeemScript)
+		if err != nil {
+			return nil, false, err
+		}
+		if !redeem.isP2WPKH() && !redeem.isP2WSH() {
+			return in.RedeemScript, false, nil
+		}
+		script = redeem
+	}
+	if script.isP2WSH() {
+		if in.WitnessScript == nil {
+			return nil, false, errors.New("missing witness script")
+		}
+		hash := sha256.Sum256(in.WitnessScript)
+		if !bytes.Equal(hash[:], script.cmds[1].(*ScriptVal).Val) {
+			return nil, false, errors.New("witness script does not match the output")
+		}
+	}
+	if script.isP2WPKH() || script.isP2WSH() {
+		code, err := witnessScriptCode(script, in.WitnessScript)
+		return code, true, err
+	}
+	if script.isP2TR() {
+		return nil, false, errors.New("taproot inputs are not supported")
+	}
+	return serializeScriptToBytes(script.cmds), false, nil
+}
+
+// Returns the serialization of the key used by the script, if any
+func keyInScript(key *PrivateKey, scriptCode []byte, segwit bool) []byte {
+	cmds, err := parseScriptFromBytes(scriptCode)
+	if err != nil {
+		return nil
+	}
+	candidates := [][]byte{key.Sec(COMPRESSED)}
+	if !segwit {
+		candidates = append(candidates, key.Sec(UNCOMPRESSED))
+	}
+	for _, sec := range candidates {
+		for _, cmd := range cmds {
+			val, ok := cmd.(*ScriptVal)
+			if ok && (bytes.Equal(val.Val, sec) || bytes.Equal(val.Val, Hash160(sec))) {
+				return sec
+			}
+		}
+	}
+	return nil
+}
+
+// Adds the signature of key for the input of tx spending prevout
+// to the partial signatures
+func (in *PsbtInput) sign(tx *Transaction, input int, prevout *Output, key *PrivateKey) error {
+	scriptCode, segwit, err := in.scriptCode(prevout)
+	if err != nil {
+		return err
+	}
+	sec := keyInScript(key, scriptCode, segwit)
+	if sec == nil {
+		return fmt.Errorf("key cannot sign input %d", input)
+	}
+	if !validSigHashType(in.sigHashType()) {
+		return fmt.Errorf("invalid sighash type for input %d: %x", input, in.sigHashType())
+	}
+	var hash []byte
+	if segwit {
+		hash, err = tx.segwitSigHash(input, scriptCode, prevout.amount, in.sigHashType())
+	} else {
+		hash, err = tx.legacySigHash(input, scriptCode, in.sigHashType())
+	}
+	if err != nil {
+		return err
+	}
+	sig := key.Sign(intFromBytes(hash))
+	in.PartialSigs[hex.EncodeToString(sec)] = append(sig.Der(), byte(in.sigHashType()))
+	return nil
+}
+
+// Signer role: adds the signature of key to the input
+func (p *Psbt) SignInput(input int, key *PrivateKey) error {
+	in, err := p.input(input)
+	if err != nil {
+		return err
+	}
+	if in.isFinal() {
+		return fmt.Errorf("input %d is already finalized", input)
+	}
+	prevout, err := p.utxo(input)
+	if err != nil {
+		return err
+	}
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		return err
+	}
+	if err := in.sign(tx, input, prevout, key); err != nil {
+		return err
+	}
+	p.updateModifiable(in.sigHashType())
+	return nil
+}
+
+// Updater role: adds the preimage of a hash checked by the witness
+// script of the input, for spending the hash locks of miniscripts
+func (p *Psbt) AddPreimage(input int, preimage []byte) error {
+	in, err := p.input(input)
+	if err != nil {
+		return err
+	}
+	if in.isFinal() {
+		return fmt.Errorf("input %d is already finalized", input)
+	}
+	if err := in.addPreimage(preimage); err != nil {
+		return fmt.Errorf("failed adding preimage to input %d: %w", input, err)
+	}
+	return nil
+}
+
+// Stores the preimage under every hash of it the witness script pushes
+func (in *PsbtInput) addPreimage(preimage []byte) error {
+	cmds, err := parseScriptFromBytes(in.WitnessScript)
+	if err != nil {
+		return err
+	}
+	found := false
+	for keyType, hash := range PSBT_PREIMAGE_HASHES {
+		hashed := hash(preimage)
+		for _, cmd := range cmds {
+			if val, ok := cmd.(*ScriptVal); ok && bytes.Equal(val.Val, hashed) {
+				in.preimages(keyType)[hex.EncodeToString(hashed)] = preimage
+				found = true
+			}
+		}
+	}
+	if !found {
+		return errors.New("preimage of no hash in the witness script")
+	}
+	return nil
+}
+
+// Signs every input the key can sign, failing with the error of each
+// input if there is none
+func (p *Psbt) Sign(key *PrivateKey) error {
+	signed := 0
+	failures := []error{}
+	for input := range p.Inputs {
+		if err := p.SignInput(input, key); err != nil {
+			failures = append(failures, fmt.Errorf("input %d: %w", input, err))
+		} else {
+			signed++
+		}
+	}
+	if signed == 0 {
+		return errors.Join(append([]error{errors.New("key cannot sign any input")}, failures...)...)
+	}
+	return nil
+}
+
+// Signs the inputs with the keys derived from master following the
+// BIP32 derivations whose fingerprint matches it
+func (p *Psbt) SignHD(master *ExtendedPrivateKey) error {
+	signed := 0
+	failures := []error{}
+	for input, in := range p.Inputs {
+		for _, origin := range in.Bip32Derivation {
+			if origin.Fingerprint != master.Fingerprint() {
+				continue
+			}
+			child := master
+			for _, index := range origin.Path {
+				var err error
+				child, err = child.Child(index)
+				if err != nil {
+					return err
+				}
+			}
+			if err := p.SignInput(input, child.PrivateKey()); err != nil {
+				failures = append(failures, fmt.Errorf("input %d: %w", input, err))
+			} else {
+				signed++
+			}
+		}
+	}
+	if signed == 0 {
+		return errors.Join(append([]error{errors.New("master key cannot sign any input")}, failures...)...)
+	}
+	return nil
+}
+
+func mergeMap[T any](into map[string]T, from map[string]T) {
+	for key, value := range from {
+		if _, ok := into[key]; !ok {
+			into[key] = value
+		}
+	}
+}
+
+func mergeBytes(into *[]byte, from []byte) {
+	if *into == nil {
+		*into = from
+	}
+}
+
+func (in *PsbtInput) merge(other *PsbtInput) {
+	if in.NonWitnessUtxo == nil {
+		in.NonWitnessUtxo = other.NonWitnessUtxo
+	}
+	if in.WitnessUtxo == nil {
+		in.WitnessUtxo = other.WitnessUtxo
+	}
+	mergeMap(in.PartialSigs, other.PartialSigs)
+	if in.SigHashType == 0 {
+		in.SigHashType = other.SigHashType
+	}
+	mergeBytes(&in.RedeemScript, other.RedeemScript)
+	mergeBytes(&in.WitnessScript, other.WitnessScript)
+	mergeMap(in.Bip32Derivation, other.Bip32Derivation)
+	mergeBytes(&in.FinalScriptSig, other.FinalScriptSig)
+	if in.FinalScriptWitness == nil {
+		in.FinalScriptWitness = other.FinalScriptWitness
+	}
+	for keyType := range PSBT_PREIMAGE_HASHES {
+		mergeMap(in.preimages(keyType), other.preimages(keyType))
+	}
+	mergeMap(in.Unknown, other.Unknown)
+}
+
+func (out *PsbtOutput) merge(other *PsbtOutput) {
+	mergeBytes(&out.RedeemScript, other.RedeemScript)
+	mergeBytes(&out.WitnessScript, other.WitnessScript)
+	mergeMap(out.Bip32Derivation, other.Bip32Derivation)
+	mergeMap(out.Unknown, other.Unknown)
+}
+
+// Combiner role: merges PSBTs of the same unsigned transaction
+func (p *Psbt) Combine(others ...*Psbt) error {
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		otherTx, err := other.UnsignedTx()
+		if err != nil {
+			return err
+		}
+		if otherTx.Id() != tx.Id() {
+			return errors.New("cannot combine psbts of different transactions")
+		}
+	}
+	for _, other := range others {
+		if p.Version == 2 {
+			p.combineModifiable(other.TxModifiable)
+		}
+		mergeMap(p.Xpubs, other.Xpubs)
+		mergeMap(p.Unknown, other.Unknown)
+		for index, in := range p.Inputs {
+			in.merge(other.Inputs[index])
+		}
+		for index, out := range p.Outputs {
+			out.merge(other.Outputs[index])
+		}
+	}
+	return nil
+}
+
+// Returns the stack satisfying a P2PK, P2PKH or m-of-n multisig
+// script with the partial signatures
+func (in *PsbtInput) satisfy(script *ScriptPubKey) ([][]byte, error) {
+	class := script.Classify()
+	switch class.Type {
+	case SCRIPT_TYPE_P2PKH:
+		for pubkey, sig := range in.PartialSigs {
+			sec, _ := hex.DecodeString(pubkey)
+			if bytes.Equal(Hash160(sec), class.Hash) {
+				return [][]byte{sig, sec}, nil
+			}
+		}
+		return nil, errors.New("missing signature for P2PKH")
+	case SCRIPT_TYPE_P2PK:
+		if sig, ok := in.PartialSigs[hex.EncodeToString(class.PubKeys[0])]; ok {
+			return [][]byte{sig}, nil
+		}
+		return nil, errors.New("missing signature for P2PK")
+	case SCRIPT_TYPE_MULTISIG:
+		// Signatures have to follow the order of the public keys
+		stack := [][]byte{{}}
+		for _, pubkey := range class.PubKeys {
+			if sig, ok := in.PartialSigs[hex.EncodeToString(pubkey)]; ok && len(stack) <= class.Required {
+				stack = append(stack, sig)
+			}
+		}
+		if len(stack) <= class.Required {
+			return nil, fmt.Errorf("multisig needs %d signatures, found %d", class.Required, len(stack)-1)
+		}
+		return stack, nil
+	}
+	return nil, fmt.Errorf("unsupported %s script to finalize", class.Type)
+}
+
+func pushesScript(items [][]byte) []byte {
+	cmds := make([]Operation, 0, len(items))
+	for _, item := range items {
+		if len(item) == 0 {
+			cmds = append(cmds, &OP_0{})
+		} else {
+			cmds = append(cmds, &ScriptVal{item})
+		}
+	}
+	return serializeScriptToBytes(cmds)
+}
+
+// Returns the scriptSig, nil when empty, and the witness spending
+// prevout, with satisfy building the stack of the script it commits to
+func (in *PsbtInput) finalScripts(prevout *Output, satisfy func(*ScriptPubKey) ([][]byte, error)) ([]byte, [][]byte, error) {
+	if _, _, err := in.scriptCode(prevout); err != nil {
+		return nil, nil, err
+	}
+	var err error
+	script := prevout.scriptPubKey
+	var scriptSig [][]byte
+	var witness [][]byte
+	if script.isP2SH() {
+		script, _ = parsedScript(in.RedeemScript)
+	}
+	if script.isP2WPKH() {
+		witness, err = in.satisfy(P2PKHScript(script.cmds[1].(*ScriptVal).Val))
+	} else if script.isP2WSH() {
+		var witnessScript *ScriptPubKey
+		if witnessScript, err = parsedScript(in.WitnessScript); err == nil {
+			if witness, err = satisfy(witnessScript); err == nil {
+				witness = append(witness, in.WitnessScript)
+			}
+		}
+	} else {
+		scriptSig, err = satisfy(script)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if prevout.scriptPubKey.isP2SH() {
+		scriptSig = append(scriptSig, in.RedeemScript)
+	}
+	if len(scriptSig) == 0 {
+		return nil, witness, nil
+	}
+	return pushesScript(scriptSig), witness, nil
+}
+
+// Finalizer role: builds the scriptSig and witness of the input
+// from its partial signatures
+func (p *Psbt) FinalizeInput(input int) error {
+	return p.finalizeInput(input, nil)
+}
+
+// Finalizer role: builds the witness of an input whose witness script
+// is the miniscript, from its partial signatures and preimages and the
+// lock times of the transaction
+func (p *Psbt) FinalizeMiniscript(input int, ms *Miniscript) error {
+	return p.finalizeInput(input, ms)
+}
+
+func (p *Psbt) finalizeInput(input int, ms *Miniscript) error {
+	in, err := p.input(input)
+	if err != nil {
+		return err
+	}
+	if in.isFinal() {
+		return nil
+	}
+	prevout, err := p.utxo(input)
+	if err != nil {
+		return err
+	}
+	satisfy := in.satisfy
+	if ms != nil {
+		tx, err := p.UnsignedTx()
+		if err != nil {
+			return err
+		}
+		satisfy = in.satisfyMiniscript(ms, tx, input)
+	}
+	scriptSig, witness, err := in.finalScripts(prevout, satisfy)
+	if err != nil {
+		return fmt.Errorf("failed finalizing input %d: %w", input, err)
+	}
+	in.FinalScriptSig = scriptSig
+	in.FinalScriptWitness = witness
+	in.PartialSigs = make(map[string][]byte)
+	in.SigHashType = 0
+	in.RedeemScript = nil
+	in.WitnessScript = nil
+	in.Bip32Derivation = make(map[string]*KeyOrigin)
+	for keyType := range PSBT_PREIMAGE_HASHES {
+		clear(in.preimages(keyType))
+	}
+	return nil
+}
+
+func (p *Psbt) Finalize() error {
+	for input := range p.Inputs {
+		if err := p.FinalizeInput(input); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Extractor role: returns the signed transaction once every input is final
+func (p *Psbt) Extract() (*Transaction, error) {
+	tx, err := p.UnsignedTx()
+	if err != nil {
+		return nil, err
+	}
+	for index, in := range p.Inputs {
+		if !in.isFinal() {
+			return nil, fmt.Errorf("input %d is not finalized", index)
+		}
+		if err := tx.inputs[index].setScriptSig(in.FinalScriptSig); err != nil {
+			return nil, err
+		}
+		tx.inputs[index].items = in.FinalScriptWitness
+		if len(in.FinalScriptWitness) > 0 {
+			tx.segwit = true
+		}
+	}
+	return tx, nil
+}
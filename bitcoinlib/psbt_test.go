@@ -0,0 +1,275 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func multisigScript(m int, keys ...*bitcoinlib.PrivateKey) []byte {
+	script := []byte{byte(0x50 + m)}
+	for _, key := range keys {
+		script = append(script, pushData(key.Sec(bitcoinlib.COMPRESSED))...)
+	}
+	return append(script, byte(0x50+len(keys)), 0xae)
+}
+
+func p2wshPubKey(script []byte) *bitcoinlib.ScriptPubKey {
+	hash := sha256.Sum256(script)
+	return bitcoinlib.P2WSHPubKey(hash[:])
+}
+
+type psbtFixture struct {
+	keys     []*bitcoinlib.PrivateKey
+	funding  *bitcoinlib.Transaction
+	redeem   [][]byte
+	witness  [][]byte
+	segwit   []bool
+	nonFinal *bitcoinlib.Psbt
+}
+
+// Funds one output of every supported type and builds the PSBT spending them
+func newPsbtFixture(t *testing.T) *psbtFixture {
+	keys := []*bitcoinlib.PrivateKey{
+		bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(4001)),
+		bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(4002)),
+		bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(4003)),
+	}
+	sec := keys[0].Sec(bitcoinlib.COMPRESSED)
+	p2wpkh := bitcoinlib.P2WPKHPubKey(bitcoinlib.Hash160(sec)).Serialize()[1:]
+	multisig := multisigScript(2, keys...)
+	fixture := &psbtFixture{
+		keys:    keys,
+		redeem:  [][]byte{nil, nil, p2wpkh, multisigScript(2, keys[0], keys[1]), nil, p2wshPubKey(multisig).Serialize()[1:]},
+		witness: [][]byte{nil, nil, nil, nil, multisig, multisig},
+		segwit:  []bool{false, true, true, false, true, true},
+	}
+	scripts := []*bitcoinlib.ScriptPubKey{
+		bitcoinlib.P2PKHScript(bitcoinlib.Hash160(sec)),
+		bitcoinlib.P2WPKHPubKey(bitcoinlib.Hash160(sec)),
+		bitcoinlib.P2SHPubKey(bitcoinlib.Hash160(fixture.redeem[2])),
+		bitcoinlib.P2SHPubKey(bitcoinlib.Hash160(fixture.redeem[3])),
+		p2wshPubKey(multisig),
+		bitcoinlib.P2SHPubKey(bitcoinlib.Hash160(fixture.redeem[5])),
+	}
+	fixture.funding = bitcoinlib.NewTransaction()
+	fixture.funding.AddInput(strings.Repeat("33", 32), 0)
+	for _, script := range scripts {
+		fixture.funding.AddOutputScript(10000, script)
+	}
+
+	tx := bitcoinlib.NewTransaction()
+	for index := range scripts {
+		tx.AddInput(fixture.funding.Id(), uint32(index))
+	}
+	if err := tx.AddOutput(55000, "1BenRpVUFK65JFWcQSuHnJKzc4M8ZP8Eqa", bitcoinlib.MAINNET_PARAMS); err != nil {
+		t.Fatalf("Failed adding output: %s", err)
+	}
+	psbt, err := bitcoinlib.NewPsbt(tx)
+	if err != nil {
+		t.Fatalf("Failed creating psbt: %s", err)
+	}
+	for index := range scripts {
+		if fixture.segwit[index] {
+			psbt.AddWitnessUtxo(index, bitcoinlib.NewOutput(10000, scripts[index]))
+		} else if err := psbt.AddNonWitnessUtxo(index, fixture.funding); err != nil {
+			t.Fatalf("Failed adding utxo %d: %s", index, err)
+		}
+		psbt.Inputs[index].RedeemScript = fixture.redeem[index]
+		psbt.Inputs[index].WitnessScript = fixture.witness[index]
+	}
+	fixture.nonFinal = psbt
+	return fixture
+}
+
+// Sends the PSBT through its serialization, as a co-signer would receive it
+func roundTrip(t *testing.T, psbt *bitcoinlib.Psbt) *bitcoinlib.Psbt {
+	parsed, err := bitcoinlib.ParsePsbtBase64(psbt.Base64())
+	if err != nil {
+		t.Fatalf("Failed parsing psbt: %s", err)
+	}
+	if !bytes.Equal(parsed.Serialize(), psbt.Serialize()) {
+		t.Fatalf("Serialization does not round trip\nExpected => %x\nGot => %x", psbt.Serialize(), parsed.Serialize())
+	}
+	return parsed
+}
+
+func TestPsbtSignCombineFinalize(t *testing.T) {
+	fixture := newPsbtFixture(t)
+	first := roundTrip(t, fixture.nonFinal)
+	second := roundTrip(t, fixture.nonFinal)
+	if err := first.Sign(fixture.keys[0]); err != nil {
+		t.Fatalf("Failed signing: %s", err)
+	}
+	if err := second.Sign(fixture.keys[1]); err != nil {
+		t.Fatalf("Failed signing: %s", err)
+	}
+	if _, err := first.Extract(); err == nil {
+		t.Fatal("Extracted psbt without finalizing")
+	}
+	if err := second.Finalize(); err == nil {
+		t.Fatal("Finalized P2PKH input without its signature")
+	}
+
+	combined := roundTrip(t, fixture.nonFinal)
+	if err := combined.Combine(roundTrip(t, first), roundTrip(t, second)); err != nil {
+		t.Fatalf("Failed combining: %s", err)
+	}
+	if err := combined.Finalize(); err != nil {
+		t.Fatalf("Failed finalizing: %s", err)
+	}
+	final := roundTrip(t, combined)
+	tx, err := final.Extract()
+	if err != nil {
+		t.Fatalf("Failed extracting: %s", err)
+	}
+	for index := range fixture.segwit {
+		if !tx.VerifyInput(index, final) {
+			t.Fatalf("Failed verifying input %d", index)
+		}
+	}
+	parsed, err := bitcoinlib.ParseTransaction(bytes.NewReader(tx.Serialize()))
+	if err != nil {
+		t.Fatalf("Failed parsing extracted transaction: %s", err)
+	}
+	if !parsed.Verify(final) {
+		t.Fatal("Failed verifying extracted transaction")
+	}
+	if tx.Fee(final) != 5000 {
+		t.Fatalf("Expected => 5000\nGot => %d", tx.Fee(final))
+	}
+}
+
+func TestPsbtSignHD(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, _ := bitcoinlib.NewMasterKey(seed, bitcoinlib.MAINNET_PARAMS)
+	child, _ := master.Derive("m/84'/0'/0'/0/1")
+	key := child.PrivateKey()
+	funding := bitcoinlib.NewTransaction()
+	funding.AddInput(strings.Repeat("44", 32), 0)
+	script := bitcoinlib.P2WPKHPubKey(bitcoinlib.Hash160(key.Sec(bitcoinlib.COMPRESSED)))
+	funding.AddOutputScript(20000, script)
+
+	tx := bitcoinlib.NewTransaction()
+	tx.AddInput(funding.Id(), 0)
+	tx.AddOutputScript(19000, script)
+	psbt, _ := bitcoinlib.NewPsbt(tx)
+	psbt.AddWitnessUtxo(0, bitcoinlib.NewOutput(20000, script))
+	origin, err := bitcoinlib.NewKeyOrigin(master.Fingerprint(), "m/84'/0'/0'/0/1")
+	if err != nil {
+		t.Fatalf("Failed parsing origin: %s", err)
+	}
+	if origin.String() != "[3442193e/84'/0'/0'/0/1]" {
+		t.Fatalf("Expected => [3442193e/84'/0'/0'/0/1]\nGot => %s", origin)
+	}
+	psbt.Inputs[0].Bip32Derivation[hex.EncodeToString(key.Sec(bitcoinlib.COMPRESSED))] = origin
+	psbt.Outputs[0].Bip32Derivation[hex.EncodeToString(key.Sec(bitcoinlib.COMPRESSED))] = origin
+	psbt.Xpubs[master.PublicKey().String()] = &bitcoinlib.KeyOrigin{Fingerprint: master.Fingerprint(), Path: []uint32{}}
+	psbt = roundTrip(t, psbt)
+
+	other, _ := bitcoinlib.NewMasterKey(append([]byte{0xff}, seed...), bitcoinlib.MAINNET_PARAMS)
+	if err := psbt.SignHD(other); err == nil {
+		t.Fatal("Signed with a master key of another wallet")
+	}
+	if err := psbt.SignHD(master); err != nil {
+		t.Fatalf("Failed signing: %s", err)
+	}
+	if err := psbt.Finalize(); err != nil {
+		t.Fatalf("Failed finalizing: %s", err)
+	}
+	signed, _ := psbt.Extract()
+	if !signed.Verify(psbt) {
+		t.Fatal("Failed verifying transaction signed from derivations")
+	}
+}
+
+func TestPsbtErrors(t *testing.T) {
+	fixture := newPsbtFixture(t)
+	raw := fixture.nonFinal.Serialize()
+	invalid := map[string][]byte{
+		"magic":         append([]byte("psbu\xff"), raw[5:]...),
+		"truncated":     raw[:len(raw)-1],
+		"trailing data": append(append([]byte{}, raw...), 0x00),
+		// Unsigned transaction key repeated at the start of the global map
+		"duplicated key": append([]byte("psbt\xff"), append(globalPair(fixture), raw[5:]...)...),
+		// Version 2 counts whose sum wraps around
+		"input count": psbtV2([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, []byte{0x01}),
+		// Witness stack claiming 2^64-1 items
+		"witness count": append(psbtV2([]byte{0x01}, []byte{0x00}), 0x01, 0x08, 0x09, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00),
+	}
+	for name, buf := range invalid {
+		if _, err := bitcoinlib.ParsePsbt(bytes.NewReader(buf)); err == nil {
+			t.Fatalf("Parsed invalid psbt: %s", name)
+		}
+	}
+
+	stranger := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(4999))
+	err := fixture.nonFinal.Sign(stranger)
+	if err == nil {
+		t.Fatal("Signed with an unrelated key")
+	}
+	if !strings.Contains(err.Error(), "input 0: ") {
+		t.Fatalf("Failed reporting the error of each input: %s", err)
+	}
+	outOfRange := map[string]func(int) error{
+		"AddNonWitnessUtxo": func(input int) error { return fixture.nonFinal.AddNonWitnessUtxo(input, bitcoinlib.NewTransaction()) },
+		"AddWitnessUtxo":    func(input int) error { return fixture.nonFinal.AddWitnessUtxo(input, bitcoinlib.NewOutput(1000, nil)) },
+		"SignInput":         func(input int) error { return fixture.nonFinal.SignInput(input, fixture.keys[0]) },
+		"AddPreimage":       func(input int) error { return fixture.nonFinal.AddPreimage(input, []byte{0x01}) },
+		"FinalizeInput":     fixture.nonFinal.FinalizeInput,
+	}
+	for name, call := range outOfRange {
+		for _, input := range []int{-1, len(fixture.nonFinal.Inputs)} {
+			if err := call(input); err == nil {
+				t.Fatalf("%s accepted input %d", name, input)
+			}
+		}
+	}
+	if err := fixture.nonFinal.AddNonWitnessUtxo(0, bitcoinlib.NewTransaction()); err == nil {
+		t.Fatal("Added utxo of a different transaction")
+	}
+	fixture.nonFinal.Inputs[3].RedeemScript = fixture.redeem[0]
+	if err := fixture.nonFinal.SignInput(3, fixture.keys[0]); err == nil {
+		t.Fatal("Signed with a redeem script not matching the output")
+	}
+
+	other := bitcoinlib.NewTransaction()
+	other.AddInput(strings.Repeat("55", 32), 0)
+	otherPsbt, _ := bitcoinlib.NewPsbt(other)
+	if err := fixture.nonFinal.Combine(otherPsbt); err == nil {
+		t.Fatal("Combined psbts of different transactions")
+	}
+}
+
+func psbtV2(inputCount, outputCount []byte) []byte {
+	buf := []byte("psbt\xff")
+	buf = append(buf, 0x01, 0x02, 0x04, 0x02, 0x00, 0x00, 0x00)
+	buf = append(append(buf, 0x01, 0x04, byte(len(inputCount))), inputCount...)
+	buf = append(append(buf, 0x01, 0x05, byte(len(outputCount))), outputCount...)
+	return append(buf, 0x01, 0xfb, 0x04, 0x02, 0x00, 0x00, 0x00, 0x00)
+}
+
+func globalPair(fixture *psbtFixture) []byte {
+	unsigned, _ := fixture.nonFinal.UnsignedTx()
+	tx := unsigned.Serialize()
+	pair := append([]byte{0x01, 0x00}, bitcoinlib.EncodeVarInt(uint64(len(tx)))...)
+	return append(pair, tx...)
+}
+
+func TestPsbtBIP174Vector(t *testing.T) {
+	// Valid PSBT with a non witness utxo from BIP174
+	encoded := "cHNidP8BAHUCAAAAASaBcTce3/KF6Tet7qSze3gADAVmy7OtZGQXE8pCFxv2AAAAAAD+////AtPf9QUAAAAAGXapFNDFmQPFusKGh2DpD9UhpGZap2UgiKwA4fUFAAAAABepFDVF5uM7gyxHBQ8k0+65PJwDlIvHh7MuEwAAAQD9pQEBAAAAAAECiaPHHqtNIOA3G7ukzGmPopXJRjr6Ljl/hTPMti+VZ+UBAAAAFxYAFL4Y0VKpsBIDna89p95PUzSe7LmF/////4b4qkOnHf8USIk6UwpyN+9rRgi7st0tAXHmOuxqSJC0AQAAABcWABT+Pp7xp0XpdNkCxDVZQ6vLNL1TU/////8CAMLrCwAAAAAZdqkUhc/xCX/Z4Ai7NK9wnGIZeziXikiIrHL++E4sAAAAF6kUM5cluiHv1irHU6m80GfWx6ajnQWHAkcwRAIgJxK+IuAnDzlPVoMR3HyppolwuAJf3TskAinwf4pfOiQCIAGLONfc0xTnNMkna9b7QPZzMlvEuqFEyADS8vAtsnZcASED0uFWdJQbrUqZY3LLh+GFbTZSYG2YVi/jnF6efkE/IQUCSDBFAiEA0SuFLYXc2WHS9fSrZgZU327tzHlMDDPOXMMJ/7X85Y0CIGczio4OFyXBl/saiK9Z9R5E5CVbIBZ8hoQDHAXR8lkqASECI7cr7vCWXRC+B3jv7NYfysb3mk6haTkzgHNEZPhPKrMAAAAAAAAA"
+	psbt, err := bitcoinlib.ParsePsbtBase64(encoded)
+	if err != nil {
+		t.Fatalf("Failed parsing: %s", err)
+	}
+	if psbt.Base64() != encoded {
+		t.Fatalf("Expected => %s\nGot => %s", encoded, psbt.Base64())
+	}
+	if psbt.Inputs[0].NonWitnessUtxo == nil || len(psbt.Outputs) != 2 {
+		t.Fatal("Failed decoding the input and output maps")
+	}
+}
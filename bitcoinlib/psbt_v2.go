@@ -0,0 +1,185 @@
+package bitcoinlib
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Flags of PSBT_GLOBAL_TX_MODIFIABLE (BIP370)
+const (
+	PSBT_INPUTS_MODIFIABLE  = 0x01
+	PSBT_OUTPUTS_MODIFIABLE = 0x02
+	PSBT_HAS_SIGHASH_SINGLE = 0x04
+)
+
+// Creator role: creates an empty version 2 PSBT where inputs and
+// outputs can still be added
+func NewPsbtV2(txVersion uint32, fallbackLocktime uint32) *Psbt {
+	return &Psbt{
+		Version:          2,
+		TxVersion:        txVersion,
+		FallbackLocktime: fallbackLocktime,
+		TxModifiable:     PSBT_INPUTS_MODIFIABLE | PSBT_OUTPUTS_MODIFIABLE,
+		Xpubs:            make(map[string]*KeyOrigin),
+		Unknown:          make(map[string][]byte),
+	}
+}
+
+// Returns an input spending the outpoint, to be added to a version 2 PSBT
+func NewPsbtInput(txid string, index uint32) *PsbtInput {
+	in := newPsbtInput()
+	in.PreviousTxid = txid
+	in.OutputIndex = index
+	return in
+}
+
+// Returns an output paying amount to the script, to be added to a
+// version 2 PSBT
+func NewPsbtOutput(amount uint64, script *ScriptPubKey) *PsbtOutput {
+	out := newPsbtOutput()
+	out.Amount = amount
+	out.Script = script
+	return out
+}
+
+func (p *Psbt) hasSignatures() bool {
+	for _, in := range p.Inputs {
+		if len(in.PartialSigs) > 0 || in.isFinal() {
+			return true
+		}
+	}
+	return false
+}
+
+// Constructor role: appends an input. Once there are signatures the
+// input cannot change the locktime of the transaction
+func (p *Psbt) AddInput(in *PsbtInput) error {
+	if p.Version != 2 {
+		return errors.New("inputs can only be added to version 2 psbts")
+	}
+	if p.TxModifiable&PSBT_INPUTS_MODIFIABLE == 0 {
+		return errors.New("psbt inputs are not modifiable")
+	}
+	if in.RequiredTimeLocktime != 0 && in.RequiredTimeLocktime < LOCKTIME_THRESHOLD {
+		return errors.New("required time locktime below the threshold")
+	}
+	if in.RequiredHeightLocktime >= LOCKTIME_THRESHOLD {
+		return errors.New("required height locktime above the threshold")
+	}
+	for _, other := range p.Inputs {
+		if other.PreviousTxid == in.PreviousTxid && other.OutputIndex == in.OutputIndex {
+			return fmt.Errorf("outpoint %s:%d is already spent by the psbt", in.PreviousTxid, in.OutputIndex)
+		}
+	}
+	before, err := p.ComputeLocktime()
+	if err != nil {
+		return err
+	}
+	p.Inputs = append(p.Inputs, in)
+	after, err := p.ComputeLocktime()
+	if err == nil && after != before && p.hasSignatures() {
+		err = errors.New("input changes the locktime of a signed psbt")
+	}
+	if err != nil {
+		p.Inputs = p.Inputs[:len(p.Inputs)-1]
+		return err
+	}
+	return nil
+}
+
+// Constructor role: appends an output
+func (p *Psbt) AddOutput(out *PsbtOutput) error {
+	if p.Version != 2 {
+		return errors.New("outputs can only be added to version 2 psbts")
+	}
+	if p.TxModifiable&PSBT_OUTPUTS_MODIFIABLE == 0 {
+		return errors.New("psbt outputs are not modifiable")
+	}
+	if out.Script == nil {
+		return errors.New("psbt output without script")
+	}
+	p.Outputs = append(p.Outputs, out)
+	return nil
+}
+
+// Returns the locktime of the transaction. In version 2 it is the
+// highest locktime required by the inputs, preferring heights when
+// both kinds are possible, or the fallback when nothing is required
+func (p *Psbt) ComputeLocktime() (uint32, error) {
+	if p.Version == 0 {
+		return p.FallbackLocktime, nil
+	}
+	constrained, heights, times := false, true, true
+	var height, time uint32
+	for _, in := range p.Inputs {
+		if in.RequiredHeightLocktime == 0 && in.RequiredTimeLocktime == 0 {
+			continue
+		}
+		constrained = true
+		heights = heights && in.RequiredHeightLocktime != 0
+		times = times && in.RequiredTimeLocktime != 0
+		height = max(height, in.RequiredHeightLocktime)
+		time = max(time, in.RequiredTimeLocktime)
+	}
+	switch {
+	case !constrained:
+		return p.FallbackLocktime, nil
+	case heights:
+		return height, nil
+	case times:
+		return time, nil
+	}
+	return 0, errors.New("inputs require both height and time locktimes")
+}
+
+// Signer role: updates the modifiable flags after adding a
+// signature with the sighash type
+func (p *Psbt) updateModifiable(hashType SigHashType) {
+	if p.Version != 2 {
+		return
+	}
+	if hashType&SIGHASH_ANYONECANPAY == 0 {
+		p.TxModifiable &^= PSBT_INPUTS_MODIFIABLE
+	}
+	base := hashType &^ SIGHASH_ANYONECANPAY
+	if base != SIGHASH_NONE {
+		p.TxModifiable &^= PSBT_OUTPUTS_MODIFIABLE
+	}
+	if base == SIGHASH_SINGLE {
+		p.TxModifiable |= PSBT_HAS_SIGHASH_SINGLE
+	}
+}
+
+// Combiner role: inputs and outputs stay modifiable only if they are
+// in every PSBT, signatures with SIGHASH_SINGLE are kept from any
+func (p *Psbt) combineModifiable(other uint8) {
+	modifiable := uint8(PSBT_INPUTS_MODIFIABLE | PSBT_OUTPUTS_MODIFIABLE)
+	p.TxModifiable = p.TxModifiable&other&modifiable | (p.TxModifiable|other)&PSBT_HAS_SIGHASH_SINGLE
+}
+
+// Converts the PSBT to version 0, fixing the locktime of the transaction
+func (p *Psbt) ConvertToV0() error {
+	locktime, err := p.ComputeLocktime()
+	if err != nil {
+		return err
+	}
+	p.Version = 0
+	p.FallbackLocktime = locktime
+	p.TxModifiable = 0
+	for _, in := range p.Inputs {
+		in.RequiredTimeLocktime = 0
+		in.RequiredHeightLocktime = 0
+	}
+	return nil
+}
+
+// Converts a version 0 PSBT to version 2. The inputs and outputs
+// of the converted PSBT are not modifiable
+func (p *Psbt) ConvertToV2() error {
+	if p.Version != 0 {
+		return fmt.Errorf("cannot convert psbt version %d", p.Version)
+	}
+	p.Version = 2
+	p.TxModifiable = 0
+	return nil
+}
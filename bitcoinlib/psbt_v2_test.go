@@ -0,0 +1,239 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// Builds a version 2 PSBT spending the fixture outputs one by one
+func newPsbtV2Fixture(t *testing.T, fixture *psbtFixture) *bitcoinlib.Psbt {
+	v0 := fixture.nonFinal
+	psbt := bitcoinlib.NewPsbtV2(1, 0)
+	for index, in := range v0.Inputs {
+		added := bitcoinlib.NewPsbtInput(fixture.funding.Id(), uint32(index))
+		added.NonWitnessUtxo = in.NonWitnessUtxo
+		added.WitnessUtxo = in.WitnessUtxo
+		added.RedeemScript = in.RedeemScript
+		added.WitnessScript = in.WitnessScript
+		if err := psbt.AddInput(added); err != nil {
+			t.Fatalf("Failed adding input %d: %s", index, err)
+		}
+	}
+	for index, out := range v0.Outputs {
+		if err := psbt.AddOutput(bitcoinlib.NewPsbtOutput(out.Amount, out.Script)); err != nil {
+			t.Fatalf("Failed adding output %d: %s", index, err)
+		}
+	}
+	return psbt
+}
+
+func TestPsbtV2Conversion(t *testing.T) {
+	fixture := newPsbtFixture(t)
+	psbt := roundTrip(t, newPsbtV2Fixture(t, fixture))
+	if psbt.Version != 2 || len(psbt.Inputs) != 6 || len(psbt.Outputs) != 1 {
+		t.Fatal("Failed decoding the version 2 maps")
+	}
+	tx, err := psbt.UnsignedTx()
+	if err != nil {
+		t.Fatalf("Failed building transaction: %s", err)
+	}
+	expected, _ := fixture.nonFinal.UnsignedTx()
+	if tx.Id() != expected.Id() {
+		t.Fatalf("Expected => %s\nGot => %s", expected.Id(), tx.Id())
+	}
+
+	if err := psbt.ConvertToV0(); err != nil {
+		t.Fatalf("Failed converting to version 0: %s", err)
+	}
+	if !bytes.Equal(psbt.Serialize(), fixture.nonFinal.Serialize()) {
+		t.Fatalf("Expected => %x\nGot => %x", fixture.nonFinal.Serialize(), psbt.Serialize())
+	}
+	if err := psbt.ConvertToV2(); err != nil {
+		t.Fatalf("Failed converting to version 2: %s", err)
+	}
+	psbt = roundTrip(t, psbt)
+	if err := psbt.AddInput(bitcoinlib.NewPsbtInput(strings.Repeat("44", 32), 0)); err == nil {
+		t.Fatal("Added input to a converted psbt")
+	}
+
+	// Signing and finalizing works the same in both versions
+	for _, key := range fixture.keys {
+		if err := psbt.Sign(key); err != nil {
+			t.Fatalf("Failed signing: %s", err)
+		}
+	}
+	if err := psbt.Finalize(); err != nil {
+		t.Fatalf("Failed finalizing: %s", err)
+	}
+	signed, err := roundTrip(t, psbt).Extract()
+	if err != nil {
+		t.Fatalf("Failed extracting: %s", err)
+	}
+	provider := bitcoinlib.NewMemoryProvider()
+	provider.AddTransaction(fixture.funding)
+	if !signed.Verify(provider) {
+		t.Fatal("Failed verifying extracted transaction")
+	}
+}
+
+func TestPsbtV2Modifiable(t *testing.T) {
+	fixture := newPsbtFixture(t)
+	psbt := newPsbtV2Fixture(t, fixture)
+	modifiable := uint8(bitcoinlib.PSBT_INPUTS_MODIFIABLE | bitcoinlib.PSBT_OUTPUTS_MODIFIABLE)
+	if psbt.TxModifiable != modifiable {
+		t.Fatalf("Expected => %x\nGot => %x", modifiable, psbt.TxModifiable)
+	}
+	if err := psbt.AddInput(bitcoinlib.NewPsbtInput(fixture.funding.Id(), 0)); err == nil {
+		t.Fatal("Added an input spending the same outpoint twice")
+	}
+	unsigned := roundTrip(t, psbt)
+
+	if err := psbt.SignInput(1, fixture.keys[0]); err != nil {
+		t.Fatalf("Failed signing: %s", err)
+	}
+	if psbt.TxModifiable != 0 {
+		t.Fatalf("Expected => 0\nGot => %x", psbt.TxModifiable)
+	}
+	if err := psbt.AddInput(bitcoinlib.NewPsbtInput(strings.Repeat("44", 32), 0)); err == nil {
+		t.Fatal("Added input after a SIGHASH_ALL signature")
+	}
+	if err := psbt.AddOutput(bitcoinlib.NewPsbtOutput(1000, fixture.nonFinal.Outputs[0].Script)); err == nil {
+		t.Fatal("Added output after a SIGHASH_ALL signature")
+	}
+
+	// SIGHASH_SINGLE|ANYONECANPAY still allows adding inputs
+	single := roundTrip(t, unsigned)
+	single.Inputs[1].SigHashType = bitcoinlib.SIGHASH_SINGLE | bitcoinlib.SIGHASH_ANYONECANPAY
+	if err := single.SignInput(1, fixture.keys[0]); err != nil {
+		t.Fatalf("Failed signing: %s", err)
+	}
+	expected := uint8(bitcoinlib.PSBT_INPUTS_MODIFIABLE | bitcoinlib.PSBT_HAS_SIGHASH_SINGLE)
+	if single.TxModifiable != expected {
+		t.Fatalf("Expected => %x\nGot => %x", expected, single.TxModifiable)
+	}
+	if err := single.AddInput(bitcoinlib.NewPsbtInput(strings.Repeat("44", 32), 0)); err != nil {
+		t.Fatalf("Failed adding input: %s", err)
+	}
+
+	// Combining keeps only the flags every PSBT agrees on
+	if err := unsigned.Combine(roundTrip(t, psbt)); err != nil {
+		t.Fatalf("Failed combining: %s", err)
+	}
+	if unsigned.TxModifiable != 0 {
+		t.Fatalf("Expected => 0\nGot => %x", unsigned.TxModifiable)
+	}
+}
+
+func TestPsbtV2Locktime(t *testing.T) {
+	// Required locktimes of each input, as height and time
+	vectors := []struct {
+		fallback uint32
+		required [][2]uint32
+		expected uint32
+		valid    bool
+	}{
+		{0, [][2]uint32{{0, 0}}, 0, true},
+		{1000, [][2]uint32{{0, 0}, {0, 0}}, 1000, true},
+		{1000, [][2]uint32{{10000, 0}, {0, 0}}, 10000, true},
+		{0, [][2]uint32{{10000, 0}, {10001, 0}}, 10001, true},
+		{0, [][2]uint32{{0, 1657048460}, {0, 1657048459}}, 1657048460, true},
+		{0, [][2]uint32{{10000, 1657048460}, {10001, 0}}, 10001, true},
+		{0, [][2]uint32{{10000, 1657048460}, {0, 1657048461}}, 1657048461, true},
+		{0, [][2]uint32{{10000, 0}, {0, 1657048460}}, 0, false},
+	}
+	for index, vector := range vectors {
+		psbt := bitcoinlib.NewPsbtV2(2, vector.fallback)
+		for input, required := range vector.required {
+			in := bitcoinlib.NewPsbtInput(strings.Repeat("55", 32), uint32(input))
+			in.RequiredHeightLocktime = required[0]
+			in.RequiredTimeLocktime = required[1]
+			psbt.Inputs = append(psbt.Inputs, in)
+		}
+		locktime, err := psbt.ComputeLocktime()
+		if (err == nil) != vector.valid || locktime != vector.expected {
+			t.Fatalf("Failed at index %d\nExpected => %d\nGot => %d (%v)", index, vector.expected, locktime, err)
+		}
+	}
+
+	// Inputs changing the locktime cannot be added once signed
+	fixture := newPsbtFixture(t)
+	psbt := newPsbtV2Fixture(t, fixture)
+	psbt.TxModifiable = bitcoinlib.PSBT_INPUTS_MODIFIABLE
+	psbt.Inputs[0].PartialSigs["00"] = []byte{}
+	in := bitcoinlib.NewPsbtInput(strings.Repeat("44", 32), 0)
+	in.RequiredHeightLocktime = 800000
+	if err := psbt.AddInput(in); err == nil {
+		t.Fatal("Added input changing the locktime of a signed psbt")
+	}
+	if len(psbt.Inputs) != 6 {
+		t.Fatal("Failed input was kept")
+	}
+	delete(psbt.Inputs[0].PartialSigs, "00")
+	if err := psbt.AddInput(in); err != nil {
+		t.Fatalf("Failed adding input: %s", err)
+	}
+	tx, _ := roundTrip(t, psbt).UnsignedTx()
+	raw := tx.Serialize()
+	if locktime := binary.LittleEndian.Uint32(raw[len(raw)-4:]); locktime != 800000 {
+		t.Fatalf("Expected => 800000\nGot => %d", locktime)
+	}
+}
+
+func psbtPair(key []byte, value []byte) []byte {
+	pair := append(bitcoinlib.EncodeVarInt(uint64(len(key))), key...)
+	pair = append(pair, bitcoinlib.EncodeVarInt(uint64(len(value)))...)
+	return append(pair, value...)
+}
+
+func TestPsbtV2Errors(t *testing.T) {
+	uint32Value := func(value uint32) []byte {
+		return binary.LittleEndian.AppendUint32(nil, value)
+	}
+	global := append(psbtPair([]byte{0x02}, uint32Value(2)), psbtPair([]byte{0x04}, []byte{1})...)
+	global = append(global, psbtPair([]byte{0x05}, []byte{0})...)
+	version := psbtPair([]byte{0xfb}, uint32Value(2))
+	outpoint := append(psbtPair([]byte{0x0e}, bytes.Repeat([]byte{0x66}, 32)), psbtPair([]byte{0x0f}, uint32Value(0))...)
+	fixture := newPsbtFixture(t)
+	unsignedTx := globalPair(fixture)
+
+	valid := append(append([]byte("psbt\xff"), global...), version...)
+	valid = append(append(append(valid, 0x00), outpoint...), 0x00)
+	parsed, err := bitcoinlib.ParsePsbt(bytes.NewReader(valid))
+	if err != nil {
+		t.Fatalf("Failed parsing minimal version 2 psbt: %s", err)
+	}
+	if !bytes.Equal(parsed.Serialize(), valid) {
+		t.Fatalf("Expected => %x\nGot => %x", valid, parsed.Serialize())
+	}
+
+	vectors := []struct {
+		name   string
+		global []byte
+		input  []byte
+	}{
+		{"unsigned tx in version 2", append(append(append([]byte{}, unsignedTx...), global...), version...), outpoint},
+		{"missing input count", append(append(psbtPair([]byte{0x02}, uint32Value(2)), psbtPair([]byte{0x05}, []byte{0})...), version...), outpoint},
+		{"missing tx version", append(global[len(psbtPair([]byte{0x02}, uint32Value(2))):], version...), outpoint},
+		{"missing previous txid", append(append([]byte{}, global...), version...), psbtPair([]byte{0x0f}, uint32Value(0))},
+		{"missing output index", append(append([]byte{}, global...), version...), psbtPair([]byte{0x0e}, bytes.Repeat([]byte{0x66}, 32))},
+		{"time locktime below threshold", append(append([]byte{}, global...), version...), append(append([]byte{}, outpoint...), psbtPair([]byte{0x11}, uint32Value(499999999))...)},
+		{"height locktime above threshold", append(append([]byte{}, global...), version...), append(append([]byte{}, outpoint...), psbtPair([]byte{0x12}, uint32Value(500000000))...)},
+		{"version 2 field in version 0", append(append([]byte{}, unsignedTx...), psbtPair([]byte{0x02}, uint32Value(2))...), nil},
+		{"unsupported version", append(append([]byte{}, global...), psbtPair([]byte{0xfb}, uint32Value(1))...), outpoint},
+	}
+	for _, vector := range vectors {
+		raw := append(append([]byte("psbt\xff"), vector.global...), 0x00)
+		if vector.input != nil {
+			raw = append(append(raw, vector.input...), 0x00)
+		}
+		if _, err := bitcoinlib.ParsePsbt(bytes.NewReader(raw)); err == nil {
+			t.Fatalf("Failed at %s\nExpected => error\nGot => nil", vector.name)
+		}
+	}
+	if err := fixture.nonFinal.AddInput(bitcoinlib.NewPsbtInput(strings.Repeat("44", 32), 0)); err == nil {
+		t.Fatal("Added input to a version 0 psbt")
+	}
+}
@@ -0,0 +1,229 @@
+package bitcoinlib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Inputs with a sequence up to this value signal opt-in replacement (BIP125)
+const MAX_BIP125_RBF_SEQUENCE = 0xfffffffd
+
+// Fee rate in sat/vB a replacement pays on top of the original, and the
+// minimum fee rate of a relayed transaction, like Bitcoin Core
+const INCREMENTAL_RELAY_FEE_RATE = 1
+const MIN_RELAY_FEE_RATE = 1
+
+// True if an input of the transaction signals replaceability
+func (tx *Transaction) SignalsReplacement() bool {
+	for _, in := range tx.inputs {
+		if in.sequence <= MAX_BIP125_RBF_SEQUENCE {
+			return true
+		}
+	}
+	return false
+}
+
+// Lowers the sequence of every input to signal replaceability, keeping
+// lower sequences used by relative timelocks. Signatures are invalidated
+func (tx *Transaction) SignalReplacement() {
+	for _, in := range tx.inputs {
+		if in.sequence > MAX_BIP125_RBF_SEQUENCE {
+			in.sequence = MAX_BIP125_RBF_SEQUENCE
+		}
+	}
+}
+
+// Copy of the transaction without scriptSigs and witnesses
+func (tx *Transaction) unsignedCopy() *Transaction {
+	copied := NewTransaction()
+	copied.version = tx.version
+	copied.locktime = tx.locktime
+	for _, in := range tx.inputs {
+		copied.AddInput(in.previousID, in.previousIndex)
+		copied.inputs[len(copied.inputs)-1].sequence = in.sequence
+	}
+	for _, out := range tx.outputs {
+		copied.AddOutputScript(out.amount, out.scriptPubKey)
+	}
+	return copied
+}
+
+// Estimates of the inputs spending P2PK, P2PKH, P2WPKH, P2TR and bare
+// multisig outputs
+func (tx *Transaction) inputEstimates(provider PrevoutProvider) ([]*InputEstimate, error) {
+	estimates := []*InputEstimate{}
+	for index, in := range tx.inputs {
+		script, err := in.ScriptPubkey(provider)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", index, err)
+		}
+		estimate, err := EstimateFromScript(script)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", index, err)
+		}
+		estimates = append(estimates, estimate)
+	}
+	return estimates, nil
+}
+
+// Smallest fee for a replacement of the given weight paying at least
+// feeRate and satisfying BIP125 against an original paying originalFee
+// for originalVSize
+func replacementFee(weight int, feeRate float64, originalFee uint64, originalVSize int) uint64 {
+	fee := max(FeeForWeight(weight, feeRate), originalFee+FeeForWeight(weight, INCREMENTAL_RELAY_FEE_RATE))
+	// The fee rate must be strictly higher than the original one
+	vsize := weightToVSize(weight)
+	originalRate := float64(originalFee) / float64(originalVSize)
+	if float64(fee)/float64(vsize) <= originalRate {
+		fee = uint64(math.Floor(originalRate*float64(vsize))) + 1
+	}
+	return fee
+}
+
+// Builds an unsigned replacement of the signed transaction paying feeRate
+// sat/vB. The fee increase comes from the output at changeIndex, which is
+// removed when left below dust, and then from the utxos, which must be
+// confirmed as BIP125 forbids new unconfirmed inputs. Estimates describe
+// the inputs of the transaction and are inferred from the prevouts when nil
+func (tx *Transaction) Replace(provider PrevoutProvider, estimates []*InputEstimate, changeIndex int, feeRate float64, utxos ...*Utxo) (*Transaction, error) {
+	if !tx.SignalsReplacement() {
+		return nil, errors.New("transaction does not signal replaceability")
+	}
+	if changeIndex < 0 || changeIndex >= len(tx.outputs) {
+		return nil, fmt.Errorf("invalid change output %d", changeIndex)
+	}
+	originalFee, err := tx.fee(provider)
+	if err != nil {
+		return nil, err
+	}
+	if estimates == nil {
+		if estimates, err = tx.inputEstimates(provider); err != nil {
+			return nil, err
+		}
+	}
+	originalVSize := tx.VSize()
+	replacement := tx.unsignedCopy()
+	replacement.SignalReplacement()
+	change := replacement.outputs[changeIndex]
+	available := change.amount + originalFee
+	inputs := append([]*InputEstimate{}, estimates...)
+	for {
+		weight, err := replacement.EstimateWeight(inputs)
+		if err != nil {
+			return nil, err
+		}
+		fee := replacementFee(weight, feeRate, originalFee, originalVSize)
+		if available >= fee && available-fee >= DustThreshold(change.scriptPubKey) {
+			change.amount = available - fee
+			return replacement, nil
+		}
+		// Without the change output everything left goes to the fee
+		outputs := replacement.outputs
+		replacement.outputs = append(outputs[:changeIndex:changeIndex], outputs[changeIndex+1:]...)
+		weight, err = replacement.EstimateWeight(inputs)
+		if err != nil {
+			return nil, err
+		}
+		if available >= replacementFee(weight, feeRate, originalFee, originalVSize) {
+			return replacement, nil
+		}
+		replacement.outputs = outputs
+		if len(utxos) == 0 {
+			return nil, errors.New("insufficient funds to bump the fee")
+		}
+		estimate, err := utxos[0].estimate()
+		if err != nil {
+			return nil, fmt.Errorf("utxo %s:%d: %w", utxos[0].TxId, utxos[0].Index, err)
+		}
+		replacement.AddInput(utxos[0].TxId, utxos[0].Index)
+		replacement.inputs[len(replacement.inputs)-1].sequence = MAX_BIP125_RBF_SEQUENCE
+		inputs = append(inputs, estimate)
+		available += utxos[0].Output.amount
+		utxos = utxos[1:]
+	}
+}
+
+// Checks that the signed replacement can replace the original under
+// BIP125. Confirmed tells whether a transaction id is confirmed, new
+// inputs are rejected when it is nil. Descendants of the original are
+// not taken into account
+func CheckReplacement(original *Transaction, replacement *Transaction, provider PrevoutProvider, confirmed func(txId string) bool) error {
+	if !original.SignalsReplacement() {
+		return errors.New("original transaction does not signal replaceability")
+	}
+	spent := map[string]bool{}
+	for _, in := range original.inputs {
+		spent[outpointKey(in.previousID, in.previousIndex)] = true
+	}
+	conflicts := false
+	for index, in := range replacement.inputs {
+		if spent[outpointKey(in.previousID, in.previousIndex)] {
+			conflicts = true
+		} else if confirmed == nil || !confirmed(in.previousID) {
+			return fmt.Errorf("input %d is a new unconfirmed input", index)
+		}
+	}
+	if !conflicts {
+		return errors.New("replacement does not spend any input of the original")
+	}
+	originalFee, err := original.fee(provider)
+	if err != nil {
+		return err
+	}
+	fee, err := replacement.fee(provider)
+	if err != nil {
+		return err
+	}
+	if fee < originalFee {
+		return fmt.Errorf("replacement fee %d is lower than the original %d", fee, originalFee)
+	}
+	vsize := replacement.VSize()
+	if required := FeeForWeight(replacement.Weight(), INCREMENTAL_RELAY_FEE_RATE); fee-originalFee < required {
+		return fmt.Errorf("replacement pays %d more than the original, at least %d are required", fee-originalFee, required)
+	}
+	if float64(fee)/float64(vsize) <= float64(originalFee)/float64(original.VSize()) {
+		return errors.New("replacement fee rate is not higher than the original")
+	}
+	return nil
+}
+
+// Builds an unsigned child spending the output of the unconfirmed parent
+// to the script, so parent and child together pay feeRate sat/vB. The
+// provider must know the prevouts of the parent, and the estimate of the
+// spent output is inferred from its script when nil
+func ChildPaysForParent(parent *Transaction, provider PrevoutProvider, index uint32, estimate *InputEstimate, script *ScriptPubKey, feeRate float64) (*Transaction, error) {
+	if int(index) >= len(parent.outputs) {
+		return nil, fmt.Errorf("parent has no output %d", index)
+	}
+	parentFee, err := parent.fee(provider)
+	if err != nil {
+		return nil, err
+	}
+	spent := parent.outputs[index]
+	if estimate == nil {
+		if estimate, err = EstimateFromScript(spent.scriptPubKey); err != nil {
+			return nil, err
+		}
+	}
+	child := NewTransaction()
+	child.AddInput(parent.Id(), index)
+	child.AddOutputScript(0, script)
+	weight, err := child.EstimateWeight([]*InputEstimate{estimate})
+	if err != nil {
+		return nil, err
+	}
+	// The package fee covers both transactions, and the child alone must
+	// still pay the minimum relay fee
+	vsize := parent.VSize() + weightToVSize(weight)
+	packageFee := FeeForWeight(vsize*WITNESS_SCALE_FACTOR, feeRate)
+	fee := FeeForWeight(weight, MIN_RELAY_FEE_RATE)
+	if packageFee > parentFee+fee {
+		fee = packageFee - parentFee
+	}
+	if spent.amount < fee || spent.amount-fee < DustThreshold(script) {
+		return nil, fmt.Errorf("output of %d cannot pay a fee of %d", spent.amount, fee)
+	}
+	child.outputs[0].amount = spent.amount - fee
+	return child, nil
+}
@@ -0,0 +1,146 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"strings"
+	"testing"
+)
+
+// Signed transaction paying 50000 from the 40000 and 100000 UTXOs of
+// the builder fixture at 1 sat/vB, with its change at index 1
+func newReplaceableFixture(t *testing.T, key *bitcoinlib.PrivateKey) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+	payee := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(6006)).P2WPKHAddress(bitcoinlib.MAINNET_PARAMS)
+	builder := newBuilderFixture(t, key, 40000, 100000)
+	builder.AddPayment(50000, payee)
+	tx, report, err := builder.Build()
+	if err != nil || report.ChangeIndex != 1 {
+		t.Fatalf("Failed building original: %v", err)
+	}
+	if tx.SignalsReplacement() {
+		t.Fatal("Final sequences signal replaceability")
+	}
+	tx.SignalReplacement()
+	provider := builder.Provider()
+	if err := tx.Sign(provider, key); err != nil {
+		t.Fatalf("Failed signing original: %s", err)
+	}
+	return tx, provider
+}
+
+func TestReplaceByFee(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(5005))
+	original, provider := newReplaceableFixture(t, key)
+	if !original.SignalsReplacement() {
+		t.Fatal("Failed signaling replaceability")
+	}
+	feeRates := []float64{5, 1}
+	for index, feeRate := range feeRates {
+		replacement, err := original.Replace(provider, nil, 1, feeRate)
+		if err != nil {
+			t.Fatalf("Failed at index %d: %s", index, err)
+		}
+		if err := replacement.Sign(provider, key); err != nil || !replacement.Verify(provider) {
+			t.Fatalf("Failed signing replacement at index %d: %v", index, err)
+		}
+		if err := bitcoinlib.CheckReplacement(original, replacement, provider, nil); err != nil {
+			t.Fatalf("Failed at index %d: %s", index, err)
+		}
+		rate, _ := replacement.FeeRate(provider)
+		if rate < feeRate {
+			t.Fatalf("Failed at index %d\nExpected => fee rate of at least %f\nGot => %f", index, feeRate, rate)
+		}
+	}
+
+	// A fee rate leaving 100 sats of change consumes the change output
+	replacement, _ := original.Replace(provider, nil, 1, 1)
+	replacement.Sign(provider, key)
+	available := original.GetOutputsAmount()[1] + uint64(original.Fee(provider))
+	replacement, err := original.Replace(provider, nil, 1, float64(available-100)/float64(replacement.VSize()))
+	if err != nil {
+		t.Fatalf("Failed replacing without change: %s", err)
+	}
+	if outputs := replacement.GetOutputsAmount(); len(outputs) != 1 || outputs[0] != 50000 {
+		t.Fatalf("Failed removing change\nExpected => [50000]\nGot => %v", outputs)
+	}
+	if _, err := original.Replace(provider, nil, 1, 2000); err == nil {
+		t.Fatal("Replaced without funds for the fee")
+	}
+
+	// A confirmed UTXO pays for what the change cannot
+	extra := bitcoinlib.NewUtxo(strings.Repeat("77", 32), 0, bitcoinlib.NewOutput(200000, builderScript(t, key.P2WPKHAddress(bitcoinlib.MAINNET_PARAMS))))
+	provider.Add(extra.TxId, extra.Index, extra.Output)
+	replacement, err = original.Replace(provider, nil, 1, 500, extra)
+	if err != nil {
+		t.Fatalf("Failed replacing with extra utxo: %s", err)
+	}
+	if len(replacement.GetInputs()) != len(original.GetInputs())+1 {
+		t.Fatal("Failed adding the extra utxo")
+	}
+	if err := replacement.Sign(provider, key); err != nil {
+		t.Fatalf("Failed signing replacement: %s", err)
+	}
+	if err := bitcoinlib.CheckReplacement(original, replacement, provider, nil); err == nil {
+		t.Fatal("Accepted a new unconfirmed input")
+	}
+	confirmed := func(txId string) bool { return txId == extra.TxId }
+	if err := bitcoinlib.CheckReplacement(original, replacement, provider, confirmed); err != nil {
+		t.Fatalf("Failed checking replacement with a confirmed input: %s", err)
+	}
+
+	// The original is not a valid replacement of itself
+	if err := bitcoinlib.CheckReplacement(original, original, provider, nil); err == nil {
+		t.Fatal("Accepted a replacement without a higher fee")
+	}
+	if _, err := original.Replace(provider, nil, 2, 5); err == nil {
+		t.Fatal("Replaced with an invalid change output")
+	}
+}
+
+func TestReplaceByFeeNotSignaled(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(5005))
+	payee := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(6006)).P2WPKHAddress(bitcoinlib.MAINNET_PARAMS)
+	builder := newBuilderFixture(t, key, 40000, 100000)
+	builder.AddPayment(50000, payee)
+	tx, _, _ := builder.Build()
+	provider := builder.Provider()
+	tx.Sign(provider, key)
+	if _, err := tx.Replace(provider, nil, 1, 5); err == nil {
+		t.Fatal("Replaced a transaction not signaling replaceability")
+	}
+	replacement := *tx
+	if err := bitcoinlib.CheckReplacement(tx, &replacement, provider, nil); err == nil {
+		t.Fatal("Accepted the replacement of a transaction not signaling replaceability")
+	}
+}
+
+func TestChildPaysForParent(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(5005))
+	parent, provider := newReplaceableFixture(t, key)
+	destination := builderScript(t, key.P2WPKHAddress(bitcoinlib.MAINNET_PARAMS))
+	feeRates := []float64{10, 1}
+	for index, feeRate := range feeRates {
+		child, err := bitcoinlib.ChildPaysForParent(parent, provider, 1, nil, destination, feeRate)
+		if err != nil {
+			t.Fatalf("Failed at index %d: %s", index, err)
+		}
+		childProvider := bitcoinlib.NewMemoryProvider()
+		childProvider.AddTransaction(parent)
+		if err := child.Sign(childProvider, key); err != nil || !child.Verify(childProvider) {
+			t.Fatalf("Failed signing child at index %d: %v", index, err)
+		}
+		parentFee, childFee := parent.Fee(provider), child.Fee(childProvider)
+		rate := float64(parentFee+childFee) / float64(parent.VSize()+child.VSize())
+		if rate < feeRate {
+			t.Fatalf("Failed at index %d\nExpected => package fee rate of at least %f\nGot => %f", index, feeRate, rate)
+		}
+		if childRate, _ := child.FeeRate(childProvider); childRate < bitcoinlib.MIN_RELAY_FEE_RATE {
+			t.Fatalf("Failed at index %d: child pays %f sat/vB", index, childRate)
+		}
+	}
+	if _, err := bitcoinlib.ChildPaysForParent(parent, provider, 1, nil, destination, 2000); err == nil {
+		t.Fatal("Built child without funds for the fee")
+	}
+	if _, err := bitcoinlib.ChildPaysForParent(parent, provider, 2, nil, destination, 10); err == nil {
+		t.Fatal("Built child spending a missing output")
+	}
+}
@@ -0,0 +1,178 @@
+package bitcoinlib
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+const SCHNORR_SIGNATURE_SIZE = 64
+const XONLY_PUBKEY_SIZE = 32
+
+const BIP340_AUX_TAG = "BIP0340/aux"
+const BIP340_NONCE_TAG = "BIP0340/nonce"
+const BIP340_CHALLENGE_TAG = "BIP0340/challenge"
+
+// BIP340 signature: the x coordinate of R and the scalar s
+type SchnorrSignature struct {
+	r Int
+	s Int
+}
+
+func (s *SchnorrSignature) String() string {
+	return s.r.String() + ":" + s.s.String()
+}
+
+// Returns sha256(sha256(tag) || sha256(tag) || data...)
+func TaggedHash(tag string, data ...[]byte) []byte {
+	hashedTag := sha256.Sum256([]byte(tag))
+	hasher := sha256.New()
+	hasher.Write(hashedTag[:])
+	hasher.Write(hashedTag[:])
+	for _, chunk := range data {
+		hasher.Write(chunk)
+	}
+	return hasher.Sum(nil)
+}
+
+func hasEvenY(p *FinitePoint) bool {
+	return p.y.value.Mod(TWO).Eq(ZERO)
+}
+
+// Returns the 32 bytes x-only serialization of the point
+func XOnly(p Point) []byte {
+	finite, ok := p.(*FinitePoint)
+	if !ok {
+		return nil
+	}
+	buf := make([]byte, XONLY_PUBKEY_SIZE)
+	finite.x.value.value.FillBytes(buf)
+	return buf
+}
+
+// Returns the point with even y for the x coordinate,
+// failing if x is not on the curve
+func liftX(x Int) (*FinitePoint, error) {
+	if x.Geq(PRIME) {
+		return nil, errors.New("x coordinate not in field")
+	}
+	alpha := x.Exp(THREE, PRIME).Add(B().value).Mod(PRIME)
+	beta := alpha.Exp(SQRT_EXP, PRIME)
+	if beta.Exp(TWO, PRIME).Ne(alpha) {
+		return nil, errors.New("x coordinate not on curve")
+	}
+	return solveY(x, true).(*FinitePoint), nil
+}
+
+// Parses a 32 bytes x-only public key into its even y point
+func ParseXOnly(pubkey []byte) (Point, error) {
+	if len(pubkey) != XONLY_PUBKEY_SIZE {
+		return nil, fmt.Errorf("invalid x-only public key length: %d", len(pubkey))
+	}
+	return liftX(intFromBytes(pubkey))
+}
+
+func (pk *PrivateKey) XOnly() []byte {
+	return XOnly(pk.p)
+}
+
+func ParseSchnorrSignature(sig []byte) (*SchnorrSignature, error) {
+	if len(sig) != SCHNORR_SIGNATURE_SIZE {
+		return nil, fmt.Errorf("invalid schnorr signature length: %d", len(sig))
+	}
+	r := intFromBytes(sig[:32])
+	s := intFromBytes(sig[32:])
+	if r.Geq(PRIME) {
+		return nil, errors.New("schnorr signature r not in field")
+	}
+	if s.Geq(ORDER) {
+		return nil, errors.New("schnorr signature s not lower than order")
+	}
+	return &SchnorrSignature{r, s}, nil
+}
+
+func (s *SchnorrSignature) Serialize() []byte {
+	buf := make([]byte, SCHNORR_SIGNATURE_SIZE)
+	s.r.value.FillBytes(buf[:32])
+	s.s.value.FillBytes(buf[32:])
+	return buf
+}
+
+func schnorrChallenge(r []byte, pubkey []byte, msg []byte) Int {
+	return intFromBytes(TaggedHash(BIP340_CHALLENGE_TAG, r, pubkey, msg)).Mod(ORDER)
+}
+
+// Verifies the signature of msg against the x-only public key
+func (s *SchnorrSignature) Verify(pubkey []byte, msg []byte) bool {
+	p, err := ParseXOnly(pubkey)
+	if err != nil {
+		return false
+	}
+	r := make([]byte, 32)
+	s.r.value.FillBytes(r)
+	e := schnorrChallenge(r, pubkey, msg)
+	total, err := G().ScaleInt(s.s).Add(p.ScaleInt(ORDER.Sub(e)))
+	if err != nil {
+		return false
+	}
+	result, ok := total.(*FinitePoint)
+	return ok && hasEvenY(result) && result.x.value.Eq(s.r)
+}
+
+// Parses and verifies a serialized BIP340 signature
+func VerifySchnorr(pubkey []byte, msg []byte, sig []byte) bool {
+	signature, err := ParseSchnorrSignature(sig)
+	if err != nil {
+		return false
+	}
+	return signature.Verify(pubkey, msg)
+}
+
+// Signs msg following BIP340, using aux as auxiliary randomness
+// for the nonce generation
+func (pk *PrivateKey) SignSchnorrWithAux(msg []byte, aux []byte) (*SchnorrSignature, error) {
+	if len(aux) != 32 {
+		return nil, fmt.Errorf("invalid auxiliary randomness length: %d", len(aux))
+	}
+	if !validScalar(pk.e) {
+		return nil, errors.New("invalid private key")
+	}
+	d := pk.e
+	if !hasEvenY(pk.p.(*FinitePoint)) {
+		d = ORDER.Sub(d)
+	}
+	dBytes := d.IntoBytes()
+	t := TaggedHash(BIP340_AUX_TAG, aux)
+	for i := range t {
+		t[i] ^= dBytes[i]
+	}
+	pubkey := pk.XOnly()
+	k := intFromBytes(TaggedHash(BIP340_NONCE_TAG, t, pubkey, msg)).Mod(ORDER)
+	if k.Eq(ZERO) {
+		return nil, errors.New("generated nonce is zero")
+	}
+	rPoint := G().ScaleInt(k).(*FinitePoint)
+	if !hasEvenY(rPoint) {
+		k = ORDER.Sub(k)
+	}
+	r := XOnly(rPoint)
+	e := schnorrChallenge(r, pubkey, msg)
+	signature := &SchnorrSignature{
+		rPoint.x.value,
+		k.Add(e.Mul(d)).Mod(ORDER),
+	}
+	if !signature.Verify(pubkey, msg) {
+		return nil, errors.New("generated schnorr signature does not verify")
+	}
+	return signature, nil
+}
+
+// Signs msg following BIP340 with fresh auxiliary randomness
+func (pk *PrivateKey) SignSchnorr(msg []byte) (*SchnorrSignature, error) {
+	aux := make([]byte, 32)
+	if _, err := rand.Read(aux); err != nil {
+		return nil, err
+	}
+	return pk.SignSchnorrWithAux(msg, aux)
+}
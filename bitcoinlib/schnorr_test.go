@@ -0,0 +1,77 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"encoding/csv"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTaggedHash(t *testing.T) {
+	expected := "770a5b7e7c304bbcc3ea107343ff951dd404312ef418db0c3b94e2ebfbb50087"
+	result := hex.EncodeToString(bitcoinlib.TaggedHash("BIP0340/challenge", []byte("a"), []byte("bc")))
+	if result != expected {
+		t.Fatalf("Expected => %s\nGot => %s", expected, result)
+	}
+}
+
+func TestBIP340Vectors(t *testing.T) {
+	file, err := os.Open("testdata/bip340_vectors.csv")
+	if err != nil {
+		t.Fatalf("Failed opening vectors: %s", err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed reading vectors: %s", err)
+	}
+	for _, record := range records[1:] {
+		index := record[0]
+		pubkey, _ := hex.DecodeString(record[2])
+		aux, _ := hex.DecodeString(record[3])
+		msg, _ := hex.DecodeString(record[4])
+		sig, _ := hex.DecodeString(record[5])
+		expected := record[6] == "TRUE"
+
+		if record[1] != "" {
+			key := bitcoinlib.NewPrivateKey(bitcoinlib.FromHexString("0x" + record[1]))
+			if !strings.EqualFold(hex.EncodeToString(key.XOnly()), record[2]) {
+				t.Fatalf("Failed at index %s\nExpected => %s\nGot => %x", index, record[2], key.XOnly())
+			}
+			signature, err := key.SignSchnorrWithAux(msg, aux)
+			if err != nil {
+				t.Fatalf("Failed signing at index %s: %s", index, err)
+			}
+			if !strings.EqualFold(hex.EncodeToString(signature.Serialize()), record[5]) {
+				t.Fatalf("Failed at index %s\nExpected => %s\nGot => %x", index, record[5], signature.Serialize())
+			}
+		}
+		if bitcoinlib.VerifySchnorr(pubkey, msg, sig) != expected {
+			t.Fatalf("Failed verifying at index %s (%s)", index, record[7])
+		}
+	}
+}
+
+func TestSchnorrRandomAux(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(12345))
+	msg := []byte("schnorr")
+	signature, err := key.SignSchnorr(msg)
+	if err != nil {
+		t.Fatalf("Failed signing: %s", err)
+	}
+	parsed, err := bitcoinlib.ParseSchnorrSignature(signature.Serialize())
+	if err != nil {
+		t.Fatalf("Failed parsing signature: %s", err)
+	}
+	if !parsed.Verify(key.XOnly(), msg) {
+		t.Fatal("Failed verifying signature")
+	}
+	if parsed.Verify(key.XOnly(), []byte("other")) {
+		t.Fatal("Verified signature for a different message")
+	}
+	if _, err := bitcoinlib.ParseSchnorrSignature(signature.Serialize()[1:]); err == nil {
+		t.Fatal("Parsed signature with invalid length")
+	}
+}
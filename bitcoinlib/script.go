@@ -16,6 +16,7 @@ type Script struct {
 
 type ScriptPubKey struct {
 	cmds []Operation
+	raw  []byte // as parsed, nil when built from cmds
 }
 
 func P2PKHScript(hash []byte) *ScriptPubKey {
@@ -27,6 +28,7 @@ func P2PKHScript(hash []byte) *ScriptPubKey {
 			&OP_EQUALVERIFY{},
 			&OP_CHECKSIG{},
 		},
+		nil,
 	}
 }
 
@@ -61,6 +63,7 @@ func NewScript(cmds []Operation) *Script {
 func NewPubkey(cmds []Operation) *ScriptPubKey {
 	return &ScriptPubKey{
 		cmds,
+		nil,
 	}
 }
 
@@ -72,6 +75,7 @@ func P2SHPubKey(hash []byte) *ScriptPubKey {
 			&ScriptVal{hash},
 			&OP_EQUAL{},
 		},
+		nil,
 	}
 }
 
@@ -81,6 +85,7 @@ func P2WPKHPubKey(hash []byte) *ScriptPubKey {
 			&OP_0{},
 			&ScriptVal{hash},
 		},
+		nil,
 	}
 }
 
@@ -90,49 +95,10 @@ func P2WSHPubKey(hash []byte) *ScriptPubKey {
 			&OP_0{},
 			&ScriptVal{hash},
 		},
+		nil,
 	}
 }
 
-func (s *ScriptPubKey) isP2SH() bool {
-	commands := P2SHPubKey([]byte{}).cmds
-	if len(commands) != len(s.cmds) {
-		return false
-	}
-	for index, cmd := range commands {
-		if cmd.Num() != s.cmds[index].Num() {
-			return false
-		}
-	}
-	return true
-}
-
-func (s *ScriptPubKey) isP2WPKH() bool {
-	commands := P2WPKHPubKey([]byte{}).cmds
-	if len(commands) != len(s.cmds) {
-		return false
-	}
-	for index, cmd := range commands {
-		if cmd.Num() != s.cmds[index].Num() {
-			return false
-		}
-	}
-	isHash160, ok := s.cmds[1].(*ScriptVal)
-	return ok && len(isHash160.Val) == 20
-}
-
-func (s *ScriptPubKey) isP2WSH() bool {
-	commands := P2WSHPubKey([]byte{}).cmds
-	if len(commands) != len(s.cmds) {
-		return false
-	}
-	for index, cmd := range commands {
-		if cmd.Num() != s.cmds[index].Num() {
-			return false
-		}
-	}
-	isHash256, ok := s.cmds[1].(*ScriptVal)
-	return ok && len(isHash256.Val) == 32
-}
 func (t *ScriptPubKey) Combine(key Script) *CombinedScript {
 	cmds := make([]Operation, len(t.cmds))
 	copy(cmds, t.cmds)
@@ -150,47 +116,69 @@ func (t *ScriptPubKey) Combine(key Script) *CombinedScript {
 // Evaluates the hash of the script provided
 func (t *CombinedScript) EvaluateScriptHash() bool {
 	//Don't need z, so just use a placeholder
-	z := ""
+	return t.executeScriptHash(NewDigestContext("", DIGEST_SCRIPT_FLAGS)) == nil
+}
+
+func (t *CombinedScript) executeScriptHash(ctx *ExecutionContext) error {
 	helperScript := &CombinedScript{
 		t.cmds[:4],
 		false,
 		false,
 		false,
 	}
-	return helperScript.Evaluate(z, nil)
+	return helperScript.Execute(ctx, nil)
 }
 
 // Evaluates a Redeem Script (need to parse it and then create the correct script to evaluate)
 func (t *CombinedScript) EvaluateRedeemScript(z string, witness [][]byte) bool {
+	return t.executeRedeemScript(NewDigestContext(z, DIGEST_SCRIPT_FLAGS), witness) == nil
+}
+
+func (t *CombinedScript) executeRedeemScript(ctx *ExecutionContext, witness [][]byte) error {
 	if witness != nil {
 		otherParse, err := parseScriptFromBytes(t.cmds[len(t.cmds)-1].(*ScriptVal).Val)
 		if err != nil {
-			return false
+			return ctx.fail(SCRIPT_ERR_BAD_OPCODE)
 		}
 		pubKey := NewPubkey(otherParse)
 		privKey := NewScript([]Operation{})
-		return pubKey.Combine(*privKey).Evaluate(z, witness)
+		combined := pubKey.Combine(*privKey)
+		return combined.Execute(ctx, witness)
+	}
+	// The redeem script is the last push of the scriptSig, right after
+	// OP_HASH160 <hash> OP_EQUAL
+	script, ok := t.cmds[3].(*ScriptVal)
+	if !ok {
+		return ctx.fail(SCRIPT_ERR_BAD_OPCODE)
 	}
-	script := t.cmds[len(t.cmds)-4].(*ScriptVal)
 	pubKeyScript, err := parseScriptFromBytes(script.Val)
 	if err != nil {
-		return false
+		return ctx.fail(SCRIPT_ERR_BAD_OPCODE)
 	}
-	pubKey := NewPubkey(pubKeyScript)
+	ctx.markNonMinimal(script.Val, pubKeyScript)
+	ctx.markCodeSeparators(pubKeyScript)
+	pubKey := &ScriptPubKey{pubKeyScript, script.Val}
 	privKey := NewScript(t.cmds[4:])
 	slices.Reverse(privKey.cmds)
-	return pubKey.Combine(*privKey).Evaluate(z, witness)
+	combined := pubKey.Combine(*privKey)
+	return combined.Execute(ctx, witness)
 }
 
 func EvaluateP2WPSH(z string, sha string, witness [][]byte) bool {
+	return executeP2WSH(NewDigestContext(z, DIGEST_SCRIPT_FLAGS), sha, witness) == nil
+}
+
+func executeP2WSH(ctx *ExecutionContext, sha string, witness [][]byte) error {
 	validation := sha256.Sum256(witness[len(witness)-1])
 	if hex.EncodeToString(validation[:]) != sha {
-		return false
+		return ctx.fail(SCRIPT_ERR_WITNESS_PROGRAM_MISMATCH)
 	}
 	script, err := parseScriptFromBytes(witness[len(witness)-1])
 	if err != nil {
-		return false
+		return ctx.fail(SCRIPT_ERR_BAD_OPCODE)
 	}
+	ctx.markNonMinimal(witness[len(witness)-1], script)
+	ctx.markCodeSeparators(script)
 	rest := []byte{}
 	for i := range len(witness) - 1 {
 		rest = append(rest, EncodeVarInt(uint64(len(witness[i])))...)
@@ -198,46 +186,64 @@ func EvaluateP2WPSH(z string, sha string, witness [][]byte) bool {
 	}
 	pubkey, err := parseScriptFromBytes(rest)
 	if err != nil {
-		return false
+		return ctx.fail(SCRIPT_ERR_BAD_OPCODE)
 	}
 	final := append(pubkey, script...)
 	slices.Reverse(final)
-	return (&CombinedScript{final, false, false, false}).Evaluate(z, nil)
+	return (&CombinedScript{final, false, false, false}).Execute(ctx, nil)
 }
 
+// Flags of the scripts evaluated against a digest, which only evaluate
+// P2SH and witness programs
+const DIGEST_SCRIPT_FLAGS = SCRIPT_VERIFY_P2SH | SCRIPT_VERIFY_WITNESS
+
+// Evaluates the script checking every signature against z
 func (t *CombinedScript) Evaluate(z string, witness [][]byte) bool {
-	if t.isP2WSH {
-		return EvaluateP2WPSH(z, hex.EncodeToString(t.cmds[0].(*ScriptVal).Val), witness)
-	}
-	if t.isP2SH {
-		//Evaluate P2SH
-		return t.EvaluateScriptHash() && t.EvaluateRedeemScript(z, witness)
+	return t.Execute(NewDigestContext(z, DIGEST_SCRIPT_FLAGS), witness) == nil
+}
+
+// Evaluates the script with the transaction and input of the context,
+// returning the *ScriptError it fails with
+func (t *CombinedScript) Execute(ctx *ExecutionContext, witness [][]byte) error {
+	isP2WPKH := t.isP2WPKH && ctx.flags.has(SCRIPT_VERIFY_WITNESS)
+	if t.isP2WSH && ctx.flags.has(SCRIPT_VERIFY_WITNESS) {
+		return executeP2WSH(ctx, hex.EncodeToString(t.cmds[0].(*ScriptVal).Val), witness)
+	}
+	if t.isP2SH && ctx.flags.has(SCRIPT_VERIFY_P2SH) {
+		//Evaluate P2SH, the scriptSig must at least push the redeem script
+		if len(t.cmds) < 4 {
+			return ctx.fail(SCRIPT_ERR_EVAL_FALSE)
+		}
+		if err := t.executeScriptHash(ctx); err != nil {
+			return err
+		}
+		return t.executeRedeemScript(ctx, witness)
 	}
 	var witnesses []byte
 	if witness != nil {
 		for _, item := range witness {
-			value := EncodeVarInt(uint64(len(item)))
-			witnesses = append(witnesses, value...)
-			if string(value) != string(item) {
-				witnesses = append(witnesses, item...)
-			}
+			witnesses = append(witnesses, EncodeVarInt(uint64(len(item)))...)
+			witnesses = append(witnesses, item...)
 		}
 	}
 	cmds := make([]Operation, len(t.cmds))
 	copy(cmds, t.cmds)
 	stack := make([]Operation, 0)
 	altstack := make([]Operation, 0)
+	ctx.branches = nil
 	for len(cmds) > 0 {
 		cmd := Pop(&cmds)
-		if !cmd.Operate(z, &stack, &altstack, &cmds) {
-			return false
+		if err := ctx.step(cmd, &stack, &altstack, &cmds); err != nil {
+			return err
 		}
-		if len(stack) == 2 && t.isP2WPKH {
+		if len(stack) == 2 && isP2WPKH {
 			witnessScript, err := parseScriptFromBytes(witnesses)
 			if err != nil {
-				fmt.Println(err)
+				return ctx.fail(SCRIPT_ERR_BAD_OPCODE)
 			}
 			h160 := Pop(&stack)
+			// The witness version is not part of the P2WPKH script
+			Pop(&stack)
 
 			p2wpkh := []Operation{
 				&OP_DUP{},
@@ -253,15 +259,22 @@ func (t *CombinedScript) Evaluate(z string, witness [][]byte) bool {
 			for len(witnessScript) > 0 {
 				Push(&cmds, Pop(&witnessScript))
 			}
-			t.isP2WPKH = false
+			isP2WPKH = false
 		}
 	}
 
 	if len(stack) == 0 {
-		return false
+		return ctx.fail(SCRIPT_ERR_EVAL_FALSE)
+	}
+	// Witness scripts must always leave a clean stack
+	if len(stack) != 1 && (ctx.sigVersion == SIGVERSION_WITNESS_V0 || ctx.flags.has(SCRIPT_VERIFY_CLEANSTACK)) {
+		return ctx.fail(SCRIPT_ERR_CLEANSTACK)
 	}
 	op := Pop(&stack)
-	return op.Num() != 0
+	if !castToBool(op) {
+		return ctx.fail(SCRIPT_ERR_EVAL_FALSE)
+	}
+	return nil
 }
 
 func ParsePubKey(from io.Reader) (*ScriptPubKey, error) {
@@ -278,6 +291,7 @@ func ParsePubKey(from io.Reader) (*ScriptPubKey, error) {
 	}
 	return &ScriptPubKey{
 		cmds,
+		buf,
 	}, err
 }
 
@@ -288,13 +302,16 @@ func serializeScriptToBytes(cmds []Operation) []byte {
 			//If its a ScriptVal then its a value
 			//That should be treated as such (length + val) or (OP_PUSHDATAx + length + VAL)
 			length := len(val.Val)
-			if length < 75 {
+			if length <= 75 {
 				result = append(result, byte(length))
 			} else if length < 256 {
 				result = append(result, 76, byte(length))
-			} else if length < 520 {
+			} else if length < 65536 {
 				result = append(result, 77)
 				result = binary.LittleEndian.AppendUint16(result, uint16(length))
+			} else {
+				result = append(result, 78)
+				result = binary.LittleEndian.AppendUint32(result, uint32(length))
 			}
 			result = append(result, val.Val...)
 		} else {
@@ -313,6 +330,9 @@ func parseScriptFromBytes(buf []byte) ([]Operation, error) {
 		index++
 		if current >= 1 && current <= 75 {
 			//It´s an element
+			if index+int(current) > total {
+				return nil, errors.New("push past the end of the script")
+			}
 			op := &ScriptVal{
 				buf[index : index+int(current)],
 			}
@@ -320,7 +340,13 @@ func parseScriptFromBytes(buf []byte) ([]Operation, error) {
 			index += int(current)
 		} else if current == 76 {
 			//OP_PUSHDATA1
-			length := FromLittleEndian(buf[index : index+1])
+			if index+1 > total {
+				return nil, errors.New("push past the end of the script")
+			}
+			length := FromLittleEndian(slices.Clone(buf[index : index+1]))
+			if index+1+int(length.value.Int64()) > total {
+				return nil, errors.New("push past the end of the script")
+			}
 			op := &ScriptVal{
 				buf[index+1 : index+1+int(length.value.Int64())],
 			}
@@ -328,21 +354,35 @@ func parseScriptFromBytes(buf []byte) ([]Operation, error) {
 			cmds = append(cmds, op)
 		} else if current == 77 {
 			//OP_PUSHDATA2
-			length := FromLittleEndian(buf[index : index+2])
+			if index+2 > total {
+				return nil, errors.New("push past the end of the script")
+			}
+			length := FromLittleEndian(slices.Clone(buf[index : index+2]))
+			if index+2+int(length.value.Int64()) > total {
+				return nil, errors.New("push past the end of the script")
+			}
 			op := &ScriptVal{
 				buf[index+2 : index+2+int(length.value.Int64())],
 			}
 			index += 2 + int(length.value.Int64())
 			cmds = append(cmds, op)
+		} else if current == 78 {
+			//OP_PUSHDATA4
+			if index+4 > total {
+				return nil, errors.New("push past the end of the script")
+			}
+			length := FromLittleEndian(slices.Clone(buf[index : index+4]))
+			if index+4+int(length.value.Int64()) > total {
+				return nil, errors.New("push past the end of the script")
+			}
+			op := &ScriptVal{
+				buf[index+4 : index+4+int(length.value.Int64())],
+			}
+			index += 4 + int(length.value.Int64())
+			cmds = append(cmds, op)
 		} else {
 			//Simple Operation
-			op := OP_CODE_FUNCTIONS[int(current)]
-			if op == nil {
-				fmt.Printf("Adding undefined operation: %d\n", int(current))
-				cmds = append(cmds, &UNDEFINED{int(current)})
-			} else {
-				cmds = append(cmds, op)
-			}
+			cmds = append(cmds, opcodeOperation(int(current), len(cmds)))
 		}
 
 	}
@@ -366,14 +406,33 @@ func ParseScript(from io.Reader) (*Script, error) {
 	}, err
 }
 
+// Reads a length prefixed script without parsing it
+func readScriptBytes(from io.Reader) ([]byte, error) {
+	length := ReadVarInt(from)
+	buf, err := io.ReadAll(io.LimitReader(from, int64(length)))
+	if err != nil || uint64(len(buf)) != length {
+		return nil, errors.Join(err, errors.New("invalid Script length decoded"))
+	}
+	return buf, nil
+}
+
 func (t *Script) Serialize() []byte {
 	val := serializeScriptToBytes(t.cmds)
 	length := EncodeVarInt(uint64(len(val)))
 	return append(length, val...)
 }
 
+// The script as serialized in the transaction, keeping the encoding
+// of its pushes when parsed
+func (t *ScriptPubKey) scriptBytes() []byte {
+	if t.raw != nil {
+		return t.raw
+	}
+	return serializeScriptToBytes(t.cmds)
+}
+
 func (t *ScriptPubKey) Serialize() []byte {
-	val := serializeScriptToBytes(t.cmds)
+	val := t.scriptBytes()
 	length := EncodeVarInt(uint64(len(val)))
 	return append(length, val...)
 }
@@ -0,0 +1,273 @@
+package bitcoinlib
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Reasons a script fails, the same as Bitcoin Core's ScriptError. Codes
+// are errors themselves, so errors.Is matches a ScriptError by its code
+type ScriptErrorCode int
+
+const (
+	SCRIPT_ERR_OK ScriptErrorCode = iota
+	SCRIPT_ERR_UNKNOWN_ERROR
+	SCRIPT_ERR_EVAL_FALSE
+	SCRIPT_ERR_OP_RETURN
+
+	// Max sizes
+	SCRIPT_ERR_SCRIPT_SIZE
+	SCRIPT_ERR_PUSH_SIZE
+	SCRIPT_ERR_OP_COUNT
+	SCRIPT_ERR_STACK_SIZE
+	SCRIPT_ERR_SIG_COUNT
+	SCRIPT_ERR_PUBKEY_COUNT
+
+	// Failed verify operations
+	SCRIPT_ERR_VERIFY
+	SCRIPT_ERR_EQUALVERIFY
+	SCRIPT_ERR_CHECKMULTISIGVERIFY
+	SCRIPT_ERR_CHECKSIGVERIFY
+	SCRIPT_ERR_NUMEQUALVERIFY
+
+	// Logical and other errors
+	SCRIPT_ERR_BAD_OPCODE
+	SCRIPT_ERR_DISABLED_OPCODE
+	SCRIPT_ERR_INVALID_STACK_OPERATION
+	SCRIPT_ERR_INVALID_ALTSTACK_OPERATION
+	SCRIPT_ERR_UNBALANCED_CONDITIONAL
+
+	// CHECKLOCKTIMEVERIFY and CHECKSEQUENCEVERIFY
+	SCRIPT_ERR_NEGATIVE_LOCKTIME
+	SCRIPT_ERR_UNSATISFIED_LOCKTIME
+
+	// Malleability
+	SCRIPT_ERR_SIG_HASHTYPE
+	SCRIPT_ERR_SIG_DER
+	SCRIPT_ERR_MINIMALDATA
+	SCRIPT_ERR_SIG_PUSHONLY
+	SCRIPT_ERR_SIG_HIGH_S
+	SCRIPT_ERR_SIG_NULLDUMMY
+	SCRIPT_ERR_PUBKEYTYPE
+	SCRIPT_ERR_CLEANSTACK
+	SCRIPT_ERR_MINIMALIF
+	SCRIPT_ERR_SIG_NULLFAIL
+
+	// Softfork safeness
+	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_NOPS
+	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM
+	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION
+	SCRIPT_ERR_DISCOURAGE_OP_SUCCESS
+	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_PUBKEYTYPE
+
+	// Segregated witness
+	SCRIPT_ERR_WITNESS_PROGRAM_WRONG_LENGTH
+	SCRIPT_ERR_WITNESS_PROGRAM_WITNESS_EMPTY
+	SCRIPT_ERR_WITNESS_PROGRAM_MISMATCH
+	SCRIPT_ERR_WITNESS_MALLEATED
+	SCRIPT_ERR_WITNESS_MALLEATED_P2SH
+	SCRIPT_ERR_WITNESS_UNEXPECTED
+	SCRIPT_ERR_WITNESS_PUBKEYTYPE
+
+	// Taproot
+	SCRIPT_ERR_SCHNORR_SIG_SIZE
+	SCRIPT_ERR_SCHNORR_SIG_HASHTYPE
+	SCRIPT_ERR_SCHNORR_SIG
+	SCRIPT_ERR_TAPROOT_WRONG_CONTROL_SIZE
+	SCRIPT_ERR_TAPSCRIPT_VALIDATION_WEIGHT
+	SCRIPT_ERR_TAPSCRIPT_CHECKMULTISIG
+	SCRIPT_ERR_TAPSCRIPT_MINIMALIF
+	SCRIPT_ERR_TAPSCRIPT_EMPTY_PUBKEY
+
+	// Constant scriptCode
+	SCRIPT_ERR_OP_CODESEPARATOR
+	SCRIPT_ERR_SIG_FINDANDDELETE
+)
+
+// Names of the errors in the Bitcoin Core test vectors
+var SCRIPT_ERROR_NAMES map[ScriptErrorCode]string = map[ScriptErrorCode]string{
+	SCRIPT_ERR_OK:                                    "OK",
+	SCRIPT_ERR_UNKNOWN_ERROR:                         "UNKNOWN_ERROR",
+	SCRIPT_ERR_EVAL_FALSE:                            "EVAL_FALSE",
+	SCRIPT_ERR_OP_RETURN:                             "OP_RETURN",
+	SCRIPT_ERR_SCRIPT_SIZE:                           "SCRIPT_SIZE",
+	SCRIPT_ERR_PUSH_SIZE:                             "PUSH_SIZE",
+	SCRIPT_ERR_OP_COUNT:                              "OP_COUNT",
+	SCRIPT_ERR_STACK_SIZE:                            "STACK_SIZE",
+	SCRIPT_ERR_SIG_COUNT:                             "SIG_COUNT",
+	SCRIPT_ERR_PUBKEY_COUNT:                          "PUBKEY_COUNT",
+	SCRIPT_ERR_VERIFY:                                "VERIFY",
+	SCRIPT_ERR_EQUALVERIFY:                           "EQUALVERIFY",
+	SCRIPT_ERR_CHECKMULTISIGVERIFY:                   "CHECKMULTISIGVERIFY",
+	SCRIPT_ERR_CHECKSIGVERIFY:                        "CHECKSIGVERIFY",
+	SCRIPT_ERR_NUMEQUALVERIFY:                        "NUMEQUALVERIFY",
+	SCRIPT_ERR_BAD_OPCODE:                            "BAD_OPCODE",
+	SCRIPT_ERR_DISABLED_OPCODE:                       "DISABLED_OPCODE",
+	SCRIPT_ERR_INVALID_STACK_OPERATION:               "INVALID_STACK_OPERATION",
+	SCRIPT_ERR_INVALID_ALTSTACK_OPERATION:            "INVALID_ALTSTACK_OPERATION",
+	SCRIPT_ERR_UNBALANCED_CONDITIONAL:                "UNBALANCED_CONDITIONAL",
+	SCRIPT_ERR_NEGATIVE_LOCKTIME:                     "NEGATIVE_LOCKTIME",
+	SCRIPT_ERR_UNSATISFIED_LOCKTIME:                  "UNSATISFIED_LOCKTIME",
+	SCRIPT_ERR_SIG_HASHTYPE:                          "SIG_HASHTYPE",
+	SCRIPT_ERR_SIG_DER:                               "SIG_DER",
+	SCRIPT_ERR_MINIMALDATA:                           "MINIMALDATA",
+	SCRIPT_ERR_SIG_PUSHONLY:                          "SIG_PUSHONLY",
+	SCRIPT_ERR_SIG_HIGH_S:                            "SIG_HIGH_S",
+	SCRIPT_ERR_SIG_NULLDUMMY:                         "SIG_NULLDUMMY",
+	SCRIPT_ERR_PUBKEYTYPE:                            "PUBKEYTYPE",
+	SCRIPT_ERR_CLEANSTACK:                            "CLEANSTACK",
+	SCRIPT_ERR_MINIMALIF:                             "MINIMALIF",
+	SCRIPT_ERR_SIG_NULLFAIL:                          "NULLFAIL",
+	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_NOPS:            "DISCOURAGE_UPGRADABLE_NOPS",
+	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM: "DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM",
+	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION: "DISCOURAGE_UPGRADABLE_TAPROOT_VERSION",
+	SCRIPT_ERR_DISCOURAGE_OP_SUCCESS:                 "DISCOURAGE_OP_SUCCESS",
+	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_PUBKEYTYPE:      "DISCOURAGE_UPGRADABLE_PUBKEYTYPE",
+	SCRIPT_ERR_WITNESS_PROGRAM_WRONG_LENGTH:          "WITNESS_PROGRAM_WRONG_LENGTH",
+	SCRIPT_ERR_WITNESS_PROGRAM_WITNESS_EMPTY:         "WITNESS_PROGRAM_WITNESS_EMPTY",
+	SCRIPT_ERR_WITNESS_PROGRAM_MISMATCH:              "WITNESS_PROGRAM_MISMATCH",
+	SCRIPT_ERR_WITNESS_MALLEATED:                     "WITNESS_MALLEATED",
+	SCRIPT_ERR_WITNESS_MALLEATED_P2SH:                "WITNESS_MALLEATED_P2SH",
+	SCRIPT_ERR_WITNESS_UNEXPECTED:                    "WITNESS_UNEXPECTED",
+	SCRIPT_ERR_WITNESS_PUBKEYTYPE:                    "WITNESS_PUBKEYTYPE",
+	SCRIPT_ERR_SCHNORR_SIG_SIZE:                      "SCHNORR_SIG_SIZE",
+	SCRIPT_ERR_SCHNORR_SIG_HASHTYPE:                  "SCHNORR_SIG_HASHTYPE",
+	SCRIPT_ERR_SCHNORR_SIG:                           "SCHNORR_SIG",
+	SCRIPT_ERR_TAPROOT_WRONG_CONTROL_SIZE:            "TAPROOT_WRONG_CONTROL_SIZE",
+	SCRIPT_ERR_TAPSCRIPT_VALIDATION_WEIGHT:           "TAPSCRIPT_VALIDATION_WEIGHT",
+	SCRIPT_ERR_TAPSCRIPT_CHECKMULTISIG:               "TAPSCRIPT_CHECKMULTISIG",
+	SCRIPT_ERR_TAPSCRIPT_MINIMALIF:                   "TAPSCRIPT_MINIMALIF",
+	SCRIPT_ERR_TAPSCRIPT_EMPTY_PUBKEY:                "TAPSCRIPT_EMPTY_PUBKEY",
+	SCRIPT_ERR_OP_CODESEPARATOR:                      "OP_CODESEPARATOR",
+	SCRIPT_ERR_SIG_FINDANDDELETE:                     "SIG_FINDANDDELETE",
+}
+
+// Descriptions of the errors, as Bitcoin Core reports them
+var scriptErrorMessages map[ScriptErrorCode]string = map[ScriptErrorCode]string{
+	SCRIPT_ERR_OK:                                    "No error",
+	SCRIPT_ERR_EVAL_FALSE:                            "Script evaluated without error but finished with a false/empty top stack element",
+	SCRIPT_ERR_VERIFY:                                "Script failed an OP_VERIFY operation",
+	SCRIPT_ERR_EQUALVERIFY:                           "Script failed an OP_EQUALVERIFY operation",
+	SCRIPT_ERR_CHECKMULTISIGVERIFY:                   "Script failed an OP_CHECKMULTISIGVERIFY operation",
+	SCRIPT_ERR_CHECKSIGVERIFY:                        "Script failed an OP_CHECKSIGVERIFY operation",
+	SCRIPT_ERR_NUMEQUALVERIFY:                        "Script failed an OP_NUMEQUALVERIFY operation",
+	SCRIPT_ERR_SCRIPT_SIZE:                           "Script is too big",
+	SCRIPT_ERR_PUSH_SIZE:                             "Push value size limit exceeded",
+	SCRIPT_ERR_OP_COUNT:                              "Operation limit exceeded",
+	SCRIPT_ERR_STACK_SIZE:                            "Stack size limit exceeded",
+	SCRIPT_ERR_SIG_COUNT:                             "Signature count negative or greater than pubkey count",
+	SCRIPT_ERR_PUBKEY_COUNT:                          "Pubkey count negative or limit exceeded",
+	SCRIPT_ERR_BAD_OPCODE:                            "Opcode missing or not understood",
+	SCRIPT_ERR_DISABLED_OPCODE:                       "Attempted to use a disabled opcode",
+	SCRIPT_ERR_INVALID_STACK_OPERATION:               "Operation not valid with the current stack size",
+	SCRIPT_ERR_INVALID_ALTSTACK_OPERATION:            "Operation not valid with the current altstack size",
+	SCRIPT_ERR_OP_RETURN:                             "OP_RETURN was encountered",
+	SCRIPT_ERR_UNBALANCED_CONDITIONAL:                "Invalid OP_IF construction",
+	SCRIPT_ERR_NEGATIVE_LOCKTIME:                     "Negative locktime",
+	SCRIPT_ERR_UNSATISFIED_LOCKTIME:                  "Locktime requirement not satisfied",
+	SCRIPT_ERR_SIG_HASHTYPE:                          "Signature hash type missing or not understood",
+	SCRIPT_ERR_SIG_DER:                               "Non-canonical DER signature",
+	SCRIPT_ERR_MINIMALDATA:                           "Data push larger than necessary",
+	SCRIPT_ERR_SIG_PUSHONLY:                          "Only push operators allowed in signatures",
+	SCRIPT_ERR_SIG_HIGH_S:                            "Non-canonical signature: S value is unnecessarily high",
+	SCRIPT_ERR_SIG_NULLDUMMY:                         "Dummy CHECKMULTISIG argument must be zero",
+	SCRIPT_ERR_MINIMALIF:                             "OP_IF/NOTIF argument must be minimal",
+	SCRIPT_ERR_SIG_NULLFAIL:                          "Signature must be zero for failed CHECK(MULTI)SIG operation",
+	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_NOPS:            "NOPx reserved for soft-fork upgrades",
+	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM: "Witness version reserved for soft-fork upgrades",
+	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION: "Taproot version reserved for soft-fork upgrades",
+	SCRIPT_ERR_DISCOURAGE_OP_SUCCESS:                 "OP_SUCCESSx reserved for soft-fork upgrades",
+	SCRIPT_ERR_DISCOURAGE_UPGRADABLE_PUBKEYTYPE:      "Public key version reserved for soft-fork upgrades",
+	SCRIPT_ERR_PUBKEYTYPE:                            "Public key is neither compressed or uncompressed",
+	SCRIPT_ERR_CLEANSTACK:                            "Stack size must be exactly one after execution",
+	SCRIPT_ERR_WITNESS_PROGRAM_WRONG_LENGTH:          "Witness program has incorrect length",
+	SCRIPT_ERR_WITNESS_PROGRAM_WITNESS_EMPTY:         "Witness program was passed an empty witness",
+	SCRIPT_ERR_WITNESS_PROGRAM_MISMATCH:              "Witness program hash mismatch",
+	SCRIPT_ERR_WITNESS_MALLEATED:                     "Witness requires empty scriptSig",
+	SCRIPT_ERR_WITNESS_MALLEATED_P2SH:                "Witness requires only-redeemscript scriptSig",
+	SCRIPT_ERR_WITNESS_UNEXPECTED:                    "Witness provided for non-witness script",
+	SCRIPT_ERR_WITNESS_PUBKEYTYPE:                    "Using non-compressed keys in segwit",
+	SCRIPT_ERR_SCHNORR_SIG_SIZE:                      "Invalid Schnorr signature size",
+	SCRIPT_ERR_SCHNORR_SIG_HASHTYPE:                  "Invalid Schnorr signature hash type",
+	SCRIPT_ERR_SCHNORR_SIG:                           "Invalid Schnorr signature",
+	SCRIPT_ERR_TAPROOT_WRONG_CONTROL_SIZE:            "Invalid Taproot control block size",
+	SCRIPT_ERR_TAPSCRIPT_VALIDATION_WEIGHT:           "Too much signature validation relative to witness weight",
+	SCRIPT_ERR_TAPSCRIPT_CHECKMULTISIG:               "OP_CHECKMULTISIG(VERIFY) is not available in tapscript",
+	SCRIPT_ERR_TAPSCRIPT_MINIMALIF:                   "OP_IF/NOTIF argument must be minimal in tapscript",
+	SCRIPT_ERR_TAPSCRIPT_EMPTY_PUBKEY:                "Empty public key in tapscript",
+	SCRIPT_ERR_OP_CODESEPARATOR:                      "Using OP_CODESEPARATOR in non-witness script",
+	SCRIPT_ERR_SIG_FINDANDDELETE:                     "Signature is found in scriptCode",
+}
+
+func (c ScriptErrorCode) String() string {
+	if name, ok := SCRIPT_ERROR_NAMES[c]; ok {
+		return name
+	}
+	return SCRIPT_ERROR_NAMES[SCRIPT_ERR_UNKNOWN_ERROR]
+}
+
+func (c ScriptErrorCode) Error() string {
+	if message, ok := scriptErrorMessages[c]; ok {
+		return message
+	}
+	return "unknown error"
+}
+
+// Failure of a script. Index is the position of the failed operation
+// among the executed ones, and Input the index of the input being
+// verified. Both are -1 when they don't apply
+type ScriptError struct {
+	Code      ScriptErrorCode
+	Index     int
+	Operation string // in ASM
+	Input     int
+}
+
+func (e *ScriptError) Error() string {
+	result := e.Code.Error()
+	if e.Index >= 0 {
+		result = fmt.Sprintf("%s at operation %d (%s)", result, e.Index, e.Operation)
+	}
+	if e.Input >= 0 {
+		result = fmt.Sprintf("input %d: %s", e.Input, result)
+	}
+	return result
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Code
+}
+
+// Code of the error, SCRIPT_ERR_OK without error and
+// SCRIPT_ERR_UNKNOWN_ERROR when it isn't a script error
+func ScriptErrorCodeOf(err error) ScriptErrorCode {
+	if err == nil {
+		return SCRIPT_ERR_OK
+	}
+	var code ScriptErrorCode
+	if errors.As(err, &code) {
+		return code
+	}
+	return SCRIPT_ERR_UNKNOWN_ERROR
+}
+
+// Input of the error, -1 for scripts evaluated without a transaction
+func (ctx *ExecutionContext) inputIndex() int {
+	if ctx.tx == nil {
+		return -1
+	}
+	return ctx.input
+}
+
+// Returns the script error of the code, not tied to an operation.
+// The first error is recorded when tracing
+func (ctx *ExecutionContext) fail(err error) error {
+	scriptErr, ok := err.(*ScriptError)
+	if !ok {
+		scriptErr = &ScriptError{ScriptErrorCodeOf(err), -1, "", ctx.inputIndex()}
+	}
+	if ctx.trace != nil && ctx.trace.Err == nil {
+		ctx.trace.Err = scriptErr
+	}
+	return scriptErr
+}
@@ -0,0 +1,142 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestScriptErrorCodes(t *testing.T) {
+	vectors := []struct {
+		scriptSig    string
+		scriptPubKey string
+		flags        bitcoinlib.ScriptFlags
+		expected     bitcoinlib.ScriptErrorCode
+	}{
+		{"1", "OP_DROP OP_DROP", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_INVALID_STACK_OPERATION},
+		{"", "OP_FROMALTSTACK", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_INVALID_ALTSTACK_OPERATION},
+		{"1 2", "OP_EQUALVERIFY 1", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_EQUALVERIFY},
+		{"1 2", "OP_NUMEQUALVERIFY 1", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_NUMEQUALVERIFY},
+		{"0", "OP_VERIFY 1", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_VERIFY},
+		{"1", "OP_RETURN", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_OP_RETURN},
+		{"1", "OP_IF 1", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_UNBALANCED_CONDITIONAL},
+		{"1", "OP_ENDIF", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_UNBALANCED_CONDITIONAL},
+		{"2 2", "OP_CAT", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_DISABLED_OPCODE},
+		{"1", "OP_VERIF", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_BAD_OPCODE},
+		{"0 0 0", "OP_CHECKSIGVERIFY 1", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_CHECKSIGVERIFY},
+		{"0 0 1 0 1", "OP_CHECKMULTISIGVERIFY 1", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_CHECKMULTISIGVERIFY},
+		{"1 0 0", "OP_CHECKMULTISIG", bitcoinlib.SCRIPT_VERIFY_NULLDUMMY, bitcoinlib.SCRIPT_ERR_SIG_NULLDUMMY},
+		{"0 0 1 0", "OP_CHECKMULTISIG", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_SIG_COUNT},
+		{"0 21", "OP_CHECKMULTISIG", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_PUBKEY_COUNT},
+		{"1 -1", "OP_PICK", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_INVALID_STACK_OPERATION},
+		{"0", "1", bitcoinlib.SCRIPT_VERIFY_CLEANSTACK, bitcoinlib.SCRIPT_ERR_CLEANSTACK},
+		{"0", "OP_NOP", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_EVAL_FALSE},
+		{"", "OP_NOP", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_EVAL_FALSE},
+		{"1", "OP_NOP", bitcoinlib.SCRIPT_VERIFY_NONE, bitcoinlib.SCRIPT_ERR_OK},
+	}
+	for index, vector := range vectors {
+		_, err := traceAsm(t, vector.scriptSig, vector.scriptPubKey, vector.flags)
+		if got := bitcoinlib.ScriptErrorCodeOf(err); got != vector.expected {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s (%v)", index, vector.expected, got, err)
+		}
+		if vector.expected != bitcoinlib.SCRIPT_ERR_OK && !errors.Is(err, vector.expected) {
+			t.Fatalf("Failed at index %d\nExpected => errors.Is %s\nGot => %v", index, vector.expected, err)
+		}
+	}
+}
+
+func TestScriptErrorFormat(t *testing.T) {
+	err := &bitcoinlib.ScriptError{Code: bitcoinlib.SCRIPT_ERR_EQUALVERIFY, Index: 3, Operation: "OP_EQUALVERIFY", Input: 1}
+	expected := "input 1: Script failed an OP_EQUALVERIFY operation at operation 3 (OP_EQUALVERIFY)"
+	if err.Error() != expected {
+		t.Fatalf("Expected => %s\nGot => %s", expected, err)
+	}
+	if bitcoinlib.SCRIPT_ERR_SIG_NULLFAIL.String() != "NULLFAIL" || bitcoinlib.SCRIPT_ERR_OK.String() != "OK" {
+		t.Fatalf("Wrong names %s %s", bitcoinlib.SCRIPT_ERR_SIG_NULLFAIL, bitcoinlib.SCRIPT_ERR_OK)
+	}
+	if bitcoinlib.ScriptErrorCodeOf(errors.New("other")) != bitcoinlib.SCRIPT_ERR_UNKNOWN_ERROR {
+		t.Fatal("Errors other than script errors must have an unknown code")
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(6007))
+	script := builderScript(t, key.P2WPKHAddress(bitcoinlib.MAINNET_PARAMS))
+	txId := strings.Repeat("78", 32)
+	provider := bitcoinlib.NewMemoryProvider()
+	provider.Add(txId, 0, bitcoinlib.NewOutput(10000, script))
+	tx := bitcoinlib.NewTransaction()
+	tx.AddInput(txId, 0)
+	tx.AddOutputScript(9000, script)
+	if err := tx.SignInput(0, provider, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.ValidateInput(0, provider, bitcoinlib.SCRIPT_VERIFY_STANDARD); err != nil {
+		t.Fatalf("Failed validating a signed input: %s", err)
+	}
+	if err := tx.Validate(provider, bitcoinlib.SCRIPT_VERIFY_STANDARD); err != nil {
+		t.Fatalf("Failed validating a signed transaction: %s", err)
+	}
+
+	// A different amount changes the signed digest
+	wrongAmount := bitcoinlib.NewMemoryProvider()
+	wrongAmount.Add(txId, 0, bitcoinlib.NewOutput(10001, script))
+	vectors := []struct {
+		flags    bitcoinlib.ScriptFlags
+		expected bitcoinlib.ScriptErrorCode
+	}{
+		{bitcoinlib.SCRIPT_VERIFY_CONSENSUS, bitcoinlib.SCRIPT_ERR_EVAL_FALSE},
+		{bitcoinlib.SCRIPT_VERIFY_STANDARD, bitcoinlib.SCRIPT_ERR_SIG_NULLFAIL},
+	}
+	for index, vector := range vectors {
+		err := tx.ValidateInput(0, wrongAmount, vector.flags)
+		var scriptErr *bitcoinlib.ScriptError
+		if !errors.As(err, &scriptErr) || scriptErr.Code != vector.expected || scriptErr.Input != 0 {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %v", index, vector.expected, err)
+		}
+		if tx.VerifyInputWithFlags(0, wrongAmount, vector.flags) {
+			t.Fatalf("Failed at index %d\nVerified an input with the wrong amount", index)
+		}
+	}
+
+	var scriptErr *bitcoinlib.ScriptError
+	if err := tx.ValidateInput(0, bitcoinlib.NewMemoryProvider(), bitcoinlib.SCRIPT_VERIFY_STANDARD); err == nil || errors.As(err, &scriptErr) {
+		t.Fatalf("Expected => missing prevout error\nGot => %v", err)
+	}
+}
+
+func TestValidateWitnessPrograms(t *testing.T) {
+	decode := func(s string) []byte {
+		b, _ := hex.DecodeString(s)
+		return b
+	}
+	program := strings.Repeat("11", 32)
+	redeem := "5220" + program // version 2
+	vectors := []struct {
+		scriptSig    string
+		scriptPubKey string
+		flags        bitcoinlib.ScriptFlags
+		expected     bitcoinlib.ScriptErrorCode
+	}{
+		// Version 1 is only taproot with its flag
+		{"", "5120" + program, bitcoinlib.SCRIPT_VERIFY_CONSENSUS &^ bitcoinlib.SCRIPT_VERIFY_TAPROOT, bitcoinlib.SCRIPT_ERR_OK},
+		{"", redeem, bitcoinlib.SCRIPT_VERIFY_CONSENSUS, bitcoinlib.SCRIPT_ERR_OK},
+		{"", redeem, bitcoinlib.SCRIPT_VERIFY_STANDARD, bitcoinlib.SCRIPT_ERR_OK},
+		{"", redeem, bitcoinlib.SCRIPT_VERIFY_CONSENSUS | bitcoinlib.SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM, bitcoinlib.SCRIPT_ERR_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM},
+		{"51", redeem, bitcoinlib.SCRIPT_VERIFY_CONSENSUS, bitcoinlib.SCRIPT_ERR_WITNESS_MALLEATED},
+		{"22" + redeem, "a914" + hex.EncodeToString(bitcoinlib.Hash160(decode(redeem))) + "87", bitcoinlib.SCRIPT_VERIFY_STANDARD, bitcoinlib.SCRIPT_ERR_OK},
+		{"5122" + redeem, "a914" + hex.EncodeToString(bitcoinlib.Hash160(decode(redeem))) + "87", bitcoinlib.SCRIPT_VERIFY_CONSENSUS, bitcoinlib.SCRIPT_ERR_WITNESS_MALLEATED_P2SH},
+		{"", "0010" + strings.Repeat("11", 16), bitcoinlib.SCRIPT_VERIFY_CONSENSUS, bitcoinlib.SCRIPT_ERR_WITNESS_PROGRAM_WRONG_LENGTH},
+		// Witnesses of scripts other than witness programs
+		{"", "51", bitcoinlib.SCRIPT_VERIFY_CONSENSUS, bitcoinlib.SCRIPT_ERR_WITNESS_UNEXPECTED},
+		{"", "51", bitcoinlib.SCRIPT_VERIFY_P2SH, bitcoinlib.SCRIPT_ERR_OK},
+	}
+	for index, vector := range vectors {
+		err := bitcoinlib.ValidateScripts(decode(vector.scriptSig), decode(vector.scriptPubKey), [][]byte{{0x01}}, 0, vector.flags)
+		if got := bitcoinlib.ScriptErrorCodeOf(err); got != vector.expected {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s (%v)", index, vector.expected, got, err)
+		}
+	}
+}
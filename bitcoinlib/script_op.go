@@ -1,16 +1,16 @@
 package bitcoinlib
 
 import (
+	"bytes"
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
-	"fmt"
 	"slices"
 )
 
 var OP_CODE_FUNCTIONS map[int]Operation = map[int]Operation{
 	0:   &OP_0{},
-	79:  &OP_NEGATE{},
+	79:  &OP_1Negate{},
 	81:  &OP_1{},
 	82:  &OP_2{},
 	83:  &OP_3{},
@@ -30,6 +30,8 @@ var OP_CODE_FUNCTIONS map[int]Operation = map[int]Operation{
 	97:  &OP_NOP{},
 	99:  &OP_IF{},
 	100: &OP_NOTIF{},
+	103: &OP_ELSE{},
+	104: &OP_ENDIF{},
 	105: &OP_VERIFY{},
 	106: &OP_RETURN{},
 	107: &OP_TOALTSTACK{},
@@ -80,24 +82,146 @@ var OP_CODE_FUNCTIONS map[int]Operation = map[int]Operation{
 	168: &OP_SHA256{},
 	169: &OP_HASH160{},
 	170: &OP_HASH256{},
+	171: &OP_CODESEPARATOR{},
 	172: &OP_CHECKSIG{},
 	173: &OP_CHECKSIGVERIFY{},
 	174: &OP_CHECKMULTISIG{},
 	175: &OP_CHECKMULTISIGVERIFY{},
-	176: &OP_NOP{},
+	176: &UPGRADABLE_NOP{176},
 	177: &OP_CHECKLOCKTIMEVERIFY{},
 	178: &OP_CHECKSEQUENCEVERIFY{},
-	179: &OP_NOP{},
-	180: &OP_NOP{},
-	181: &OP_NOP{},
-	182: &OP_NOP{},
-	183: &OP_NOP{},
-	184: &OP_NOP{},
-	185: &OP_NOP{},
-}
-
+	179: &UPGRADABLE_NOP{179},
+	180: &UPGRADABLE_NOP{180},
+	181: &UPGRADABLE_NOP{181},
+	182: &UPGRADABLE_NOP{182},
+	183: &UPGRADABLE_NOP{183},
+	184: &UPGRADABLE_NOP{184},
+	185: &UPGRADABLE_NOP{185},
+	186: &OP_CHECKSIGADD{},
+}
+
+// Names of the opcodes as Bitcoin Core prints them, small numbers
+// are written as decimal numbers
+var OP_CODE_NAMES map[int]string = map[int]string{
+	0:   "0",
+	76:  "OP_PUSHDATA1",
+	77:  "OP_PUSHDATA2",
+	78:  "OP_PUSHDATA4",
+	79:  "-1",
+	80:  "OP_RESERVED",
+	81:  "1",
+	82:  "2",
+	83:  "3",
+	84:  "4",
+	85:  "5",
+	86:  "6",
+	87:  "7",
+	88:  "8",
+	89:  "9",
+	90:  "10",
+	91:  "11",
+	92:  "12",
+	93:  "13",
+	94:  "14",
+	95:  "15",
+	96:  "16",
+	97:  "OP_NOP",
+	98:  "OP_VER",
+	99:  "OP_IF",
+	100: "OP_NOTIF",
+	101: "OP_VERIF",
+	102: "OP_VERNOTIF",
+	103: "OP_ELSE",
+	104: "OP_ENDIF",
+	105: "OP_VERIFY",
+	106: "OP_RETURN",
+	107: "OP_TOALTSTACK",
+	108: "OP_FROMALTSTACK",
+	109: "OP_2DROP",
+	110: "OP_2DUP",
+	111: "OP_3DUP",
+	112: "OP_2OVER",
+	113: "OP_2ROT",
+	114: "OP_2SWAP",
+	115: "OP_IFDUP",
+	116: "OP_DEPTH",
+	117: "OP_DROP",
+	118: "OP_DUP",
+	119: "OP_NIP",
+	120: "OP_OVER",
+	121: "OP_PICK",
+	122: "OP_ROLL",
+	123: "OP_ROT",
+	124: "OP_SWAP",
+	125: "OP_TUCK",
+	126: "OP_CAT",
+	127: "OP_SUBSTR",
+	128: "OP_LEFT",
+	129: "OP_RIGHT",
+	130: "OP_SIZE",
+	131: "OP_INVERT",
+	132: "OP_AND",
+	133: "OP_OR",
+	134: "OP_XOR",
+	135: "OP_EQUAL",
+	136: "OP_EQUALVERIFY",
+	137: "OP_RESERVED1",
+	138: "OP_RESERVED2",
+	139: "OP_1ADD",
+	140: "OP_1SUB",
+	141: "OP_2MUL",
+	142: "OP_2DIV",
+	143: "OP_NEGATE",
+	144: "OP_ABS",
+	145: "OP_NOT",
+	146: "OP_0NOTEQUAL",
+	147: "OP_ADD",
+	148: "OP_SUB",
+	149: "OP_MUL",
+	150: "OP_DIV",
+	151: "OP_MOD",
+	152: "OP_LSHIFT",
+	153: "OP_RSHIFT",
+	154: "OP_BOOLAND",
+	155: "OP_BOOLOR",
+	156: "OP_NUMEQUAL",
+	157: "OP_NUMEQUALVERIFY",
+	158: "OP_NUMNOTEQUAL",
+	159: "OP_LESSTHAN",
+	160: "OP_GREATERTHAN",
+	161: "OP_LESSTHANOREQUAL",
+	162: "OP_GREATERTHANOREQUAL",
+	163: "OP_MIN",
+	164: "OP_MAX",
+	165: "OP_WITHIN",
+	166: "OP_RIPEMD160",
+	167: "OP_SHA1",
+	168: "OP_SHA256",
+	169: "OP_HASH160",
+	170: "OP_HASH256",
+	171: "OP_CODESEPARATOR",
+	172: "OP_CHECKSIG",
+	173: "OP_CHECKSIGVERIFY",
+	174: "OP_CHECKMULTISIG",
+	175: "OP_CHECKMULTISIGVERIFY",
+	176: "OP_NOP1",
+	177: "OP_CHECKLOCKTIMEVERIFY",
+	178: "OP_CHECKSEQUENCEVERIFY",
+	179: "OP_NOP4",
+	180: "OP_NOP5",
+	181: "OP_NOP6",
+	182: "OP_NOP7",
+	183: "OP_NOP8",
+	184: "OP_NOP9",
+	185: "OP_NOP10",
+	186: "OP_CHECKSIGADD",
+}
+
+// Opcodes read the spending transaction, the input and the flags from
+// the execution context. Operate returns the ScriptErrorCode the script
+// fails with
 type Operation interface {
-	Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool
+	Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error
 	Num() int
 }
 
@@ -106,10 +230,16 @@ type UNDEFINED struct {
 	num int
 }
 
-func (op *UNDEFINED) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
-	return false
+func (op *UNDEFINED) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	if slices.Contains(DISABLED_OPCODES, op.num) {
+		return SCRIPT_ERR_DISABLED_OPCODE
+	}
+	return SCRIPT_ERR_BAD_OPCODE
 }
 
+// Opcodes disabled since the early days of bitcoin
+var DISABLED_OPCODES = []int{126, 127, 128, 129, 131, 132, 133, 134, 141, 142, 149, 150, 151, 152, 153}
+
 func (op *UNDEFINED) Num() int {
 	return op.num
 }
@@ -138,9 +268,12 @@ type ScriptVal struct {
 }
 
 // This value should not be operated with
-func (t *ScriptVal) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *ScriptVal) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	if ctx.nonMinimal[t] && ctx.flags.has(SCRIPT_VERIFY_MINIMALDATA) {
+		return SCRIPT_ERR_MINIMALDATA
+	}
 	Push(stack, t)
-  return true
+  return nil
 }
 
 // Need to add this method to have duck typing
@@ -149,17 +282,30 @@ func (t *ScriptVal) Num() int {
 	return -1
 }
 
-// Utility function to get the
-// number value out of an operation
-// I need this function for numbers
-// that happen to be valid operation
-// numbers as well
-func intoValue(val Operation) int {
-	dVal, ok := val.(*ScriptVal)
-	if ok {
-		return int(decodeNum(dVal.Val).value.Int64())
+// Returns the bytes an operation represents once it is on the stack
+func stackBytes(op Operation) []byte {
+	if val, ok := op.(*ScriptVal); ok {
+		return val.Val
+	}
+	if op.Num() >= 81 && op.Num() <= 96 {
+		return encodeNum(FromInt(op.Num() - 80))
 	}
-	return val.Num()
+	if op.Num() == 79 {
+		return encodeNum(FromInt(-1))
+	}
+	return encodeNum(FromInt(op.Num()))
+}
+
+// An element is false when it is empty or encodes zero,
+// including negative zero
+func castToBool(op Operation) bool {
+	val := stackBytes(op)
+	for index, b := range val {
+		if b != 0 {
+			return index != len(val)-1 || b != 0x80
+		}
+	}
+	return false
 }
 
 func encodeNum(num Int) []byte {
@@ -174,10 +320,11 @@ func encodeNum(num Int) []byte {
 
 	result := make([]byte, len(num.value.Bytes()))
 	copy(result, num.value.Bytes())
+	// The sign is the top bit of the last byte once reversed
 	if negative && result[0]&0x80 == 0x80 {
-		result = append(result, 0x80)
+		result = append([]byte{0x80}, result...)
 	} else if !negative && result[0]&0x80 == 0x80 {
-		result = append(result, 0x00)
+		result = append([]byte{0x00}, result...)
 	} else if negative {
 		result[0] |= 0x80
 	}
@@ -189,26 +336,57 @@ func decodeNum(element []byte) Int {
 	if len(element) == 0 {
 		return ZERO
 	}
+	result := make([]byte, len(element))
+	copy(result, element)
 	negative := false
-	if element[len(element)-1]&0x80 == 0x80 {
+	if result[len(result)-1]&0x80 == 0x80 {
 		negative = true
-		element[len(element)-1] = element[len(element)-1] & 0x7f
+		result[len(result)-1] &= 0x7f
 	}
-	result := make([]byte, len(element))
-	copy(result, element)
 	slices.Reverse(result)
 	value := FromHexString("0x"+hex.EncodeToString(result))
 	if negative {
-		value.Mul(FromInt(-1))
+		value = value.Mul(FromInt(-1))
 	}
 	return value
 }
 
+// Numeric operands are at most 4 bytes, like Bitcoin Core's CScriptNum
+const SCRIPT_NUM_SIZE = 4
+
+// True if the number has no extra zero byte, other than the one keeping
+// the sign bit apart from the value
+func isMinimalNum(element []byte) bool {
+	if len(element) == 0 || element[len(element)-1]&0x7f != 0 {
+		return true
+	}
+	return len(element) > 1 && element[len(element)-2]&0x80 != 0
+}
+
+// Reads a numeric operand of at most size bytes, which has to be
+// minimally encoded under MINIMALDATA
+func (ctx *ExecutionContext) scriptNum(op Operation, size int) (int64, error) {
+	element := stackBytes(op)
+	if len(element) > size {
+		return 0, SCRIPT_ERR_UNKNOWN_ERROR
+	}
+	if ctx.flags.has(SCRIPT_VERIFY_MINIMALDATA) && !isMinimalNum(element) {
+		return 0, SCRIPT_ERR_UNKNOWN_ERROR
+	}
+	return decodeNum(element).value.Int64(), nil
+}
+
+// Pops a numeric operand of the arithmetic and stack operations
+func popNum(ctx *ExecutionContext, stack *Stack) (int, error) {
+	num, err := ctx.scriptNum(Pop(stack), SCRIPT_NUM_SIZE)
+	return int(num), err
+}
+
 type OP_0 struct{}
 
-func (t *OP_0) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_0) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, t)
-	return true
+	return nil
 }
 
 func (t *OP_0) Num() int {
@@ -217,10 +395,10 @@ func (t *OP_0) Num() int {
 
 type OP_1Negate struct{}
 
-func (t *OP_1Negate) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_1Negate) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(-1))})
-	return true
+	return nil
 }
 
 func (t *OP_1Negate) Num() int {
@@ -229,9 +407,9 @@ func (t *OP_1Negate) Num() int {
 
 type OP_1 struct{}
 
-func (t *OP_1) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_1) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(1))})
-	return true
+	return nil
 }
 
 func (t *OP_1) Num() int {
@@ -240,9 +418,9 @@ func (t *OP_1) Num() int {
 
 type OP_2 struct{}
 
-func (t *OP_2) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_2) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(2))})
-	return true
+	return nil
 }
 
 func (t *OP_2) Num() int {
@@ -251,9 +429,9 @@ func (t *OP_2) Num() int {
 
 type OP_3 struct{}
 
-func (t *OP_3) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_3) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(3))})
-	return true
+	return nil
 }
 
 func (t *OP_3) Num() int {
@@ -262,9 +440,9 @@ func (t *OP_3) Num() int {
 
 type OP_4 struct{}
 
-func (t *OP_4) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_4) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(4))})
-	return true
+	return nil
 }
 
 func (t *OP_4) Num() int {
@@ -273,9 +451,9 @@ func (t *OP_4) Num() int {
 
 type OP_5 struct{}
 
-func (t *OP_5) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_5) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(5))})
-	return true
+	return nil
 }
 
 func (t *OP_5) Num() int {
@@ -284,9 +462,9 @@ func (t *OP_5) Num() int {
 
 type OP_6 struct{}
 
-func (t *OP_6) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_6) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(6))})
-	return true
+	return nil
 }
 
 func (t *OP_6) Num() int {
@@ -295,9 +473,9 @@ func (t *OP_6) Num() int {
 
 type OP_7 struct{}
 
-func (t *OP_7) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_7) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(7))})
-	return true
+	return nil
 }
 
 func (t *OP_7) Num() int {
@@ -306,9 +484,9 @@ func (t *OP_7) Num() int {
 
 type OP_8 struct{}
 
-func (t *OP_8) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_8) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(8))})
-	return true
+	return nil
 }
 
 func (t *OP_8) Num() int {
@@ -317,9 +495,9 @@ func (t *OP_8) Num() int {
 
 type OP_9 struct{}
 
-func (t *OP_9) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_9) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(9))})
-	return true
+	return nil
 }
 
 func (t *OP_9) Num() int {
@@ -328,9 +506,9 @@ func (t *OP_9) Num() int {
 
 type OP_10 struct{}
 
-func (t *OP_10) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_10) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(10))})
-	return true
+	return nil
 }
 
 func (t *OP_10) Num() int {
@@ -339,9 +517,9 @@ func (t *OP_10) Num() int {
 
 type OP_11 struct{}
 
-func (t *OP_11) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_11) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(11))})
-	return true
+	return nil
 }
 
 func (t *OP_11) Num() int {
@@ -350,9 +528,9 @@ func (t *OP_11) Num() int {
 
 type OP_12 struct{}
 
-func (t *OP_12) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_12) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(12))})
-	return true
+	return nil
 }
 
 func (t *OP_12) Num() int {
@@ -361,9 +539,9 @@ func (t *OP_12) Num() int {
 
 type OP_13 struct{}
 
-func (t *OP_13) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_13) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(13))})
-	return true
+	return nil
 }
 
 func (t *OP_13) Num() int {
@@ -372,9 +550,9 @@ func (t *OP_13) Num() int {
 
 type OP_14 struct{}
 
-func (t *OP_14) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_14) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(14))})
-	return true
+	return nil
 }
 
 func (t *OP_14) Num() int {
@@ -383,9 +561,9 @@ func (t *OP_14) Num() int {
 
 type OP_15 struct{}
 
-func (t *OP_15) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_15) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(15))})
-	return true
+	return nil
 }
 
 func (t *OP_15) Num() int {
@@ -394,9 +572,9 @@ func (t *OP_15) Num() int {
 
 type OP_16 struct{}
 
-func (t *OP_16) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_16) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	*stack = append(*stack, &ScriptVal{encodeNum(FromInt(16))})
-	return true
+	return nil
 }
 
 func (t *OP_16) Num() int {
@@ -405,21 +583,38 @@ func (t *OP_16) Num() int {
 
 type OP_NOP struct{}
 
-func (t *OP_NOP) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
-	return true
+func (t *OP_NOP) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	return nil
 }
 
 func (t *OP_NOP) Num() int {
 	return 97
 }
 
+// OP_NOP1 and OP_NOP4 to OP_NOP10 do nothing, they keep their opcode so
+// scripts serialize back to the same bytes
+type UPGRADABLE_NOP struct {
+	num int
+}
+
+func (t *UPGRADABLE_NOP) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	if ctx.flags.has(SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_NOPS) {
+		return SCRIPT_ERR_DISCOURAGE_UPGRADABLE_NOPS
+	}
+	return nil
+}
+
+func (t *UPGRADABLE_NOP) Num() int {
+	return t.num
+}
+
 type OP_IF struct{}
 
 // This function manipulatesc cmds to eliminate or "Prune" the branched values
 // that should not be executed based on the condition in the stack.
-func (t *OP_IF) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_IF) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if len(*stack) < 1 {
-		return false
+		return SCRIPT_ERR_UNBALANCED_CONDITIONAL
 	}
 	trueItems := make(Stack, 0)
 	falseItems := make(Stack, 0)
@@ -447,15 +642,22 @@ func (t *OP_IF) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bo
 		}
 	}
 	if !found {
-		return false
+		return SCRIPT_ERR_UNBALANCED_CONDITIONAL
 	}
+	// Branches were collected in execution order, cmds is popped from the end
+	slices.Reverse(trueItems)
+	slices.Reverse(falseItems)
 	element := Pop(stack)
-	if element.Num() == 0 {
+	if ctx.sigVersion == SIGVERSION_WITNESS_V0 && ctx.flags.has(SCRIPT_VERIFY_MINIMALIF) && !isMinimalIf(element) {
+		return SCRIPT_ERR_MINIMALIF
+	}
+	ctx.enterBranch(castToBool(element), len(*cmds))
+	if !castToBool(element) {
 		*cmds = append(*cmds, falseItems...)
 	} else {
 		*cmds = append(*cmds, trueItems...)
 	}
-	return true
+	return nil
 }
 
 func (t *OP_IF) Num() int {
@@ -465,9 +667,9 @@ func (t *OP_IF) Num() int {
 type OP_NOTIF struct{}
 
 // Same as OP_IF, but switches the branches that are reinserted into cmds
-func (t *OP_NOTIF) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_NOTIF) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if len(*stack) < 1 {
-		return false
+		return SCRIPT_ERR_UNBALANCED_CONDITIONAL
 	}
 	trueItems := make(Stack, 0)
 	falseItems := make(Stack, 0)
@@ -495,29 +697,60 @@ func (t *OP_NOTIF) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack)
 		}
 	}
 	if !found {
-		return false
+		return SCRIPT_ERR_UNBALANCED_CONDITIONAL
 	}
+	slices.Reverse(trueItems)
+	slices.Reverse(falseItems)
 	element := Pop(stack)
-	if element.Num() == 0 {
+	if ctx.sigVersion == SIGVERSION_WITNESS_V0 && ctx.flags.has(SCRIPT_VERIFY_MINIMALIF) && !isMinimalIf(element) {
+		return SCRIPT_ERR_MINIMALIF
+	}
+	ctx.enterBranch(!castToBool(element), len(*cmds))
+	if !castToBool(element) {
 		*cmds = append(*cmds, trueItems...)
 	} else {
 		*cmds = append(*cmds, falseItems...)
 	}
-	return true
+	return nil
 }
 
 func (t *OP_NOTIF) Num() int {
 	return 100
 }
 
+// OP_ELSE and OP_ENDIF are consumed by OP_IF and OP_NOTIF,
+// reaching them means the conditional is unbalanced
+type OP_ELSE struct{}
+
+func (t *OP_ELSE) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	return SCRIPT_ERR_UNBALANCED_CONDITIONAL
+}
+
+func (t *OP_ELSE) Num() int {
+	return 103
+}
+
+type OP_ENDIF struct{}
+
+func (t *OP_ENDIF) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	return SCRIPT_ERR_UNBALANCED_CONDITIONAL
+}
+
+func (t *OP_ENDIF) Num() int {
+	return 104
+}
+
 type OP_VERIFY struct{}
 
-func (t *OP_VERIFY) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_VERIFY) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	element := Pop(stack)
-	return element.Num() != 0
+	if !castToBool(element) {
+		return SCRIPT_ERR_VERIFY
+	}
+	return nil
 }
 
 func (t *OP_VERIFY) Num() int {
@@ -526,8 +759,8 @@ func (t *OP_VERIFY) Num() int {
 
 type OP_RETURN struct{}
 
-func (t *OP_RETURN) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
-	return false
+func (t *OP_RETURN) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	return SCRIPT_ERR_OP_RETURN
 }
 
 func (t *OP_RETURN) Num() int {
@@ -536,12 +769,12 @@ func (t *OP_RETURN) Num() int {
 
 type OP_TOALTSTACK struct{}
 
-func (t *OP_TOALTSTACK) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
-	if Len(altstack) < 1 {
-		return false
+func (t *OP_TOALTSTACK) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	if Len(stack) < 1 {
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	Push(altstack, Pop(stack))
-	return true
+	return nil
 }
 
 func (t *OP_TOALTSTACK) Num() int {
@@ -550,12 +783,12 @@ func (t *OP_TOALTSTACK) Num() int {
 
 type OP_FROMALTSTACK struct{}
 
-func (t *OP_FROMALTSTACK) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_FROMALTSTACK) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(altstack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_ALTSTACK_OPERATION
 	}
 	Push(stack, Pop(altstack))
-	return true
+	return nil
 }
 
 func (t *OP_FROMALTSTACK) Num() int {
@@ -564,13 +797,13 @@ func (t *OP_FROMALTSTACK) Num() int {
 
 type OP_2DROP struct{}
 
-func (t *OP_2DROP) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_2DROP) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	Pop(stack)
 	Pop(stack)
-	return true
+	return nil
 }
 
 func (t *OP_2DROP) Num() int {
@@ -579,13 +812,13 @@ func (t *OP_2DROP) Num() int {
 
 type OP_2DUP struct{}
 
-func (t *OP_2DUP) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_2DUP) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	Push(stack, (*stack)[Len(stack)-2])
 	Push(stack, (*stack)[Len(stack)-2])
-	return true
+	return nil
 }
 
 func (t *OP_2DUP) Num() int {
@@ -594,14 +827,14 @@ func (t *OP_2DUP) Num() int {
 
 type OP_3DUP struct{}
 
-func (t *OP_3DUP) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_3DUP) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 3 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	Push(stack, (*stack)[Len(stack)-3])
 	Push(stack, (*stack)[Len(stack)-3])
 	Push(stack, (*stack)[Len(stack)-3])
-	return true
+	return nil
 }
 
 func (t *OP_3DUP) Num() int {
@@ -610,13 +843,13 @@ func (t *OP_3DUP) Num() int {
 
 type OP_2OVER struct{}
 
-func (t *OP_2OVER) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_2OVER) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 4 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	Push(stack, (*stack)[Len(stack)-4])
 	Push(stack, (*stack)[Len(stack)-4])
-	return true
+	return nil
 }
 
 func (t *OP_2OVER) Num() int {
@@ -625,13 +858,13 @@ func (t *OP_2OVER) Num() int {
 
 type OP_2ROT struct{}
 
-func (t *OP_2ROT) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_2ROT) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 6 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	Push(stack, (*stack)[Len(stack)-6])
 	Push(stack, (*stack)[Len(stack)-6])
-	return true
+	return nil
 }
 
 func (t *OP_2ROT) Num() int {
@@ -640,13 +873,13 @@ func (t *OP_2ROT) Num() int {
 
 type OP_2SWAP struct{}
 
-func (t *OP_2SWAP) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_2SWAP) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 4 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	last := Len(stack)
 	(*stack)[last-2], (*stack)[last-1], (*stack)[last-4], (*stack)[last-3] = (*stack)[last-4], (*stack)[last-3], (*stack)[last-2], (*stack)[last-1]
-	return true
+	return nil
 }
 
 func (t *OP_2SWAP) Num() int {
@@ -655,14 +888,14 @@ func (t *OP_2SWAP) Num() int {
 
 type OP_IFDUP struct{}
 
-func (t *OP_IFDUP) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_IFDUP) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
-	if (*stack)[Len(stack)-1].Num() != 0 {
+	if castToBool((*stack)[Len(stack)-1]) {
 		Push(stack, (*stack)[Len(stack)-1])
 	}
-	return true
+	return nil
 }
 
 func (t *OP_IFDUP) Num() int {
@@ -673,10 +906,10 @@ type OP_DEPTH struct{}
 
 // Define how I should take care of random
 // values (items of different length and how to process them)
-func (t *OP_DEPTH) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_DEPTH) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	val := encodeNum(FromInt(Len(stack)))
 	Push(stack, &ScriptVal{val})
-	return true
+	return nil
 }
 
 func (t *OP_DEPTH) Num() int {
@@ -685,12 +918,12 @@ func (t *OP_DEPTH) Num() int {
 
 type OP_DROP struct{}
 
-func (t *OP_DROP) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_DROP) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	Pop(stack)
-	return true
+	return nil
 }
 
 func (t *OP_DROP) Num() int {
@@ -699,12 +932,12 @@ func (t *OP_DROP) Num() int {
 
 type OP_DUP struct{}
 
-func (t *OP_DUP) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_DUP) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	Push(stack, (*stack)[Len(stack)-1])
-	return true
+	return nil
 }
 
 func (t *OP_DUP) Num() int {
@@ -713,15 +946,15 @@ func (t *OP_DUP) Num() int {
 
 type OP_NIP struct{}
 
-func (t *OP_NIP) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_NIP) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	first := Pop(stack)
 	//Drop the second value
 	Pop(stack)
 	Push(stack, first)
-	return true
+	return nil
 }
 
 func (t *OP_NIP) Num() int {
@@ -730,12 +963,12 @@ func (t *OP_NIP) Num() int {
 
 type OP_OVER struct{}
 
-func (t *OP_OVER) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_OVER) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	Push(stack, (*stack)[Len(stack)-2])
-	return true
+	return nil
 }
 
 func (t *OP_OVER) Num() int {
@@ -744,16 +977,19 @@ func (t *OP_OVER) Num() int {
 
 type OP_PICK struct{}
 
-func (t *OP_PICK) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_PICK) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	n, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	n := intoValue(Pop(stack))
-	if Len(stack) < n+1 {
-		return false
+	if n < 0 || Len(stack) < n+1 {
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	Push(stack, (*stack)[Len(stack)-(n+1)])
-	return true
+	return nil
 }
 
 func (t *OP_PICK) Num() int {
@@ -762,21 +998,24 @@ func (t *OP_PICK) Num() int {
 
 type OP_ROLL struct{}
 
-func (t *OP_ROLL) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_ROLL) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
-	n := intoValue(Pop(stack))
-	if Len(stack) < n+1 {
-		return false
+	n, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	if n < 0 || Len(stack) < n+1 {
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	if n == 0 {
-		return true
+		return nil
 	}
 	rolled := (*stack)[Len(stack)-(n+1)]
 	(*stack) = append((*stack)[:Len(stack)-(n+1)], (*stack)[Len(stack)-n:]...)
 	Push(stack, rolled)
-	return true
+	return nil
 }
 
 func (t *OP_ROLL) Num() int {
@@ -785,15 +1024,15 @@ func (t *OP_ROLL) Num() int {
 
 type OP_ROT struct{}
 
-func (t *OP_ROT) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_ROT) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 3 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	edge := Len(stack) - 3
 	rolled := (*stack)[edge]
 	(*stack) = append((*stack)[:edge], (*stack)[edge+1:]...)
 	Push(stack, rolled)
-	return true
+	return nil
 }
 
 func (t *OP_ROT) Num() int {
@@ -802,12 +1041,12 @@ func (t *OP_ROT) Num() int {
 
 type OP_SWAP struct{}
 
-func (t *OP_SWAP) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_SWAP) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	(*stack)[Len(stack)-2], (*stack)[Len(stack)-1] = (*stack)[Len(stack)-1], (*stack)[Len(stack)-2]
-	return true
+	return nil
 }
 
 func (t *OP_SWAP) Num() int {
@@ -816,13 +1055,13 @@ func (t *OP_SWAP) Num() int {
 
 type OP_TUCK struct{}
 
-func (t *OP_TUCK) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_TUCK) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	Push(stack, (*stack)[Len(stack)-1])
 	(*stack)[Len(stack)-3], (*stack)[Len(stack)-2] = (*stack)[Len(stack)-2], (*stack)[Len(stack)-3]
-	return true
+	return nil
 }
 
 func (t *OP_TUCK) Num() int {
@@ -831,9 +1070,9 @@ func (t *OP_TUCK) Num() int {
 
 type OP_SIZE struct{}
 
-func (t *OP_SIZE) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_SIZE) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	last := Pop(stack)
 	size := 1
@@ -847,7 +1086,7 @@ func (t *OP_SIZE) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack)
 	}
 	Push(stack, last)
 	Push(stack, val)
-	return true
+	return nil
 }
 
 func (t *OP_SIZE) Num() int {
@@ -856,26 +1095,22 @@ func (t *OP_SIZE) Num() int {
 
 type OP_EQUAL struct{}
 
-func (t *OP_EQUAL) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_EQUAL) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	first := Pop(stack)
 	second := Pop(stack)
-	valFirst, ok1 := first.(*ScriptVal)
-	valSecond, ok2 := second.(*ScriptVal)
-	trueVal := first.Num() == second.Num()
-	if ok1 && ok2 {
-		trueVal = decodeNum(valFirst.Val).Eq(decodeNum(valSecond.Val))
-	}
-	if trueVal {
-		//TODO: Should change it to get the value
-		//from the master table
-		Push(stack, &OP_1{})
+	if bytes.Equal(stackBytes(first), stackBytes(second)) {
+		Push(stack, &ScriptVal{
+			encodeNum(ONE),
+		})
 	} else {
-		Push(stack, &OP_2{})
+		Push(stack, &ScriptVal{
+			encodeNum(ZERO),
+		})
 	}
-	return true
+	return nil
 }
 
 func (t *OP_EQUAL) Num() int {
@@ -884,9 +1119,9 @@ func (t *OP_EQUAL) Num() int {
 
 type OP_EQUALVERIFY struct{}
 
-func (t *OP_EQUALVERIFY) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_EQUALVERIFY) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	first := Pop(stack)
 	second := Pop(stack)
@@ -897,7 +1132,10 @@ func (t *OP_EQUALVERIFY) Operate(z string, stack *Stack, altstack *Stack, cmds *
 		trueVal = decodeNum(valFirst.Val).Eq(decodeNum(valSecond.Val))
 	
 	}
-	return trueVal
+	if !trueVal {
+		return SCRIPT_ERR_EQUALVERIFY
+	}
+	return nil
 }
 
 func (t *OP_EQUALVERIFY) Num() int {
@@ -906,16 +1144,19 @@ func (t *OP_EQUALVERIFY) Num() int {
 
 type OP_1ADD struct{}
 
-func (t *OP_1ADD) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_1ADD) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element := intoValue(Pop(stack))
 	result := &ScriptVal{
 		encodeNum(FromInt(element + 1)),
 	}
 	Push(stack, result)
-	return true
+	return nil
 }
 
 func (t *OP_1ADD) Num() int {
@@ -924,16 +1165,19 @@ func (t *OP_1ADD) Num() int {
 
 type OP_1SUB struct{}
 
-func (t *OP_1SUB) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_1SUB) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element := intoValue(Pop(stack))
 	result := &ScriptVal{
 		encodeNum(FromInt(element - 1)),
 	}
 	Push(stack, result)
-	return true
+	return nil
 }
 
 func (t *OP_1SUB) Num() int {
@@ -942,16 +1186,19 @@ func (t *OP_1SUB) Num() int {
 
 type OP_NEGATE struct{}
 
-func (t *OP_NEGATE) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_NEGATE) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element := intoValue(Pop(stack))
 	result := &ScriptVal{
 		encodeNum(FromInt(-element)),
 	}
 	Push(stack, result)
-	return true
+	return nil
 }
 
 func (t *OP_NEGATE) Num() int {
@@ -960,18 +1207,21 @@ func (t *OP_NEGATE) Num() int {
 
 type OP_ABS struct{}
 
-func (t *OP_ABS) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_ABS) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element := intoValue(Pop(stack))
 	result := &ScriptVal{
 		encodeNum(FromInt(element)),
 	}
 	if element < 0 {
 		result.Val = encodeNum(FromInt(-element))
 	}
-	return true
+	return nil
 }
 
 func (t *OP_ABS) Num() int {
@@ -980,12 +1230,15 @@ func (t *OP_ABS) Num() int {
 
 type OP_NOT struct{}
 
-func (t *OP_NOT) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_NOT) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
-	element := Pop(stack)
-	if intoValue(element) == 0 {
+	element, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	if element == 0 {
 		Push(stack, &ScriptVal{
 			encodeNum(ONE),
 		})
@@ -994,7 +1247,7 @@ func (t *OP_NOT) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) b
 			encodeNum(ZERO),
 		})
 	}
-	return true
+	return nil
 }
 
 func (t *OP_NOT) Num() int {
@@ -1003,12 +1256,15 @@ func (t *OP_NOT) Num() int {
 
 type OP_0NOTEQUAL struct{}
 
-func (t *OP_0NOTEQUAL) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_0NOTEQUAL) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
-	element := Pop(stack)
-	if intoValue(element) == 0 {
+	element, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	if element == 0 {
 		Push(stack, &ScriptVal{
 			encodeNum(ZERO),
 		})
@@ -1017,7 +1273,7 @@ func (t *OP_0NOTEQUAL) Operate(z string, stack *Stack, altstack *Stack, cmds *St
 			encodeNum(ONE),
 		})
 	}
-	return true
+	return nil
 }
 func (t *OP_0NOTEQUAL) Num() int {
 	return 146
@@ -1025,16 +1281,22 @@ func (t *OP_0NOTEQUAL) Num() int {
 
 type OP_ADD struct{}
 
-func (t *OP_ADD) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_ADD) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element1, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	element2, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element1 := intoValue(Pop(stack))
-	element2 := intoValue(Pop(stack))
 	Push(stack, &ScriptVal{
 		encodeNum(FromInt(element1 + element2)),
 	})
-	return true
+	return nil
 }
 
 func (t *OP_ADD) Num() int {
@@ -1043,16 +1305,22 @@ func (t *OP_ADD) Num() int {
 
 type OP_SUB struct{}
 
-func (t *OP_SUB) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_SUB) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element1, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	element2, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element1 := intoValue(Pop(stack))
-	element2 := intoValue(Pop(stack))
 	Push(stack, &ScriptVal{
 		encodeNum(FromInt(element2 - element1)),
 	})
-	return true
+	return nil
 }
 
 func (t *OP_SUB) Num() int {
@@ -1061,16 +1329,22 @@ func (t *OP_SUB) Num() int {
 
 type OP_MUL struct{}
 
-func (t *OP_MUL) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_MUL) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element1, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	element2, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element1 := intoValue(Pop(stack))
-	element2 := intoValue(Pop(stack))
 	Push(stack, &ScriptVal{
 		encodeNum(FromInt(element2 * element1)),
 	})
-	return true
+	return nil
 }
 
 func (t *OP_MUL) Num() int {
@@ -1079,12 +1353,18 @@ func (t *OP_MUL) Num() int {
 
 type OP_BOOLAND struct{}
 
-func (t *OP_BOOLAND) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_BOOLAND) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element1, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	element2, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element1 := intoValue(Pop(stack))
-	element2 := intoValue(Pop(stack))
 	if element1+element2 >= 2 {
 		Push(stack, &ScriptVal{
 			encodeNum(ONE),
@@ -1094,7 +1374,7 @@ func (t *OP_BOOLAND) Operate(z string, stack *Stack, altstack *Stack, cmds *Stac
 			encodeNum(ZERO),
 		})
 	}
-	return true
+	return nil
 }
 
 func (t *OP_BOOLAND) Num() int {
@@ -1103,13 +1383,19 @@ func (t *OP_BOOLAND) Num() int {
 
 type OP_BOOLOR struct{}
 
-func (t *OP_BOOLOR) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_BOOLOR) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 
-	element1 := intoValue(Pop(stack))
-	element2 := intoValue(Pop(stack))
+	element1, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	element2, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
 	if element1+element2 > 0 {
 		Push(stack, &ScriptVal{
 			encodeNum(ONE),
@@ -1119,7 +1405,7 @@ func (t *OP_BOOLOR) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack
 			encodeNum(ZERO),
 		})
 	}
-	return true
+	return nil
 }
 
 func (t *OP_BOOLOR) Num() int {
@@ -1128,12 +1414,18 @@ func (t *OP_BOOLOR) Num() int {
 
 type OP_NUMEQUAL struct{}
 
-func (t *OP_NUMEQUAL) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_NUMEQUAL) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element1, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	element2, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element1 := intoValue(Pop(stack))
-	element2 := intoValue(Pop(stack))
 	if element1 == element2 {
 		Push(stack, &ScriptVal{
 			encodeNum(ONE),
@@ -1143,7 +1435,7 @@ func (t *OP_NUMEQUAL) Operate(z string, stack *Stack, altstack *Stack, cmds *Sta
 			encodeNum(ZERO),
 		})
 	}
-	return true
+	return nil
 }
 
 func (t *OP_NUMEQUAL) Num() int {
@@ -1152,10 +1444,8 @@ func (t *OP_NUMEQUAL) Num() int {
 
 type OP_NUMEQUALVERIFY struct{}
 
-func (t *OP_NUMEQUALVERIFY) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
-	equal := &OP_NUMEQUAL{}
-	verify := &OP_VERIFY{}
-	return equal.Operate(z, stack, altstack, cmds) && verify.Operate(z, stack, altstack, cmds)
+func (t *OP_NUMEQUALVERIFY) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	return operateVerify(ctx, &OP_NUMEQUAL{}, SCRIPT_ERR_NUMEQUALVERIFY, stack, altstack, cmds)
 }
 
 func (t *OP_NUMEQUALVERIFY) Num() int {
@@ -1164,12 +1454,18 @@ func (t *OP_NUMEQUALVERIFY) Num() int {
 
 type OP_NUMNOTEQUAL struct{}
 
-func (t *OP_NUMNOTEQUAL) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_NUMNOTEQUAL) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element1, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	element2, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element1 := intoValue(Pop(stack))
-	element2 := intoValue(Pop(stack))
 	if element1 == element2 {
 		Push(stack, &ScriptVal{
 			encodeNum(ZERO),
@@ -1179,7 +1475,7 @@ func (t *OP_NUMNOTEQUAL) Operate(z string, stack *Stack, altstack *Stack, cmds *
 			encodeNum(ONE),
 		})
 	}
-	return true
+	return nil
 }
 
 func (t *OP_NUMNOTEQUAL) Num() int {
@@ -1188,12 +1484,18 @@ func (t *OP_NUMNOTEQUAL) Num() int {
 
 type OP_LESSTHAN struct{}
 
-func (t *OP_LESSTHAN) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_LESSTHAN) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element1, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	element2, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element1 := intoValue(Pop(stack))
-	element2 := intoValue(Pop(stack))
 	if element2 < element1 {
 		Push(stack, &ScriptVal{
 			encodeNum(ONE),
@@ -1203,7 +1505,7 @@ func (t *OP_LESSTHAN) Operate(z string, stack *Stack, altstack *Stack, cmds *Sta
 			encodeNum(ZERO),
 		})
 	}
-	return true
+	return nil
 }
 
 func (t *OP_LESSTHAN) Num() int {
@@ -1212,12 +1514,18 @@ func (t *OP_LESSTHAN) Num() int {
 
 type OP_GREATERTHAN struct{}
 
-func (t *OP_GREATERTHAN) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_GREATERTHAN) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element1, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	element2, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element1 := intoValue(Pop(stack))
-	element2 := intoValue(Pop(stack))
 	if element2 > element1 {
 		Push(stack, &ScriptVal{
 			encodeNum(ONE),
@@ -1227,7 +1535,7 @@ func (t *OP_GREATERTHAN) Operate(z string, stack *Stack, altstack *Stack, cmds *
 			encodeNum(ZERO),
 		})
 	}
-	return true
+	return nil
 }
 
 func (t *OP_GREATERTHAN) Num() int {
@@ -1236,12 +1544,18 @@ func (t *OP_GREATERTHAN) Num() int {
 
 type OP_LESSTHANOREQUAL struct{}
 
-func (t *OP_LESSTHANOREQUAL) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_LESSTHANOREQUAL) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element1, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	element2, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element1 := intoValue(Pop(stack))
-	element2 := intoValue(Pop(stack))
 	if element2 <= element1 {
 		Push(stack, &ScriptVal{
 			encodeNum(ONE),
@@ -1251,7 +1565,7 @@ func (t *OP_LESSTHANOREQUAL) Operate(z string, stack *Stack, altstack *Stack, cm
 			encodeNum(ZERO),
 		})
 	}
-	return true
+	return nil
 }
 
 func (t *OP_LESSTHANOREQUAL) Num() int {
@@ -1260,12 +1574,18 @@ func (t *OP_LESSTHANOREQUAL) Num() int {
 
 type OP_GREATERTHANOREQUAL struct{}
 
-func (t *OP_GREATERTHANOREQUAL) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_GREATERTHANOREQUAL) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element1, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	element2, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element1 := intoValue(Pop(stack))
-	element2 := intoValue(Pop(stack))
 	if element2 >= element1 {
 		Push(stack, &ScriptVal{
 			encodeNum(ONE),
@@ -1275,7 +1595,7 @@ func (t *OP_GREATERTHANOREQUAL) Operate(z string, stack *Stack, altstack *Stack,
 			encodeNum(ZERO),
 		})
 	}
-	return true
+	return nil
 }
 
 func (t *OP_GREATERTHANOREQUAL) Num() int {
@@ -1284,12 +1604,18 @@ func (t *OP_GREATERTHANOREQUAL) Num() int {
 
 type OP_MIN struct{}
 
-func (t *OP_MIN) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_MIN) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element1, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	element2, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element1 := intoValue(Pop(stack))
-	element2 := intoValue(Pop(stack))
 	if element1 < element2 {
 		Push(stack, &ScriptVal{
 			encodeNum(FromInt(element1)),
@@ -1299,7 +1625,7 @@ func (t *OP_MIN) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) b
 			encodeNum(FromInt(element2)),
 		})
 	}
-	return true
+	return nil
 }
 
 func (t *OP_MIN) Num() int {
@@ -1308,12 +1634,18 @@ func (t *OP_MIN) Num() int {
 
 type OP_MAX struct{}
 
-func (t *OP_MAX) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_MAX) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	element1, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	element2, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	element1 := intoValue(Pop(stack))
-	element2 := intoValue(Pop(stack))
 	if element1 > element2 {
 		Push(stack, &ScriptVal{
 			encodeNum(FromInt(element1)),
@@ -1323,7 +1655,7 @@ func (t *OP_MAX) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) b
 			encodeNum(FromInt(element2)),
 		})
 	}
-	return true
+	return nil
 }
 
 func (t *OP_MAX) Num() int {
@@ -1332,13 +1664,22 @@ func (t *OP_MAX) Num() int {
 
 type OP_WITHIN struct{}
 
-func (t *OP_WITHIN) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_WITHIN) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 3 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	maximum, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	minimum, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	element, err := popNum(ctx, stack)
+	if err != nil {
+		return err
 	}
-	maximum := intoValue(Pop(stack))
-	minimum := intoValue(Pop(stack))
-	element := intoValue(Pop(stack))
 	if element < maximum && element >= minimum {
 		Push(stack, &ScriptVal{
 			encodeNum(ONE),
@@ -1348,7 +1689,7 @@ func (t *OP_WITHIN) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack
 			encodeNum(ZERO),
 		})
 	}
-	return true
+	return nil
 }
 
 func (t *OP_WITHIN) Num() int {
@@ -1357,9 +1698,9 @@ func (t *OP_WITHIN) Num() int {
 
 type OP_RIPEMD160 struct{}
 
-func (t *OP_RIPEMD160) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_RIPEMD160) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	element := Pop(stack)
 	val, ok := element.(*ScriptVal)
@@ -1372,7 +1713,7 @@ func (t *OP_RIPEMD160) Operate(z string, stack *Stack, altstack *Stack, cmds *St
 	Push(stack, &ScriptVal{
 		hashed,
 	})
-	return true
+	return nil
 }
 
 func (t *OP_RIPEMD160) Num() int {
@@ -1381,9 +1722,9 @@ func (t *OP_RIPEMD160) Num() int {
 
 type OP_SHA1 struct{}
 
-func (t *OP_SHA1) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_SHA1) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	element := Pop(stack)
 	val, ok := element.(*ScriptVal)
@@ -1397,7 +1738,7 @@ func (t *OP_SHA1) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack)
 	Push(stack, &ScriptVal{
 		sha.Sum(nil),
 	})
-	return true
+	return nil
 }
 
 func (t *OP_SHA1) Num() int {
@@ -1406,9 +1747,9 @@ func (t *OP_SHA1) Num() int {
 
 type OP_SHA256 struct{}
 
-func (t *OP_SHA256) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_SHA256) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	element := Pop(stack)
 	val, ok := element.(*ScriptVal)
@@ -1422,7 +1763,7 @@ func (t *OP_SHA256) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack
 	Push(stack, &ScriptVal{
 		sha.Sum(nil),
 	})
-	return true
+	return nil
 }
 
 func (t *OP_SHA256) Num() int {
@@ -1431,9 +1772,9 @@ func (t *OP_SHA256) Num() int {
 
 type OP_HASH160 struct{}
 
-func (t *OP_HASH160) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_HASH160) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	element := Pop(stack)
 	val, ok := element.(*ScriptVal)
@@ -1445,7 +1786,7 @@ func (t *OP_HASH160) Operate(z string, stack *Stack, altstack *Stack, cmds *Stac
 	Push(stack, &ScriptVal{
 		Hash160(val.Val),
 	})
-	return true
+	return nil
 }
 
 func (t *OP_HASH160) Num() int {
@@ -1454,9 +1795,9 @@ func (t *OP_HASH160) Num() int {
 
 type OP_HASH256 struct{}
 
-func (t *OP_HASH256) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_HASH256) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
 	element := Pop(stack)
 	val, ok := element.(*ScriptVal)
@@ -1468,35 +1809,84 @@ func (t *OP_HASH256) Operate(z string, stack *Stack, altstack *Stack, cmds *Stac
 	Push(stack, &ScriptVal{
 		Hash256(val.Val),
 	})
-	return true
+	return nil
 }
 
 func (t *OP_HASH256) Num() int {
 	return 170
 }
 
+// Signatures commit to the script after the last OP_CODESEPARATOR
+// executed. position is its index among the operations of its script
+type OP_CODESEPARATOR struct {
+	position int
+}
+
+func (t *OP_CODESEPARATOR) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	if ctx.codeSeparators[t] {
+		ctx.separator = t.position + 1
+		clear(ctx.sighashes)
+	}
+	return nil
+}
+
+func (t *OP_CODESEPARATOR) Num() int {
+	return 171
+}
+
+// Operation of the opcode at position in its script, which is a new
+// one for OP_CODESEPARATOR to know where it is
+func opcodeOperation(opcode int, position int) Operation {
+	if opcode == 171 {
+		return &OP_CODESEPARATOR{position}
+	}
+	if op := OP_CODE_FUNCTIONS[opcode]; op != nil {
+		return op
+	}
+	// Fails when executed
+	return &UNDEFINED{opcode}
+}
+
+// In tapscript it checks Schnorr signatures against x-only public keys
 type OP_CHECKSIG struct{}
 
-func (t *OP_CHECKSIG) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_CHECKSIG) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 2 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
-	secOP := Pop(stack)
-	derOP := Pop(stack)
-	sec, okSEC := secOP.(*ScriptVal)
-	der, okDER := derOP.(*ScriptVal)
-	if !(okDER && okSEC) {
-		return false
+	if ctx.sigVersion == SIGVERSION_TAPSCRIPT {
+		return tapscriptCheckSig(ctx, stack)
 	}
-	secP, err := ParseFromSec(sec.Val)
+	// Empty signatures can be pushed with OP_0
+	sec := stackBytes(Pop(stack))
+	der := stackBytes(Pop(stack))
+	valid, err := ctx.checkSig(der, sec)
 	if err != nil {
-		return false
+		return err
 	}
-	sign, err := ParseFromDer(secP, der.Val[:len(der.Val)-1])
+	if !valid && len(der) > 0 && ctx.flags.has(SCRIPT_VERIFY_NULLFAIL) {
+		return SCRIPT_ERR_SIG_NULLFAIL
+	}
+	if valid {
+		Push(stack, &ScriptVal{
+			encodeNum(ONE),
+		})
+	} else {
+		Push(stack, &ScriptVal{
+			encodeNum(ZERO),
+		})
+	}
+	return nil
+}
+
+func tapscriptCheckSig(ctx *ExecutionContext, stack *Stack) error {
+	pubkey := stackBytes(Pop(stack))
+	sig := stackBytes(Pop(stack))
+	valid, err := ctx.checkSchnorrSig(sig, pubkey)
 	if err != nil {
-		return false
+		return err
 	}
-	if sign.Verify(FromHexString("0x" + z)) {
+	if valid {
 		Push(stack, &ScriptVal{
 			encodeNum(ONE),
 		})
@@ -1505,7 +1895,7 @@ func (t *OP_CHECKSIG) Operate(z string, stack *Stack, altstack *Stack, cmds *Sta
 			encodeNum(ZERO),
 		})
 	}
-	return true
+	return nil
 }
 
 func (t *OP_CHECKSIG) Num() int {
@@ -1514,82 +1904,105 @@ func (t *OP_CHECKSIG) Num() int {
 
 type OP_CHECKSIGVERIFY struct{}
 
-func (t *OP_CHECKSIGVERIFY) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
-	check := &OP_CHECKSIG{}
-	verify := &OP_VERIFY{}
-	return check.Operate(z, stack, altstack, cmds) && verify.Operate(z, stack, altstack, cmds)
+func (t *OP_CHECKSIGVERIFY) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	return operateVerify(ctx, &OP_CHECKSIG{}, SCRIPT_ERR_CHECKSIGVERIFY, stack, altstack, cmds)
 }
 
 func (t *OP_CHECKSIGVERIFY) Num() int {
 	return 173
 }
 
+// Most public keys OP_CHECKMULTISIG checks
+const MAX_PUBKEYS_PER_MULTISIG = 20
+
 type OP_CHECKMULTISIG struct{}
 
-func (t *OP_CHECKMULTISIG) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
+func (t *OP_CHECKMULTISIG) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
 	if Len(stack) < 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	n, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > MAX_PUBKEYS_PER_MULTISIG {
+		return SCRIPT_ERR_PUBKEY_COUNT
 	}
-	val := Pop(stack)
-	n := intoValue(val)
 	if Len(stack) < n + 1{
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
-	pubkeys := []Point{}
+	pubkeys := [][]byte{}
 	for range n {
-		pubkey, ok := Pop(stack).(*ScriptVal)
-		if !ok {
-			return false
-		}
-		point, err := ParseFromSec(pubkey.Val)
-		if err != nil {
-			fmt.Printf("Failed to parse Sec value with error: %s", err)
-			return false
-		}
-		pubkeys = append(pubkeys, point)
+		// Public keys that can't be parsed fail their signature check
+		pubkeys = append(pubkeys, stackBytes(Pop(stack)))
+	}
+	m, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	if m < 0 || m > n {
+		return SCRIPT_ERR_SIG_COUNT
 	}
-	m := intoValue(Pop(stack))
 	if Len(stack) < m + 1 {
-		return false
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
 	}
-	signatures := []*ScriptVal{}
+	signatures := [][]byte{}
 	for range m {
-		signature, ok := Pop(stack).(*ScriptVal)
-		if !ok {
-			return false
-		}
-		signatures = append(signatures, signature)
+		signatures = append(signatures, stackBytes(Pop(stack)))
+	}
+	//Popping out the OP_0 value, which has to be empty under NULLDUMMY
+	dummy := Pop(stack)
+	if ctx.flags.has(SCRIPT_VERIFY_NULLDUMMY) && len(stackBytes(dummy)) != 0 {
+		return SCRIPT_ERR_SIG_NULLDUMMY
 	}
-	//Popping out the OP_0 value
-	Pop(stack)
 	//Now I need to verify the signarutes agains the pubkeys
-	if multisigcheck(z, signatures, pubkeys) {
+	valid, err := multisigcheck(ctx, signatures, pubkeys)
+	if err != nil {
+		return err
+	}
+	if valid {
 		Push(stack, &OP_1{})
 	}else {
+		if ctx.flags.has(SCRIPT_VERIFY_NULLFAIL) {
+			for _, signature := range signatures {
+				if len(signature) > 0 {
+					return SCRIPT_ERR_SIG_NULLFAIL
+				}
+			}
+		}
 		Push(stack, &OP_0{})
 	}
-	return true
+	return nil
 }
 
-func multisigcheck(z string, signatures []*ScriptVal, pubkeys []Point) bool {
-	
+// Runs the check followed by OP_VERIFY, failing with code when the
+// check leaves false
+func operateVerify(ctx *ExecutionContext, check Operation, code ScriptErrorCode, stack *Stack, altstack *Stack, cmds *Stack) error {
+	if err := check.Operate(ctx, stack, altstack, cmds); err != nil {
+		return err
+	}
+	if !castToBool(Pop(stack)) {
+		return code
+	}
+	return nil
+}
+
+func multisigcheck(ctx *ExecutionContext, signatures [][]byte, pubkeys [][]byte) (bool, error) {
 	actualSig := 0
 	actualPubKey := 0
-	for actualSig < len(signatures) && actualPubKey < len(pubkeys) {
-		sig := signatures[actualSig].Val
-		copied := make([]byte, len(sig))
-		copy(copied, sig)
-		der, err := ParseFromDer(pubkeys[actualPubKey], copied[:len(copied)-1])
+	// Stops once the keys left can't match the signatures left, before
+	// checking the encoding of the next ones
+	for actualSig < len(signatures) && len(signatures)-actualSig <= len(pubkeys)-actualPubKey {
+		valid, err := ctx.checkSigOf(signatures[actualSig], pubkeys[actualPubKey], signatures)
 		if err != nil {
-			fmt.Printf("Failed to parse der signature at index %d with error: %s", actualSig, err)
-			return false
-		} 
-		if der.Verify(FromHexString("0x"+z)) {
+			return false, err
+		}
+		if valid {
 			actualSig++
 		}
 		actualPubKey++
 	}
-	return actualSig == len(signatures)
+	return actualSig == len(signatures), nil
 }
 
 func (t *OP_CHECKMULTISIG) Num() int {
@@ -1598,32 +2011,61 @@ func (t *OP_CHECKMULTISIG) Num() int {
 
 type OP_CHECKMULTISIGVERIFY struct{}
 
-func (t *OP_CHECKMULTISIGVERIFY) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
-	check := &OP_CHECKMULTISIG{}
-	verify := &OP_VERIFY{}
-	return check.Operate(z, stack, altstack, cmds) && verify.Operate(z, stack, altstack, cmds)
+func (t *OP_CHECKMULTISIGVERIFY) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	return operateVerify(ctx, &OP_CHECKMULTISIG{}, SCRIPT_ERR_CHECKMULTISIGVERIFY, stack, altstack, cmds)
 }
 
 func (t *OP_CHECKMULTISIGVERIFY) Num() int {
 	return 175
 }
 
+// Without its flag it is the upgradable OP_NOP2, and without a
+// transaction, as in a digest context, there is nothing to check
 type OP_CHECKLOCKTIMEVERIFY struct{}
 
-func (t *OP_CHECKLOCKTIMEVERIFY) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
-	//TODO: Check how to implement this
-	return true
+func (t *OP_CHECKLOCKTIMEVERIFY) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	if !ctx.flags.has(SCRIPT_VERIFY_CHECKLOCKTIMEVERIFY) {
+		return (&UPGRADABLE_NOP{}).Operate(ctx, stack, altstack, cmds)
+	}
+	if ctx.tx == nil {
+		return nil
+	}
+	locktime, err := topLocktime(ctx, stack)
+	if err != nil {
+		return err
+	}
+	if !ctx.checkLockTime(locktime) {
+		return SCRIPT_ERR_UNSATISFIED_LOCKTIME
+	}
+	return nil
 }
 
 func (t *OP_CHECKLOCKTIMEVERIFY) Num() int {
 	return 177
 }
 
+// Without its flag it is the upgradable OP_NOP3, like OP_CHECKLOCKTIMEVERIFY
 type OP_CHECKSEQUENCEVERIFY struct{}
 
-func (t *OP_CHECKSEQUENCEVERIFY) Operate(z string, stack *Stack, altstack *Stack, cmds *Stack) bool {
-	//TODO: Check how to implement this
-	return true
+func (t *OP_CHECKSEQUENCEVERIFY) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	if !ctx.flags.has(SCRIPT_VERIFY_CHECKSEQUENCEVERIFY) {
+		return (&UPGRADABLE_NOP{}).Operate(ctx, stack, altstack, cmds)
+	}
+	if ctx.tx == nil {
+		return nil
+	}
+	sequence, err := topLocktime(ctx, stack)
+	if err != nil {
+		return err
+	}
+	// A sequence with the disable flag set keeps the NOP behaviour
+	if sequence&SEQUENCE_LOCKTIME_DISABLE_FLAG != 0 {
+		return nil
+	}
+	if !ctx.checkSequence(sequence) {
+		return SCRIPT_ERR_UNSATISFIED_LOCKTIME
+	}
+	return nil
 }
 
 func (t *OP_CHECKSEQUENCEVERIFY) Num() int {
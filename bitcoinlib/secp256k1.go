@@ -40,6 +40,17 @@ func Hash160(from []byte) []byte {
   return ripe.Sum(nil)
 }
 
+func Ripemd160(from []byte) []byte {
+  ripe := ripemd160.New()
+  ripe.Write(from)
+  return ripe.Sum(nil)
+}
+
+func Sha256(from []byte) []byte {
+  hashed := sha256.Sum256(from)
+  return hashed[:]
+}
+
 func Hash256(from []byte) []byte {
   first_round := sha256.Sum256(from)
   second_round := sha256.Sum256(first_round[:])
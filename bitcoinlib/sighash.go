@@ -0,0 +1,7 @@
+package bitcoinlib
+
+// Sighash types that can be used to sign legacy and segwit v0 inputs
+func validSigHashType(hashType SigHashType) bool {
+	base := hashType &^ SIGHASH_ANYONECANPAY
+	return base >= SIGHASH_ALL && base <= SIGHASH_SINGLE
+}
@@ -0,0 +1,219 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+var sigHashTypes = []bitcoinlib.SigHashType{
+	bitcoinlib.SIGHASH_ALL,
+	bitcoinlib.SIGHASH_NONE,
+	bitcoinlib.SIGHASH_SINGLE,
+	bitcoinlib.SIGHASH_ALL | bitcoinlib.SIGHASH_ANYONECANPAY,
+	bitcoinlib.SIGHASH_NONE | bitcoinlib.SIGHASH_ANYONECANPAY,
+	bitcoinlib.SIGHASH_SINGLE | bitcoinlib.SIGHASH_ANYONECANPAY,
+}
+
+// Funds a P2PKH and a P2WPKH output of the key
+func sigHashFunding(key *bitcoinlib.PrivateKey) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+	hash := bitcoinlib.Hash160(key.Sec(bitcoinlib.COMPRESSED))
+	funding := bitcoinlib.NewTransaction()
+	funding.AddInput(strings.Repeat("66", 32), 0)
+	funding.AddOutputScript(50000, bitcoinlib.P2PKHScript(hash))
+	funding.AddOutputScript(50000, bitcoinlib.P2WPKHPubKey(hash))
+	provider := bitcoinlib.NewMemoryProvider()
+	provider.AddTransaction(funding)
+	return funding, provider
+}
+
+// Builds a transaction spending the funding outputs, and a third
+// outpoint when there are three sequences
+func sigHashSpend(t *testing.T, funding *bitcoinlib.Transaction, amounts []uint64, sequences []uint32) *bitcoinlib.Transaction {
+	psbt := bitcoinlib.NewPsbtV2(2, 0)
+	for index, sequence := range sequences {
+		in := bitcoinlib.NewPsbtInput(funding.Id(), uint32(index))
+		if index == 2 {
+			in = bitcoinlib.NewPsbtInput(strings.Repeat("77", 32), 0)
+		}
+		in.Sequence = sequence
+		psbt.AddInput(in)
+	}
+	for _, amount := range amounts {
+		psbt.AddOutput(bitcoinlib.NewPsbtOutput(amount, bitcoinlib.P2PKHScript(make([]byte, 20))))
+	}
+	tx, err := psbt.UnsignedTx()
+	if err != nil {
+		t.Fatalf("Failed building transaction: %s", err)
+	}
+	return tx
+}
+
+// Input 0 uses the legacy digest and input 1 the BIP143 one
+func sigHashDigest(t *testing.T, tx *bitcoinlib.Transaction, provider bitcoinlib.PrevoutProvider, input int, hashType bitcoinlib.SigHashType) string {
+	var hash []byte
+	var err error
+	if input == 0 {
+		hash, err = tx.SigHashWithType(input, provider, false, hashType)
+	} else {
+		hash, err = tx.SigHashBIP143WithType(input, provider, false, hashType)
+	}
+	if err != nil {
+		t.Fatalf("Failed computing sighash %x of input %d: %s", hashType, input, err)
+	}
+	return hex.EncodeToString(hash)
+}
+
+func TestSigHashTypesCommitments(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(5001))
+	funding, provider := sigHashFunding(key)
+	all := bitcoinlib.SIGHASH_ALL
+	none := bitcoinlib.SIGHASH_NONE
+	single := bitcoinlib.SIGHASH_SINGLE
+	acp := bitcoinlib.SIGHASH_ANYONECANPAY
+	base := sigHashSpend(t, funding, []uint64{1000, 2000}, []uint32{0xffffffff, 0xffffffff})
+
+	// Sighash types of each input whose digest is not affected by the change
+	vectors := []struct {
+		name      string
+		amounts   []uint64
+		sequences []uint32
+		same      [2][]bitcoinlib.SigHashType
+	}{
+		{
+			"second output changed",
+			[]uint64{1000, 3000},
+			[]uint32{0xffffffff, 0xffffffff},
+			[2][]bitcoinlib.SigHashType{{none, single, none | acp, single | acp}, {none, none | acp}},
+		},
+		{
+			"input appended",
+			[]uint64{1000, 2000},
+			[]uint32{0xffffffff, 0xffffffff, 0xffffffff},
+			[2][]bitcoinlib.SigHashType{{all | acp, none | acp, single | acp}, {all | acp, none | acp, single | acp}},
+		},
+		{
+			"second sequence changed",
+			[]uint64{1000, 2000},
+			[]uint32{0xffffffff, 0xfffffffd},
+			[2][]bitcoinlib.SigHashType{{none, single, all | acp, none | acp, single | acp}, {}},
+		},
+	}
+	for _, vector := range vectors {
+		changed := sigHashSpend(t, funding, vector.amounts, vector.sequences)
+		for input := range 2 {
+			for _, hashType := range sigHashTypes {
+				expected := false
+				for _, same := range vector.same[input] {
+					expected = expected || same == hashType
+				}
+				got := sigHashDigest(t, base, provider, input, hashType) == sigHashDigest(t, changed, provider, input, hashType)
+				if got != expected {
+					t.Fatalf("Failed at %s, input %d, sighash %x\nExpected => %t\nGot => %t", vector.name, input, hashType, expected, got)
+				}
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for input := range 2 {
+		for _, hashType := range sigHashTypes {
+			seen[sigHashDigest(t, base, provider, input, hashType)] = true
+		}
+	}
+	if len(seen) != 2*len(sigHashTypes) {
+		t.Fatal("Different sighash types produced the same hash")
+	}
+
+	// SIGHASH_SINGLE without a matching output signs the number one
+	extra := sigHashSpend(t, funding, []uint64{1000}, []uint32{0xffffffff, 0xffffffff, 0xffffffff})
+	provider.Add(strings.Repeat("77", 32), 0, bitcoinlib.NewOutput(50000, bitcoinlib.P2PKHScript(bitcoinlib.Hash160(key.Sec(bitcoinlib.COMPRESSED)))))
+	expected := "01" + strings.Repeat("00", 31)
+	for _, hashType := range []bitcoinlib.SigHashType{single, single | acp} {
+		hash, err := extra.SigHashWithType(2, provider, false, hashType)
+		if err != nil || hex.EncodeToString(hash) != expected {
+			t.Fatalf("Expected => %s\nGot => %x (%v)", expected, hash, err)
+		}
+	}
+}
+
+func TestSigHashTypesSigning(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(5002))
+	funding, provider := sigHashFunding(key)
+	for _, hashType := range sigHashTypes {
+		unsigned := sigHashSpend(t, funding, []uint64{1000, 2000}, []uint32{0xffffffff, 0xffffffff})
+		psbt, _ := bitcoinlib.NewPsbt(unsigned)
+		psbt.AddNonWitnessUtxo(0, funding)
+		psbt.AddWitnessUtxo(1, bitcoinlib.NewOutput(50000, bitcoinlib.P2WPKHPubKey(bitcoinlib.Hash160(key.Sec(bitcoinlib.COMPRESSED)))))
+		for _, in := range psbt.Inputs {
+			in.SigHashType = hashType
+		}
+		if err := psbt.Sign(key); err != nil {
+			t.Fatalf("Failed signing with sighash %x: %s", hashType, err)
+		}
+		if err := psbt.Finalize(); err != nil {
+			t.Fatalf("Failed finalizing with sighash %x: %s", hashType, err)
+		}
+		tx, _ := psbt.Extract()
+		parsed, _ := bitcoinlib.ParseTransaction(bytes.NewReader(tx.Serialize()))
+		if !parsed.Verify(provider) {
+			t.Fatalf("Failed verifying sighash %x", hashType)
+		}
+
+		// Outputs appended after the signed ones are only allowed
+		// when the signatures do not commit to every output
+		tx.AddOutputScript(500, bitcoinlib.P2PKHScript(make([]byte, 20)))
+		expected := hashType&^bitcoinlib.SIGHASH_ANYONECANPAY != bitcoinlib.SIGHASH_ALL
+		for input := range 2 {
+			if tx.VerifyInput(input, provider) != expected {
+				t.Fatalf("Failed at input %d with sighash %x\nExpected => %t\nGot => %t", input, hashType, expected, !expected)
+			}
+		}
+	}
+
+	tx := sigHashSpend(t, funding, []uint64{1000}, []uint32{0xffffffff})
+	if err := tx.SignInputWithType(0, provider, key, bitcoinlib.SIGHASH_NONE); err != nil {
+		t.Fatalf("Failed signing: %s", err)
+	}
+	if !tx.VerifyInput(0, provider) {
+		t.Fatal("Failed verifying SIGHASH_NONE signature")
+	}
+	if err := tx.SignInputWithType(0, provider, key, 0x04); err == nil {
+		t.Fatal("Signed with invalid sighash type")
+	}
+}
+
+// Bitcoin Core's sighash.json, with the legacy digest of SIGHASH_SINGLE
+// without a matching output appended
+func TestLegacySigHashVectors(t *testing.T) {
+	file, err := os.Open("testdata/sighash.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	tests, err := bitcoinlib.ParseSigHashTests(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests) == 0 {
+		t.Fatal("No sighash vectors")
+	}
+	tests = append(tests, &bitcoinlib.SigHashTest{
+		Tx:       "907c2bc503ade11cc3b04eb2918b6f547b0630ab569273824748c87ea14b0696526c66ba740200000004ab65ababfd1f9bdd4ef073c7afc4ae00da8a66f429c917a0081ad1e1dabce28d373eab81d8628de802000000096aab5253ab52000052ad042b5f25efb33beec9f3364e8a9139e8439d9d7e26529c3c30b6c3fd89f8684cfd68ea0200000009ab53526500636a52ab599ac2fe02a526ed040000000008535300516352515164370e010000000003006300ab2ec229",
+		Script:   "",
+		Input:    2,
+		HashType: bitcoinlib.SIGHASH_SINGLE,
+		Expected: strings.Repeat("00", 31) + "01",
+	})
+	for index, test := range tests {
+		t.Run(fmt.Sprintf("sighash.json:%d", index), func(t *testing.T) {
+			if err := test.Run(); err != nil {
+				t.Fatalf("Failed at index %d with error: %s", index, err)
+			}
+		})
+	}
+}
@@ -1,11 +1,13 @@
 package bitcoinlib
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math/big"
 	"strings"
 )
 
@@ -62,32 +64,26 @@ func FromBase58Address(str string) string{
 	return hex.EncodeToString(address[1:])
 }
 
-func H160P2PKHAddress(hash []byte, testnet bool) string {
-	prefix := []byte{0x00}
-	if testnet {
-		prefix[0] = 0x6f
-	}
+func H160P2PKHAddress(hash []byte, params *ChainParams) string {
+	prefix := []byte{params.P2PKHPrefix}
 	total := append(prefix, hash...)
 	checksum := Hash256(total)[:4]
 	total = append(total,checksum...)
 	return IntoBase58(hex.EncodeToString(total))
 }
 
-func H160P2SHAddress(hash []byte, testnet bool) string {
-	prefix := []byte{0x05}
-	if testnet {
-		prefix[0] = 0xc4
-	}
+func H160P2SHAddress(hash []byte, params *ChainParams) string {
+	prefix := []byte{params.P2SHPrefix}
 	total := append(prefix, hash...)
 	checksum := Hash256(total)[:4]
 	total = append(total, checksum...)
 	return IntoBase58(hex.EncodeToString(total))
 }
 
-func Address(point Point, secType SecStart, testnet bool) string {
+func Address(point Point, secType SecStart, params *ChainParams) string {
 	secVal := sec(point, secType)
 	hashed := Hash160(secVal)
-	return H160P2PKHAddress(hashed, testnet)
+	return H160P2PKHAddress(hashed, params)
 }
 
 func uncompressedSec(p *FinitePoint) []byte {
@@ -122,6 +118,24 @@ func ParseFromSec(stream []byte) (Point, error) {
 	return parseCompressed(stream)
 }
 
+// Parses a public key like ParseFromSec, also accepting the hybrid
+// encoding Bitcoin Core allows in scripts without STRICTENC: 0x06 or 0x07
+// for an even or odd y, followed by both coordinates
+func parseLaxSec(stream []byte) (Point, error) {
+	if len(stream) != 65 || (stream[0] != 0x06 && stream[0] != 0x07) {
+		return ParseFromSec(stream)
+	}
+	point, err := parseUncompressed(stream)
+	if err != nil {
+		return nil, err
+	}
+	finite, ok := point.(*FinitePoint)
+	if !ok || compressedSec(finite)[0] != stream[0]-4 {
+		return nil, errors.New("hybrid public key with the wrong y parity")
+	}
+	return point, nil
+}
+
 func parseCompressed(stream []byte) (Point, error) {
 	if len(stream) != 33 {
 		return nil, errors.New("invalid stream length for compressed sec format")
@@ -142,10 +156,10 @@ func parseUncompressed(stream []byte) (Point, error) {
 	return NewS256Point(x, y)
 }
 
+// Minimal big endian encoding, with a zero byte only to keep it positive
 func encodeIntToDer(value Int) []byte {
-	buf := make([]byte, 32)
-	value.value.FillBytes(buf)
-	if len(buf) > 0 && buf[0]&0x80 != 0 {
+	buf := value.value.Bytes()
+	if len(buf) == 0 || buf[0]&0x80 != 0 {
 		buf = append([]byte{0}, buf...)
 	}
 	start := []byte{0x02, byte(len(buf))}
@@ -167,8 +181,10 @@ func parseBigEndian(value []byte) Int {
 	return result
 }
 
+// Parses a DER signature, rejecting lengths that don't match the
+// encoding. Use isStrictDer for the full BIP66 rules
 func ParseFromDer(pubkey Point, sign []byte) (*Signature, error){
-  if sign[0] != 0x30 {
+  if len(sign) < 8 || sign[0] != 0x30 {
     return nil, errors.New("invalid der signature")
   }
   sign = sign[1:]
@@ -180,16 +196,22 @@ func ParseFromDer(pubkey Point, sign []byte) (*Signature, error){
   if marker != 0x02 {
     return nil, errors.New("invalid marker")
   }
-  rLength := sign[1]
+  rLength := int(sign[1])
   sign = sign[2:]
+  if rLength == 0 || rLength+2 > len(sign) {
+    return nil, errors.New("invalid r length")
+  }
   r := parseBigEndian(sign[:rLength])
   sign = sign[rLength:]
   marker = sign[0]
   if marker != 0x02 {
     return nil, errors.New("invalid marker")
   }
-  sLength := sign[1]
+  sLength := int(sign[1])
   sign = sign[2:]
+  if sLength == 0 || sLength != len(sign) {
+    return nil, errors.New("invalid s length")
+  }
   s := parseBigEndian(sign[:sLength]).ExpNeg(ORDER)
   return &Signature{
     s: s,
@@ -199,6 +221,76 @@ func ParseFromDer(pubkey Point, sign []byte) (*Signature, error){
 
 }
 
+// Parses a signature the way Bitcoin Core does without BIP66, accepting
+// long form lengths, padded integers and trailing bytes. Signatures with
+// r or s out of range parse but can't be valid, so they are rejected
+func parseLaxDer(pubkey Point, sign []byte) (*Signature, error) {
+	pos := 0
+	if pos == len(sign) || sign[pos] != 0x30 {
+		return nil, errors.New("invalid der signature")
+	}
+	pos++
+	if pos == len(sign) {
+		return nil, errors.New("invalid der signature length")
+	}
+	length := int(sign[pos])
+	pos++
+	if length&0x80 != 0 {
+		length -= 0x80
+		if length > len(sign)-pos {
+			return nil, errors.New("invalid der signature length")
+		}
+		pos += length
+	}
+	values := [2][]byte{}
+	for index := range values {
+		if pos == len(sign) || sign[pos] != 0x02 {
+			return nil, errors.New("invalid marker")
+		}
+		pos++
+		if pos == len(sign) {
+			return nil, errors.New("invalid integer length")
+		}
+		length = int(sign[pos])
+		pos++
+		if length&0x80 != 0 {
+			size := length - 0x80
+			if size > len(sign)-pos {
+				return nil, errors.New("invalid integer length")
+			}
+			for size > 0 && sign[pos] == 0 {
+				pos++
+				size--
+			}
+			if size >= 8 {
+				return nil, errors.New("invalid integer length")
+			}
+			length = 0
+			for ; size > 0; size-- {
+				length = length<<8 + int(sign[pos])
+				pos++
+			}
+		}
+		if length > len(sign)-pos {
+			return nil, errors.New("invalid integer length")
+		}
+		values[index] = bytes.TrimLeft(sign[pos:pos+length], "\x00")
+		pos += length
+	}
+	result := [2]Int{}
+	for index, value := range values {
+		if len(value) == 0 || len(value) > 32 {
+			return nil, errors.New("integer out of range")
+		}
+		result[index] = FromInt(0)
+		result[index].value = new(big.Int).SetBytes(value)
+		if result[index].Geq(ORDER) {
+			return nil, errors.New("integer out of range")
+		}
+	}
+	return NewSignature(result[0], result[1], pubkey), nil
+}
+
 func sec(p Point, secType SecStart) []byte {
 	if point, ok := p.(*FinitePoint); ok {
 		switch secType {
@@ -220,17 +312,14 @@ func (p *PrivateKey) Sec(secType SecStart) []byte {
 	return sec(p.p, secType)
 }
 
-func (p *PrivateKey) Address(secType SecStart, testnet bool) string {
-	return Address(p.p, secType, testnet)
+func (p *PrivateKey) Address(secType SecStart, params *ChainParams) string {
+	return Address(p.p, secType, params)
 }
 
-func (p *PrivateKey) WIF(secType SecStart, testnet bool) string {
-	wif := []byte{0x80}
+func (p *PrivateKey) WIF(secType SecStart, params *ChainParams) string {
+	wif := []byte{params.WIFPrefix}
 	num := p.e.IntoBytes()
 	suffix := []byte{}
-	if testnet {
-		wif[0] = 0xef
-	}
 	if secType != UNCOMPRESSED {
 		suffix = append(suffix, 0x01)
 	}
@@ -85,9 +85,14 @@ func TestDerValues(t *testing.T) {
 		*bitcoinlib.NewSignature(bitcoinlib.FromHexString("0x37206a0610995c58074999cb9767b87af4c4978db68c06e8e6e81d282047a7c6"),
 			bitcoinlib.FromHexString("0x8ca63759c1157ebeaec0d03cecca119fc9a75bf8e6d0fa65c841c8e2738cdaec"),
 			nil),
+		// Values below 2^248 are encoded without leading zeros
+		*bitcoinlib.NewSignature(bitcoinlib.FromHexString("0x0037206a0610995c58074999cb9767b87af4c4978db68c06e8e6e81d282047a7"),
+			bitcoinlib.FromHexString("0x0000003759c1157ebeaec0d03cecca119fc9a75bf8e6d0fa65c841c8e2738cda"),
+			nil),
 	}
 	results := []string{
 		"3045022037206a0610995c58074999cb9767b87af4c4978db68c06e8e6e81d282047a7c60221008ca63759c1157ebeaec0d03cecca119fc9a75bf8e6d0fa65c841c8e2738cdaec",
+		"3040021f37206a0610995c58074999cb9767b87af4c4978db68c06e8e6e81d282047a7021d3759c1157ebeaec0d03cecca119fc9a75bf8e6d0fa65c841c8e2738cda",
 	}
 	for index, signature := range signatures {
 		result := hex.EncodeToString(signature.Der())
@@ -110,7 +115,7 @@ func TestAddresses(t *testing.T) {
 		bitcoinlib.COMPRESSED,
     bitcoinlib.COMPRESSED,
 	}
-	net := []bool{true, true, false, true}
+	net := []*bitcoinlib.ChainParams{bitcoinlib.TESTNET3_PARAMS, bitcoinlib.TESTNET3_PARAMS, bitcoinlib.MAINNET_PARAMS, bitcoinlib.TESTNET3_PARAMS}
 	results := []string{
 		"mmTPbXQFxboEtNRkwfh6K51jvdtHLxGeMA",
 		"mopVkxp8UhXqRYbCYJsbeE1h1fiF64jcoH",
@@ -137,7 +142,7 @@ func TestEncodingWIF(t *testing.T) {
 		bitcoinlib.UNCOMPRESSED,
 		bitcoinlib.COMPRESSED,
 	}
-	net := []bool{true, true, false}
+	net := []*bitcoinlib.ChainParams{bitcoinlib.TESTNET3_PARAMS, bitcoinlib.TESTNET3_PARAMS, bitcoinlib.MAINNET_PARAMS}
 	results := []string{
 		"cMahea7zqjxrtgAbB7LSGbcQUr1uX1ojuat9jZodMN8rFTv2sfUK",
 		"91avARGdfge8E4tZfYLoxeJ5sGBdNJQH4kvjpWAxgzczjbCwxic",
@@ -158,10 +163,10 @@ func TestP2PKHAddress(t *testing.T) {
 	h160, _ := hex.DecodeString("74d691da1574e6b3c192ecfb52cc8984ee7b6c56")
 	expectedMainet := "1BenRpVUFK65JFWcQSuHnJKzc4M8ZP8Eqa"
 	expectedTestnet := "mrAjisaT4LXL5MzE81sfcDYKU3wqWSvf9q"
-	if bitcoinlib.H160P2PKHAddress(h160, false) != expectedMainet {
+	if bitcoinlib.H160P2PKHAddress(h160, bitcoinlib.MAINNET_PARAMS) != expectedMainet {
 		t.Fatal("Failed to create mainet p2pkh address")
 	}
-	if bitcoinlib.H160P2PKHAddress(h160, true) != expectedTestnet {
+	if bitcoinlib.H160P2PKHAddress(h160, bitcoinlib.TESTNET3_PARAMS) != expectedTestnet {
 		t.Fatal("Failed to create testnet p2pkh address")
 	}
 }
@@ -170,12 +175,12 @@ func TestP2SHAddress(t *testing.T) {
 	h160, _ := hex.DecodeString("74d691da1574e6b3c192ecfb52cc8984ee7b6c56")
 	expectedMainet := "3CLoMMyuoDQTPRD3XYZtCvgvkadrAdvdXh"
 	expectedTestnet := "2N3u1R6uwQfuobCqbCgBkpsgBxvr1tZpe7B"
-	if bitcoinlib.H160P2SHAddress(h160, false) != expectedMainet {
+	if bitcoinlib.H160P2SHAddress(h160, bitcoinlib.MAINNET_PARAMS) != expectedMainet {
 		t.Fatalf("Failed to create p2sh mainet address: %s vs %s", 
-			bitcoinlib.H160P2SHAddress(h160, false),
+			bitcoinlib.H160P2SHAddress(h160, bitcoinlib.MAINNET_PARAMS),
 			expectedMainet)
 	}
-	if bitcoinlib.H160P2SHAddress(h160, true) != expectedTestnet {
+	if bitcoinlib.H160P2SHAddress(h160, bitcoinlib.TESTNET3_PARAMS) != expectedTestnet {
 		t.Fatal("Failed to create p2sh testnet address")
 	}
 }
\ No newline at end of file
@@ -0,0 +1,180 @@
+package bitcoinlib
+
+// Standard templates of scriptPubKeys, the same as Bitcoin Core's TxoutType
+type ScriptType int
+
+const (
+	SCRIPT_TYPE_NONSTANDARD ScriptType = iota
+	SCRIPT_TYPE_P2PK
+	SCRIPT_TYPE_P2PKH
+	SCRIPT_TYPE_P2SH
+	SCRIPT_TYPE_MULTISIG
+	SCRIPT_TYPE_NULL_DATA
+	SCRIPT_TYPE_P2WPKH
+	SCRIPT_TYPE_P2WSH
+	SCRIPT_TYPE_P2TR
+	SCRIPT_TYPE_WITNESS_UNKNOWN
+)
+
+// Names of the script types used by Bitcoin Core's RPCs
+var SCRIPT_TYPE_NAMES = map[ScriptType]string{
+	SCRIPT_TYPE_NONSTANDARD:     "nonstandard",
+	SCRIPT_TYPE_P2PK:            "pubkey",
+	SCRIPT_TYPE_P2PKH:           "pubkeyhash",
+	SCRIPT_TYPE_P2SH:            "scripthash",
+	SCRIPT_TYPE_MULTISIG:        "multisig",
+	SCRIPT_TYPE_NULL_DATA:       "nulldata",
+	SCRIPT_TYPE_P2WPKH:          "witness_v0_keyhash",
+	SCRIPT_TYPE_P2WSH:           "witness_v0_scripthash",
+	SCRIPT_TYPE_P2TR:            "witness_v1_taproot",
+	SCRIPT_TYPE_WITNESS_UNKNOWN: "witness_unknown",
+}
+
+func (t ScriptType) String() string {
+	if name, ok := SCRIPT_TYPE_NAMES[t]; ok {
+		return name
+	}
+	return SCRIPT_TYPE_NAMES[SCRIPT_TYPE_NONSTANDARD]
+}
+
+// Template a scriptPubKey matches and the data it carries. Fields not
+// used by the type are empty
+type ScriptClass struct {
+	Type     ScriptType
+	Hash     []byte   // P2PKH, P2SH, P2WPKH and P2WSH
+	PubKeys  [][]byte // P2PK and multisig
+	Required int      // signatures of a multisig
+	Version  int      // witness version, -1 for scripts that aren't witness programs
+	Program  []byte   // witness program, the output key of P2TR
+	Data     [][]byte // pushes after the OP_RETURN of null data
+}
+
+// Number of keys of a multisig
+func (c *ScriptClass) Keys() int {
+	return len(c.PubKeys)
+}
+
+// Public key sizes by their first byte, like Bitcoin Core's
+// CPubKey::ValidSize. The key itself isn't checked
+func validPubKeySize(sec []byte) bool {
+	if len(sec) == 0 {
+		return false
+	}
+	switch sec[0] {
+	case 2, 3:
+		return len(sec) == 33
+	case 4, 6, 7:
+		return len(sec) == 65
+	}
+	return false
+}
+
+// Checks the serialized script against the template, where -1 stands
+// for the bytes of a push of size bytes with the opcode of its size, so
+// pushes encoded otherwise don't match
+func (s *ScriptPubKey) matches(template []int, size int) bool {
+	script := s.scriptBytes()
+	index := 0
+	for _, opcode := range template {
+		if opcode < 0 {
+			if index+1+size > len(script) || script[index] != byte(size) {
+				return false
+			}
+			index += 1 + size
+		} else if index >= len(script) || script[index] != byte(opcode) {
+			return false
+		} else {
+			index++
+		}
+	}
+	return index == len(script)
+}
+
+// Matches the script against the standard templates the way Bitcoin
+// Core's Solver does, extracting the hashes, keys and programs
+func (s *ScriptPubKey) Classify() *ScriptClass {
+	class := &ScriptClass{Type: SCRIPT_TYPE_NONSTANDARD, Version: -1}
+	cmds := s.cmds
+	script := s.scriptBytes()
+	if s.matches([]int{0xa9, -1, 0x87}, 20) {
+		class.Type = SCRIPT_TYPE_P2SH
+		class.Hash = script[2:22]
+		return class
+	}
+	if version, program, ok := s.witnessProgram(); ok {
+		class.Version = int(version)
+		class.Program = program
+		switch {
+		case version == 0 && len(program) == 20:
+			class.Type = SCRIPT_TYPE_P2WPKH
+			class.Hash = program
+		case version == 0 && len(program) == 32:
+			class.Type = SCRIPT_TYPE_P2WSH
+			class.Hash = program
+		case version == 0:
+			// Version 0 programs of other sizes can't be spent
+		case version == 1 && len(program) == XONLY_PUBKEY_SIZE:
+			class.Type = SCRIPT_TYPE_P2TR
+		default:
+			class.Type = SCRIPT_TYPE_WITNESS_UNKNOWN
+		}
+		return class
+	}
+	if len(cmds) > 0 && cmds[0].Num() == 106 && isPushOnly(cmds[1:]) {
+		class.Type = SCRIPT_TYPE_NULL_DATA
+		for _, cmd := range cmds[1:] {
+			class.Data = append(class.Data, stackBytes(cmd))
+		}
+		return class
+	}
+	for _, size := range []int{33, 65} {
+		if s.matches([]int{-1, 0xac}, size) && validPubKeySize(script[1:1+size]) {
+			class.Type = SCRIPT_TYPE_P2PK
+			class.PubKeys = [][]byte{script[1 : 1+size]}
+			return class
+		}
+	}
+	if s.matches([]int{0x76, 0xa9, -1, 0x88, 0xac}, 20) {
+		class.Type = SCRIPT_TYPE_P2PKH
+		class.Hash = script[3:23]
+		return class
+	}
+	if len(cmds) >= 4 && cmds[len(cmds)-1].Num() == 174 {
+		m, n := cmds[0].Num()-80, cmds[len(cmds)-2].Num()-80
+		if m < 1 || m > 16 || n < m || n > 16 || n != len(cmds)-3 {
+			return class
+		}
+		pubkeys := [][]byte{}
+		for _, cmd := range cmds[1 : len(cmds)-2] {
+			sec, ok := cmd.(*ScriptVal)
+			if !ok || !validPubKeySize(sec.Val) {
+				return class
+			}
+			pubkeys = append(pubkeys, sec.Val)
+		}
+		class.Type = SCRIPT_TYPE_MULTISIG
+		class.PubKeys = pubkeys
+		class.Required = m
+	}
+	return class
+}
+
+func (s *ScriptPubKey) isP2PKH() bool {
+	return s.Classify().Type == SCRIPT_TYPE_P2PKH
+}
+
+func (s *ScriptPubKey) isP2SH() bool {
+	return s.Classify().Type == SCRIPT_TYPE_P2SH
+}
+
+func (s *ScriptPubKey) isP2WPKH() bool {
+	return s.Classify().Type == SCRIPT_TYPE_P2WPKH
+}
+
+func (s *ScriptPubKey) isP2WSH() bool {
+	return s.Classify().Type == SCRIPT_TYPE_P2WSH
+}
+
+func (s *ScriptPubKey) isP2TR() bool {
+	return s.Classify().Type == SCRIPT_TYPE_P2TR
+}
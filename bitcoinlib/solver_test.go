@@ -0,0 +1,130 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	hash20 := "751e76e8199196d454941c45d1b3a323f1433bd6"
+	hash32 := "1863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"
+	key33 := "02" + strings.Repeat("11", 32)
+	key65 := "04" + strings.Repeat("22", 64)
+	vectors := []struct {
+		asm      string
+		expected bitcoinlib.ScriptType
+		data     string // hash, program, keys or pushes joined by spaces
+		version  int
+		required int
+	}{
+		{"OP_DUP OP_HASH160 " + hash20 + " OP_EQUALVERIFY OP_CHECKSIG", bitcoinlib.SCRIPT_TYPE_P2PKH, hash20, -1, 0},
+		{"OP_HASH160 " + hash20 + " OP_EQUAL", bitcoinlib.SCRIPT_TYPE_P2SH, hash20, -1, 0},
+		{"0 " + hash20, bitcoinlib.SCRIPT_TYPE_P2WPKH, hash20, 0, 0},
+		{"0 " + hash32, bitcoinlib.SCRIPT_TYPE_P2WSH, hash32, 0, 0},
+		{"1 " + hash32, bitcoinlib.SCRIPT_TYPE_P2TR, hash32, 1, 0},
+		{"16 0102", bitcoinlib.SCRIPT_TYPE_WITNESS_UNKNOWN, "0102", 16, 0},
+		{"1 " + hash20, bitcoinlib.SCRIPT_TYPE_WITNESS_UNKNOWN, hash20, 1, 0},
+		{key33 + " OP_CHECKSIG", bitcoinlib.SCRIPT_TYPE_P2PK, key33, -1, 0},
+		{key65 + " OP_CHECKSIG", bitcoinlib.SCRIPT_TYPE_P2PK, key65, -1, 0},
+		{"1 " + key33 + " " + key65 + " 2 OP_CHECKMULTISIG", bitcoinlib.SCRIPT_TYPE_MULTISIG, key33 + " " + key65, -1, 1},
+		{"OP_RETURN", bitcoinlib.SCRIPT_TYPE_NULL_DATA, "", -1, 0},
+		{"OP_RETURN 68656c6c6f 0", bitcoinlib.SCRIPT_TYPE_NULL_DATA, "68656c6c6f ", -1, 0},
+		// Close to the templates, but not standard
+		{"OP_HASH160 " + hash32 + " OP_EQUAL", bitcoinlib.SCRIPT_TYPE_NONSTANDARD, "", -1, 0},
+		{"0 " + hash20 + "00", bitcoinlib.SCRIPT_TYPE_NONSTANDARD, "", 0, 0},
+		{"OP_DUP OP_HASH160 " + hash32 + " OP_EQUALVERIFY OP_CHECKSIG", bitcoinlib.SCRIPT_TYPE_NONSTANDARD, "", -1, 0},
+		{"05" + strings.Repeat("11", 32) + " OP_CHECKSIG", bitcoinlib.SCRIPT_TYPE_NONSTANDARD, "", -1, 0},
+		{"3 " + key33 + " " + key65 + " 2 OP_CHECKMULTISIG", bitcoinlib.SCRIPT_TYPE_NONSTANDARD, "", -1, 0},
+		{"1 " + key33 + " 2 OP_CHECKMULTISIG", bitcoinlib.SCRIPT_TYPE_NONSTANDARD, "", -1, 0},
+		{"OP_RETURN OP_DUP", bitcoinlib.SCRIPT_TYPE_NONSTANDARD, "", -1, 0},
+		{"", bitcoinlib.SCRIPT_TYPE_NONSTANDARD, "", -1, 0},
+	}
+	for index, vector := range vectors {
+		cmds, err := bitcoinlib.ParseAsm(vector.asm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		class := bitcoinlib.NewPubkey(cmds).Classify()
+		items := [][]byte{}
+		switch class.Type {
+		case bitcoinlib.SCRIPT_TYPE_P2PK, bitcoinlib.SCRIPT_TYPE_MULTISIG:
+			items = class.PubKeys
+		case bitcoinlib.SCRIPT_TYPE_NULL_DATA:
+			items = class.Data
+		case bitcoinlib.SCRIPT_TYPE_P2TR, bitcoinlib.SCRIPT_TYPE_WITNESS_UNKNOWN:
+			items = [][]byte{class.Program}
+		case bitcoinlib.SCRIPT_TYPE_NONSTANDARD:
+		default:
+			items = [][]byte{class.Hash}
+		}
+		words := []string{}
+		for _, item := range items {
+			words = append(words, hex.EncodeToString(item))
+		}
+		data := strings.Join(words, " ")
+		if class.Type != vector.expected || data != vector.data || class.Version != vector.version || class.Required != vector.required {
+			t.Fatalf("Failed at index %d\nExpected => %s %s %d %d\nGot => %s %s %d %d", index, vector.expected, vector.data, vector.version, vector.required, class.Type, data, class.Version, class.Required)
+		}
+	}
+}
+
+func TestClassifyAddress(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(6008))
+	vectors := []struct {
+		address  string
+		expected bitcoinlib.ScriptType
+	}{
+		{key.Address(bitcoinlib.COMPRESSED, bitcoinlib.MAINNET_PARAMS), bitcoinlib.SCRIPT_TYPE_P2PKH},
+		{key.P2WPKHAddress(bitcoinlib.MAINNET_PARAMS), bitcoinlib.SCRIPT_TYPE_P2WPKH},
+		{key.P2TRAddress(bitcoinlib.MAINNET_PARAMS), bitcoinlib.SCRIPT_TYPE_P2TR},
+		{"3CLoMMyuoDQTPRD3XYZtCvgvkadrAdvdXh", bitcoinlib.SCRIPT_TYPE_P2SH},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", bitcoinlib.SCRIPT_TYPE_P2WSH},
+	}
+	for index, vector := range vectors {
+		script := builderScript(t, vector.address)
+		if got := script.Classify().Type; got != vector.expected {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s", index, vector.expected, got)
+		}
+	}
+
+	cmds, _ := bitcoinlib.ParseAsm("OP_RETURN 68656c6c6f")
+	if _, err := bitcoinlib.NewPubkey(cmds).Address(bitcoinlib.MAINNET_PARAMS); err == nil || !strings.Contains(err.Error(), "nulldata") {
+		t.Fatalf("Expected => nulldata script without address\nGot => %v", err)
+	}
+}
+
+// Templates are matched on the serialized script, so pushes that are not
+// encoded with the opcode of their size don't match
+func TestClassifyNonMinimalPushes(t *testing.T) {
+	hash20 := "751e76e8199196d454941c45d1b3a323f1433bd6"
+	key33 := "02" + strings.Repeat("11", 32)
+	vectors := []struct {
+		script   string
+		expected bitcoinlib.ScriptType
+	}{
+		{"a914" + hash20 + "87", bitcoinlib.SCRIPT_TYPE_P2SH},
+		{"a94c14" + hash20 + "87", bitcoinlib.SCRIPT_TYPE_NONSTANDARD},
+		{"76a914" + hash20 + "88ac", bitcoinlib.SCRIPT_TYPE_P2PKH},
+		{"76a94c14" + hash20 + "88ac", bitcoinlib.SCRIPT_TYPE_NONSTANDARD},
+		{"21" + key33 + "ac", bitcoinlib.SCRIPT_TYPE_P2PK},
+		{"4c21" + key33 + "ac", bitcoinlib.SCRIPT_TYPE_NONSTANDARD},
+		{"0014" + hash20, bitcoinlib.SCRIPT_TYPE_P2WPKH},
+		{"004c14" + hash20, bitcoinlib.SCRIPT_TYPE_NONSTANDARD},
+	}
+	for index, vector := range vectors {
+		raw, _ := hex.DecodeString(vector.script)
+		script, err := bitcoinlib.ParsePubKey(bytes.NewReader(append(bitcoinlib.EncodeVarInt(uint64(len(raw))), raw...)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := script.Classify().Type; got != vector.expected {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s", index, vector.expected, got)
+		}
+		if got := hex.EncodeToString(script.Serialize()[1:]); got != vector.script {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s", index, vector.script, got)
+		}
+	}
+}
@@ -0,0 +1,489 @@
+package bitcoinlib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const TAPROOT_LEAF_TAPSCRIPT = 0xc0
+const TAPROOT_LEAF_MASK = 0xfe
+const TAPROOT_ANNEX_TAG = 0x50
+const TAPROOT_CONTROL_BASE_SIZE = 33
+const TAPROOT_CONTROL_NODE_SIZE = 32
+const TAPROOT_CONTROL_MAX_NODE_COUNT = 128
+
+const TAP_TWEAK_TAG = "TapTweak"
+const TAP_LEAF_TAG = "TapLeaf"
+const TAP_BRANCH_TAG = "TapBranch"
+const TAP_SIGHASH_TAG = "TapSighash"
+
+// Returns the tweak committing the internal key to the merkle
+// root of its script tree (nil when there is no script path)
+func TapTweak(internalKey []byte, merkleRoot []byte) []byte {
+	return TaggedHash(TAP_TWEAK_TAG, internalKey, merkleRoot)
+}
+
+// Tweaks the x-only internal key with the merkle root, returning the
+// x-only output key and whether its y coordinate is odd
+func TaprootOutputKey(internalKey []byte, merkleRoot []byte) ([]byte, bool, error) {
+	p, err := ParseXOnly(internalKey)
+	if err != nil {
+		return nil, false, err
+	}
+	tweak := intFromBytes(TapTweak(internalKey, merkleRoot))
+	if tweak.Geq(ORDER) {
+		return nil, false, errors.New("taproot tweak out of range")
+	}
+	q, err := p.Add(G().ScaleInt(tweak))
+	if err != nil {
+		return nil, false, err
+	}
+	finite, ok := q.(*FinitePoint)
+	if !ok {
+		return nil, false, errors.New("taproot output key is infinite")
+	}
+	return XOnly(finite), !hasEvenY(finite), nil
+}
+
+// Returns the private key of the output key obtained by tweaking
+// the key with the merkle root (nil when there is no script path)
+func (pk *PrivateKey) TaprootTweak(merkleRoot []byte) (*PrivateKey, error) {
+	d := pk.e
+	if !hasEvenY(pk.p.(*FinitePoint)) {
+		d = ORDER.Sub(d)
+	}
+	tweak := intFromBytes(TapTweak(pk.XOnly(), merkleRoot))
+	if tweak.Geq(ORDER) {
+		return nil, errors.New("taproot tweak out of range")
+	}
+	tweaked := d.Add(tweak).Mod(ORDER)
+	if tweaked.Eq(ZERO) {
+		return nil, errors.New("tweaked private key is zero")
+	}
+	return NewPrivateKey(tweaked), nil
+}
+
+// Builds the scriptPubKey paying to the x-only output key
+func P2TRPubKey(outputKey []byte) *ScriptPubKey {
+	return &ScriptPubKey{
+		[]Operation{
+			&OP_1{},
+			&ScriptVal{outputKey},
+		},
+		nil,
+	}
+}
+
+// Key path only (BIP86) P2TR address of the key
+func (pk *PrivateKey) P2TRAddress(params *ChainParams) string {
+	outputKey, _, _ := TaprootOutputKey(pk.XOnly(), nil)
+	address, _ := EncodeSegwitAddress(params.Bech32Hrp, 1, outputKey)
+	return address
+}
+
+// Returns the hash of a leaf of the script tree
+func TapLeafHash(leafVersion byte, script []byte) []byte {
+	size := EncodeVarInt(uint64(len(script)))
+	return TaggedHash(TAP_LEAF_TAG, []byte{leafVersion}, size, script)
+}
+
+// Returns the hash of a branch, whose children are sorted
+func TapBranchHash(a []byte, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	return TaggedHash(TAP_BRANCH_TAG, a, b)
+}
+
+// Node of a taproot script tree, either a leaf or a branch
+type TapTree struct {
+	leafVersion byte
+	script      []byte
+	left        *TapTree
+	right       *TapTree
+}
+
+func NewTapLeaf(script []byte) *TapTree {
+	return NewTapLeafVersion(TAPROOT_LEAF_TAPSCRIPT, script)
+}
+
+func NewTapLeafVersion(leafVersion byte, script []byte) *TapTree {
+	return &TapTree{
+		leafVersion: leafVersion & TAPROOT_LEAF_MASK,
+		script:      script,
+	}
+}
+
+func NewTapBranch(left *TapTree, right *TapTree) *TapTree {
+	return &TapTree{
+		left:  left,
+		right: right,
+	}
+}
+
+func (t *TapTree) IsLeaf() bool {
+	return t.left == nil && t.right == nil
+}
+
+func (t *TapTree) Hash() []byte {
+	if t.IsLeaf() {
+		return TapLeafHash(t.leafVersion, t.script)
+	}
+	return TapBranchHash(t.left.Hash(), t.right.Hash())
+}
+
+// Returns the sibling hashes from the leaf to the root, or
+// false if the tree has no leaf with that hash
+func (t *TapTree) merklePath(leafHash []byte) ([][]byte, bool) {
+	if t.IsLeaf() {
+		return [][]byte{}, bytes.Equal(t.Hash(), leafHash)
+	}
+	if path, ok := t.left.merklePath(leafHash); ok {
+		return append(path, t.right.Hash()), true
+	}
+	if path, ok := t.right.merklePath(leafHash); ok {
+		return append(path, t.left.Hash()), true
+	}
+	return nil, false
+}
+
+// Builds the control block spending the script of the tree
+// committed to the given internal key
+func (t *TapTree) ControlBlock(internalKey []byte, leafVersion byte, script []byte) (*ControlBlock, error) {
+	path, ok := t.merklePath(TapLeafHash(leafVersion, script))
+	if !ok {
+		return nil, errors.New("script not found in tap tree")
+	}
+	_, odd, err := TaprootOutputKey(internalKey, t.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return &ControlBlock{
+		leafVersion,
+		odd,
+		internalKey,
+		path,
+	}, nil
+}
+
+// Proves that a script is committed to by a taproot output key
+type ControlBlock struct {
+	leafVersion byte
+	oddKey      bool
+	internalKey []byte
+	path        [][]byte
+}
+
+func ParseControlBlock(buf []byte) (*ControlBlock, error) {
+	if len(buf) < TAPROOT_CONTROL_BASE_SIZE ||
+		(len(buf)-TAPROOT_CONTROL_BASE_SIZE)%TAPROOT_CONTROL_NODE_SIZE != 0 {
+		return nil, fmt.Errorf("invalid control block length: %d", len(buf))
+	}
+	nodes := (len(buf) - TAPROOT_CONTROL_BASE_SIZE) / TAPROOT_CONTROL_NODE_SIZE
+	if nodes > TAPROOT_CONTROL_MAX_NODE_COUNT {
+		return nil, fmt.Errorf("control block path too long: %d", nodes)
+	}
+	internalKey := buf[1:TAPROOT_CONTROL_BASE_SIZE]
+	if _, err := ParseXOnly(internalKey); err != nil {
+		return nil, err
+	}
+	path := make([][]byte, 0, nodes)
+	for i := range nodes {
+		start := TAPROOT_CONTROL_BASE_SIZE + i*TAPROOT_CONTROL_NODE_SIZE
+		path = append(path, buf[start:start+TAPROOT_CONTROL_NODE_SIZE])
+	}
+	return &ControlBlock{
+		buf[0] & TAPROOT_LEAF_MASK,
+		buf[0]&1 == 1,
+		internalKey,
+		path,
+	}, nil
+}
+
+func (c *ControlBlock) Serialize() []byte {
+	first := c.leafVersion
+	if c.oddKey {
+		first |= 1
+	}
+	buf := append([]byte{first}, c.internalKey...)
+	for _, node := range c.path {
+		buf = append(buf, node...)
+	}
+	return buf
+}
+
+func (c *ControlBlock) LeafVersion() byte {
+	return c.leafVersion
+}
+
+func (c *ControlBlock) InternalKey() []byte {
+	return c.internalKey
+}
+
+// Returns the merkle root obtained climbing from the leaf hash
+func (c *ControlBlock) MerkleRoot(leafHash []byte) []byte {
+	current := leafHash
+	for _, node := range c.path {
+		current = TapBranchHash(current, node)
+	}
+	return current
+}
+
+// Checks that the script is committed to by the output key
+func (c *ControlBlock) Verify(outputKey []byte, script []byte) bool {
+	root := c.MerkleRoot(TapLeafHash(c.leafVersion, script))
+	expected, odd, err := TaprootOutputKey(c.internalKey, root)
+	return err == nil && odd == c.oddKey && bytes.Equal(expected, outputKey)
+}
+
+func validTaprootHashType(hashType SigHashType) bool {
+	base := hashType &^ SIGHASH_ANYONECANPAY
+	return hashType == SIGHASH_DEFAULT || (base >= SIGHASH_ALL && base <= SIGHASH_SINGLE)
+}
+
+// Returns the annex of the witness, if any (BIP341)
+func taprootAnnex(items [][]byte) []byte {
+	if len(items) >= 2 {
+		last := items[len(items)-1]
+		if len(last) > 0 && last[0] == TAPROOT_ANNEX_TAG {
+			return last
+		}
+	}
+	return nil
+}
+
+// Sets the annex of the input, which must start with 0x50. The
+// annex is committed to by the taproot signatures of the input
+func (tx *Transaction) SetAnnex(input int, annex []byte) error {
+	if len(annex) == 0 || annex[0] != TAPROOT_ANNEX_TAG {
+		return errors.New("annex must start with 0x50")
+	}
+	in := tx.inputs[input]
+	if taprootAnnex(in.items) != nil {
+		in.items = in.items[:len(in.items)-1]
+	}
+	if len(in.items) == 0 {
+		// Placeholder until the input is signed
+		in.items = append(in.items, []byte{})
+	}
+	in.items = append(in.items, annex)
+	tx.segwit = true
+	return nil
+}
+
+func sha256Of(data []byte) []byte {
+	hashed := sha256.Sum256(data)
+	return hashed[:]
+}
+
+func (in *Input) outpoint() []byte {
+	buf, _ := hex.DecodeString(in.previousID)
+	slices.Reverse(buf)
+	return binary.LittleEndian.AppendUint32(buf, in.previousIndex)
+}
+
+// Position committed by script path signatures when no OP_CODESEPARATOR
+// was executed
+const TAPSCRIPT_NO_CODESEPARATOR = 0xffffffff
+
+// Returns the BIP341 signature hash of the input. leafHash is nil
+// for key path spends, and the hash of the executed leaf otherwise
+func (tx *Transaction) SigHashTaproot(input int, provider PrevoutProvider, hashType SigHashType, leafHash []byte) ([]byte, error) {
+	return tx.SigHashTapscript(input, provider, hashType, leafHash, TAPSCRIPT_NO_CODESEPARATOR)
+}
+
+// Returns the signature hash like SigHashTaproot, for a signature
+// checked after the OP_CODESEPARATOR at codeSeparator in the leaf
+func (tx *Transaction) SigHashTapscript(input int, provider PrevoutProvider, hashType SigHashType, leafHash []byte, codeSeparator uint32) ([]byte, error) {
+	if !validTaprootHashType(hashType) {
+		return nil, fmt.Errorf("invalid taproot sighash type: %x", hashType)
+	}
+	if input >= len(tx.inputs) {
+		return nil, fmt.Errorf("input %d out of range", input)
+	}
+	prevouts := make([]*Output, len(tx.inputs))
+	for index, in := range tx.inputs {
+		prevout, err := in.Prevout(provider)
+		if err != nil {
+			return nil, err
+		}
+		prevouts[index] = prevout
+	}
+	base := hashType &^ SIGHASH_ANYONECANPAY
+	anyoneCanPay := hashType&SIGHASH_ANYONECANPAY != 0
+
+	// Epoch 0
+	buf := []byte{0x00, byte(hashType)}
+	buf = append(buf, tx.version.Serialize()...)
+	buf = binary.LittleEndian.AppendUint32(buf, tx.locktime)
+	if !anyoneCanPay {
+		var outpoints, amounts, scripts, sequences []byte
+		for index, in := range tx.inputs {
+			outpoints = append(outpoints, in.outpoint()...)
+			amounts = binary.LittleEndian.AppendUint64(amounts, prevouts[index].amount)
+			scripts = append(scripts, prevouts[index].scriptPubKey.Serialize()...)
+			sequences = binary.LittleEndian.AppendUint32(sequences, in.sequence)
+		}
+		buf = append(buf, sha256Of(outpoints)...)
+		buf = append(buf, sha256Of(amounts)...)
+		buf = append(buf, sha256Of(scripts)...)
+		buf = append(buf, sha256Of(sequences)...)
+	}
+	if base != SIGHASH_NONE && base != SIGHASH_SINGLE {
+		var outputs []byte
+		for _, output := range tx.outputs {
+			outputs = append(outputs, output.Serialize()...)
+		}
+		buf = append(buf, sha256Of(outputs)...)
+	}
+	in := tx.inputs[input]
+	annex := taprootAnnex(in.items)
+	spendType := byte(0)
+	if leafHash != nil {
+		spendType |= 2
+	}
+	if annex != nil {
+		spendType |= 1
+	}
+	buf = append(buf, spendType)
+	if anyoneCanPay {
+		buf = append(buf, in.outpoint()...)
+		buf = append(buf, prevouts[input].Serialize()...)
+		buf = binary.LittleEndian.AppendUint32(buf, in.sequence)
+	} else {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(input))
+	}
+	if annex != nil {
+		buf = append(buf, sha256Of(append(EncodeVarInt(uint64(len(annex))), annex...))...)
+	}
+	if base == SIGHASH_SINGLE {
+		if input >= len(tx.outputs) {
+			return nil, errors.New("SIGHASH_SINGLE without matching output")
+		}
+		buf = append(buf, sha256Of(tx.outputs[input].Serialize())...)
+	}
+	if leafHash != nil {
+		buf = append(buf, leafHash...)
+		// Key version 0
+		buf = append(buf, 0x00)
+		buf = binary.LittleEndian.AppendUint32(buf, codeSeparator)
+	}
+	return TaggedHash(TAP_SIGHASH_TAG, buf), nil
+}
+
+// Serializes a schnorr signature, appending the sighash type
+// unless it is SIGHASH_DEFAULT
+func taprootSignature(sig *SchnorrSignature, hashType SigHashType) []byte {
+	serialized := sig.Serialize()
+	if hashType != SIGHASH_DEFAULT {
+		serialized = append(serialized, byte(hashType))
+	}
+	return serialized
+}
+
+// Splits a taproot signature into its schnorr signature and sighash type
+func parseTaprootSignature(sig []byte) (*SchnorrSignature, SigHashType, error) {
+	hashType := SIGHASH_DEFAULT
+	if len(sig) == SCHNORR_SIGNATURE_SIZE+1 {
+		hashType = SigHashType(sig[SCHNORR_SIGNATURE_SIZE])
+		if hashType == SIGHASH_DEFAULT {
+			return nil, 0, errors.New("explicit SIGHASH_DEFAULT in taproot signature")
+		}
+		sig = sig[:SCHNORR_SIGNATURE_SIZE]
+	}
+	parsed, err := ParseSchnorrSignature(sig)
+	return parsed, hashType, err
+}
+
+// Script error of a taproot signature that can't be parsed
+func taprootSignatureError(sig []byte) ScriptErrorCode {
+	if len(sig) != SCHNORR_SIGNATURE_SIZE && len(sig) != SCHNORR_SIGNATURE_SIZE+1 {
+		return SCRIPT_ERR_SCHNORR_SIG_SIZE
+	}
+	if len(sig) == SCHNORR_SIGNATURE_SIZE+1 && SigHashType(sig[SCHNORR_SIGNATURE_SIZE]) == SIGHASH_DEFAULT {
+		return SCRIPT_ERR_SCHNORR_SIG_HASHTYPE
+	}
+	return SCRIPT_ERR_SCHNORR_SIG
+}
+
+// Signs a key path spend of a P2TR input. merkleRoot is the root of
+// the script tree of the output, or nil if it has no script path
+func (tx *Transaction) SignTaprootInput(input int, provider PrevoutProvider, key *PrivateKey, merkleRoot []byte, hashType SigHashType) error {
+	scriptPubKey, err := tx.inputs[input].ScriptPubkey(provider)
+	if err != nil {
+		return err
+	}
+	if !scriptPubKey.isP2TR() {
+		return errors.New("input does not spend a taproot output")
+	}
+	tweaked, err := key.TaprootTweak(merkleRoot)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(tweaked.XOnly(), scriptPubKey.cmds[1].(*ScriptVal).Val) {
+		return errors.New("key does not match the taproot output key")
+	}
+	hash, err := tx.SigHashTaproot(input, provider, hashType, nil)
+	if err != nil {
+		return err
+	}
+	sig, err := tweaked.SignSchnorr(hash)
+	if err != nil {
+		return err
+	}
+	in := tx.inputs[input]
+	witness := [][]byte{taprootSignature(sig, hashType)}
+	if annex := taprootAnnex(in.items); annex != nil {
+		witness = append(witness, annex)
+	}
+	in.items = witness
+	in.scriptSig, in.rawScriptSig = &Script{}, nil
+	tx.segwit = true
+	return nil
+}
+
+// Verifies the witness of an input spending a P2TR output
+func (tx *Transaction) verifyTaprootInput(ctx *ExecutionContext, outputKey []byte) error {
+	items := tx.inputs[ctx.input].items
+	if taprootAnnex(items) != nil {
+		items = items[:len(items)-1]
+	}
+	if len(items) == 0 {
+		return ctx.fail(SCRIPT_ERR_WITNESS_PROGRAM_WITNESS_EMPTY)
+	}
+	if len(items) == 1 {
+		// Key path
+		sig, hashType, err := parseTaprootSignature(items[0])
+		if err != nil {
+			return ctx.fail(taprootSignatureError(items[0]))
+		}
+		hash, err := ctx.SigHash(hashType)
+		if err != nil {
+			return ctx.fail(SCRIPT_ERR_SCHNORR_SIG_HASHTYPE)
+		}
+		if !sig.Verify(outputKey, hash) {
+			return ctx.fail(SCRIPT_ERR_SCHNORR_SIG)
+		}
+		return nil
+	}
+	// Script path
+	control, err := ParseControlBlock(items[len(items)-1])
+	if err != nil {
+		return ctx.fail(SCRIPT_ERR_TAPROOT_WRONG_CONTROL_SIZE)
+	}
+	script := items[len(items)-2]
+	if !control.Verify(outputKey, script) {
+		return ctx.fail(SCRIPT_ERR_WITNESS_PROGRAM_MISMATCH)
+	}
+	if control.LeafVersion() != TAPROOT_LEAF_TAPSCRIPT {
+		// Unknown leaf versions are left spendable for future upgrades
+		return nil
+	}
+	budget := TAPSCRIPT_BUDGET_OFFSET + witnessSize(tx.inputs[ctx.input].items)
+	return executeTapscript(ctx.tapscript(script, budget), script, items[:len(items)-2])
+}
@@ -0,0 +1,213 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTaprootOutputKey(t *testing.T) {
+	vectors := []struct {
+		internalKey string
+		script      string
+		outputKey   string
+		address     string
+		control     string
+	}{
+		{
+			"d6889cb081036e0faefa3a35157ad71086b123b2b144b649798b494c300a961d",
+			"",
+			"53a1f6e454df1aa2776a2814a721372d6258050de330b3c6d10ee8f4e0dda343",
+			"bc1p2wsldez5mud2yam29q22wgfh9439spgduvct83k3pm50fcxa5dps59h4z5",
+			"",
+		},
+		{
+			"187791b6f712a8ea41c8ecdd0ee77fab3e85263b37e1ec18a3651926b3a6cf27",
+			"20d85a959b0290bf19bb89ed43c916be835475d013da4b362117393e25a48229b8ac",
+			"147c9c57132f6e7ecddba9800bb0c4449251c92a1e60371ee77557b6620f3ea3",
+			"bc1pz37fc4cn9ah8anwm4xqqhvxygjf9rjf2resrw8h8w4tmvcs0863sa2e586",
+			"c1187791b6f712a8ea41c8ecdd0ee77fab3e85263b37e1ec18a3651926b3a6cf27",
+		},
+	}
+	for index, vector := range vectors {
+		internalKey, _ := hex.DecodeString(vector.internalKey)
+		script, _ := hex.DecodeString(vector.script)
+		var tree *bitcoinlib.TapTree
+		var merkleRoot []byte
+		if len(script) > 0 {
+			tree = bitcoinlib.NewTapLeaf(script)
+			merkleRoot = tree.Hash()
+		}
+		outputKey, _, err := bitcoinlib.TaprootOutputKey(internalKey, merkleRoot)
+		if err != nil {
+			t.Fatalf("Failed at index %d with error: %s", index, err)
+		}
+		if hex.EncodeToString(outputKey) != vector.outputKey {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %x", index, vector.outputKey, outputKey)
+		}
+		address, err := bitcoinlib.P2TRPubKey(outputKey).Address(bitcoinlib.MAINNET_PARAMS)
+		if err != nil || address != vector.address {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %s", index, vector.address, address)
+		}
+		if tree == nil {
+			continue
+		}
+		control, err := tree.ControlBlock(internalKey, bitcoinlib.TAPROOT_LEAF_TAPSCRIPT, script)
+		if err != nil {
+			t.Fatalf("Failed building control block at index %d: %s", index, err)
+		}
+		if hex.EncodeToString(control.Serialize()) != vector.control {
+			t.Fatalf("Failed at index %d\nExpected => %s\nGot => %x", index, vector.control, control.Serialize())
+		}
+		if !control.Verify(outputKey, script) {
+			t.Fatalf("Failed verifying control block at index %d", index)
+		}
+	}
+}
+
+func TestTapTreeControlBlocks(t *testing.T) {
+	internalKey, _ := hex.DecodeString("93478e9488f956df2396be2ce6c5cced75f900dfa18e7dabd2428aae78451820")
+	scripts := [][]byte{{0x51}, {0x52}, {0x53}}
+	tree := bitcoinlib.NewTapBranch(
+		bitcoinlib.NewTapLeaf(scripts[0]),
+		bitcoinlib.NewTapBranch(
+			bitcoinlib.NewTapLeaf(scripts[1]),
+			bitcoinlib.NewTapLeaf(scripts[2]),
+		),
+	)
+	outputKey, _, _ := bitcoinlib.TaprootOutputKey(internalKey, tree.Hash())
+	for index, script := range scripts {
+		control, err := tree.ControlBlock(internalKey, bitcoinlib.TAPROOT_LEAF_TAPSCRIPT, script)
+		if err != nil {
+			t.Fatalf("Failed at index %d with error: %s", index, err)
+		}
+		parsed, err := bitcoinlib.ParseControlBlock(control.Serialize())
+		if err != nil {
+			t.Fatalf("Failed parsing control block at index %d: %s", index, err)
+		}
+		if !parsed.Verify(outputKey, script) {
+			t.Fatalf("Failed verifying control block at index %d", index)
+		}
+		if parsed.Verify(outputKey, []byte{0x54}) {
+			t.Fatalf("Verified wrong script at index %d", index)
+		}
+	}
+	if _, err := tree.ControlBlock(internalKey, bitcoinlib.TAPROOT_LEAF_TAPSCRIPT, []byte{0x54}); err == nil {
+		t.Fatal("Built control block for a script outside the tree")
+	}
+	if _, err := bitcoinlib.ParseControlBlock(make([]byte, 34)); err == nil {
+		t.Fatal("Parsed control block with invalid length")
+	}
+}
+
+func taprootSpend(t *testing.T, key *bitcoinlib.PrivateKey) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+	outputKey, _, _ := bitcoinlib.TaprootOutputKey(key.XOnly(), nil)
+	funding := bitcoinlib.NewTransaction()
+	funding.AddInput(strings.Repeat("11", 32), 0)
+	funding.AddOutputScript(50000, bitcoinlib.P2TRPubKey(outputKey))
+	funding.AddOutputScript(20000, bitcoinlib.P2PKHScript(bitcoinlib.Hash160(key.Sec(bitcoinlib.COMPRESSED))))
+	provider := bitcoinlib.NewMemoryProvider()
+	provider.AddTransaction(funding)
+
+	tx := bitcoinlib.NewTransaction()
+	tx.AddInput(funding.Id(), 0)
+	tx.AddInput(funding.Id(), 1)
+	if err := tx.AddOutput(60000, key.P2TRAddress(bitcoinlib.MAINNET_PARAMS), bitcoinlib.MAINNET_PARAMS); err != nil {
+		t.Fatalf("Failed adding output: %s", err)
+	}
+	return tx, provider
+}
+
+func TestTaprootKeyPathSigning(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(31337))
+	tx, provider := taprootSpend(t, key)
+	if err := tx.Sign(provider, key); err != nil {
+		t.Fatalf("Failed signing: %s", err)
+	}
+	if !tx.Verify(provider) {
+		t.Fatal("Failed to verify taproot key path spend")
+	}
+	parsed, err := bitcoinlib.ParseTransaction(bytes.NewReader(tx.Serialize()))
+	if err != nil {
+		t.Fatalf("Failed parsing signed transaction: %s", err)
+	}
+	if !parsed.Verify(provider) {
+		t.Fatal("Failed to verify parsed taproot key path spend")
+	}
+	other := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(31338))
+	if err := tx.SignInput(0, provider, other); err == nil {
+		t.Fatal("Signed taproot input with the wrong key")
+	}
+}
+
+func TestTaprootSigHashTypes(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(31337))
+	hashTypes := []bitcoinlib.SigHashType{
+		bitcoinlib.SIGHASH_ALL,
+		bitcoinlib.SIGHASH_NONE,
+		bitcoinlib.SIGHASH_SINGLE,
+		bitcoinlib.SIGHASH_ALL | bitcoinlib.SIGHASH_ANYONECANPAY,
+		bitcoinlib.SIGHASH_NONE | bitcoinlib.SIGHASH_ANYONECANPAY,
+		bitcoinlib.SIGHASH_SINGLE | bitcoinlib.SIGHASH_ANYONECANPAY,
+	}
+	seen := map[string]bool{}
+	for _, hashType := range hashTypes {
+		tx, provider := taprootSpend(t, key)
+		if err := tx.SetAnnex(0, []byte{0x50, 0x01}); err != nil {
+			t.Fatalf("Failed setting annex: %s", err)
+		}
+		hash, err := tx.SigHashTaproot(0, provider, hashType, nil)
+		if err != nil {
+			t.Fatalf("Failed sighash %x: %s", hashType, err)
+		}
+		seen[hex.EncodeToString(hash)] = true
+		if err := tx.SignTaprootInput(0, provider, key, nil, hashType); err != nil {
+			t.Fatalf("Failed signing with sighash %x: %s", hashType, err)
+		}
+		if !tx.VerifyInput(0, provider) {
+			t.Fatalf("Failed verifying sighash %x", hashType)
+		}
+	}
+	if len(seen) != len(hashTypes) {
+		t.Fatal("Different sighash types produced the same hash")
+	}
+	tx, provider := taprootSpend(t, key)
+	if _, err := tx.SigHashTaproot(0, provider, 0x04, nil); err == nil {
+		t.Fatal("Accepted invalid sighash type")
+	}
+	if _, err := tx.SigHashTaproot(1, provider, bitcoinlib.SIGHASH_SINGLE, nil); err == nil {
+		t.Fatal("Accepted SIGHASH_SINGLE without matching output")
+	}
+}
+
+// BIP341's wallet-test-vectors.json, vendored as bip341_wallet_vectors.json
+func TestTaprootKeyPathSpending(t *testing.T) {
+	file, err := os.Open("testdata/bip341_wallet_vectors.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Skip("BIP341 wallet vectors aren't vendored in testdata")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	tests, err := bitcoinlib.ParseTaprootKeyPathTests(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests) == 0 {
+		t.Fatal("No key path spending vectors")
+	}
+	for index, test := range tests {
+		t.Run(fmt.Sprintf("keyPathSpending:%d", index), func(t *testing.T) {
+			if err := test.Run(); err != nil {
+				t.Fatalf("Failed at index %d with error: %s", index, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package bitcoinlib
+
+import (
+	"errors"
+	"slices"
+)
+
+const TAPSCRIPT_SIGOP_WEIGHT = 50
+const TAPSCRIPT_BUDGET_OFFSET = 50
+const MAX_STACK_SIZE = 1000
+const MAX_SCRIPT_ELEMENT_SIZE = 520
+
+// Opcodes that make a tapscript succeed unconditionally (BIP342),
+// reserved for future soft forks
+func isOpSuccess(op byte) bool {
+	return op == 80 || op == 98 ||
+		(op >= 126 && op <= 129) ||
+		(op >= 131 && op <= 134) ||
+		(op >= 137 && op <= 138) ||
+		(op >= 141 && op <= 142) ||
+		(op >= 149 && op <= 153) ||
+		(op >= 187 && op <= 254)
+}
+
+// Looks for an OP_SUCCESSx while decoding the script, failing
+// if a push runs past its end before one is found
+func hasOpSuccess(script []byte) (bool, error) {
+	index := 0
+	for index < len(script) {
+		current := script[index]
+		index++
+		length := 0
+		if current >= 1 && current <= 75 {
+			length = int(current)
+		} else if current >= 76 && current <= 78 {
+			size := 1 << (current - 76)
+			if index+size > len(script) {
+				return false, errors.New("truncated push in tapscript")
+			}
+			length = int(FromLittleEndian(script[index : index+size]).value.Int64())
+			index += size
+		} else if isOpSuccess(current) {
+			return true, nil
+		}
+		if index+length > len(script) {
+			return false, errors.New("truncated push in tapscript")
+		}
+		index += length
+	}
+	return false, nil
+}
+
+// OP_CHECKSIGADD only exists in tapscript, elsewhere it fails like
+// any other undefined operation
+type OP_CHECKSIGADD struct{}
+
+func (t *OP_CHECKSIGADD) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	if ctx.sigVersion != SIGVERSION_TAPSCRIPT {
+		return SCRIPT_ERR_BAD_OPCODE
+	}
+	if Len(stack) < 3 {
+		return SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	pubkey := stackBytes(Pop(stack))
+	n, err := popNum(ctx, stack)
+	if err != nil {
+		return err
+	}
+	sig := stackBytes(Pop(stack))
+	valid, err := ctx.checkSchnorrSig(sig, pubkey)
+	if err != nil {
+		return err
+	}
+	if valid {
+		n++
+	}
+	Push(stack, &ScriptVal{
+		encodeNum(FromInt(n)),
+	})
+	return nil
+}
+
+func (t *OP_CHECKSIGADD) Num() int {
+	return 186
+}
+
+// OP_IF and OP_NOTIF under the MINIMALIF rule: the condition
+// must be empty or exactly 0x01
+type tapIf struct {
+	cond Operation
+}
+
+func (t *tapIf) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	if Len(stack) < 1 {
+		return SCRIPT_ERR_UNBALANCED_CONDITIONAL
+	}
+	val := stackBytes((*stack)[Len(stack)-1])
+	if len(val) > 1 || (len(val) == 1 && val[0] != 1) {
+		return SCRIPT_ERR_TAPSCRIPT_MINIMALIF
+	}
+	return t.cond.Operate(ctx, stack, altstack, cmds)
+}
+
+func (t *tapIf) Num() int {
+	return t.cond.Num()
+}
+
+type tapCheckMultisig struct {
+	num int
+}
+
+func (t *tapCheckMultisig) Operate(ctx *ExecutionContext, stack *Stack, altstack *Stack, cmds *Stack) error {
+	return SCRIPT_ERR_TAPSCRIPT_CHECKMULTISIG
+}
+
+func (t *tapCheckMultisig) Num() int {
+	return t.num
+}
+
+// Swaps the operations whose semantics change in tapscript
+func tapscriptOperations(cmds []Operation) ([]Operation, error) {
+	result := make([]Operation, len(cmds))
+	for index, cmd := range cmds {
+		switch cmd.Num() {
+		case -1:
+			if len(cmd.(*ScriptVal).Val) > MAX_SCRIPT_ELEMENT_SIZE {
+				return nil, SCRIPT_ERR_PUSH_SIZE
+			}
+			result[index] = cmd
+		case 99, 100:
+			result[index] = &tapIf{cmd}
+		case 174, 175:
+			// OP_CHECKMULTISIG is disabled, OP_CHECKSIGADD replaces it
+			result[index] = &tapCheckMultisig{cmd.Num()}
+		default:
+			result[index] = cmd
+		}
+	}
+	return result, nil
+}
+
+// Executes a tapscript leaf (leaf version 0xc0) spending the input,
+// with items as the initial stack. budget is the validation weight
+// available to signature checks
+func (tx *Transaction) EvaluateTapscript(input int, provider PrevoutProvider, script []byte, items [][]byte, budget int) bool {
+	base := &ExecutionContext{tx: tx, input: input, provider: provider, flags: SCRIPT_VERIFY_CONSENSUS}
+	return executeTapscript(base.tapscript(script, budget), script, items) == nil
+}
+
+func executeTapscript(ctx *ExecutionContext, script []byte, items [][]byte) error {
+	success, err := hasOpSuccess(script)
+	if err != nil {
+		return ctx.fail(SCRIPT_ERR_BAD_OPCODE)
+	}
+	if success {
+		return nil
+	}
+	parsed, err := parseScriptFromBytes(script)
+	if err != nil {
+		return ctx.fail(SCRIPT_ERR_BAD_OPCODE)
+	}
+	cmds, err := tapscriptOperations(parsed)
+	if err != nil {
+		return ctx.fail(err)
+	}
+	ctx.markCodeSeparators(parsed)
+	slices.Reverse(cmds)
+	if len(items) > MAX_STACK_SIZE {
+		return ctx.fail(SCRIPT_ERR_STACK_SIZE)
+	}
+	stack := make([]Operation, 0, len(items))
+	altstack := make([]Operation, 0)
+	for _, item := range items {
+		if len(item) > MAX_SCRIPT_ELEMENT_SIZE {
+			return ctx.fail(SCRIPT_ERR_PUSH_SIZE)
+		}
+		if len(item) == 0 {
+			Push(&stack, &OP_0{})
+		} else {
+			Push(&stack, &ScriptVal{item})
+		}
+	}
+	ctx.branches = nil
+	for len(cmds) > 0 {
+		cmd := Pop(&cmds)
+		if err := ctx.step(cmd, &stack, &altstack, &cmds); err != nil {
+			return err
+		}
+		if len(stack)+len(altstack) > MAX_STACK_SIZE {
+			return ctx.fail(SCRIPT_ERR_STACK_SIZE)
+		}
+	}
+	// Tapscript requires a clean stack
+	if len(stack) != 1 {
+		return ctx.fail(SCRIPT_ERR_CLEANSTACK)
+	}
+	if !castToBool(stack[0]) {
+		return ctx.fail(SCRIPT_ERR_EVAL_FALSE)
+	}
+	return nil
+}
+
+// Returns the size of the serialized witness of the input
+func witnessSize(items [][]byte) int {
+	size := len(EncodeVarInt(uint64(len(items))))
+	for _, item := range items {
+		size += len(EncodeVarInt(uint64(len(item)))) + len(item)
+	}
+	return size
+}
+
+// Creates a signature for a script path spend of the leaf
+func (tx *Transaction) SignTapscript(input int, provider PrevoutProvider, key *PrivateKey, leafHash []byte, hashType SigHashType) ([]byte, error) {
+	hash, err := tx.SigHashTaproot(input, provider, hashType, leafHash)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := key.SignSchnorr(hash)
+	if err != nil {
+		return nil, err
+	}
+	return taprootSignature(sig, hashType), nil
+}
+
+// Sets the witness of a script path spend: the stack satisfying
+// the script, the script itself and its control block
+func (tx *Transaction) SetTapscriptWitness(input int, stack [][]byte, script []byte, control *ControlBlock) {
+	in := tx.inputs[input]
+	witness := append(slices.Clone(stack), script, control.Serialize())
+	if annex := taprootAnnex(in.items); annex != nil {
+		witness = append(witness, annex)
+	}
+	in.items = witness
+	in.scriptSig, in.rawScriptSig = &Script{}, nil
+	tx.segwit = true
+}
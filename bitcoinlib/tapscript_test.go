@@ -0,0 +1,203 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func pushData(data []byte) []byte {
+	return append([]byte{byte(len(data))}, data...)
+}
+
+func checkSigScript(key *bitcoinlib.PrivateKey) []byte {
+	return append(pushData(key.XOnly()), 0xac)
+}
+
+// Funds a P2TR output committing to the tree and returns a transaction spending it
+func tapscriptSpend(t *testing.T, internal *bitcoinlib.PrivateKey, tree *bitcoinlib.TapTree) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+	outputKey, _, err := bitcoinlib.TaprootOutputKey(internal.XOnly(), tree.Hash())
+	if err != nil {
+		t.Fatalf("Failed computing output key: %s", err)
+	}
+	funding := bitcoinlib.NewTransaction()
+	funding.AddInput(strings.Repeat("22", 32), 0)
+	funding.AddOutputScript(50000, bitcoinlib.P2TRPubKey(outputKey))
+	provider := bitcoinlib.NewMemoryProvider()
+	provider.AddTransaction(funding)
+
+	tx := bitcoinlib.NewTransaction()
+	tx.AddInput(funding.Id(), 0)
+	if err := tx.AddOutput(40000, internal.P2TRAddress(bitcoinlib.MAINNET_PARAMS), bitcoinlib.MAINNET_PARAMS); err != nil {
+		t.Fatalf("Failed adding output: %s", err)
+	}
+	return tx, provider
+}
+
+func TestTapscriptCheckSig(t *testing.T) {
+	internal := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(1001))
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(1002))
+	preimage := []byte("tapscript preimage")
+	hash := sha256.Sum256(preimage)
+	sigLeaf := checkSigScript(key)
+	hashLeaf := append(append([]byte{0xa8}, pushData(hash[:])...), 0x87)
+	tree := bitcoinlib.NewTapBranch(bitcoinlib.NewTapLeaf(sigLeaf), bitcoinlib.NewTapLeaf(hashLeaf))
+	tx, provider := tapscriptSpend(t, internal, tree)
+
+	control, _ := tree.ControlBlock(internal.XOnly(), bitcoinlib.TAPROOT_LEAF_TAPSCRIPT, sigLeaf)
+	leafHash := bitcoinlib.TapLeafHash(bitcoinlib.TAPROOT_LEAF_TAPSCRIPT, sigLeaf)
+	for _, hashType := range []bitcoinlib.SigHashType{bitcoinlib.SIGHASH_DEFAULT, bitcoinlib.SIGHASH_SINGLE} {
+		sig, err := tx.SignTapscript(0, provider, key, leafHash, hashType)
+		if err != nil {
+			t.Fatalf("Failed signing with sighash %x: %s", hashType, err)
+		}
+		tx.SetTapscriptWitness(0, [][]byte{sig}, sigLeaf, control)
+		if !tx.Verify(provider) {
+			t.Fatalf("Failed verifying script path spend with sighash %x", hashType)
+		}
+	}
+	other := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(1003))
+	sig, _ := tx.SignTapscript(0, provider, other, leafHash, bitcoinlib.SIGHASH_DEFAULT)
+	tx.SetTapscriptWitness(0, [][]byte{sig}, sigLeaf, control)
+	if tx.VerifyInput(0, provider) {
+		t.Fatal("Verified signature from the wrong key")
+	}
+	tx.SetTapscriptWitness(0, [][]byte{{}}, sigLeaf, control)
+	if tx.VerifyInput(0, provider) {
+		t.Fatal("Verified empty signature")
+	}
+
+	control, _ = tree.ControlBlock(internal.XOnly(), bitcoinlib.TAPROOT_LEAF_TAPSCRIPT, hashLeaf)
+	tx.SetTapscriptWitness(0, [][]byte{preimage}, hashLeaf, control)
+	if !tx.VerifyInput(0, provider) {
+		t.Fatal("Failed verifying hash lock leaf")
+	}
+	tx.SetTapscriptWitness(0, [][]byte{[]byte("wrong")}, hashLeaf, control)
+	if tx.VerifyInput(0, provider) {
+		t.Fatal("Verified hash lock with the wrong preimage")
+	}
+	tx.SetTapscriptWitness(0, [][]byte{preimage}, sigLeaf, control)
+	if tx.VerifyInput(0, provider) {
+		t.Fatal("Verified leaf with the control block of another leaf")
+	}
+}
+
+func TestTapscriptCheckSigAdd(t *testing.T) {
+	internal := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(2001))
+	keys := []*bitcoinlib.PrivateKey{
+		bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(2002)),
+		bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(2003)),
+		bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(2004)),
+	}
+	// <A> OP_CHECKSIG <B> OP_CHECKSIGADD <C> OP_CHECKSIGADD OP_2 OP_NUMEQUAL
+	script := checkSigScript(keys[0])
+	script = append(append(script, pushData(keys[1].XOnly())...), 0xba)
+	script = append(append(script, pushData(keys[2].XOnly())...), 0xba)
+	script = append(script, 0x52, 0x9c)
+	tree := bitcoinlib.NewTapLeaf(script)
+	tx, provider := tapscriptSpend(t, internal, tree)
+	control, _ := tree.ControlBlock(internal.XOnly(), bitcoinlib.TAPROOT_LEAF_TAPSCRIPT, script)
+	leafHash := tree.Hash()
+
+	sigs := make([][]byte, len(keys))
+	for index, key := range keys {
+		sigs[index], _ = tx.SignTapscript(0, provider, key, leafHash, bitcoinlib.SIGHASH_DEFAULT)
+	}
+	vectors := []struct {
+		stack    [][]byte
+		expected bool
+	}{
+		{[][]byte{sigs[2], {}, sigs[0]}, true},
+		{[][]byte{{}, sigs[1], sigs[0]}, true},
+		{[][]byte{sigs[2], sigs[1], sigs[0]}, false},
+		{[][]byte{{}, {}, sigs[0]}, false},
+		{[][]byte{sigs[1], {}, sigs[0]}, false},
+	}
+	for index, vector := range vectors {
+		tx.SetTapscriptWitness(0, vector.stack, script, control)
+		if tx.VerifyInput(0, provider) != vector.expected {
+			t.Fatalf("Failed at index %d\nExpected => %t\nGot => %t", index, vector.expected, !vector.expected)
+		}
+	}
+}
+
+func TestTapscriptRules(t *testing.T) {
+	internal := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(3001))
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(3002))
+	multisig := append(append([]byte{0x51}, pushData(key.Sec(bitcoinlib.COMPRESSED))...), 0x51, 0xae)
+	vectors := []struct {
+		name     string
+		script   []byte
+		stack    [][]byte
+		expected bool
+	}{
+		{"OP_SUCCESS80", []byte{0x50}, nil, true},
+		{"OP_SUCCESS after failure", []byte{0x00, 0x69, 0xfe}, nil, true},
+		{"truncated push", []byte{0x51, 0x4c, 0x05, 0x01}, nil, false},
+		{"minimal if true", []byte{0x63, 0x51, 0x67, 0x00, 0x68}, [][]byte{{0x01}}, true},
+		{"minimal if false", []byte{0x63, 0x00, 0x67, 0x51, 0x68}, [][]byte{{}}, true},
+		{"non minimal if", []byte{0x63, 0x51, 0x67, 0x00, 0x68}, [][]byte{{0x02}}, false},
+		{"unclean stack", []byte{0x51, 0x51}, nil, false},
+		{"checkmultisig", multisig, [][]byte{{}, {}}, false},
+		{"checksigadd empty signature", append(append([]byte{0x00, 0x00}, pushData(key.XOnly())...), 0xba, 0x00, 0x87), nil, true},
+		{"empty public key", []byte{0x00, 0x00, 0xac, 0x91}, nil, false},
+		{"unknown public key type", []byte{0x01, 0x02, 0xac}, [][]byte{{0x01}}, true},
+	}
+	for _, vector := range vectors {
+		tree := bitcoinlib.NewTapLeaf(vector.script)
+		tx, provider := tapscriptSpend(t, internal, tree)
+		control, _ := tree.ControlBlock(internal.XOnly(), bitcoinlib.TAPROOT_LEAF_TAPSCRIPT, vector.script)
+		tx.SetTapscriptWitness(0, vector.stack, vector.script, control)
+		if tx.VerifyInput(0, provider) != vector.expected {
+			t.Fatalf("Failed at %s\nExpected => %t\nGot => %t", vector.name, vector.expected, !vector.expected)
+		}
+	}
+
+	// Leaf versions other than tapscript are not executed
+	script := []byte{0x6a}
+	tree := bitcoinlib.NewTapLeafVersion(0xc2, script)
+	tx, provider := tapscriptSpend(t, internal, tree)
+	control, _ := tree.ControlBlock(internal.XOnly(), 0xc2, script)
+	tx.SetTapscriptWitness(0, nil, script, control)
+	if !tx.VerifyInput(0, provider) {
+		t.Fatal("Failed spending unknown leaf version")
+	}
+}
+
+// Signatures commit to the position of the last OP_CODESEPARATOR executed
+func TestTapscriptCodeSeparator(t *testing.T) {
+	internal := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(4001))
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(4002))
+	executed := append([]byte{0xab}, checkSigScript(key)...)
+	skipped := append([]byte{0x00, 0x63, 0xab, 0x68}, checkSigScript(key)...)
+	vectors := []struct {
+		script        []byte
+		codeSeparator uint32
+		expected      bool
+	}{
+		{executed, 0, true},
+		{executed, 1, false},
+		{executed, bitcoinlib.TAPSCRIPT_NO_CODESEPARATOR, false},
+		{skipped, bitcoinlib.TAPSCRIPT_NO_CODESEPARATOR, true},
+		{skipped, 2, false},
+	}
+	for index, vector := range vectors {
+		tree := bitcoinlib.NewTapLeaf(vector.script)
+		tx, provider := tapscriptSpend(t, internal, tree)
+		control, _ := tree.ControlBlock(internal.XOnly(), bitcoinlib.TAPROOT_LEAF_TAPSCRIPT, vector.script)
+		leafHash := bitcoinlib.TapLeafHash(bitcoinlib.TAPROOT_LEAF_TAPSCRIPT, vector.script)
+		hash, err := tx.SigHashTapscript(0, provider, bitcoinlib.SIGHASH_DEFAULT, leafHash, vector.codeSeparator)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := key.SignSchnorr(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.SetTapscriptWitness(0, [][]byte{sig.Serialize()}, vector.script, control)
+		if tx.VerifyInput(0, provider) != vector.expected {
+			t.Fatalf("Failed at index %d\nExpected => %t\nGot => %t", index, vector.expected, !vector.expected)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package bitcoinlib
+
+// Sequence of an input without relative lock time nor replaceability
+const SEQUENCE_FINAL = 0xffffffff
+
+// The sequence has no relative lock time when the flag is set (BIP68)
+const SEQUENCE_LOCKTIME_DISABLE_FLAG = 1 << 31
+
+// The relative lock time counts units of 512 seconds when the flag is
+// set, and blocks otherwise
+const SEQUENCE_LOCKTIME_TYPE_FLAG = 1 << 22
+const SEQUENCE_LOCKTIME_MASK = 0x0000ffff
+
+// Lock times on the stack are numbers of up to 5 bytes, so they can
+// reach the 32 bits of locktimes and sequences
+const LOCKTIME_NUM_SIZE = 5
+
+// Reads the lock time on top of the stack without popping it
+func topLocktime(ctx *ExecutionContext, stack *Stack) (int64, error) {
+	if Len(stack) < 1 {
+		return 0, SCRIPT_ERR_INVALID_STACK_OPERATION
+	}
+	locktime, err := ctx.scriptNum((*stack)[Len(stack)-1], LOCKTIME_NUM_SIZE)
+	if err != nil {
+		return 0, err
+	}
+	if locktime < 0 {
+		return 0, SCRIPT_ERR_NEGATIVE_LOCKTIME
+	}
+	return locktime, nil
+}
+
+// Sets the locktime, which has to be reached for the transaction to be
+// valid unless all its inputs are final
+func (tx *Transaction) SetLocktime(locktime uint32) {
+	tx.locktime = locktime
+}
+
+// Sets the sequence of the input. Relative lock times need version 2
+func (tx *Transaction) SetSequence(input int, sequence uint32) {
+	tx.inputs[input].sequence = sequence
+}
+
+func (tx *Transaction) SetVersion(version uint32) {
+	tx.version = *NewVersion(version)
+}
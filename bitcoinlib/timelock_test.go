@@ -0,0 +1,134 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"crypto/sha256"
+	"testing"
+)
+
+// Minimal little endian encoding of a script number
+func scriptNum(n int64) []byte {
+	if n == 0 {
+		return []byte{0}
+	}
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+	result := []byte{}
+	for n > 0 {
+		result = append(result, byte(n&0xff))
+		n >>= 8
+	}
+	if result[len(result)-1]&0x80 != 0 {
+		result = append(result, 0)
+	}
+	if negative {
+		result[len(result)-1] |= 0x80
+	}
+	return pushData(result)
+}
+
+// <n> OP_CHECKLOCKTIMEVERIFY or OP_CHECKSEQUENCEVERIFY, OP_DROP OP_1
+func timelockScript(n int64, opcode byte) []byte {
+	return append(scriptNum(n), opcode, 0x75, 0x51)
+}
+
+// Spends the P2SH or P2WSH output of the script with the given version,
+// locktime and sequence
+func timelockSpend(t *testing.T, script []byte, witness bool, version uint32, locktime uint32, sequence uint32) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+	hash := sha256.Sum256(script)
+	scriptPubKey := bitcoinlib.P2WSHPubKey(hash[:])
+	if !witness {
+		scriptPubKey = bitcoinlib.P2SHPubKey(bitcoinlib.Hash160(script))
+	}
+	tx, provider := spendOutput(scriptPubKey, version, locktime, sequence)
+	if witness {
+		return finalizeSpend(t, tx, nil, [][]byte{script}), provider
+	}
+	return finalizeSpend(t, tx, pushData(script), nil), provider
+}
+
+func TestCheckLockTimeVerify(t *testing.T) {
+	vectors := []struct {
+		locktime   int64
+		txLocktime uint32
+		sequence   uint32
+		valid      bool
+	}{
+		{100, 100, 0xfffffffe, true},
+		{99, 100, 0, true},
+		{0, 0, 0xfffffffe, true},
+		{101, 100, 0xfffffffe, false},
+		// Heights and times can't be compared
+		{100, 500000000, 0xfffffffe, false},
+		{500000000, 499999999, 0xfffffffe, false},
+		{500000100, 500000200, 0xfffffffe, true},
+		{0xffffffff, 0xffffffff, 0xfffffffe, true},
+		// A final input disables the locktime
+		{100, 200, 0xffffffff, false},
+		{-1, 100, 0xfffffffe, false},
+	}
+	for index, vector := range vectors {
+		script := timelockScript(vector.locktime, 0xb1)
+		for _, witness := range []bool{false, true} {
+			tx, provider := timelockSpend(t, script, witness, 1, vector.txLocktime, vector.sequence)
+			if tx.VerifyInput(0, provider) != vector.valid {
+				t.Fatalf("Failed at index %d (witness %t)\nExpected => %t\nGot => %t", index, witness, vector.valid, !vector.valid)
+			}
+			if tx.EvaluateTapscript(0, provider, script, nil, 50) != vector.valid {
+				t.Fatalf("Failed at index %d in tapscript\nExpected => %t\nGot => %t", index, vector.valid, !vector.valid)
+			}
+		}
+	}
+}
+
+func TestCheckSequenceVerify(t *testing.T) {
+	vectors := []struct {
+		sequence   int64
+		version    uint32
+		txSequence uint32
+		valid      bool
+	}{
+		{10, 2, 10, true},
+		{10, 2, 11, true},
+		{11, 2, 10, false},
+		// Relative lock times need version 2
+		{10, 1, 10, false},
+		// Blocks and units of 512 seconds can't be compared
+		{10, 2, bitcoinlib.SEQUENCE_LOCKTIME_TYPE_FLAG | 10, false},
+		{bitcoinlib.SEQUENCE_LOCKTIME_TYPE_FLAG | 5, 2, bitcoinlib.SEQUENCE_LOCKTIME_TYPE_FLAG | 5, true},
+		{bitcoinlib.SEQUENCE_LOCKTIME_TYPE_FLAG | 5, 2, 5, false},
+		// The input must enforce its relative lock time
+		{10, 2, bitcoinlib.SEQUENCE_LOCKTIME_DISABLE_FLAG | 10, false},
+		// Bits outside of the type flag and the mask are ignored
+		{1<<25 | 10, 2, 10, true},
+		{10, 2, 1<<25 | 10, true},
+		// The disable flag in the script makes it a NOP
+		{bitcoinlib.SEQUENCE_LOCKTIME_DISABLE_FLAG | 10, 1, bitcoinlib.SEQUENCE_FINAL, true},
+		{-1, 2, 10, false},
+		// More than 5 bytes
+		{1 << 40, 2, 10, false},
+	}
+	for index, vector := range vectors {
+		script := timelockScript(vector.sequence, 0xb2)
+		for _, witness := range []bool{false, true} {
+			tx, provider := timelockSpend(t, script, witness, vector.version, 0, vector.txSequence)
+			if tx.VerifyInput(0, provider) != vector.valid {
+				t.Fatalf("Failed at index %d (witness %t)\nExpected => %t\nGot => %t", index, witness, vector.valid, !vector.valid)
+			}
+			if tx.EvaluateTapscript(0, provider, script, nil, 50) != vector.valid {
+				t.Fatalf("Failed at index %d in tapscript\nExpected => %t\nGot => %t", index, vector.valid, !vector.valid)
+			}
+		}
+	}
+}
+
+func TestTimelockEmptyStack(t *testing.T) {
+	for index, opcode := range []byte{0xb1, 0xb2} {
+		tx, provider := timelockSpend(t, []byte{opcode, 0x51}, true, 2, 0, 0)
+		if tx.VerifyInput(0, provider) {
+			t.Fatalf("Failed at index %d: verified with an empty stack", index)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package bitcoinlib
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// An operation executed by the interpreter, with the stacks before and
+// after it. Branches holds the condition of each OP_IF and OP_NOTIF the
+// operation is nested in: true in the first branch, false after OP_ELSE
+type TraceStep struct {
+	Index         int
+	Operation     string // in ASM
+	Stack         [][]byte
+	AltStack      [][]byte
+	StackAfter    [][]byte
+	AltStackAfter [][]byte
+	Branches      []bool
+	Err           error
+}
+
+func formatStack(stack [][]byte) string {
+	items := make([]string, len(stack))
+	for i, item := range stack {
+		items[i] = hex.EncodeToString(item)
+	}
+	return "[" + strings.Join(items, " ") + "]"
+}
+
+func (s *TraceStep) String() string {
+	result := fmt.Sprintf("#%d %s%s\n  stack: %s -> %s", s.Index, strings.Repeat("  ", len(s.Branches)), s.Operation, formatStack(s.Stack), formatStack(s.StackAfter))
+	if len(s.AltStack) > 0 || len(s.AltStackAfter) > 0 {
+		result += fmt.Sprintf("\n  altstack: %s -> %s", formatStack(s.AltStack), formatStack(s.AltStackAfter))
+	}
+	if s.Err != nil {
+		result += fmt.Sprintf("\n  error: %s", s.Err)
+	}
+	return result
+}
+
+// Record of the scripts run by a verification. Err holds why it
+// failed, usually a *ScriptError, and is nil when the scripts are valid
+type Trace struct {
+	Steps []*TraceStep
+	Err   error
+}
+
+func (t *Trace) String() string {
+	lines := make([]string, 0, len(t.Steps)+1)
+	for _, step := range t.Steps {
+		lines = append(lines, step.String())
+	}
+	if t.Err != nil {
+		lines = append(lines, fmt.Sprintf("failed: %s", t.Err))
+	} else {
+		lines = append(lines, "success")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Records every operation run with the context into the trace
+func (ctx *ExecutionContext) SetTrace(trace *Trace) {
+	ctx.trace = trace
+}
+
+// Conditional branch being executed, until only end operations remain
+type branchFrame struct {
+	taken bool
+	end   int
+}
+
+// Called by OP_IF and OP_NOTIF before pushing the operations of the
+// branch they execute
+func (ctx *ExecutionContext) enterBranch(taken bool, end int) {
+	if ctx.trace != nil {
+		ctx.branches = append(ctx.branches, branchFrame{taken, end})
+	}
+}
+
+func traceStack(stack Stack) [][]byte {
+	result := make([][]byte, len(stack))
+	for i, op := range stack {
+		result[i] = stackBytes(op)
+	}
+	return result
+}
+
+// Runs the operation popped from cmds, recording it when tracing. A
+// failing operation returns a *ScriptError with its position among the
+// executed ones
+func (ctx *ExecutionContext) step(cmd Operation, stack *Stack, altstack *Stack, cmds *Stack) error {
+	index := ctx.steps
+	ctx.steps++
+	var step *TraceStep
+	if ctx.trace != nil {
+		for len(ctx.branches) > 0 && ctx.branches[len(ctx.branches)-1].end > len(*cmds) {
+			ctx.branches = ctx.branches[:len(ctx.branches)-1]
+		}
+		step = &TraceStep{
+			Index:     index,
+			Operation: FormatAsm([]Operation{cmd}),
+			Stack:     traceStack(*stack),
+			AltStack:  traceStack(*altstack),
+			Branches:  make([]bool, len(ctx.branches)),
+		}
+		for i, frame := range ctx.branches {
+			step.Branches[i] = frame.taken
+		}
+		ctx.trace.Steps = append(ctx.trace.Steps, step)
+	}
+	err := cmd.Operate(ctx, stack, altstack, cmds)
+	if step != nil {
+		step.StackAfter = traceStack(*stack)
+		step.AltStackAfter = traceStack(*altstack)
+	}
+	if err == nil {
+		return nil
+	}
+	err = ctx.fail(&ScriptError{ScriptErrorCodeOf(err), index, FormatAsm([]Operation{cmd}), ctx.inputIndex()})
+	if step != nil {
+		step.Err = err
+	}
+	return err
+}
+
+// Verifies the input like VerifyInputWithFlags, recording the scripts it
+// runs and why they fail
+func (tx *Transaction) TraceInput(input int, provider PrevoutProvider, flags ScriptFlags) *Trace {
+	trace := &Trace{}
+	ctx, err := NewExecutionContext(tx, input, provider, flags)
+	if err != nil {
+		trace.Err = err
+		return trace
+	}
+	ctx.SetTrace(trace)
+	trace.Err = tx.verifyInput(ctx)
+	return trace
+}
+
+// Steps through a trace, like a debugger replaying the execution
+type Debugger struct {
+	trace    *Trace
+	position int
+}
+
+func NewDebugger(trace *Trace) *Debugger {
+	return &Debugger{trace, -1}
+}
+
+// Moves to the next operation, returning nil at the end of the trace
+func (d *Debugger) Step() *TraceStep {
+	if d.position < len(d.trace.Steps) {
+		d.position++
+	}
+	return d.Current()
+}
+
+// Moves back to the previous operation, returning nil before the start
+func (d *Debugger) Back() *TraceStep {
+	if d.position >= 0 {
+		d.position--
+	}
+	return d.Current()
+}
+
+// The operation the debugger is at, nil before the first step and
+// after the last one
+func (d *Debugger) Current() *TraceStep {
+	if d.position < 0 || d.position >= len(d.trace.Steps) {
+		return nil
+	}
+	return d.trace.Steps[d.position]
+}
+
+// Steps until an operation fails or the trace ends
+func (d *Debugger) Continue() *TraceStep {
+	for step := d.Step(); step != nil; step = d.Step() {
+		if step.Err != nil {
+			return step
+		}
+	}
+	return nil
+}
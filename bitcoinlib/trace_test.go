@@ -0,0 +1,117 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func traceAsm(t *testing.T, scriptSig string, scriptPubKey string, flags bitcoinlib.ScriptFlags) (*bitcoinlib.Trace, error) {
+	sig, err := bitcoinlib.ParseAsm(scriptSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, err := bitcoinlib.ParseAsm(scriptPubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace := &bitcoinlib.Trace{}
+	ctx := bitcoinlib.NewDigestContext(strings.Repeat("00", 32), flags)
+	ctx.SetTrace(trace)
+	err = bitcoinlib.NewPubkey(pubKey).Combine(*bitcoinlib.NewScript(sig)).Execute(ctx, nil)
+	return trace, err
+}
+
+func TestTrace(t *testing.T) {
+	vectors := []struct {
+		scriptSig    string
+		scriptPubKey string
+		flags        bitcoinlib.ScriptFlags
+		operations   []string
+		branches     []int
+		err          bitcoinlib.ScriptErrorCode
+	}{
+		{"1", "IF 2 ELSE 3 ENDIF 2 OP_EQUAL", bitcoinlib.SCRIPT_VERIFY_NONE, []string{"1", "OP_IF", "2", "2", "OP_EQUAL"}, []int{0, 0, 1, 0, 0}, bitcoinlib.SCRIPT_ERR_OK},
+		{"0", "IF 2 ELSE 3 ENDIF 2 OP_EQUAL", bitcoinlib.SCRIPT_VERIFY_NONE, []string{"0", "OP_IF", "3", "2", "OP_EQUAL"}, []int{0, 0, 1, 0, 0}, bitcoinlib.SCRIPT_ERR_EVAL_FALSE},
+		{"1 1", "IF IF 4 ENDIF 5 ENDIF", bitcoinlib.SCRIPT_VERIFY_NONE, []string{"1", "1", "OP_IF", "OP_IF", "4", "5"}, []int{0, 0, 0, 1, 2, 1}, bitcoinlib.SCRIPT_ERR_OK},
+		{"1 2", "OP_EQUALVERIFY 1", bitcoinlib.SCRIPT_VERIFY_NONE, []string{"1", "2", "OP_EQUALVERIFY"}, []int{0, 0, 0}, bitcoinlib.SCRIPT_ERR_EQUALVERIFY},
+		{"", "OP_DROP", bitcoinlib.SCRIPT_VERIFY_NONE, []string{"OP_DROP"}, []int{0}, bitcoinlib.SCRIPT_ERR_INVALID_STACK_OPERATION},
+		{"1", "OP_DROP", bitcoinlib.SCRIPT_VERIFY_NONE, []string{"1", "OP_DROP"}, []int{0, 0}, bitcoinlib.SCRIPT_ERR_EVAL_FALSE},
+		{"1 1", "OP_NOP", bitcoinlib.SCRIPT_VERIFY_CLEANSTACK, []string{"1", "1", "OP_NOP"}, []int{0, 0, 0}, bitcoinlib.SCRIPT_ERR_CLEANSTACK},
+		{"1 1", "OP_NOP", bitcoinlib.SCRIPT_VERIFY_NONE, []string{"1", "1", "OP_NOP"}, []int{0, 0, 0}, bitcoinlib.SCRIPT_ERR_OK},
+	}
+	for index, vector := range vectors {
+		trace, err := traceAsm(t, vector.scriptSig, vector.scriptPubKey, vector.flags)
+		operations := []string{}
+		branches := []int{}
+		for _, step := range trace.Steps {
+			operations = append(operations, step.Operation)
+			branches = append(branches, len(step.Branches))
+		}
+		if !slices.Equal(operations, vector.operations) || !slices.Equal(branches, vector.branches) {
+			t.Fatalf("Failed at index %d\nExpected => %v %v\nGot => %v %v", index, vector.operations, vector.branches, operations, branches)
+		}
+		if err != trace.Err || bitcoinlib.ScriptErrorCodeOf(err) != vector.err {
+			t.Fatalf("Failed at index %d\nExpected => %v\nGot => %v %v", index, vector.err, err, trace.Err)
+		}
+	}
+
+	trace, _ := traceAsm(t, "0", "IF 2 ELSE 3 ENDIF", bitcoinlib.SCRIPT_VERIFY_NONE)
+	if step := trace.Steps[2]; !slices.Equal(step.Branches, []bool{false}) || len(step.Stack) != 0 || string(step.StackAfter[0]) != "\x03" {
+		t.Fatalf("Failed tracing the ELSE branch\nGot => %s", step)
+	}
+}
+
+func TestTraceScriptError(t *testing.T) {
+	trace, _ := traceAsm(t, "1 2 OP_TOALTSTACK", "OP_FROMALTSTACK 3 OP_EQUALVERIFY 1", bitcoinlib.SCRIPT_VERIFY_NONE)
+	var scriptErr *bitcoinlib.ScriptError
+	if !errors.As(trace.Err, &scriptErr) || scriptErr.Index != 5 || scriptErr.Operation != "OP_EQUALVERIFY" || scriptErr.Input != -1 {
+		t.Fatalf("Expected => OP_EQUALVERIFY failing at step 5\nGot => %v", trace.Err)
+	}
+	debugger := bitcoinlib.NewDebugger(trace)
+	if step := debugger.Continue(); step == nil || step.Index != 5 || step.Err != trace.Err {
+		t.Fatalf("Debugger didn't stop at the failed step\nGot => %v", step)
+	}
+	if step := debugger.Back(); step.Operation != "3" || len(step.StackAfter) != 3 {
+		t.Fatalf("Failed stepping back\nGot => %s", step)
+	}
+	if step := debugger.Step(); step.Index != 5 {
+		t.Fatalf("Failed stepping\nGot => %s", step)
+	}
+	if debugger.Step() != nil || debugger.Step() != nil || debugger.Back() == nil {
+		t.Fatal("Debugger stepped past the end of the trace")
+	}
+}
+
+func TestTraceInput(t *testing.T) {
+	key := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(6006))
+	script := builderScript(t, key.P2WPKHAddress(bitcoinlib.MAINNET_PARAMS))
+	txId := strings.Repeat("77", 32)
+	provider := bitcoinlib.NewMemoryProvider()
+	provider.Add(txId, 0, bitcoinlib.NewOutput(10000, script))
+	tx := bitcoinlib.NewTransaction()
+	tx.AddInput(txId, 0)
+	tx.AddOutputScript(9000, script)
+	if err := tx.SignInput(0, provider, key); err != nil {
+		t.Fatal(err)
+	}
+
+	trace := tx.TraceInput(0, provider, bitcoinlib.SCRIPT_VERIFY_STANDARD)
+	if trace.Err != nil || trace.Steps[len(trace.Steps)-1].Operation != "OP_CHECKSIG" {
+		t.Fatalf("Failed tracing a valid input\nGot => %s", trace)
+	}
+
+	// A different amount changes the signed digest
+	wrongAmount := bitcoinlib.NewMemoryProvider()
+	wrongAmount.Add(txId, 0, bitcoinlib.NewOutput(10001, script))
+	trace = tx.TraceInput(0, wrongAmount, bitcoinlib.SCRIPT_VERIFY_STANDARD)
+	var scriptErr *bitcoinlib.ScriptError
+	if !errors.As(trace.Err, &scriptErr) || scriptErr.Code != bitcoinlib.SCRIPT_ERR_SIG_NULLFAIL || scriptErr.Operation != "OP_CHECKSIG" || scriptErr.Input != 0 {
+		t.Fatalf("Expected => SIG_NULLFAIL at OP_CHECKSIG of input 0\nGot => %v", trace.Err)
+	}
+	if trace := tx.TraceInput(0, bitcoinlib.NewMemoryProvider(), bitcoinlib.SCRIPT_VERIFY_STANDARD); trace.Err == nil {
+		t.Fatal("Traced an input without its prevout")
+	}
+}
@@ -2,18 +2,39 @@ package bitcoinlib
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"slices"
 	"strings"
 )
 
 const VERSION_SIZE = 4
 
+// Locktimes below the threshold are block heights, timestamps otherwise
+const LOCKTIME_THRESHOLD = 500000000
+
+// Largest amount in satoshis, the 21 million bitcoins
+const MAX_MONEY = 21000000 * 100000000
+
+// Maximum weight of a block (BIP141)
+const MAX_BLOCK_WEIGHT = 4000000
+
+// Selects the parts of the transaction committed by a signature
+type SigHashType uint32
+
+const (
+	// Taproot only, commits like SIGHASH_ALL with a 64 bytes signature
+	SIGHASH_DEFAULT      SigHashType = 0x00
+	SIGHASH_ALL          SigHashType = 0x01
+	SIGHASH_NONE         SigHashType = 0x02
+	SIGHASH_SINGLE       SigHashType = 0x03
+	SIGHASH_ANYONECANPAY SigHashType = 0x80
+)
+
 // Version, VarInt, Input\s, VarInt, Output\s
 type Transaction struct {
 	segwit   bool
@@ -57,6 +78,7 @@ type Input struct {
 	scriptSig     *Script
 	sequence      uint32
 	items         [][]byte
+	rawScriptSig  []byte // scriptSig as serialized, nil when built here
 }
 
 type Output struct {
@@ -64,35 +86,13 @@ type Output struct {
 	scriptPubKey *ScriptPubKey
 }
 
-var TxCache map[string]*Transaction = make(map[string]*Transaction)
-
-func GetUrl(testnet bool) string {
-	if testnet {
-		return "http://testnet.programmingbitcoin.com"
-	}
-	return "http://mainnet.programmingbitcoin.com"
-}
-
-func FetchTransaction(tx_id string, testnet bool, fresh bool) (*Transaction, error) {
-	if _, ok := TxCache[tx_id]; fresh || !ok {
-		url := fmt.Sprintf("%s/tx/%s.hex", GetUrl(testnet), tx_id)
-		response, err := http.Get(url)
-		if err != nil {
-			return nil, err
-		}
-		buf, err := io.ReadAll(response.Body)
-		if err != nil {
-			return nil, err
-		}
-		buf = bytes.TrimSpace(buf)
-		buf, _ = hex.DecodeString(string(buf))
-		tx, err := ParseTransaction(bytes.NewReader(buf))
-		if err != nil {
-			return nil, err
-		}
-		TxCache[tx.Id()] = tx
+// Fetches a transaction from the default Esplora server of the network
+func FetchTransaction(tx_id string, params *ChainParams) (*Transaction, error) {
+	provider, err := DefaultProvider(params)
+	if err != nil {
+		return nil, err
 	}
-	return TxCache[tx_id], nil
+	return provider.Transaction(tx_id)
 }
 
 func (tx *Transaction) Id() string {
@@ -130,6 +130,21 @@ func parseUint64(from io.Reader) (uint64, error) {
 	return binary.LittleEndian.Uint64(buf), err
 }
 
+func NewOutput(amount uint64, scriptPubKey *ScriptPubKey) *Output {
+	return &Output{
+		amount,
+		scriptPubKey,
+	}
+}
+
+func (o *Output) Amount() uint64 {
+	return o.amount
+}
+
+func (o *Output) ScriptPubKey() *ScriptPubKey {
+	return o.scriptPubKey
+}
+
 func NewOutputFrom(from io.Reader) (*Output, error) {
 	amount, err := parseUint64(from)
 	if err != nil {
@@ -154,7 +169,11 @@ func NewInputFrom(from io.Reader) (*Input, error) {
 	if err != nil {
 		return nil, err
 	}
-	script, err := ParseScript(from)
+	raw, err := readScriptBytes(from)
+	if err != nil {
+		return nil, err
+	}
+	cmds, err := parseScriptFromBytes(raw)
 	if err != nil {
 		return nil, err
 	}
@@ -162,9 +181,10 @@ func NewInputFrom(from io.Reader) (*Input, error) {
 	return &Input{
 		previousID,
 		prevIndex,
-		script,
+		NewScript(cmds),
 		sequence,
 		nil,
+		raw,
 	}, err
 }
 
@@ -228,10 +248,8 @@ func ParseTransaction(from io.Reader) (*Transaction, error) {
 	}
 	if segwit {
 		for i := range inputArr {
-			value := make([]byte, 1)
-			from.Read(value)
-			items := value[0]
-			for _ = range items {
+			items := ReadVarInt(from)
+			for range items {
 				length := ReadVarInt(from)
 				item := make([]byte, length)
 				from.Read(item)
@@ -300,43 +318,41 @@ func (tx *Transaction) Serialize() []byte {
 		for _, input := range tx.inputs {
 			buf = append(buf, EncodeVarInt(uint64(len(input.items)))...)
 			for _, item := range input.items {
-				value := EncodeVarInt(uint64(len(item)))
-				buf = append(buf, value...)
-				if string(value) != string(item) {
-					buf = append(buf, item...)
-				}
+				buf = append(buf, EncodeVarInt(uint64(len(item)))...)
+				buf = append(buf, item...)
 			}
 		}
 	}
 	return binary.LittleEndian.AppendUint32(buf, tx.locktime)
 }
 
-func (t *Input) FetchTx(testnet bool) (*Transaction, error) {
-	return FetchTransaction(t.previousID, testnet, false)
+// Returns the output spent by the input
+func (t *Input) Prevout(provider PrevoutProvider) (*Output, error) {
+	return provider.Prevout(t.previousID, t.previousIndex)
 }
 
-func (t *Input) Value(testnet bool) (uint64, error) {
-	tx, err := t.FetchTx(testnet)
+func (t *Input) Value(provider PrevoutProvider) (uint64, error) {
+	prevout, err := t.Prevout(provider)
 	if err != nil {
 		return 0, err
 	}
-	return tx.GetOutputsAmount()[t.previousIndex], nil
+	return prevout.amount, nil
 }
 
-func (t *Input) ScriptPubkey(testnet bool) (*ScriptPubKey, error) {
-	tx, err := t.FetchTx(testnet)
+func (t *Input) ScriptPubkey(provider PrevoutProvider) (*ScriptPubKey, error) {
+	prevout, err := t.Prevout(provider)
 	if err != nil {
 		return nil, err
 	}
-	return tx.outputs[t.previousIndex].scriptPubKey, nil
+	return prevout.scriptPubKey, nil
 }
 
 // Returns the implied fee of a Transaction
-func (tx *Transaction) Fee(testnet bool) int64 {
+func (tx *Transaction) Fee(provider PrevoutProvider) int64 {
 	var totalOutput uint64
 	var totalInput uint64
 	for _, val := range tx.inputs {
-		valTotal, err := val.Value(testnet)
+		valTotal, err := val.Value(provider)
 		if err != nil {
 			return -1
 		}
@@ -353,36 +369,6 @@ func (tx *Transaction) Fee(testnet bool) int64 {
 	return int64(totalInput - totalOutput)
 }
 
-// Returns the input serialization with
-// the pubkey of the previous transaction
-// instead of the script sig
-// If empty is true, does not replace the ScripSig with the
-// previous ScriptPubKey
-func (in *Input) ReplaceScriptSig(empty bool, testnet bool, p2sh bool, p2wsh bool, segwit bool) []byte {
-	buf, _ := hex.DecodeString(in.previousID)
-	slices.Reverse(buf)
-	buf = binary.LittleEndian.AppendUint32(buf, in.previousIndex)
-	if empty {
-		buf = append(buf, 0x00)
-	} else if segwit && p2wsh {
-		cmds, _ := parseScriptFromBytes(in.items[len(in.items)-1])
-		pubKey := NewPubkey(cmds)
-		buf = append(buf, pubKey.Serialize()...)
-	} else {
-		pubKey, _ := FetchTransaction(in.previousID, testnet, false)
-		scriptPubKey := pubKey.outputs[in.previousIndex].scriptPubKey
-		if p2sh {
-			cmds, _ := parseScriptFromBytes(in.scriptSig.cmds[len(in.scriptSig.cmds)-1].(*ScriptVal).Val)
-			script := NewPubkey(cmds)
-			buf = append(buf, script.Serialize()...)
-		} else {
-			buf = append(buf, scriptPubKey.Serialize()...)
-		}
-	}
-	buf = binary.LittleEndian.AppendUint32(buf, in.sequence)
-	return buf
-}
-
 func (tx *Transaction) hashprevouts() []byte {
 	prevouts := []byte{}
 	for _, txIn := range tx.inputs {
@@ -401,20 +387,209 @@ func (tx *Transaction) hashsequence() []byte {
 	return Hash256(sequences)
 }
 
-func (tx *Transaction) SigHash(input int, testnet bool, p2sh bool) []byte {
+// Legacy signature hash of the input, committing to scriptCode
+// in place of its scriptSig. Any hash type byte is accepted, its
+// low bits select the outputs like in Bitcoin Core
+func (tx *Transaction) legacySigHash(input int, scriptCode []byte, hashType SigHashType) ([]byte, error) {
+	if input < 0 || input >= len(tx.inputs) {
+		return nil, fmt.Errorf("input %d out of range", input)
+	}
+	base := hashType & 0x1f
+	anyoneCanPay := hashType&SIGHASH_ANYONECANPAY != 0
+	if base == SIGHASH_SINGLE && input >= len(tx.outputs) {
+		// Without a matching output the digest is the number one,
+		// a bug that is now part of consensus
+		one := make([]byte, 32)
+		one[0] = 0x01
+		return one, nil
+	}
 	buf := tx.version.Serialize()
-	buf = append(buf, EncodeVarInt(uint64(len(tx.inputs)))...)
-	for index, val := range tx.inputs {
-		buf = append(buf, val.ReplaceScriptSig(index != input, testnet, p2sh, false, tx.segwit)...)
+	inputs := tx.inputs
+	if anyoneCanPay {
+		inputs = tx.inputs[input : input+1]
 	}
-	buf = append(buf, EncodeVarInt(uint64(len(tx.outputs)))...)
-	for _, val := range tx.outputs {
-		buf = append(buf, val.Serialize()...)
+	buf = append(buf, EncodeVarInt(uint64(len(inputs)))...)
+	for _, in := range inputs {
+		buf = append(buf, in.outpoint()...)
+		if in == tx.inputs[input] {
+			buf = append(buf, legacyScriptCode(scriptCode)...)
+			buf = binary.LittleEndian.AppendUint32(buf, in.sequence)
+			continue
+		}
+		buf = append(buf, 0x00)
+		// The other inputs can be replaced when outputs are not all signed
+		if base == SIGHASH_NONE || base == SIGHASH_SINGLE {
+			buf = binary.LittleEndian.AppendUint32(buf, 0)
+		} else {
+			buf = binary.LittleEndian.AppendUint32(buf, in.sequence)
+		}
+	}
+	switch base {
+	case SIGHASH_NONE:
+		buf = append(buf, 0x00)
+	case SIGHASH_SINGLE:
+		buf = append(buf, EncodeVarInt(uint64(input+1))...)
+		for range input {
+			// Outputs before the signed one are blanked with a -1 amount
+			buf = binary.LittleEndian.AppendUint64(buf, 0xffffffffffffffff)
+			buf = append(buf, 0x00)
+		}
+		buf = append(buf, tx.outputs[input].Serialize()...)
+	default:
+		buf = append(buf, EncodeVarInt(uint64(len(tx.outputs)))...)
+		for _, val := range tx.outputs {
+			buf = append(buf, val.Serialize()...)
+		}
 	}
 	buf = binary.LittleEndian.AppendUint32(buf, tx.locktime)
-	buf = append(buf, 0x01, 0x00, 0x00, 0x00) //Append SIGHASH_ALL
-	hashed := Hash256(buf)
-	return hashed
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(hashType))
+	return Hash256(buf), nil
+}
+
+// Serializes scriptCode for the legacy digest without its OP_CODESEPARATORs,
+// like Bitcoin Core: the bytes of a push past the end are left out, but
+// still counted by the length
+func legacyScriptCode(scriptCode []byte) []byte {
+	code := []byte{}
+	separators := 0
+	index := 0
+	for index < len(scriptCode) {
+		opcode := scriptCode[index]
+		index++
+		if opcode == 0xab {
+			separators++
+			continue
+		}
+		size, width := int(opcode), 0
+		switch opcode {
+		case 76:
+			width = 1
+		case 77:
+			width = 2
+		case 78:
+			width = 4
+		}
+		if opcode > 78 {
+			size = 0
+		} else if width > 0 {
+			if index+width > len(scriptCode) {
+				code = append(code, opcode)
+				break
+			}
+			size = int(FromLittleEndian(slices.Clone(scriptCode[index : index+width])).value.Int64())
+		}
+		if index+width+size > len(scriptCode) {
+			code = append(code, scriptCode[index-1:index+width]...)
+			break
+		}
+		code = append(code, scriptCode[index-1:index+width+size]...)
+		index += width + size
+	}
+	return append(EncodeVarInt(uint64(len(scriptCode)-separators)), code...)
+}
+
+// Size of the operation the script starts with, the rest of the script
+// when its push is truncated
+func operationSize(script []byte) int {
+	opcode := script[0]
+	size, width := 0, 0
+	switch {
+	case opcode < 76:
+		size = int(opcode)
+	case opcode == 76:
+		width = 1
+	case opcode == 77:
+		width = 2
+	case opcode == 78:
+		width = 4
+	}
+	if 1+width > len(script) {
+		return len(script)
+	}
+	if width > 0 {
+		size = int(FromLittleEndian(slices.Clone(script[1 : 1+width])).value.Int64())
+	}
+	if 1+width+size > len(script) {
+		return len(script)
+	}
+	return 1 + width + size
+}
+
+// Removes the pushes of data from the script like Bitcoin Core's
+// FindAndDelete, matching them at the start of operations only
+func findAndDelete(script []byte, data []byte) []byte {
+	pattern := serializeScriptToBytes([]Operation{&ScriptVal{data}})
+	result := []byte{}
+	index := 0
+	for index < len(script) {
+		if bytes.HasPrefix(script[index:], pattern) {
+			index += len(pattern)
+			continue
+		}
+		next := index + operationSize(script[index:])
+		result = append(result, script[index:next]...)
+		index = next
+	}
+	return result
+}
+
+// Replaces the scriptSig with the one serialized in raw
+func (in *Input) setScriptSig(raw []byte) error {
+	cmds, err := parseScriptFromBytes(raw)
+	if err != nil {
+		return err
+	}
+	in.scriptSig, in.rawScriptSig = NewScript(cmds), raw
+	return nil
+}
+
+// The scriptSig as serialized in the transaction
+func (in *Input) scriptSigBytes() []byte {
+	if in.rawScriptSig != nil {
+		return in.rawScriptSig
+	}
+	return serializeScriptToBytes(in.scriptSig.cmds)
+}
+
+// Returns the redeem script pushed last by the scriptSig of a P2SH input
+func (in *Input) redeemScript() (*ScriptPubKey, error) {
+	if len(in.scriptSig.cmds) == 0 {
+		return nil, errors.New("missing redeem script")
+	}
+	last, ok := in.scriptSig.cmds[len(in.scriptSig.cmds)-1].(*ScriptVal)
+	if !ok {
+		return nil, errors.New("missing redeem script")
+	}
+	return parsedScript(last.Val)
+}
+
+// Returns the script committed to by the legacy digest of the input:
+// the redeem script for P2SH, the script of the prevout otherwise
+func (tx *Transaction) legacyScriptCode(input int, provider PrevoutProvider, p2sh bool) ([]byte, error) {
+	script, err := tx.inputs[input].ScriptPubkey(provider)
+	if err != nil {
+		return nil, err
+	}
+	if p2sh {
+		script, err = tx.inputs[input].redeemScript()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return script.scriptBytes(), nil
+}
+
+func (tx *Transaction) SigHash(input int, provider PrevoutProvider, p2sh bool) ([]byte, error) {
+	return tx.SigHashWithType(input, provider, p2sh, SIGHASH_ALL)
+}
+
+// Legacy signature hash of the input for any sighash type
+func (tx *Transaction) SigHashWithType(input int, provider PrevoutProvider, p2sh bool, hashType SigHashType) ([]byte, error) {
+	scriptCode, err := tx.legacyScriptCode(input, provider, p2sh)
+	if err != nil {
+		return nil, err
+	}
+	return tx.legacySigHash(input, scriptCode, hashType)
 }
 
 func (tx *Transaction) hashOutputs() []byte {
@@ -425,66 +600,202 @@ func (tx *Transaction) hashOutputs() []byte {
 	return Hash256(total)
 }
 
-func (tx *Transaction) SigHashBIP143(input int, testnet bool, p2sh bool) []byte {
+// BIP143 signature hash of the input spending amount, committing to scriptCode
+func (tx *Transaction) segwitSigHash(input int, scriptCode []byte, amount uint64, hashType SigHashType) ([]byte, error) {
+	if input < 0 || input >= len(tx.inputs) {
+		return nil, fmt.Errorf("input %d out of range", input)
+	}
+	base := hashType & 0x1f
+	anyoneCanPay := hashType&SIGHASH_ANYONECANPAY != 0
+	// Parts of the transaction that are not signed are zero hashes
+	hashPrevouts := make([]byte, 32)
+	hashSequence := make([]byte, 32)
+	hashOutputs := make([]byte, 32)
+	if !anyoneCanPay {
+		hashPrevouts = tx.hashprevouts()
+	}
+	if !anyoneCanPay && base != SIGHASH_SINGLE && base != SIGHASH_NONE {
+		hashSequence = tx.hashsequence()
+	}
+	if base != SIGHASH_SINGLE && base != SIGHASH_NONE {
+		hashOutputs = tx.hashOutputs()
+	} else if base == SIGHASH_SINGLE && input < len(tx.outputs) {
+		hashOutputs = Hash256(tx.outputs[input].Serialize())
+	}
+	in := tx.inputs[input]
 	buf := tx.version.Serialize()
-	buf = append(buf, tx.hashprevouts()...)
-	buf = append(buf, tx.hashsequence()...)
-	lastTx, _ := hex.DecodeString(tx.inputs[input].previousID)
-	buf = append(buf, lastTx...)
-	buf = binary.LittleEndian.AppendUint32(buf, tx.inputs[input].previousIndex)
+	buf = append(buf, hashPrevouts...)
+	buf = append(buf, hashSequence...)
+	buf = append(buf, in.outpoint()...)
+	buf = append(buf, EncodeVarInt(uint64(len(scriptCode)))...)
+	buf = append(buf, scriptCode...)
+	buf = binary.LittleEndian.AppendUint64(buf, amount)
+	buf = binary.LittleEndian.AppendUint32(buf, in.sequence)
+	buf = append(buf, hashOutputs...)
+	buf = binary.LittleEndian.AppendUint32(buf, tx.locktime)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(hashType))
+	return Hash256(buf), nil
+}
+
+// Returns the BIP143 scriptCode of a witness program: the implied P2PKH
+// script for P2WPKH and the witness script for P2WSH
+func witnessScriptCode(program *ScriptPubKey, witnessScript []byte) ([]byte, error) {
+	if program.isP2WPKH() {
+		return serializeScriptToBytes(P2PKHScript(program.cmds[1].(*ScriptVal).Val).cmds), nil
+	}
+	if program.isP2WSH() {
+		if witnessScript == nil {
+			return nil, errors.New("missing witness script")
+		}
+		return witnessScript, nil
+	}
+	return nil, errors.New("script is not a witness program")
+}
+
+// Returns the BIP143 scriptCode of the input and the amount it spends
+func (tx *Transaction) segwitScriptCode(input int, provider PrevoutProvider, p2sh bool) ([]byte, uint64, error) {
+	in := tx.inputs[input]
+	prevout, err := in.Prevout(provider)
+	if err != nil {
+		return nil, 0, err
+	}
+	program := prevout.scriptPubKey
 	if p2sh {
-		redeemScript, _ := parseScriptFromBytes(tx.inputs[input].scriptSig.cmds[len(tx.inputs[input].scriptSig.cmds)-1].(*ScriptVal).Val)
-		redeem := NewPubkey(redeemScript)
-		if redeem.isP2WSH() {
-			last := tx.inputs[input].items[len(tx.inputs[input].items)-1]
-			buf = append(buf, EncodeVarInt(uint64(len(last)))...)
-			buf = append(buf, last...)
-		} else {
-			buf = append(buf, P2WPKHPubKey(redeemScript[1].(*ScriptVal).Val).Serialize()...)
+		program, err = in.redeemScript()
+		if err != nil {
+			return nil, 0, err
 		}
-	} else {
-		buf = append(buf, tx.inputs[input].ReplaceScriptSig(false, testnet, p2sh, false, tx.segwit)...)
 	}
-	value, _ := tx.inputs[input].Value(testnet)
-	buf = binary.LittleEndian.AppendUint64(buf, value)
-	buf = binary.LittleEndian.AppendUint32(buf, tx.inputs[input].sequence)
-	buf = append(buf, tx.hashOutputs()...)
-	buf = binary.LittleEndian.AppendUint32(buf, tx.locktime)
-	buf = append(buf, 0x01, 0x00, 0x00, 0x00) //Append SIGHASH_ALL
-	return Hash256(buf)
+	var witnessScript []byte
+	if len(in.items) > 0 {
+		witnessScript = in.items[len(in.items)-1]
+	}
+	scriptCode, err := witnessScriptCode(program, witnessScript)
+	if err != nil {
+		return nil, 0, err
+	}
+	return scriptCode, prevout.amount, nil
+}
+
+func (tx *Transaction) SigHashBIP143(input int, provider PrevoutProvider, p2sh bool) ([]byte, error) {
+	return tx.SigHashBIP143WithType(input, provider, p2sh, SIGHASH_ALL)
 }
 
-func (tx *Transaction) VerifyInput(input int, testnet bool) bool {
-	//Get the public key that goes with this input script
-	pubKey, err := tx.inputs[input].ScriptPubkey(testnet)
+// BIP143 signature hash of the input for any sighash type
+func (tx *Transaction) SigHashBIP143WithType(input int, provider PrevoutProvider, p2sh bool, hashType SigHashType) ([]byte, error) {
+	scriptCode, amount, err := tx.segwitScriptCode(input, provider, p2sh)
 	if err != nil {
-		return false
+		return nil, err
 	}
+	return tx.segwitSigHash(input, scriptCode, amount, hashType)
+}
 
-	//First of, get Z
-	var hash []byte
-	if tx.segwit {
-		hash = tx.SigHashBIP143(input, testnet, pubKey.isP2SH())
-	} else {
-		hash = tx.SigHash(input, testnet, pubKey.isP2SH())
+func (tx *Transaction) VerifyInput(input int, provider PrevoutProvider) bool {
+	return tx.VerifyInputWithFlags(input, provider, SCRIPT_VERIFY_CONSENSUS)
+}
+
+// Verifies the input enforcing the rules of the flags, which can be
+// SCRIPT_VERIFY_CONSENSUS, SCRIPT_VERIFY_STANDARD or any combination
+func (tx *Transaction) VerifyInputWithFlags(input int, provider PrevoutProvider, flags ScriptFlags) bool {
+	return tx.ValidateInput(input, provider, flags) == nil
+}
+
+// Verifies the input like VerifyInputWithFlags, returning why it is
+// invalid: a *ScriptError when its scripts fail, or the error fetching
+// the output it spends
+func (tx *Transaction) ValidateInput(input int, provider PrevoutProvider, flags ScriptFlags) error {
+	ctx, err := NewExecutionContext(tx, input, provider, flags)
+	if err != nil {
+		return err
 	}
+	return tx.verifyInput(ctx)
+}
+
+func (tx *Transaction) verifyInput(ctx *ExecutionContext) error {
+	input, flags := ctx.input, ctx.flags
+	if ctx.sigVersion == SIGVERSION_TAPROOT {
+		return tx.verifyTaprootInput(ctx, ctx.scriptPubKey.cmds[1].(*ScriptVal).Val)
+	}
+	scriptSig := tx.inputs[input].scriptSig
+	// The scriptSig of a P2SH input can only push the redeem script and
+	// its arguments
+	if !isPushOnly(scriptSig.cmds) && (flags.has(SCRIPT_VERIFY_SIGPUSHONLY) || (flags.has(SCRIPT_VERIFY_P2SH) && ctx.scriptPubKey.isP2SH())) {
+		return ctx.fail(SCRIPT_ERR_SIG_PUSHONLY)
+	}
+	// Parsing forgets how the data was pushed, so the pushes failing
+	// MINIMALDATA when executed come from the serialized scriptSig
+	ctx.markNonMinimal(tx.inputs[input].scriptSigBytes(), scriptSig.cmds)
+	ctx.markCodeSeparators(ctx.scriptPubKey.cmds)
 	//Combine and evaluate the final Script
-	combined := pubKey.Combine(*tx.inputs[input].scriptSig)
-	return combined.Evaluate(hex.EncodeToString(hash), tx.inputs[input].items)
+	combined := ctx.scriptPubKey.Combine(*scriptSig)
+	if !flags.has(SCRIPT_VERIFY_WITNESS) {
+		return combined.Execute(ctx, tx.inputs[input].items)
+	}
+	_, program, p2sh, isWitness := ctx.witnessProgram()
+	if !isWitness {
+		if err := combined.Execute(ctx, nil); err != nil {
+			return err
+		}
+		// Only witness programs can be spent with a witness
+		if len(tx.inputs[input].items) > 0 {
+			return ctx.fail(SCRIPT_ERR_WITNESS_UNEXPECTED)
+		}
+		return nil
+	}
+	// The scriptSig of a witness program can only be the single push of
+	// the redeem script of a P2SH output
+	if p2sh {
+		if len(scriptSig.cmds) != 1 || !bytes.Equal(tx.inputs[input].scriptSigBytes(), serializeScriptToBytes(scriptSig.cmds)) {
+			return ctx.fail(SCRIPT_ERR_WITNESS_MALLEATED_P2SH)
+		}
+		if _, ok := scriptSig.cmds[0].(*ScriptVal); !ok {
+			return ctx.fail(SCRIPT_ERR_WITNESS_MALLEATED_P2SH)
+		}
+	} else if len(scriptSig.cmds) != 0 {
+		return ctx.fail(SCRIPT_ERR_WITNESS_MALLEATED)
+	}
+	if ctx.sigVersion != SIGVERSION_BASE {
+		return combined.Execute(ctx, tx.inputs[input].items)
+	}
+	// Programs of unknown versions are left to future soft forks, they
+	// only have to leave true on the stack
+	if p2sh {
+		if err := combined.executeScriptHash(ctx); err != nil {
+			return err
+		}
+	}
+	if !castToBool(&ScriptVal{program}) {
+		return ctx.fail(SCRIPT_ERR_EVAL_FALSE)
+	}
+	if flags.has(SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM) {
+		return ctx.fail(SCRIPT_ERR_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM)
+	}
+	return nil
+}
+
+func (tx *Transaction) Verify(provider PrevoutProvider) bool {
+	return tx.VerifyWithFlags(provider, SCRIPT_VERIFY_CONSENSUS)
 }
 
-func (tx *Transaction) Verify(testnet bool) bool {
+// Verifies every input enforcing the rules of the flags
+func (tx *Transaction) VerifyWithFlags(provider PrevoutProvider, flags ScriptFlags) bool {
+	return tx.Validate(provider, flags) == nil
+}
+
+// Verifies the transaction like VerifyWithFlags, returning the error of
+// the first invalid input
+func (tx *Transaction) Validate(provider PrevoutProvider, flags ScriptFlags) error {
 	//Validating the fee
-	if tx.Fee(testnet) < 0 {
-		return false
+	if tx.Fee(provider) < 0 {
+		return errors.New("outputs spend more than the inputs")
 	}
 	//Need to validate the script of each input
 	for i := range tx.inputs {
-		if !tx.VerifyInput(i, testnet) {
-			return false
+		if err := tx.ValidateInput(i, provider, flags); err != nil {
+			return err
 		}
 	}
-	return true
+	return nil
 }
 
 func NewTransaction() *Transaction {
@@ -497,6 +808,50 @@ func NewTransaction() *Transaction {
 	}
 }
 
+// Checks the rules of Bitcoin Core's CheckTransaction, which don't
+// depend on the outputs spent or the chain
+func (tx *Transaction) Check() error {
+	if len(tx.inputs) == 0 {
+		return errors.New("transaction without inputs")
+	}
+	if len(tx.outputs) == 0 {
+		return errors.New("transaction without outputs")
+	}
+	if tx.BaseSize()*WITNESS_SCALE_FACTOR > MAX_BLOCK_WEIGHT {
+		return errors.New("transaction larger than a block")
+	}
+	var total uint64
+	for index, out := range tx.outputs {
+		if out.amount > MAX_MONEY {
+			return fmt.Errorf("amount of output %d out of range", index)
+		}
+		total += out.amount
+		if total > MAX_MONEY {
+			return errors.New("total amount of the outputs out of range")
+		}
+	}
+	spent := map[string]bool{}
+	for index, in := range tx.inputs {
+		outpoint := fmt.Sprintf("%s:%d", in.previousID, in.previousIndex)
+		if spent[outpoint] {
+			return fmt.Errorf("input %d spends the outpoint of a previous input", index)
+		}
+		spent[outpoint] = true
+	}
+	if tx.IsCoinbase() {
+		if size := len(tx.inputs[0].scriptSigBytes()); size < 2 || size > 100 {
+			return fmt.Errorf("coinbase scriptSig of %d bytes", size)
+		}
+		return nil
+	}
+	for index, in := range tx.inputs {
+		if in.previousID == strings.Repeat("00", 32) && in.previousIndex == 0xffffffff {
+			return fmt.Errorf("input %d spends a null outpoint", index)
+		}
+	}
+	return nil
+}
+
 func (tx *Transaction) IsCoinbase() bool {
 	coinbase := len(tx.inputs) == 1
 
@@ -518,32 +873,161 @@ func (tx *Transaction) AddInput(previousID string, previousIndex uint32) {
 		&Script{},
 		0xffffffff,
 		nil,
+		nil,
 	}
 	tx.inputs = append(tx.inputs, newInput)
 }
 
-func (tx *Transaction) SignInput(input int, testnet bool, key *PrivateKey) {
-	z := tx.SigHash(input, testnet, false)
-	zInt := FromHexString("0x" + hex.EncodeToString(z))
-	sig := key.Sign(zInt)
-	script := P2PKHSignature(append(sig.Der(), 0x01), key.Sec(COMPRESSED))
-	tx.inputs[input].scriptSig = script
+// Signs the input with the key, building the scriptSig and witness for
+// P2PK, P2PKH, P2WPKH and P2SH-P2WPKH outputs. P2TR inputs are signed
+// through the key path, assuming the output has no script tree
+func (tx *Transaction) SignInput(input int, provider PrevoutProvider, key *PrivateKey) error {
+	scriptPubKey, err := tx.inputs[input].ScriptPubkey(provider)
+	if err != nil {
+		return err
+	}
+	if scriptPubKey.isP2TR() {
+		return tx.SignTaprootInput(input, provider, key, nil, SIGHASH_DEFAULT)
+	}
+	return tx.SignInputWithType(input, provider, key, SIGHASH_ALL)
+}
+
+// Signs the input committing to the parts of the transaction selected
+// by the sighash type
+func (tx *Transaction) SignInputWithType(input int, provider PrevoutProvider, key *PrivateKey, hashType SigHashType) error {
+	scriptPubKey, err := tx.inputs[input].ScriptPubkey(provider)
+	if err != nil {
+		return err
+	}
+	if scriptPubKey.isP2TR() {
+		return tx.SignTaprootInput(input, provider, key, nil, hashType)
+	}
+	var script []byte
+	if scriptPubKey.isP2SH() {
+		// A single key can only spend a P2SH wrapping its P2WPKH program
+		script = serializeScriptToBytes(P2WPKHPubKey(Hash160(key.Sec(COMPRESSED))).cmds)
+	}
+	return tx.SignInputScript(input, provider, []*PrivateKey{key}, script, hashType)
+}
+
+// Signs the input with every key and builds its scriptSig and witness.
+// script is the redeem script of P2SH outputs or the witness script of
+// P2WSH and P2SH-P2WSH outputs, and nil for outputs spent directly like
+// P2PKH, P2WPKH or bare multisig. Multisig scripts need enough keys to
+// be satisfied, partial signing goes through a Psbt
+func (tx *Transaction) SignInputScript(input int, provider PrevoutProvider, keys []*PrivateKey, script []byte, hashType SigHashType) error {
+	in, prevout, err := tx.signScriptInput(input, provider, keys, script, hashType)
+	if err != nil {
+		return err
+	}
+	return tx.finalizeScriptInput(input, in, prevout, in.satisfy)
+}
+
+// Signs the input spending a P2WSH or P2SH-P2WSH output whose witness
+// script is the miniscript, satisfying it with the signatures of the
+// keys, the preimages and the lock times of the transaction
+func (tx *Transaction) SignMiniscript(input int, provider PrevoutProvider, ms *Miniscript, keys []*PrivateKey, preimages [][]byte, hashType SigHashType) error {
+	in, prevout, err := tx.signScriptInput(input, provider, keys, ms.Serialize(), hashType)
+	if err != nil {
+		return err
+	}
+	if in.WitnessScript == nil {
+		return fmt.Errorf("input %d doesn't spend the P2WSH output of the miniscript", input)
+	}
+	for _, preimage := range preimages {
+		if err := in.addPreimage(preimage); err != nil {
+			return fmt.Errorf("failed signing input %d: %w", input, err)
+		}
+	}
+	return tx.finalizeScriptInput(input, in, prevout, in.satisfyMiniscript(ms, tx, input))
+}
+
+// Returns the signatures of the keys for the input in a PSBT input,
+// along with the output it spends
+func (tx *Transaction) signScriptInput(input int, provider PrevoutProvider, keys []*PrivateKey, script []byte, hashType SigHashType) (*PsbtInput, *Output, error) {
+	if !validSigHashType(hashType) {
+		return nil, nil, fmt.Errorf("invalid sighash type: %x", hashType)
+	}
+	prevout, err := tx.inputs[input].Prevout(provider)
+	if err != nil {
+		return nil, nil, err
+	}
+	in := newPsbtInput()
+	in.SigHashType = hashType
+	scriptPubKey := prevout.scriptPubKey
+	if scriptPubKey.isP2WSH() {
+		in.WitnessScript = script
+	} else if scriptPubKey.isP2SH() && script != nil {
+		in.RedeemScript = script
+		// A witness script is wrapped in the P2WSH program it hashes to
+		hash := sha256.Sum256(script)
+		program := serializeScriptToBytes(P2WSHPubKey(hash[:]).cmds)
+		if bytes.Equal(Hash160(program), scriptPubKey.cmds[1].(*ScriptVal).Val) {
+			in.RedeemScript = program
+			in.WitnessScript = script
+		}
+	}
+	for _, key := range keys {
+		if err := in.sign(tx, input, prevout, key); err != nil {
+			return nil, nil, err
+		}
+	}
+	return in, prevout, nil
 }
 
-func (tx *Transaction) AddOutput(amount uint64, address string) {
-	hash := FromBase58Address(address)
-	encoded, _ := hex.DecodeString(hash)
+// Sets the scriptSig and witness of the input from the signed PSBT input
+func (tx *Transaction) finalizeScriptInput(input int, in *PsbtInput, prevout *Output, satisfy func(*ScriptPubKey) ([][]byte, error)) error {
+	scriptSig, witness, err := in.finalScripts(prevout, satisfy)
+	if err != nil {
+		return fmt.Errorf("failed signing input %d: %w", input, err)
+	}
+	if err := tx.inputs[input].setScriptSig(scriptSig); err != nil {
+		return err
+	}
+	tx.inputs[input].items = witness
+	if len(witness) > 0 {
+		tx.segwit = true
+	}
+	return nil
+}
+
+// Adds an output paying amount to the address, which can be
+// of any standard type but has to belong to the network
+func (tx *Transaction) AddOutput(amount uint64, address string, params *ChainParams) error {
+	script, err := AddressToScriptPubKey(address, params)
+	if err != nil {
+		return err
+	}
+	tx.AddOutputScript(amount, script)
+	return nil
+}
+
+func (tx *Transaction) AddOutputScript(amount uint64, script *ScriptPubKey) {
 	newOutput := &Output{
 		amount,
-		P2PKHScript(encoded),
+		script,
 	}
 	tx.outputs = append(tx.outputs, newOutput)
 }
 
-func (tx *Transaction) Sign(testnet bool, key *PrivateKey) {
+// Returns the addresses each output pays to, or an
+// empty string for outputs without address
+func (tx *Transaction) GetOutputAddresses(params *ChainParams) []string {
+	result := make([]string, 0)
+	for _, o := range tx.outputs {
+		address, _ := o.scriptPubKey.Address(params)
+		result = append(result, address)
+	}
+	return result
+}
+
+func (tx *Transaction) Sign(provider PrevoutProvider, key *PrivateKey) error {
 	for input := range tx.inputs {
-		tx.SignInput(input, testnet, key)
+		if err := tx.SignInput(input, provider, key); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 func (tx *Transaction) String() string {
@@ -4,6 +4,7 @@ import (
 	"bitcoinlib/bitcoinlib"
 	"bytes"
 	"encoding/hex"
+	"strings"
 	"testing"
 )
 
@@ -118,33 +119,73 @@ func TestTransactionInputsVsOutputs(t *testing.T) {
 	tx := "0100000001813f79011acb80925dfe69b3def355fe914bd1d96a3f5f71bf8303c6a989c7d1000000006b483045022100ed81ff192e75a3fd2304004dcadb746fa5e24c5031ccfcf21320b0277457c98f02207a986d955c6e0cb35d446a89d3f56100f4d7f67801c31967743a9c8e10615bed01210349fc4e631e3624a545de3f89f5d8684c7b8138bd94bdd531d2e213bf016b278afeffffff02a135ef01000000001976a914bc3b654dca7e56b04dca18f2566cdaf02e8d9ada88ac99c39800000000001976a9141c4bc762dd5423e332166702cb75f40df79fea1288ac19430600"
 	hexed, _ := hex.DecodeString(tx)
 	parsed, _ := bitcoinlib.ParseTransaction(bytes.NewReader(hexed))
-	if parsed.Fee(false) < 0 {
-		t.Fatalf("Failed transaction: %d", parsed.Fee(false))
+	provider, _ := bitcoinlib.DefaultProvider(bitcoinlib.MAINNET_PARAMS)
+	if parsed.Fee(provider) < 0 {
+		t.Fatalf("Failed transaction: %d", parsed.Fee(provider))
 	}
 }
 
+func defaultProvider(t *testing.T, params *bitcoinlib.ChainParams) bitcoinlib.PrevoutProvider {
+	provider, err := bitcoinlib.DefaultProvider(params)
+	if err != nil {
+		t.Fatalf("No provider for %s: %s", params, err)
+	}
+	return provider
+}
+
+// Unsigned transaction spending an output of scriptPubKey to another one,
+// with the version, locktime and sequence of its input
+func spendOutput(scriptPubKey *bitcoinlib.ScriptPubKey, version uint32, locktime uint32, sequence uint32) (*bitcoinlib.Transaction, *bitcoinlib.MemoryProvider) {
+	txId := strings.Repeat("99", 32)
+	provider := bitcoinlib.NewMemoryProvider()
+	provider.Add(txId, 0, bitcoinlib.NewOutput(10000, scriptPubKey))
+	tx := bitcoinlib.NewTransaction()
+	tx.SetVersion(version)
+	tx.SetLocktime(locktime)
+	tx.AddInput(txId, 0)
+	tx.SetSequence(0, sequence)
+	tx.AddOutputScript(9000, scriptPubKey)
+	return tx, provider
+}
+
+// Sets the scriptSig and witness of the first input through a psbt
+func finalizeSpend(t *testing.T, tx *bitcoinlib.Transaction, scriptSig []byte, witness [][]byte) *bitcoinlib.Transaction {
+	psbt, err := bitcoinlib.NewPsbt(tx)
+	if err != nil {
+		t.Fatalf("Failed creating psbt: %s", err)
+	}
+	psbt.Inputs[0].FinalScriptSig = scriptSig
+	psbt.Inputs[0].FinalScriptWitness = witness
+	spend, err := psbt.Extract()
+	if err != nil {
+		t.Fatalf("Failed extracting transaction: %s", err)
+	}
+	return spend
+}
+
 func TestSigHash(t *testing.T) {
-	tx, _ := bitcoinlib.FetchTransaction("452c629d67e41baec3ac6f04fe744b4b9617f8f859c63b3002f8684e7a4fee03", false, true)
+	tx, _ := bitcoinlib.FetchTransaction("452c629d67e41baec3ac6f04fe744b4b9617f8f859c63b3002f8684e7a4fee03", bitcoinlib.MAINNET_PARAMS)
 	want := "27e0c5994dec7824e56dec6b2fcb342eb7cdb0d0957c2fce9882f715e85d81a6"
-	if hex.EncodeToString(tx.SigHash(0, false, false)) != want {
+	hash, err := tx.SigHash(0, defaultProvider(t, bitcoinlib.MAINNET_PARAMS), false)
+	if err != nil || hex.EncodeToString(hash) != want {
 		t.Fatalf("Failed sighash")
 	}
 }
 
 func TestVerifiyP2PKH(t *testing.T) {
-	tx, err := bitcoinlib.FetchTransaction("452c629d67e41baec3ac6f04fe744b4b9617f8f859c63b3002f8684e7a4fee03", false, true)
+	tx, err := bitcoinlib.FetchTransaction("452c629d67e41baec3ac6f04fe744b4b9617f8f859c63b3002f8684e7a4fee03", bitcoinlib.MAINNET_PARAMS)
 	if err != nil {
 		t.Fatal("Failed to fetch transaction")
 	}
-	if !tx.Verify(false) {
+	if !tx.Verify(defaultProvider(t, bitcoinlib.MAINNET_PARAMS)) {
 		t.Fatal("Failed to verify Transaction")
 	}
 
-	tx, err = bitcoinlib.FetchTransaction("5418099cc755cb9dd3ebc6cf1a7888ad53a1a3beb5a025bce89eb1bf7f1650a2", true, true)
+	tx, err = bitcoinlib.FetchTransaction("5418099cc755cb9dd3ebc6cf1a7888ad53a1a3beb5a025bce89eb1bf7f1650a2", bitcoinlib.TESTNET3_PARAMS)
 	if err != nil {
 		t.Fatal("Failed to fetch transaction 2")
 	}
-	if !tx.Verify(true) {
+	if !tx.Verify(defaultProvider(t, bitcoinlib.TESTNET3_PARAMS)) {
 		t.Fatal("Failed to verify Transaction 2")
 	}
 }
@@ -157,16 +198,16 @@ func TestOP_MULTISIG(t *testing.T) {
 	sec1, _ := hex.DecodeString("022626e955ea6ea6d98850c994f9107b036b1334f18ca8830bfff1295d21cfdb70")
 	sec2, _ := hex.DecodeString("03b287eaf122eea69030a0e9feed096bed8045c8b98bec453e1ffac7fbdbd4bb71")
 	pubkey := bitcoinlib.NewPubkey([]bitcoinlib.Operation{
-		&bitcoinlib.OP_CHECKMULTISIGVERIFY{},
 		&bitcoinlib.OP_2{},
 		bitcoinlib.NewScriptVal(sec1),
 		bitcoinlib.NewScriptVal(sec2),
 		&bitcoinlib.OP_2{},
+		&bitcoinlib.OP_CHECKMULTISIG{},
 	})
 	scripSig := bitcoinlib.NewScript([]bitcoinlib.Operation{
+		&bitcoinlib.OP_0{},
 		bitcoinlib.NewScriptVal(sig1),
 		bitcoinlib.NewScriptVal(sig2),
-		&bitcoinlib.OP_0{},
 	})
 	if !pubkey.Combine(*scripSig).Evaluate(z, nil) {
 		t.Fatal("Failed evaluation of OP_CHECKMULTISIG")
@@ -174,25 +215,25 @@ func TestOP_MULTISIG(t *testing.T) {
 }
 
 func TestP2SHTransaction(t *testing.T) {
-	tx, _ := bitcoinlib.FetchTransaction("46df1a9484d0a81d03ce0ee543ab6e1a23ed06175c104a178268fad381216c2b", false, false)
-	if !tx.Verify(false) {
+	tx, _ := bitcoinlib.FetchTransaction("46df1a9484d0a81d03ce0ee543ab6e1a23ed06175c104a178268fad381216c2b", bitcoinlib.MAINNET_PARAMS)
+	if !tx.Verify(defaultProvider(t, bitcoinlib.MAINNET_PARAMS)) {
 		t.Fatal("Failed to verify transaction")
 	}
 }
 
 func TestIsCoinbase(t *testing.T) {
-	tx, _ := bitcoinlib.FetchTransaction("46df1a9484d0a81d03ce0ee543ab6e1a23ed06175c104a178268fad381216c2b", false, false)
+	tx, _ := bitcoinlib.FetchTransaction("46df1a9484d0a81d03ce0ee543ab6e1a23ed06175c104a178268fad381216c2b", bitcoinlib.MAINNET_PARAMS)
 	if tx.IsCoinbase() {
 		t.Fatal("Considered coinbase a transaction that wasn´t")
 	}
-	tx, _ = bitcoinlib.FetchTransaction("51bdce0f8a1edd5bc023fd4de42edb63478ca67fc8a37a6e533229c17d794d3f", false, false)
+	tx, _ = bitcoinlib.FetchTransaction("51bdce0f8a1edd5bc023fd4de42edb63478ca67fc8a37a6e533229c17d794d3f", bitcoinlib.MAINNET_PARAMS)
 	if !tx.IsCoinbase() {
 		t.Fatal("Could not identify a coinbase transaction")
 	}
 }
 
 func TestCoinbaseHeight(t *testing.T) {
-	tx, _ := bitcoinlib.FetchTransaction("51bdce0f8a1edd5bc023fd4de42edb63478ca67fc8a37a6e533229c17d794d3f", false, false)
+	tx, _ := bitcoinlib.FetchTransaction("51bdce0f8a1edd5bc023fd4de42edb63478ca67fc8a37a6e533229c17d794d3f", bitcoinlib.MAINNET_PARAMS)
 	if !tx.IsCoinbase() {
 		t.Fatal("Could not identify a coinbase transaction")
 	}
@@ -206,11 +247,11 @@ func TestCoinbaseHeight(t *testing.T) {
 }
 
 func TestP2PWKH(t *testing.T) {
-	tx, err := bitcoinlib.FetchTransaction("d869f854e1f8788bcff294cc83b280942a8c728de71eb709a2c29d10bfe21b7c", true, false)
+	tx, err := bitcoinlib.FetchTransaction("d869f854e1f8788bcff294cc83b280942a8c728de71eb709a2c29d10bfe21b7c", bitcoinlib.TESTNET3_PARAMS)
 	if err != nil {
 		t.Fatalf("Failed fetching transaction: %s", err)
 	}
-	if !tx.Verify(true) {
+	if !tx.Verify(defaultProvider(t, bitcoinlib.TESTNET3_PARAMS)) {
 		t.Fatal("Failed to verify p2pwkh transaction")
 	}
 	serialized := tx.Serialize()
@@ -226,11 +267,11 @@ func TestP2PWKH(t *testing.T) {
 }
 
 func TestP2SH_P2PWKH(t *testing.T) {
-	tx, err := bitcoinlib.FetchTransaction("c586389e5e4b3acb9d6c8be1c19ae8ab2795397633176f5a6442a261bbdefc3a", false, false)
+	tx, err := bitcoinlib.FetchTransaction("c586389e5e4b3acb9d6c8be1c19ae8ab2795397633176f5a6442a261bbdefc3a", bitcoinlib.MAINNET_PARAMS)
 	if err != nil {
 		t.Fatalf("Failed fetching transaction: %s", err)
 	}
-	if !tx.Verify(false) {
+	if !tx.Verify(defaultProvider(t, bitcoinlib.MAINNET_PARAMS)) {
 		t.Fatal("Failed to verify p2sh-p2pwkh transaction")
 	}
 	serialized := tx.Serialize()
@@ -246,11 +287,11 @@ func TestP2SH_P2PWKH(t *testing.T) {
 }
 
 func TestP2WSH(t *testing.T) {
-	tx, err := bitcoinlib.FetchTransaction("78457666f82c28aa37b74b506745a7c7684dc7842a52a457b09f09446721e11c", true, false)
+	tx, err := bitcoinlib.FetchTransaction("78457666f82c28aa37b74b506745a7c7684dc7842a52a457b09f09446721e11c", bitcoinlib.TESTNET3_PARAMS)
 	if err != nil {
 		t.Fatalf("Failed fetching transaction: %s", err)
 	}
-	if !tx.Verify(true) {
+	if !tx.Verify(defaultProvider(t, bitcoinlib.TESTNET3_PARAMS)) {
 		t.Fatal("Failed to verify p2wsh transaction")
 	}
 	serialized := tx.Serialize()
@@ -272,11 +313,11 @@ def test_verify_p2sh_p2wsh(self):
 */
 
 func TestP2SH_P2WSH(t *testing.T) {
-	tx, err := bitcoinlib.FetchTransaction("954f43dbb30ad8024981c07d1f5eb6c9fd461e2cf1760dd1283f052af746fc88", true, false)
+	tx, err := bitcoinlib.FetchTransaction("954f43dbb30ad8024981c07d1f5eb6c9fd461e2cf1760dd1283f052af746fc88", bitcoinlib.TESTNET3_PARAMS)
 	if err != nil {
 		t.Fatalf("Failed fetching transaction: %s", err)
 	}
-	if !tx.Verify(true) {
+	if !tx.Verify(defaultProvider(t, bitcoinlib.TESTNET3_PARAMS)) {
 		t.Fatal("Failed to verify p2sh_p2wsh transaction")
 	}
 	serialized := tx.Serialize()
@@ -290,3 +331,128 @@ func TestP2SH_P2WSH(t *testing.T) {
 		t.Fatalf("Serialization from serialization doesnt match: %s vs %s", first, second)
 	}
 }
+
+func TestSigHashBIP143NativeP2WPKH(t *testing.T) {
+	// Native P2WPKH example from BIP143
+	raw, _ := hex.DecodeString("0100000002fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f0000000000eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac11000000")
+	tx, err := bitcoinlib.ParseTransaction(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed parsing transaction: %s", err)
+	}
+	hash, _ := hex.DecodeString("1d0f172a0ecb48aee1be1f2687d2963ae33f71a1")
+	provider := bitcoinlib.NewMemoryProvider()
+	provider.Add("8ac60eb9575db5b2d987e29f301b5b819ea83a5c6579d282d189cc04b8e151ef", 1, bitcoinlib.NewOutput(600000000, bitcoinlib.P2WPKHPubKey(hash)))
+	expected := "c37af31116d1b27caf68aae9e3ac82f1477929014d5b917657d0eb49478cb670"
+	result, err := tx.SigHashBIP143(1, provider, false)
+	if err != nil || hex.EncodeToString(result) != expected {
+		t.Fatalf("Expected => %s\nGot => %x (%v)", expected, result, err)
+	}
+}
+
+func TestSignInputTypes(t *testing.T) {
+	fixture := newPsbtFixture(t)
+	keys := fixture.keys
+	bare := multisigScript(2, keys[1], keys[2])
+	funding := bitcoinlib.NewTransaction()
+	funding.AddInput(strings.Repeat("88", 32), 0)
+	bareScript, _ := bitcoinlib.ParsePubKey(bytes.NewReader(append([]byte{byte(len(bare))}, bare...)))
+	funding.AddOutputScript(10000, bareScript)
+	provider := bitcoinlib.NewMemoryProvider()
+	provider.AddTransaction(fixture.funding)
+	provider.AddTransaction(funding)
+
+	tx, _ := fixture.nonFinal.UnsignedTx()
+	tx.AddInput(funding.Id(), 0)
+	// P2PKH, P2WPKH and P2SH-P2WPKH only need the key
+	for input := range 3 {
+		if err := tx.SignInput(input, provider, keys[0]); err != nil {
+			t.Fatalf("Failed signing input %d: %s", input, err)
+		}
+	}
+	vectors := []struct {
+		keys   []*bitcoinlib.PrivateKey
+		script []byte
+	}{
+		{keys[:2], fixture.redeem[3]},
+		{keys[1:], fixture.witness[4]},
+		{[]*bitcoinlib.PrivateKey{keys[0], keys[2]}, fixture.witness[5]},
+		{keys[1:], nil},
+	}
+	for index, vector := range vectors {
+		if err := tx.SignInputScript(index+3, provider, vector.keys, vector.script, bitcoinlib.SIGHASH_ALL); err != nil {
+			t.Fatalf("Failed signing input %d: %s", index+3, err)
+		}
+	}
+	parsed, err := bitcoinlib.ParseTransaction(bytes.NewReader(tx.Serialize()))
+	if err != nil {
+		t.Fatalf("Failed parsing signed transaction: %s", err)
+	}
+	// Serialized with the segwit marker and flag
+	if !bytes.Equal(tx.Serialize()[4:6], []byte{0x00, 0x01}) || !bytes.Equal(parsed.Serialize(), tx.Serialize()) {
+		t.Fatal("Failed round tripping the segwit serialization")
+	}
+	for input := range 7 {
+		if !parsed.VerifyInput(input, provider) {
+			t.Fatalf("Failed verifying input %d", input)
+		}
+	}
+
+	if err := tx.SignInput(4, provider, keys[0]); err == nil {
+		t.Fatal("Signed P2WSH input without its witness script")
+	}
+	if err := tx.SignInputScript(4, provider, keys[:1], fixture.witness[4], bitcoinlib.SIGHASH_ALL); err == nil {
+		t.Fatal("Signed 2-of-3 multisig with a single key")
+	}
+	if err := tx.SignInputScript(3, provider, keys[:2], fixture.witness[4], bitcoinlib.SIGHASH_ALL); err == nil {
+		t.Fatal("Signed P2SH input with the wrong redeem script")
+	}
+	other := bitcoinlib.NewPrivateKey(bitcoinlib.FromInt(4004))
+	if err := tx.SignInput(1, provider, other); err == nil {
+		t.Fatal("Signed P2WPKH input with the wrong key")
+	}
+}
+
+func TestTransactionCheck(t *testing.T) {
+	prevout := strings.Repeat("11", 32) + "00000000"
+	null := strings.Repeat("00", 32) + "ffffffff"
+	// Transactions of version 1 and lock time 0, with empty scriptSigs
+	// unless given and outputs paying to OP_1
+	build := func(inputs []string, amounts []string) string {
+		raw := "01000000" + hex.EncodeToString([]byte{byte(len(inputs))})
+		for _, input := range inputs {
+			if len(input) == 72 {
+				input += "00"
+			}
+			raw += input + "ffffffff"
+		}
+		raw += hex.EncodeToString([]byte{byte(len(amounts))})
+		for _, amount := range amounts {
+			raw += amount + "0151"
+		}
+		return raw + "00000000"
+	}
+	vectors := []struct {
+		tx       string
+		expected bool
+	}{
+		{build([]string{prevout}, []string{"e803000000000000"}), true},
+		{build([]string{null + "020101"}, []string{"e803000000000000"}), true},
+		{build([]string{prevout}, nil), false},
+		// 21000000 BTC and one satoshi
+		{build([]string{prevout}, []string{"0140075af0750700"}), false},
+		{build([]string{prevout}, []string{"0040075af0750700", "0100000000000000"}), false},
+		{build([]string{prevout, prevout}, []string{"e803000000000000"}), false},
+		{build([]string{null + "0151"}, []string{"e803000000000000"}), false},
+		{build([]string{prevout, null}, []string{"e803000000000000"}), false},
+	}
+	for index, vector := range vectors {
+		raw, _ := hex.DecodeString(vector.tx)
+		tx, err := bitcoinlib.ParseTransaction(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("Failed at index %d: %s", index, err)
+		}
+		if err := tx.Check(); (err == nil) != vector.expected {
+			t.Fatalf("Failed at index %d\nExpected => %v\nGot => %v", index, vector.expected, err)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package bitcoinlib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Weight units per byte of non witness data (BIP141)
+const WITNESS_SCALE_FACTOR = 4
+
+// Weight of the segwit marker and flag
+const SEGWIT_MARKER_WEIGHT = 2
+
+// Signature size assumed by the estimates: the largest DER signature
+// with a low S value, 71 bytes, plus the sighash byte
+const ESTIMATED_SIGNATURE_SIZE = 72
+
+// Size of a Schnorr signature with the default sighash
+const ESTIMATED_SCHNORR_SIGNATURE_SIZE = 64
+
+// Maximum number of public keys in OP_CHECKMULTISIG
+const MAX_MULTISIG_KEYS = 20
+
+// Maximum size of a P2SH redeem script
+const MAX_REDEEM_SCRIPT_SIZE = 520
+
+// Size of the serialization without the witness data
+func (tx *Transaction) BaseSize() int {
+	return len(tx.serializeLegacy())
+}
+
+// Size of the serialization with the witness data
+func (tx *Transaction) TotalSize() int {
+	return len(tx.Serialize())
+}
+
+// BIP141 weight: the base size counts 4 times and the witness data once
+func (tx *Transaction) Weight() int {
+	return tx.BaseSize()*(WITNESS_SCALE_FACTOR-1) + tx.TotalSize()
+}
+
+// Virtual size, the weight divided by 4 rounded up
+func (tx *Transaction) VSize() int {
+	return weightToVSize(tx.Weight())
+}
+
+// Returns the fee rate in sat/vB
+func (tx *Transaction) FeeRate(provider PrevoutProvider) (float64, error) {
+	fee, err := tx.fee(provider)
+	if err != nil {
+		return 0, err
+	}
+	return float64(fee) / float64(tx.VSize()), nil
+}
+
+func (tx *Transaction) inputAmount(provider PrevoutProvider) (uint64, error) {
+	var total uint64
+	for index, in := range tx.inputs {
+		value, err := in.Value(provider)
+		if err != nil {
+			return 0, fmt.Errorf("input %d: %w", index, err)
+		}
+		total += value
+	}
+	return total, nil
+}
+
+func (tx *Transaction) outputAmount() uint64 {
+	var total uint64
+	for _, out := range tx.outputs {
+		total += out.amount
+	}
+	return total
+}
+
+// Fee of the transaction, failing when a prevout is missing
+func (tx *Transaction) fee(provider PrevoutProvider) (uint64, error) {
+	inputs, err := tx.inputAmount(provider)
+	if err != nil {
+		return 0, err
+	}
+	if inputs < tx.outputAmount() {
+		return 0, errors.New("outputs spend more than the inputs")
+	}
+	return inputs - tx.outputAmount(), nil
+}
+
+func weightToVSize(weight int) int {
+	return (weight + WITNESS_SCALE_FACTOR - 1) / WITNESS_SCALE_FACTOR
+}
+
+// Fee in satoshis paid by the weight at feeRate sat/vB, rounded up
+func FeeForWeight(weight int, feeRate float64) uint64 {
+	return uint64(math.Ceil(float64(weight) * feeRate / WITNESS_SCALE_FACTOR))
+}
+
+// Kind of input, to estimate its size before it is signed
+type InputType int
+
+const (
+	P2PK_INPUT InputType = iota
+	P2PKH_INPUT
+	P2SH_P2WPKH_INPUT
+	P2WPKH_INPUT
+	P2TR_INPUT // key path spend
+	MULTISIG_INPUT
+	P2SH_MULTISIG_INPUT
+	P2SH_P2WSH_MULTISIG_INPUT
+	P2WSH_MULTISIG_INPUT
+)
+
+// Signed input whose weight is estimated. Required and Keys are the
+// m and n of the multisig types, with compressed public keys
+type InputEstimate struct {
+	Type     InputType
+	Required int
+	Keys     int
+}
+
+func NewInputEstimate(inputType InputType) *InputEstimate {
+	return &InputEstimate{Type: inputType}
+}
+
+func NewMultisigEstimate(inputType InputType, required int, keys int) *InputEstimate {
+	return &InputEstimate{
+		Type:     inputType,
+		Required: required,
+		Keys:     keys,
+	}
+}
+
+// Estimates the input spending a P2PK, P2PKH, P2WPKH, P2TR or bare
+// multisig output. Other scripts depend on the redeem or witness script
+func EstimateFromScript(script *ScriptPubKey) (*InputEstimate, error) {
+	class := script.Classify()
+	switch class.Type {
+	case SCRIPT_TYPE_P2PKH:
+		return NewInputEstimate(P2PKH_INPUT), nil
+	case SCRIPT_TYPE_P2WPKH:
+		return NewInputEstimate(P2WPKH_INPUT), nil
+	case SCRIPT_TYPE_P2TR:
+		return NewInputEstimate(P2TR_INPUT), nil
+	case SCRIPT_TYPE_P2PK:
+		return NewInputEstimate(P2PK_INPUT), nil
+	case SCRIPT_TYPE_MULTISIG:
+		return NewMultisigEstimate(MULTISIG_INPUT, class.Required, class.Keys()), nil
+	}
+	return nil, fmt.Errorf("cannot estimate the input spending a %s script", class.Type)
+}
+
+func (e *InputEstimate) isMultisig() bool {
+	return e.Type >= MULTISIG_INPUT
+}
+
+// True if the input has witness data
+func (e *InputEstimate) IsSegwit() bool {
+	switch e.Type {
+	case P2SH_P2WPKH_INPUT, P2WPKH_INPUT, P2TR_INPUT, P2SH_P2WSH_MULTISIG_INPUT, P2WSH_MULTISIG_INPUT:
+		return true
+	}
+	return false
+}
+
+func pushSize(size int) int {
+	switch {
+	case size < 76:
+		return 1 + size
+	case size <= 255:
+		return 2 + size
+	}
+	return 3 + size
+}
+
+func varIntSize(value int) int {
+	return len(EncodeVarInt(uint64(value)))
+}
+
+// Returns the sizes of the scriptSig and of the witness
+func (e *InputEstimate) scriptSizes() (int, int, error) {
+	if e.isMultisig() {
+		if e.Required < 1 || e.Required > e.Keys || e.Keys > MAX_MULTISIG_KEYS {
+			return 0, 0, fmt.Errorf("invalid %d of %d multisig", e.Required, e.Keys)
+		}
+	}
+	signature := 1 + ESTIMATED_SIGNATURE_SIZE
+	pubkey := 1 + 33
+	witnessPubKeyHash := varIntSize(2) + signature + pubkey
+	// OP_m <pubkeys> OP_n OP_CHECKMULTISIG
+	multisig := 1 + e.Keys*pubkey + 1 + 1
+	// The dummy element for the OP_CHECKMULTISIG bug comes first
+	signatures := 1 + e.Required*signature
+	witnessMultisig := varIntSize(e.Required+2) + signatures + varIntSize(multisig) + multisig
+	switch e.Type {
+	case P2PK_INPUT:
+		return signature, 0, nil
+	case P2PKH_INPUT:
+		return signature + pubkey, 0, nil
+	case P2SH_P2WPKH_INPUT:
+		return pushSize(22), witnessPubKeyHash, nil
+	case P2WPKH_INPUT:
+		return 0, witnessPubKeyHash, nil
+	case P2TR_INPUT:
+		return 0, varIntSize(1) + 1 + ESTIMATED_SCHNORR_SIGNATURE_SIZE, nil
+	case MULTISIG_INPUT:
+		return signatures, 0, nil
+	case P2SH_MULTISIG_INPUT:
+		if multisig > MAX_REDEEM_SCRIPT_SIZE {
+			return 0, 0, fmt.Errorf("redeem script of %d bytes exceeds %d", multisig, MAX_REDEEM_SCRIPT_SIZE)
+		}
+		return signatures + pushSize(multisig), 0, nil
+	case P2SH_P2WSH_MULTISIG_INPUT:
+		return pushSize(34), witnessMultisig, nil
+	case P2WSH_MULTISIG_INPUT:
+		return 0, witnessMultisig, nil
+	}
+	return 0, 0, fmt.Errorf("unknown input type %d", e.Type)
+}
+
+// Weight of the signed input, including its witness
+func (e *InputEstimate) Weight() (int, error) {
+	scriptSig, witness, err := e.scriptSizes()
+	if err != nil {
+		return 0, err
+	}
+	// Outpoint, sequence and the scriptSig
+	base := 36 + 4 + varIntSize(scriptSig) + scriptSig
+	return base*WITNESS_SCALE_FACTOR + witness, nil
+}
+
+// Estimates the weight of the transaction once signed, ignoring the
+// current scriptSigs and witnesses. Takes an estimate per input
+func (tx *Transaction) EstimateWeight(inputs []*InputEstimate) (int, error) {
+	if len(inputs) != len(tx.inputs) {
+		return 0, fmt.Errorf("expected %d input estimates, got %d", len(tx.inputs), len(inputs))
+	}
+	base := VERSION_SIZE + varIntSize(len(tx.inputs)) + varIntSize(len(tx.outputs)) + 4
+	for _, output := range tx.outputs {
+		base += len(output.Serialize())
+	}
+	weight := base * WITNESS_SCALE_FACTOR
+	segwit := false
+	for index, input := range inputs {
+		inputWeight, err := input.Weight()
+		if err != nil {
+			return 0, fmt.Errorf("input %d: %w", index, err)
+		}
+		weight += inputWeight
+		segwit = segwit || input.IsSegwit()
+	}
+	if segwit {
+		// Marker, flag and the empty witness of the legacy inputs
+		weight += SEGWIT_MARKER_WEIGHT
+		for _, input := range inputs {
+			if !input.IsSegwit() {
+				weight += varIntSize(0)
+			}
+		}
+	}
+	return weight, nil
+}
+
+func (tx *Transaction) EstimateVSize(inputs []*InputEstimate) (int, error) {
+	weight, err := tx.EstimateWeight(inputs)
+	if err != nil {
+		return 0, err
+	}
+	return weightToVSize(weight), nil
+}
+
+// Fee to pay feeRate sat/vB once the transaction is signed
+func (tx *Transaction) EstimateFee(inputs []*InputEstimate, feeRate float64) (uint64, error) {
+	weight, err := tx.EstimateWeight(inputs)
+	if err != nil {
+		return 0, err
+	}
+	return FeeForWeight(weight, feeRate), nil
+}
@@ -0,0 +1,131 @@
+package bitcoinlib_test
+
+import (
+	"bitcoinlib/bitcoinlib"
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestTransactionWeightLegacy(t *testing.T) {
+	raw := "0100000001813f79011acb80925dfe69b3def355fe914bd1d96a3f5f71bf8303c6a989c7d1000000006b483045022100ed81ff192e75a3fd2304004dcadb746fa5e24c5031ccfcf21320b0277457c98f02207a986d955c6e0cb35d446a89d3f56100f4d7f67801c31967743a9c8e10615bed01210349fc4e631e3624a545de3f89f5d8684c7b8138bd94bdd531d2e213bf016b278afeffffff02a135ef01000000001976a914bc3b654dca7e56b04dca18f2566cdaf02e8d9ada88ac99c39800000000001976a9141c4bc762dd5423e332166702cb75f40df79fea1288ac19430600"
+	hexed, _ := hex.DecodeString(raw)
+	tx, err := bitcoinlib.ParseTransaction(bytes.NewReader(hexed))
+	if err != nil {
+		t.Fatalf("Failed parsing transaction: %s", err)
+	}
+	// Without witness data every byte weighs 4
+	if tx.BaseSize() != 226 || tx.TotalSize() != 226 || tx.Weight() != 904 || tx.VSize() != 226 {
+		t.Fatalf("Failed legacy sizes\nExpected => 226 226 904 226\nGot => %d %d %d %d", tx.BaseSize(), tx.TotalSize(), tx.Weight(), tx.VSize())
+	}
+}
+
+func TestTransactionWeightEstimate(t *testing.T) {
+	fixture := newPsbtFixture(t)
+	keys := fixture.keys
+	bare := multisigScript(2, keys[1], keys[2])
+	funding := bitcoinlib.NewTransaction()
+	funding.AddInput(strings.Repeat("88", 32), 0)
+	bareScript, _ := bitcoinlib.ParsePubKey(bytes.NewReader(append([]byte{byte(len(bare))}, bare...)))
+	funding.AddOutputScript(10000, bareScript)
+	provider := bitcoinlib.NewMemoryProvider()
+	provider.AddTransaction(fixture.funding)
+	provider.AddTransaction(funding)
+
+	tx, _ := fixture.nonFinal.UnsignedTx()
+	tx.AddInput(funding.Id(), 0)
+	bareEstimate, err := bitcoinlib.EstimateFromScript(bareScript)
+	if err != nil || bareEstimate.Type != bitcoinlib.MULTISIG_INPUT || bareEstimate.Required != 2 || bareEstimate.Keys != 2 {
+		t.Fatalf("Failed estimating bare multisig: %v", err)
+	}
+	estimates := []*bitcoinlib.InputEstimate{
+		bitcoinlib.NewInputEstimate(bitcoinlib.P2PKH_INPUT),
+		bitcoinlib.NewInputEstimate(bitcoinlib.P2WPKH_INPUT),
+		bitcoinlib.NewInputEstimate(bitcoinlib.P2SH_P2WPKH_INPUT),
+		bitcoinlib.NewMultisigEstimate(bitcoinlib.P2SH_MULTISIG_INPUT, 2, 2),
+		bitcoinlib.NewMultisigEstimate(bitcoinlib.P2WSH_MULTISIG_INPUT, 2, 3),
+		bitcoinlib.NewMultisigEstimate(bitcoinlib.P2SH_P2WSH_MULTISIG_INPUT, 2, 3),
+		bareEstimate,
+	}
+	estimate, err := tx.EstimateWeight(estimates)
+	if err != nil {
+		t.Fatalf("Failed estimating weight: %s", err)
+	}
+
+	for input := range 3 {
+		if err := tx.SignInput(input, provider, keys[0]); err != nil {
+			t.Fatalf("Failed signing input %d: %s", input, err)
+		}
+	}
+	scripts := [][]byte{fixture.redeem[3], fixture.witness[4], fixture.witness[5], nil}
+	signers := [][]*bitcoinlib.PrivateKey{keys[:2], keys[1:], keys[1:], keys[1:]}
+	for index, script := range scripts {
+		if err := tx.SignInputScript(index+3, provider, signers[index], script, bitcoinlib.SIGHASH_ALL); err != nil {
+			t.Fatalf("Failed signing input %d: %s", index+3, err)
+		}
+	}
+	// Signatures are at most 72 bytes with low S, 11 signatures in total
+	weight := tx.Weight()
+	if weight > estimate || estimate-weight > 11*4 {
+		t.Fatalf("Failed estimating weight\nExpected => %d\nGot => %d", weight, estimate)
+	}
+	if tx.BaseSize() >= tx.TotalSize() || weight != 3*tx.BaseSize()+tx.TotalSize() {
+		t.Fatal("Failed computing the weight of a segwit transaction")
+	}
+	if tx.VSize() != (weight+3)/4 {
+		t.Fatalf("Failed at vsize\nExpected => %d\nGot => %d", (weight+3)/4, tx.VSize())
+	}
+	feeRate, err := tx.FeeRate(provider)
+	if err != nil {
+		t.Fatalf("Failed computing fee rate: %s", err)
+	}
+	if expected := float64(tx.Fee(provider)) / float64(tx.VSize()); feeRate != expected {
+		t.Fatalf("Failed at fee rate\nExpected => %f\nGot => %f", expected, feeRate)
+	}
+	fee, _ := tx.EstimateFee(estimates, 2.5)
+	if fee != bitcoinlib.FeeForWeight(estimate, 2.5) || fee < uint64(weight)*5/8 {
+		t.Fatalf("Failed estimating fee: %d", fee)
+	}
+}
+
+func TestInputEstimateWeights(t *testing.T) {
+	vectors := []struct {
+		estimate *bitcoinlib.InputEstimate
+		weight   int
+	}{
+		{bitcoinlib.NewInputEstimate(bitcoinlib.P2PK_INPUT), 4 * (41 + 73)},
+		{bitcoinlib.NewInputEstimate(bitcoinlib.P2PKH_INPUT), 4 * (41 + 107)},
+		{bitcoinlib.NewInputEstimate(bitcoinlib.P2SH_P2WPKH_INPUT), 4*(41+23) + 1 + 73 + 34},
+		{bitcoinlib.NewInputEstimate(bitcoinlib.P2WPKH_INPUT), 4*41 + 1 + 73 + 34},
+		{bitcoinlib.NewInputEstimate(bitcoinlib.P2TR_INPUT), 4*41 + 1 + 65},
+		{bitcoinlib.NewMultisigEstimate(bitcoinlib.MULTISIG_INPUT, 1, 1), 4 * (41 + 1 + 73)},
+		// 2-of-3 redeem script of 105 bytes pushed with OP_PUSHDATA1
+		{bitcoinlib.NewMultisigEstimate(bitcoinlib.P2SH_MULTISIG_INPUT, 2, 3), 4 * (40 + 3 + 1 + 2*73 + 2 + 105)},
+		{bitcoinlib.NewMultisigEstimate(bitcoinlib.P2WSH_MULTISIG_INPUT, 2, 3), 4*41 + 1 + 1 + 2*73 + 1 + 105},
+		{bitcoinlib.NewMultisigEstimate(bitcoinlib.P2SH_P2WSH_MULTISIG_INPUT, 2, 3), 4*(41+35) + 1 + 1 + 2*73 + 1 + 105},
+	}
+	for index, vector := range vectors {
+		weight, err := vector.estimate.Weight()
+		if err != nil || weight != vector.weight {
+			t.Fatalf("Failed at index %d\nExpected => %d\nGot => %d %v", index, vector.weight, weight, err)
+		}
+	}
+
+	invalid := []*bitcoinlib.InputEstimate{
+		bitcoinlib.NewMultisigEstimate(bitcoinlib.P2WSH_MULTISIG_INPUT, 3, 2),
+		bitcoinlib.NewMultisigEstimate(bitcoinlib.MULTISIG_INPUT, 0, 2),
+		bitcoinlib.NewMultisigEstimate(bitcoinlib.P2WSH_MULTISIG_INPUT, 1, 21),
+		// 16 keys exceed the 520 bytes of a redeem script
+		bitcoinlib.NewMultisigEstimate(bitcoinlib.P2SH_MULTISIG_INPUT, 1, 16),
+		bitcoinlib.NewInputEstimate(bitcoinlib.InputType(99)),
+	}
+	for index, estimate := range invalid {
+		if _, err := estimate.Weight(); err == nil {
+			t.Fatalf("Failed at index %d: estimated an invalid input", index)
+		}
+	}
+	if _, err := bitcoinlib.EstimateFromScript(bitcoinlib.P2SHPubKey(make([]byte, 20))); err == nil {
+		t.Fatal("Estimated a P2SH input without its redeem script")
+	}
+}
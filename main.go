@@ -5,6 +5,8 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
+	"os"
+	"strings"
 )
 
 func transactionMain() {
@@ -17,22 +19,29 @@ func transactionMain() {
 	tx.AddInput("ee3f743e3cba5ddb75cdf77cfdfaddaeb2ce00ad8c7a92b9338cf4bc05c7db28", 0)
 	tx.AddInput("2fa03ac8be24b9ee984737130694aeed71d0a737d36c896a3d2ed898461aaa25", 0)
 	//Add the outputs
-	tx.AddOutput(30000, "mwQkTVnb1hLa6qXyLT3i2cAFmi8p8Wn5wr")
+	if err := tx.AddOutput(30000, "mwQkTVnb1hLa6qXyLT3i2cAFmi8p8Wn5wr", bitcoinlib.TESTNET3_PARAMS); err != nil {
+		fmt.Println("Error: ", err)
+		return
+	}
 	//Sign the transaction
-	tx.Sign(true, key)
-	fmt.Println(tx.Fee(true))
+	provider, _ := bitcoinlib.DefaultProvider(bitcoinlib.TESTNET3_PARAMS)
+	if err := tx.Sign(provider, key); err != nil {
+		fmt.Println("Error: ", err)
+		return
+	}
+	fmt.Println(tx.Fee(provider))
 	fmt.Println(tx.String())
 	//Verify it
-	fmt.Println(tx.Verify(true))
+	fmt.Println(tx.Verify(provider))
 	//Print its serialization
 	//ae55a2b58fd4839a5e597d94fa4c80c6195ada82
-	fmt.Println(key.Address(bitcoinlib.COMPRESSED, true))
+	fmt.Println(key.Address(bitcoinlib.COMPRESSED, bitcoinlib.TESTNET3_PARAMS))
 }
 
 func nodeMain() {
 	params := bitcoinlib.NodeParams{
-		Addr:    "testnet-seed.bitcoin.jonasschnelli.ch",
-		Testnet: true,
+		Addr:  "testnet-seed.bitcoin.jonasschnelli.ch",
+		Chain: bitcoinlib.TESTNET3_PARAMS,
 	}
 	node := bitcoinlib.NewSimpleNode(params)
 	err := node.Handshake()
@@ -43,8 +52,8 @@ func nodeMain() {
 
 func nodeHeaders() {
 	params := bitcoinlib.NodeParams{
-		Addr:    "testnet-seed.bitcoin.jonasschnelli.ch",
-		Testnet: true,
+		Addr:  "testnet-seed.bitcoin.jonasschnelli.ch",
+		Chain: bitcoinlib.TESTNET3_PARAMS,
 	}
 	gBytes, _ := hex.DecodeString(bitcoinlib.TESTNET_GENESIS_BLOCK)
 	block := bitcoinlib.NewBlock()
@@ -95,7 +104,7 @@ func TransactionOfInterestMain() {
 	address := "mwJn1YPMq7y5F8J3LkC5Hxg9PHyZ5K4cFv"
 	params := bitcoinlib.NodeParams{
 		Addr:    "testnet-seed.bitcoin.jonasschnelli.ch",
-		Testnet: true,
+		Chain:   bitcoinlib.TESTNET3_PARAMS,
 		Logging: true,
 	}
 	node := bitcoinlib.NewSimpleNode(params)
@@ -122,6 +131,30 @@ func TransactionOfInterestMain() {
 	node.WaitFor(map[string]bitcoinlib.Message{bitcoinlib.PING: bitcoinlib.PING_MESSAGE})
 }
 
+// Prints every step of a scriptSig and scriptPubKey written in ASM:
+// go run . debug "<scriptSig>" "<scriptPubKey>"
+func debugScriptMain(scriptSig string, scriptPubKey string) {
+	sig, err := bitcoinlib.ParseAsm(scriptSig)
+	if err != nil {
+		fmt.Printf("Failed parsing scriptSig: %s\n", err)
+		return
+	}
+	pubKey, err := bitcoinlib.ParseAsm(scriptPubKey)
+	if err != nil {
+		fmt.Printf("Failed parsing scriptPubKey: %s\n", err)
+		return
+	}
+	trace := &bitcoinlib.Trace{}
+	ctx := bitcoinlib.NewDigestContext(strings.Repeat("00", 32), bitcoinlib.DIGEST_SCRIPT_FLAGS)
+	ctx.SetTrace(trace)
+	bitcoinlib.NewPubkey(pubKey).Combine(*bitcoinlib.NewScript(sig)).Execute(ctx, nil)
+	fmt.Println(trace)
+}
+
 func main() {
+	if len(os.Args) == 4 && os.Args[1] == "debug" {
+		debugScriptMain(os.Args[2], os.Args[3])
+		return
+	}
 	TransactionOfInterestMain()
 }